@@ -1,8 +1,17 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -12,43 +21,490 @@ import (
 
 	"github.com/Lionel-Wilson/payment-gateway/internal/api/handlers"
 	"github.com/Lionel-Wilson/payment-gateway/internal/api/middlewares"
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/validators"
+	"github.com/Lionel-Wilson/payment-gateway/internal/bank"
+	"github.com/Lionel-Wilson/payment-gateway/internal/bin"
+	"github.com/Lionel-Wilson/payment-gateway/internal/certs"
+	"github.com/Lionel-Wilson/payment-gateway/internal/currency"
+	"github.com/Lionel-Wilson/payment-gateway/internal/envelope"
+	"github.com/Lionel-Wilson/payment-gateway/internal/oauth"
+	"github.com/Lionel-Wilson/payment-gateway/internal/ratelimit"
+	"github.com/Lionel-Wilson/payment-gateway/internal/rbac"
+	"github.com/Lionel-Wilson/payment-gateway/internal/signing"
+	"github.com/Lionel-Wilson/payment-gateway/internal/storage"
+	"github.com/Lionel-Wilson/payment-gateway/internal/vault"
+	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
 )
 
 func main() {
-	addr := os.Getenv("DEV_ADDRESS")
+	addr := utils.EnvString("DEV_ADDRESS", ":8080")
 
 	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
 	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
 
+	keyring, err := newKeyring()
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	store, err := newStore(context.Background(), keyring)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	acquiringBank, err := newAcquiringBank()
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	authorizationTTL, err := utils.EnvDuration("AUTHORIZATION_TTL", 7*24*time.Hour)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	authorizationExpiryInterval, err := utils.EnvDuration("AUTHORIZATION_EXPIRY_INTERVAL", time.Minute)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	refundReconciliationInterval, err := utils.EnvDuration("REFUND_RECONCILIATION_INTERVAL", 5*time.Minute)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	captureReconciliationInterval, err := utils.EnvDuration("CAPTURE_RECONCILIATION_INTERVAL", 5*time.Minute)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	idempotencyKeyTTL, err := utils.EnvDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	idempotencyKeyExpiryInterval, err := utils.EnvDuration("IDEMPOTENCY_KEY_EXPIRY_INTERVAL", time.Hour)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	// Every currency is accepted unless CURRENCY_ALLOW_LISTS names a file of allow-lists
+	var currencies currency.AllowLists
+	if path := os.Getenv("CURRENCY_ALLOW_LISTS"); path != "" {
+		if currencies, err = currency.LoadAllowLists(path); err != nil {
+			errorLog.Fatal(err)
+		}
+	}
+
+	maxExpiryYears, err := utils.EnvInt("CARD_EXPIRY_MAX_YEARS", validators.DefaultMaxExpiryYears)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	binTableReloadInterval, err := utils.EnvDuration("BIN_TABLE_RELOAD_INTERVAL", time.Minute)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	// Requests to the payments endpoints only need to be signed when REQUEST_SIGNING is "required"
+	requestSigning := utils.EnvString("REQUEST_SIGNING", "off")
+	if requestSigning != "off" && requestSigning != "required" {
+		errorLog.Fatalf("REQUEST_SIGNING must be off or required, not %q", requestSigning)
+	}
+
+	requestSignatureWindow, err := utils.EnvDuration("REQUEST_SIGNATURE_WINDOW", 5*time.Minute)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	// Nonces are kept in memory unless REQUEST_SIGNATURE_NONCE_STORE is "shared", when they are kept in the store, so
+	// that a signed request cannot be replayed against another instance of the gateway sharing the database
+	nonceStore := utils.EnvString("REQUEST_SIGNATURE_NONCE_STORE", "memory")
+	if nonceStore != "memory" && nonceStore != "shared" {
+		errorLog.Fatalf("REQUEST_SIGNATURE_NONCE_STORE must be memory or shared, not %q", nonceStore)
+	}
+
+	nonceExpiryInterval, err := utils.EnvDuration("REQUEST_SIGNATURE_NONCE_EXPIRY_INTERVAL", time.Minute)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	sessionTTL, err := utils.EnvDuration("SESSION_TTL", 8*time.Hour)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	sessionExpiryInterval, err := utils.EnvDuration("SESSION_EXPIRY_INTERVAL", time.Hour)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	accessTokens, err := newAccessTokenIssuer()
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	tlsConfig, err := newTLSConfig(context.Background(), infoLog, errorLog)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	// Requests on behalf of the merchants in MTLS_MERCHANTS must be made with a client certificate naming the merchant
+	// in MTLS_TRUST_DOMAIN
+	mtlsMerchants := strings.FieldsFunc(os.Getenv("MTLS_MERCHANTS"), func(r rune) bool { return r == ',' || r == ' ' })
+	mtlsTrustDomain := utils.EnvString("MTLS_TRUST_DOMAIN", "payment-gateway")
+	if len(mtlsMerchants) > 0 && (tlsConfig == nil || tlsConfig.ClientCAs == nil) {
+		errorLog.Fatal("MTLS_MERCHANTS needs TLS_CERT_FILE, TLS_KEY_FILE and TLS_CLIENT_CA_FILE")
+	}
+
+	var cardVault *vault.Vault
+	if keyring != nil {
+		cardVault = vault.New(keyring)
+	}
+
 	app := &handlers.Application{
+		ErrorLog:         errorLog,
+		InfoLog:          infoLog,
+		Payments:         store,
+		Refunds:          store,
+		Tokens:           store,
+		APIKeys:          store,
+		Merchants:        store,
+		OAuthClients:     store,
+		Users:            store,
+		Sessions:         store,
+		SessionTTL:       sessionTTL,
+		AccessTokens:     accessTokens,
+		Vault:            cardVault,
+		Bank:             acquiringBank,
+		Currencies:       currencies,
+		AuthorizationTTL: authorizationTTL,
+		MaxExpiryYears:   maxExpiryYears,
+		Clock:            time.Now,
+	}
+
+	go app.RunAuthorizationExpiry(context.Background(), authorizationExpiryInterval)
+	go app.RunRefundReconciliation(context.Background(), refundReconciliationInterval)
+	go app.RunCaptureReconciliation(context.Background(), captureReconciliationInterval)
+	go app.RunSessionExpiry(context.Background(), sessionExpiryInterval)
+
+	// Card issuers are only looked up when BIN_TABLE names a BIN table, which is reloaded whenever it changes
+	if path := os.Getenv("BIN_TABLE"); path != "" {
+		bins, err := bin.Open(path)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		infoLog.Printf("Loaded %d BINs from %s", bins.Len(), path)
+
+		app.BINs = bins
+		go bins.Watch(context.Background(), binTableReloadInterval, infoLog, errorLog)
+	}
+
+	idempotency := middlewares.IdempotencyConfig{
+		Store:    store,
+		TTL:      idempotencyKeyTTL,
+		Clock:    time.Now,
 		ErrorLog: errorLog,
-		InfoLog:  infoLog,
 	}
 
+	go middlewares.RunIdempotencyKeyExpiry(context.Background(), idempotency, idempotencyKeyExpiryInterval)
+
+	rateLimits, err := newRateLimitConfig(store, errorLog)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	rateLimitExpiryInterval, err := utils.EnvDuration("RATE_LIMIT_EXPIRY_INTERVAL", time.Minute)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	go middlewares.RunRateLimitBucketExpiry(context.Background(), rateLimits, rateLimitExpiryInterval)
+
 	// Set up Gin router
 	r := gin.Default()
 
+	// Client IP addresses are only taken from X-Forwarded-For when the request comes from a proxy in TRUSTED_PROXIES,
+	// so that clients cannot escape their rate limits by making up addresses
+	trustedProxies := strings.FieldsFunc(os.Getenv("TRUSTED_PROXIES"), func(r rune) bool { return r == ',' || r == ' ' })
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		errorLog.Fatal(err)
+	}
+
 	r.Use(gin.Recovery())
 	r.Use(gin.Logger())
 
 	r.Use(middlewares.SecureHeaders())
 	r.Use(middlewares.CorsMiddleware())
 
+	// Requests are authenticated with an API key, an OAuth access token or a dashboard session token, and each
+	// route needs a permission: secret keys have them all, publishable keys can only tokenize cards and look up BINs,
+	// access tokens have those named by their scopes, and dashboard users those of their role
+	authentication := middlewares.APIKeyConfig{
+		Store:        store,
+		AccessTokens: accessTokens,
+		Sessions:     store,
+		Users:        store,
+		Clock:        time.Now,
+		ErrorLog:     errorLog,
+	}
+	can := middlewares.RequirePermission
+
+	// Permissions are checked before the idempotency key is used, so that rejected requests can be retried
+	idempotent := middlewares.Idempotency(idempotency)
+
+	// Requests are limited by client IP address before they are authenticated, so that guessed credentials are limited
+	// too, and by API key and merchant after
+	limitIP := middlewares.RateLimitIP(rateLimits)
+	limit := middlewares.RateLimit(rateLimits)
+
 	apiV1 := r.Group("/api/v1")
+	apiV1.GET("/health", app.HealthCheck)
+
+	// OAuth clients exchange their credentials for access tokens, and dashboard users their password for sessions
+	r.POST("/oauth/token", limitIP, app.IssueAccessToken)
+	apiV1.POST("/sessions", limitIP, app.CreateSession)
+
+	authenticated := apiV1.Group("")
+	authenticated.Use(limitIP, middlewares.APIKeyAuth(authentication), middlewares.RequireClientCertificate(mtlsTrustDomain, mtlsMerchants), limit)
 	{
-		apiV1.POST("/payments", app.ProcessPayment)
-		apiV1.GET("/payments/:id", app.RetrievePayment)
-		apiV1.GET("/payments", app.AllPayments)
+		authenticated.GET("/sessions/current", app.RetrieveSession)
+		authenticated.DELETE("/sessions/current", app.DeleteSession)
+
+		authenticated.POST("/tokens", can(rbac.TokensWrite), idempotent, app.CreateToken)
+		authenticated.GET("/bins/:bin", can(rbac.BINsRead), app.RetrieveBIN)
+		authenticated.GET("/tokens/:id", can(rbac.TokensManage), app.RetrieveToken)
+		authenticated.DELETE("/tokens/:id", can(rbac.TokensManage), idempotent, app.RevokeToken)
+		authenticated.GET("/merchant", can(rbac.MerchantRead), app.RetrieveMerchant)
+		authenticated.POST("/merchant/signing-secret", can(rbac.MerchantWrite), idempotent, app.CreateSigningSecret)
+		authenticated.POST("/api-keys", can(rbac.APIKeysWrite), idempotent, app.CreateAPIKey)
+		authenticated.GET("/api-keys", can(rbac.APIKeysRead), app.ListAPIKeys)
+		authenticated.POST("/api-keys/:id/rotate", can(rbac.APIKeysWrite), idempotent, app.RotateAPIKey)
+		authenticated.DELETE("/api-keys/:id", can(rbac.APIKeysWrite), idempotent, app.RevokeAPIKey)
+		authenticated.POST("/users", can(rbac.UsersWrite), idempotent, app.CreateUser)
+		authenticated.GET("/users", can(rbac.UsersRead), app.ListUsers)
+		authenticated.PATCH("/users/:id", can(rbac.UsersWrite), idempotent, app.UpdateUser)
+		authenticated.DELETE("/users/:id", can(rbac.UsersWrite), idempotent, app.DisableUser)
+	}
+
+	// Payments may also need to be signed, which is checked before the idempotency key is used
+	payments := authenticated.Group("/payments")
+	if requestSigning == "required" {
+		signatures := middlewares.SignatureConfig{
+			Merchants: store,
+			Nonces:    signing.NewMemoryNonceCache(),
+			Window:    requestSignatureWindow,
+			Clock:     time.Now,
+			ErrorLog:  errorLog,
+		}
+		if nonceStore == "shared" {
+			signatures.Nonces = signing.NonceCacheFunc(store.AddNonce)
+			go middlewares.RunNonceExpiry(context.Background(), signatures, store, nonceExpiryInterval)
+		}
 
-		apiV1.GET("/health", app.HealthCheck)
+		payments.Use(middlewares.RequestSignature(signatures))
+	}
+	{
+		payments.POST("", can(rbac.PaymentsWrite), idempotent, app.ProcessPayment)
+		payments.GET("/:id", can(rbac.PaymentsRead), app.RetrievePayment)
+		payments.GET("", can(rbac.PaymentsRead), app.AllPayments)
+		payments.POST("/:id/captures", can(rbac.PaymentsWrite), idempotent, app.CapturePayment)
+		payments.POST("/:id/voids", can(rbac.PaymentsWrite), idempotent, app.VoidPayment)
+		payments.POST("/:id/refunds", can(rbac.RefundsWrite), idempotent, app.RefundPayment)
+		payments.GET("/:id/refunds", can(rbac.PaymentsRead), app.ListRefunds)
+		payments.GET("/:id/refunds/:refundId", can(rbac.PaymentsRead), app.RetrieveRefund)
 	}
 
 	// Serve Swagger documentation
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	infoLog.Printf("Starting server on %s", addr)
-	err := r.Run(addr)
+	server := &http.Server{Addr: addr, Handler: r, TLSConfig: tlsConfig, ErrorLog: errorLog}
+	if tlsConfig == nil {
+		infoLog.Printf("Starting server on %s", addr)
+		errorLog.Fatal(server.ListenAndServe())
+	}
+
+	// Plain HTTP requests are redirected to HTTPS when HTTP_REDIRECT_ADDRESS is set
+	if redirectAddr := os.Getenv("HTTP_REDIRECT_ADDRESS"); redirectAddr != "" {
+		redirect := gin.New()
+		redirect.Use(gin.Logger(), middlewares.RedirectToHTTPS(addr))
+
+		infoLog.Printf("Redirecting HTTP on %s to HTTPS", redirectAddr)
+		go func() {
+			errorLog.Fatal(http.ListenAndServe(redirectAddr, redirect))
+		}()
+	}
+
+	infoLog.Printf("Starting HTTPS server on %s", addr)
+	errorLog.Fatal(server.ListenAndServeTLS("", ""))
+}
+
+// newRateLimitConfig configures rate limiting with the limits in the JSON file at RATE_LIMITS_PATH, or the default
+// limits if it is not set. Token buckets are kept in memory unless RATE_LIMIT_STORE is "shared", when they are kept in
+// store, so that instances of the gateway sharing a database share their limits.
+func newRateLimitConfig(store storage.Store, errorLog *log.Logger) (middlewares.RateLimitConfig, error) {
+	config := middlewares.RateLimitConfig{
+		Rules:    ratelimit.DefaultRules,
+		Clock:    time.Now,
+		ErrorLog: errorLog,
+	}
+
+	if path := os.Getenv("RATE_LIMITS_PATH"); path != "" {
+		rules, err := ratelimit.LoadRules(path)
+		if err != nil {
+			return middlewares.RateLimitConfig{}, err
+		}
+		config.Rules = rules
+	}
+
+	switch backend := utils.EnvString("RATE_LIMIT_STORE", "memory"); backend {
+	case "memory":
+		config.Store = storage.NewMemoryStore()
+	case "shared":
+		config.Store = store
+	default:
+		return middlewares.RateLimitConfig{}, fmt.Errorf("RATE_LIMIT_STORE must be memory or shared, not %q", backend)
+	}
+
+	return config, nil
+}
+
+// newStore creates the payment and refund store selected by the STORAGE_DRIVER environment variable.
+// Supported drivers are "memory" (the default), "postgres", which connects to DATABASE_URL, and "sqlite",
+// which stores everything in the file at SQLITE_PATH. Database backends apply any pending schema
+// migrations before returning, and encrypt cardholder data with keyring if it is not nil.
+func newStore(ctx context.Context, keyring *envelope.Keyring) (storage.Store, error) {
+	var options []storage.Option
+	if keyring != nil {
+		options = append(options, storage.WithKeyring(keyring))
+	}
+
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "", "memory":
+		return storage.NewMemoryStore(), nil
+	case "postgres":
+		return storage.NewPostgresStore(ctx, os.Getenv("DATABASE_URL"), options...)
+	case "sqlite":
+		path := os.Getenv("SQLITE_PATH")
+		if path == "" {
+			path = "payment-gateway.db"
+		}
+		return storage.NewSQLiteStore(ctx, path, options...)
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_DRIVER %q", driver)
+	}
+}
+
+// newAccessTokenIssuer creates the issuer of OAuth access tokens from the base64-encoded key in OAUTH_SIGNING_KEY,
+// e.g. from `openssl rand -base64 32`. Without a key, access tokens are neither issued nor accepted.
+func newAccessTokenIssuer() (*oauth.Issuer, error) {
+	encoded := os.Getenv("OAUTH_SIGNING_KEY")
+	if encoded == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
-		errorLog.Fatal(err)
+		return nil, fmt.Errorf("OAUTH_SIGNING_KEY must be base64-encoded: %w", err)
 	}
+
+	ttl, err := utils.EnvDuration("OAUTH_TOKEN_TTL", 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	return oauth.NewIssuer(key, utils.EnvString("OAUTH_ISSUER", "payment-gateway"), ttl)
+}
+
+// newTLSConfig creates the configuration for serving HTTPS with the certificate in TLS_CERT_FILE and its private key
+// in TLS_KEY_FILE, which are reloaded when they change, checking every TLS_RELOAD_INTERVAL. Clients may present
+// certificates issued by the authorities in TLS_CLIENT_CA_FILE, if it is set. Without a certificate, the gateway
+// serves plain HTTP and nil is returned.
+func newTLSConfig(ctx context.Context, infoLog, errorLog *log.Logger) (*tls.Config, error) {
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	} else if certFile == "" || keyFile == "" {
+		return nil, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	reloadInterval, err := utils.EnvDuration("TLS_RELOAD_INTERVAL", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	certificate, err := certs.Open(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	infoLog.Printf("Loaded TLS certificate for %s, expiring %s", certificate.Leaf().Subject.CommonName, certificate.Leaf().NotAfter.Format(time.RFC3339))
+	go certificate.Watch(ctx, reloadInterval, infoLog, errorLog)
+
+	var clientCAs *x509.CertPool
+	if path := os.Getenv("TLS_CLIENT_CA_FILE"); path != "" {
+		if clientCAs, err = certs.LoadPool(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return certificate.ServerConfig(clientCAs), nil
+}
+
+// newAcquiringBank creates the bank client used to process payments. When BANK_URL is set, payments are sent
+// over HTTP to the bank at that address, such as cmd/bank-simulator; otherwise they are processed by an
+// in-process simulator whose mode is selected by BANK_SIMULATOR_MODE, defaulting to random outcomes.
+func newAcquiringBank() (bank.AcquiringBank, error) {
+	baseURL := os.Getenv("BANK_URL")
+	if baseURL == "" {
+		mode := bank.SimulatorMode(os.Getenv("BANK_SIMULATOR_MODE"))
+		if mode != bank.ModeDeterministic {
+			mode = bank.ModeRandom
+		}
+		return bank.NewSimulator(mode), nil
+	}
+
+	config := bank.HTTPClientConfig{BaseURL: baseURL}
+
+	var err error
+	if config.Timeout, err = utils.EnvDuration("BANK_TIMEOUT", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if config.MaxRetries, err = utils.EnvInt("BANK_MAX_RETRIES", 2); err != nil {
+		return nil, err
+	}
+	if config.RetryBackoff, err = utils.EnvDuration("BANK_RETRY_BACKOFF", 200*time.Millisecond); err != nil {
+		return nil, err
+	}
+
+	return bank.NewHTTPClient(config), nil
+}
+
+// newKeyring loads the keyring of master keys in the file at KEYRING_PATH. Cardholder data is only encrypted at rest,
+// and cards can only be tokenized, when KEYRING_PATH is set. Cards tokenized before envelope encryption were encrypted
+// with the base64-encoded key in VAULT_KEY, which is added to the keyring as its legacy key so that they can still be
+// charged until rotate-keys seals them with a master key.
+func newKeyring() (*envelope.Keyring, error) {
+	path := os.Getenv("KEYRING_PATH")
+	if path == "" {
+		if os.Getenv("VAULT_KEY") != "" {
+			return nil, errors.New("KEYRING_PATH must be set to charge cards tokenized with VAULT_KEY")
+		}
+		return nil, nil
+	}
+
+	keyring, err := envelope.LoadKeyring(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if encoded := os.Getenv("VAULT_KEY"); encoded != "" {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("VAULT_KEY must be base64-encoded: %w", err)
+		}
+		if err := keyring.SetLegacyKey(key); err != nil {
+			return nil, fmt.Errorf("VAULT_KEY: %w", err)
+		}
+	}
+
+	return keyring, nil
 }
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/bank"
+	"github.com/Lionel-Wilson/payment-gateway/internal/banksim"
+	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
+)
+
+func main() {
+	addr := utils.EnvString("BANK_SIMULATOR_ADDRESS", ":8081")
+
+	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
+	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+
+	config, err := loadConfig()
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	server := banksim.NewServer(config, errorLog)
+
+	r := gin.Default()
+	server.Routes(r)
+
+	infoLog.Printf("Starting bank simulator in %s mode on %s", config.Mode, addr)
+	err = r.Run(addr)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+}
+
+// loadConfig reads the simulator's configuration from BANK_SIMULATOR_* environment variables.
+func loadConfig() (banksim.Config, error) {
+	config := banksim.Config{
+		Mode: bank.SimulatorMode(utils.EnvString("BANK_SIMULATOR_MODE", string(bank.ModeDeterministic))),
+	}
+
+	var err error
+	if config.Latency, err = utils.EnvDuration("BANK_SIMULATOR_LATENCY", 0); err != nil {
+		return config, err
+	}
+	if config.LatencyJitter, err = utils.EnvDuration("BANK_SIMULATOR_LATENCY_JITTER", 0); err != nil {
+		return config, err
+	}
+	if config.TimeoutDelay, err = utils.EnvDuration("BANK_SIMULATOR_TIMEOUT_DELAY", 30*time.Second); err != nil {
+		return config, err
+	}
+	if config.ErrorRate, err = utils.EnvFloat("BANK_SIMULATOR_ERROR_RATE", 0); err != nil {
+		return config, err
+	}
+	if config.MaxAnswers, err = utils.EnvInt("BANK_SIMULATOR_MAX_ANSWERS", banksim.DefaultMaxAnswers); err != nil {
+		return config, err
+	}
+
+	if path := os.Getenv("BANK_SIMULATOR_SCRIPT"); path != "" {
+		if config.Script, err = banksim.LoadScript(path); err != nil {
+			return config, err
+		}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,127 @@
+// Command create-api-key creates an API key for a merchant and prints it, e.g. to give a new merchant the first key
+// they use to manage the others through the API. Given -name instead of -merchant, it creates a new merchant first
+// and prints its ID before the key:
+//
+//	go run ./cmd/create-api-key -name "Acme Ltd" -kind secret -mode test
+//	go run ./cmd/create-api-key -merchant MER-3f9a0c5e8b7d4a1f9e2c6b0d8a4f7e1c -kind publishable -mode test
+//
+// It connects to the database selected by STORAGE_DRIVER, DATABASE_URL and SQLITE_PATH, as the gateway does, and
+// reads merchants with the keyring in KEYRING_PATH if it is set.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/apikey"
+	"github.com/Lionel-Wilson/payment-gateway/internal/envelope"
+	"github.com/Lionel-Wilson/payment-gateway/internal/storage"
+)
+
+func main() {
+	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+
+	merchantID := flag.String("merchant", "", "ID of the merchant the key authenticates")
+	name := flag.String("name", "", "name of a new merchant to create the key for, instead of -merchant")
+	kind := flag.String("kind", string(apikey.Secret), "kind of key: publishable or secret")
+	mode := flag.String("mode", string(apikey.Test), "mode of the key: live or test")
+	flag.Parse()
+
+	if (*merchantID == "") == (*name == "") {
+		fmt.Fprintln(os.Stderr, "exactly one of -merchant and -name is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	secret, err := apikey.Generate(apikey.Kind(*kind), apikey.Mode(*mode))
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	id, err := apikey.NewID()
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	ctx := context.Background()
+	store, err := openStore(ctx)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	defer store.Close()
+
+	if *name != "" {
+		merchant, err := createMerchant(ctx, store, *name)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		*merchantID = merchant.ID
+		fmt.Println(merchant.ID)
+	} else if _, err := store.GetMerchant(ctx, *merchantID); err != nil {
+		errorLog.Fatalf("merchant %s: %v", *merchantID, err)
+	}
+
+	err = store.CreateAPIKey(ctx, models.APIKey{
+		ID:         id,
+		MerchantID: *merchantID,
+		Kind:       apikey.Kind(*kind),
+		Mode:       apikey.Mode(*mode),
+		Last4:      apikey.Last4(secret),
+		Hash:       apikey.Hash(secret),
+		CreatedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	fmt.Println(secret)
+}
+
+// createMerchant stores a new merchant with the given name.
+func createMerchant(ctx context.Context, store storage.MerchantStore, name string) (models.Merchant, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return models.Merchant{}, err
+	}
+
+	merchant := models.Merchant{
+		ID:        "MER-" + hex.EncodeToString(id),
+		Name:      name,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	return merchant, store.CreateMerchant(ctx, merchant)
+}
+
+// openStore opens the database selected by STORAGE_DRIVER. Keys cannot be created for the memory driver, whose
+// contents only live as long as the gateway process.
+func openStore(ctx context.Context) (*storage.SQLStore, error) {
+	var options []storage.Option
+	if path := os.Getenv("KEYRING_PATH"); path != "" {
+		keyring, err := envelope.LoadKeyring(path)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, storage.WithKeyring(keyring))
+	}
+
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "postgres":
+		return storage.NewPostgresStore(ctx, os.Getenv("DATABASE_URL"), options...)
+	case "sqlite":
+		path := os.Getenv("SQLITE_PATH")
+		if path == "" {
+			path = "payment-gateway.db"
+		}
+		return storage.NewSQLiteStore(ctx, path, options...)
+	default:
+		return nil, fmt.Errorf("STORAGE_DRIVER %q does not store data at rest", driver)
+	}
+}
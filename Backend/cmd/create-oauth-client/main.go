@@ -0,0 +1,125 @@
+// Command create-oauth-client creates an OAuth client for a platform partner acting on behalf of merchants, and
+// prints its ID and secret, which the partner exchanges for access tokens at /oauth/token. Given -revoke instead, it
+// revokes a client so that it can no longer obtain tokens:
+//
+//	go run ./cmd/create-oauth-client -name "Acme Platform" -merchants MER-1,MER-2 -scopes payments:write,payments:read
+//	go run ./cmd/create-oauth-client -revoke CLI-9b2e4d6f8a0c1e3b5d7f9a2c4e6b8d0f
+//
+// It connects to the database selected by STORAGE_DRIVER, DATABASE_URL and SQLITE_PATH, as the gateway does, and
+// reads merchants with the keyring in KEYRING_PATH if it is set.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/envelope"
+	"github.com/Lionel-Wilson/payment-gateway/internal/oauth"
+	"github.com/Lionel-Wilson/payment-gateway/internal/storage"
+)
+
+func main() {
+	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+
+	name := flag.String("name", "", "name of the partner the client belongs to")
+	merchants := flag.String("merchants", "", "comma-separated IDs of the merchants the client acts on behalf of")
+	scopes := flag.String("scopes", oauth.FormatScope(oauth.Scopes), "comma- or space-separated scopes the client may request")
+	revoke := flag.String("revoke", "", "ID of a client to revoke, instead of creating one")
+	flag.Parse()
+
+	ctx := context.Background()
+
+	if *revoke != "" {
+		store, err := openStore(ctx)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		defer store.Close()
+
+		if err := store.RevokeOAuthClient(ctx, *revoke, time.Now()); err != nil {
+			errorLog.Fatalf("client %s: %v", *revoke, err)
+		}
+		return
+	}
+
+	merchantIDs := strings.FieldsFunc(*merchants, func(r rune) bool { return r == ',' || r == ' ' })
+	if *name == "" || len(merchantIDs) == 0 {
+		fmt.Fprintln(os.Stderr, "-name and -merchants are required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	clientScopes, err := oauth.ParseScope(strings.ReplaceAll(*scopes, ",", " "))
+	if err != nil || len(clientScopes) == 0 {
+		errorLog.Fatalf("-scopes must name some of: %s", oauth.FormatScope(oauth.Scopes))
+	}
+
+	id, err := oauth.NewClientID()
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	secret, err := oauth.GenerateSecret()
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	store, err := openStore(ctx)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	defer store.Close()
+
+	for _, merchantID := range merchantIDs {
+		if _, err := store.GetMerchant(ctx, merchantID); err != nil {
+			errorLog.Fatalf("merchant %s: %v", merchantID, err)
+		}
+	}
+
+	err = store.CreateOAuthClient(ctx, models.OAuthClient{
+		ID:          id,
+		Name:        *name,
+		SecretHash:  oauth.HashSecret(secret),
+		Scopes:      clientScopes,
+		MerchantIDs: merchantIDs,
+		CreatedAt:   time.Now().UTC(),
+	})
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	fmt.Println(id)
+	fmt.Println(secret)
+}
+
+// openStore opens the database selected by STORAGE_DRIVER. Clients cannot be created for the memory driver, whose
+// contents only live as long as the gateway process.
+func openStore(ctx context.Context) (*storage.SQLStore, error) {
+	var options []storage.Option
+	if path := os.Getenv("KEYRING_PATH"); path != "" {
+		keyring, err := envelope.LoadKeyring(path)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, storage.WithKeyring(keyring))
+	}
+
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "postgres":
+		return storage.NewPostgresStore(ctx, os.Getenv("DATABASE_URL"), options...)
+	case "sqlite":
+		path := os.Getenv("SQLITE_PATH")
+		if path == "" {
+			path = "payment-gateway.db"
+		}
+		return storage.NewSQLiteStore(ctx, path, options...)
+	default:
+		return nil, fmt.Errorf("STORAGE_DRIVER %q does not store data at rest", driver)
+	}
+}
@@ -0,0 +1,82 @@
+// Command generate-certs generates the certificates needed to run the gateway over HTTPS locally: a certificate
+// authority, a server certificate it issues for the given hosts, and a client certificate for each of the given
+// merchants, for testing mutual TLS:
+//
+//	go run ./cmd/generate-certs -dir certs -hosts localhost,127.0.0.1 -merchants MER-1,MER-2
+//
+// It writes ca.pem and ca-key.pem, server.pem and server-key.pem, and client-<merchant>.pem and
+// client-<merchant>-key.pem to the directory. Client certificates name their merchant in a URI subject alternative
+// name, spiffe://<trust-domain>/merchant/<merchant>, where -trust-domain defaults to the gateway's default
+// MTLS_TRUST_DOMAIN. Running the gateway with TLS_CERT_FILE=certs/server.pem,
+// TLS_KEY_FILE=certs/server-key.pem and TLS_CLIENT_CA_FILE=certs/ca.pem serves HTTPS to clients trusting
+// certs/ca.pem. The certificates are for local use only.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/certs"
+)
+
+func main() {
+	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+
+	dir := flag.String("dir", "certs", "directory to write the certificates to")
+	hosts := flag.String("hosts", "localhost,127.0.0.1", "comma-separated DNS names and IP addresses of the server")
+	merchants := flag.String("merchants", "", "comma-separated IDs of the merchants to issue client certificates to")
+	trustDomain := flag.String("trust-domain", "payment-gateway", "trust domain of the merchants' URIs, as in MTLS_TRUST_DOMAIN")
+	validFor := flag.Duration("valid-for", 365*24*time.Hour, "how long the certificates are valid for")
+	flag.Parse()
+
+	split := func(s string) []string {
+		return strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+
+	serverHosts := split(*hosts)
+	if len(serverHosts) == 0 {
+		fmt.Fprintln(os.Stderr, "-hosts is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		errorLog.Fatal(err)
+	}
+
+	// write writes a key pair to <name>.pem and <name>-key.pem in the directory
+	write := func(pair certs.KeyPair, name string) {
+		certFile := filepath.Join(*dir, name+".pem")
+		if err := pair.Write(certFile, filepath.Join(*dir, name+"-key.pem")); err != nil {
+			errorLog.Fatal(err)
+		}
+		fmt.Println(certFile)
+	}
+
+	now := time.Now()
+
+	ca, err := certs.NewAuthority("Payment Gateway Local CA", now, *validFor)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	write(ca, "ca")
+
+	server, err := ca.IssueServer(serverHosts, now, *validFor)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	write(server, "server")
+
+	for _, merchantID := range split(*merchants) {
+		client, err := ca.IssueClient(merchantID, certs.MerchantURI(*trustDomain, merchantID), now, *validFor)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		write(client, "client-"+merchantID)
+	}
+}
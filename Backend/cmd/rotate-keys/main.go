@@ -0,0 +1,78 @@
+// Command rotate-keys brings the cardholder data stored by the gateway under the primary master key of the keyring
+// in KEYRING_PATH, encrypting any data stored in plaintext and any card tokenized with the legacy VAULT_KEY. It
+// connects to the database selected by STORAGE_DRIVER, DATABASE_URL and SQLITE_PATH, as the gateway does, and can run
+// while the gateway is serving requests.
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/envelope"
+	"github.com/Lionel-Wilson/payment-gateway/internal/storage"
+	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
+)
+
+func main() {
+	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
+	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+
+	path := os.Getenv("KEYRING_PATH")
+	if path == "" {
+		errorLog.Fatal("KEYRING_PATH must name a keyring file")
+	}
+
+	keyring, err := envelope.LoadKeyring(path)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	// Cards tokenized before envelope encryption were encrypted with VAULT_KEY, and are sealed again with the primary key
+	if encoded := os.Getenv("VAULT_KEY"); encoded != "" {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			errorLog.Fatalf("VAULT_KEY must be base64-encoded: %v", err)
+		}
+		if err := keyring.SetLegacyKey(key); err != nil {
+			errorLog.Fatalf("VAULT_KEY: %v", err)
+		}
+	}
+
+	batchSize, err := utils.EnvInt("ROTATE_KEYS_BATCH_SIZE", 500)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	ctx := context.Background()
+	store, err := openStore(ctx, keyring)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	defer store.Close()
+
+	rotated, err := store.RotateKeys(ctx, batchSize)
+	if err != nil {
+		errorLog.Fatalf("rotated %d records before failing: %v", rotated, err)
+	}
+
+	infoLog.Printf("Rotated %d records to master key %s", rotated, keyring.PrimaryKeyID())
+}
+
+// openStore opens the database selected by STORAGE_DRIVER. Only database backends store data that can be rotated.
+func openStore(ctx context.Context, keyring *envelope.Keyring) (*storage.SQLStore, error) {
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "postgres":
+		return storage.NewPostgresStore(ctx, os.Getenv("DATABASE_URL"), storage.WithKeyring(keyring))
+	case "sqlite":
+		path := os.Getenv("SQLITE_PATH")
+		if path == "" {
+			path = "payment-gateway.db"
+		}
+		return storage.NewSQLiteStore(ctx, path, storage.WithKeyring(keyring))
+	default:
+		return nil, fmt.Errorf("STORAGE_DRIVER %q does not store data at rest", driver)
+	}
+}
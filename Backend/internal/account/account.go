@@ -0,0 +1,76 @@
+// Package account generates the credentials of dashboard users: their IDs, password hashes and the session tokens
+// they authenticate with once logged in. Session tokens are only shown when they are created; the gateway stores
+// their hashes.
+package account
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordCost is the bcrypt cost of password hashes.
+const passwordCost = 12
+
+// SessionTokenPrefix starts every session token, which distinguishes it from API keys and access tokens.
+const SessionTokenPrefix = "sess_"
+
+// dummyHash is compared against when a user does not exist, so that logging in takes as long for unknown email
+// addresses as for known ones.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), passwordCost)
+
+// NewUserID returns a new ID for a dashboard user.
+func NewUserID() (string, error) {
+	return randomHex("USR-", 16)
+}
+
+// HashPassword returns the hash a password is stored as.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	return string(hash), err
+}
+
+// CheckPassword reports whether password matches hash. An empty hash matches no password, but takes as long to check.
+func CheckPassword(hash, password string) bool {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// NewSessionToken returns a new session token.
+func NewSessionToken() (string, error) {
+	return randomHex(SessionTokenPrefix, 32)
+}
+
+// IsSessionToken reports whether token looks like a session token.
+func IsSessionToken(token string) bool {
+	return strings.HasPrefix(token, SessionTokenPrefix)
+}
+
+// HashSessionToken returns the hash a session token is stored and looked up by. Tokens are long and random, so a
+// fast hash cannot be reversed by guessing.
+func HashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeEmail returns the form an email address is stored and looked up by.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// randomHex returns prefix followed by size random bytes in hexadecimal.
+func randomHex(prefix string, size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return prefix + hex.EncodeToString(b), nil
+}
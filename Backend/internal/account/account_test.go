@@ -0,0 +1,35 @@
+package account
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswords(t *testing.T) {
+	hash, err := HashPassword("correct horse battery")
+	require.NoError(t, err)
+	assert.NotContains(t, hash, "correct horse battery")
+
+	assert.True(t, CheckPassword(hash, "correct horse battery"))
+	assert.False(t, CheckPassword(hash, "correct horse"))
+	assert.False(t, CheckPassword("", "correct horse battery"))
+}
+
+func TestSessionTokens(t *testing.T) {
+	token, err := NewSessionToken()
+	require.NoError(t, err)
+	assert.Regexp(t, `^sess_[0-9a-f]{64}$`, token)
+	assert.True(t, IsSessionToken(token))
+	assert.False(t, IsSessionToken("sk_test_123"))
+	assert.Len(t, HashSessionToken(token), 64)
+
+	id, err := NewUserID()
+	require.NoError(t, err)
+	assert.Regexp(t, `^USR-[0-9a-f]{32}$`, id)
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	assert.Equal(t, "jane@example.com", NormalizeEmail("  Jane@Example.COM "))
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/validators"
+	"github.com/Lionel-Wilson/payment-gateway/internal/apikey"
+	"github.com/Lionel-Wilson/payment-gateway/internal/rbac"
+	"github.com/Lionel-Wilson/payment-gateway/internal/storage"
+	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateAPIKey creates an API key for the merchant making the request.
+//
+// @Summary      Create an API Key
+// @Description  Creates a publishable or secret API key in live or test mode. The key is only returned in this
+// @Description  response, and not when it is replayed for an Idempotency-Key, so it must be stored safely by the
+// @Description  merchant. Only dashboard users whose role grants every permission can create secret keys.
+// @Tags         API Keys
+// @Accept       json
+// @Produce      json
+// @Param        APIKeyRequestBody body APIKeyRequest true "A JSON body"
+// @Success      201  {object}  APIKey
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      422  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /api-keys [post]
+func (app *Application) CreateAPIKey(c *gin.Context) {
+	var keyRequest models.APIKeyRequest
+	if err := c.ShouldBindJSON(&keyRequest); err != nil {
+		utils.NewErrorResponse(c, http.StatusBadRequest, "Invalid request payload", nil)
+		return
+	}
+
+	utils.TrimWhitespace(&keyRequest)
+
+	if err := validate.Struct(keyRequest); err != nil {
+		utils.NewErrorResponse(c, http.StatusUnprocessableEntity, "Validation failed", validators.TranslateValidationErrors(err))
+		return
+	}
+
+	if keyRequest.Kind == apikey.Secret && !canIssueSecretKeys(c) {
+		utils.NewErrorResponse(c, http.StatusForbidden, "Your role does not allow this", []string{"The " + string(rbac.SecretKeysWrite) + " permission is required"})
+		return
+	}
+
+	key, ok := app.issueAPIKey(c, merchantID(c), keyRequest.Kind, keyRequest.Mode)
+	if !ok {
+		return
+	}
+
+	app.secretJSON(c, http.StatusCreated, key, key.Redacted())
+}
+
+// ListAPIKeys lists the API keys of the merchant making the request.
+//
+// @Summary      List API Keys
+// @Description  Lists the API keys of the merchant, including expired and revoked keys, in the order they were created.
+// @Tags         API Keys
+// @Accept       json
+// @Produce      json
+// @Success      200  {array}   APIKey
+// @Failure      401  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /api-keys [get]
+func (app *Application) ListAPIKeys(c *gin.Context) {
+	keys, err := app.APIKeys.ListAPIKeys(c.Request.Context(), merchantID(c))
+	if err != nil {
+		app.ErrorLog.Printf("failed to list API keys: %v", err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// RotateAPIKey replaces an API key of the merchant making the request with a new key of the same kind and mode.
+//
+// @Summary      Rotate an API Key
+// @Description  Creates a new key of the same kind and mode as an existing key, which stops working once the
+// @Description  optional grace period has passed, so that the merchant can replace it without downtime.
+// @Tags         API Keys
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "API key ID"
+// @Param        RotateAPIKeyRequestBody body RotateAPIKeyRequest false "A JSON body"
+// @Success      201  {object}  APIKey
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      422  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /api-keys/{id}/rotate [post]
+func (app *Application) RotateAPIKey(c *gin.Context) {
+	// The body is optional, so an empty one stops the old key working immediately
+	var rotateRequest models.RotateAPIKeyRequest
+	if err := c.ShouldBindJSON(&rotateRequest); err != nil && !errors.Is(err, io.EOF) {
+		utils.NewErrorResponse(c, http.StatusBadRequest, "Invalid request payload", nil)
+		return
+	}
+
+	if err := validate.Struct(rotateRequest); err != nil {
+		utils.NewErrorResponse(c, http.StatusUnprocessableEntity, "Validation failed", validators.TranslateValidationErrors(err))
+		return
+	}
+
+	old, ok := app.findAPIKey(c, strings.TrimSpace(c.Param("id")))
+	if !ok {
+		return
+	}
+
+	if old.Kind == apikey.Secret && !canIssueSecretKeys(c) {
+		utils.NewErrorResponse(c, http.StatusForbidden, "Your role does not allow this", []string{"The " + string(rbac.SecretKeysWrite) + " permission is required"})
+		return
+	}
+
+	if !old.Active(app.now()) {
+		utils.NewErrorResponse(c, http.StatusUnprocessableEntity, "API key cannot be rotated", []string{"API key has been revoked or has expired"})
+		return
+	}
+
+	key, ok := app.issueAPIKey(c, old.MerchantID, old.Kind, old.Mode)
+	if !ok {
+		return
+	}
+
+	expiresAt := app.now().Add(time.Duration(rotateRequest.GracePeriodSeconds) * time.Second)
+	if err := app.APIKeys.ExpireAPIKey(c.Request.Context(), old.ID, expiresAt); err != nil {
+		app.ErrorLog.Printf("failed to expire API key %s: %v", old.ID, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	app.secretJSON(c, http.StatusCreated, key, key.Redacted())
+}
+
+// RevokeAPIKey revokes an API key of the merchant making the request, so that it stops working immediately.
+//
+// @Summary      Revoke an API Key
+// @Description  Revokes an API key so that requests made with it are rejected. Revoking a revoked key has no effect.
+// @Tags         API Keys
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "API key ID"
+// @Success      200  {object}  APIKey
+// @Failure      401  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /api-keys/{id} [delete]
+func (app *Application) RevokeAPIKey(c *gin.Context) {
+	key, ok := app.findAPIKey(c, strings.TrimSpace(c.Param("id")))
+	if !ok {
+		return
+	}
+
+	if err := app.APIKeys.RevokeAPIKey(c.Request.Context(), key.ID, app.now()); err != nil {
+		app.ErrorLog.Printf("failed to revoke API key %s: %v", key.ID, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	key, ok = app.findAPIKey(c, key.ID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, key)
+}
+
+// issueAPIKey generates and stores a new API key for a merchant, and returns it with the key itself. If the key
+// cannot be created, an error response is sent and false is returned.
+func (app *Application) issueAPIKey(c *gin.Context, merchantID string, kind apikey.Kind, mode apikey.Mode) (models.APIKey, bool) {
+	id, err := apikey.NewID()
+	if err != nil {
+		app.ErrorLog.Printf("failed to generate API key ID: %v", err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return models.APIKey{}, false
+	}
+
+	secret, err := apikey.Generate(kind, mode)
+	if err != nil {
+		app.ErrorLog.Printf("failed to generate API key %s: %v", id, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return models.APIKey{}, false
+	}
+
+	key := models.APIKey{
+		ID:         id,
+		MerchantID: merchantID,
+		Kind:       kind,
+		Mode:       mode,
+		Last4:      apikey.Last4(secret),
+		Hash:       apikey.Hash(secret),
+		CreatedAt:  app.now().UTC(),
+	}
+
+	if err := app.APIKeys.CreateAPIKey(c.Request.Context(), key); err != nil {
+		app.ErrorLog.Printf("failed to create API key %s: %v", id, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return models.APIKey{}, false
+	}
+
+	key.Key = secret
+	return key, true
+}
+
+// canIssueSecretKeys reports whether the credentials of a request may create and rotate secret keys. Secret keys have
+// every permission, so dashboard users whose role does not grant every permission could otherwise give themselves
+// more than their role allows. Secret keys may, since they have every permission already.
+func canIssueSecretKeys(c *gin.Context) bool {
+	if value, ok := c.Get(UserKey); ok {
+		user, ok := value.(models.User)
+		return ok && user.Role.Can(rbac.SecretKeysWrite)
+	}
+
+	value, _ := c.Get(APIKeyKey)
+	key, ok := value.(models.APIKey)
+	return ok && key.Kind == apikey.Secret
+}
+
+// secretJSON sends a response carrying a secret, and keeps the same response without the secret under
+// RedactedResponseKey, so that only the redacted response is stored if the request is idempotent.
+func (app *Application) secretJSON(c *gin.Context, status int, response, redacted any) {
+	body, err := json.Marshal(redacted)
+	if err != nil {
+		app.ErrorLog.Printf("failed to redact response: %v", err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	c.Set(RedactedResponseKey, body)
+	c.JSON(status, response)
+}
+
+// findAPIKey retrieves the API key with the given ID. Keys of other merchants are reported as not found.
+// If the key cannot be retrieved, an error response is sent and false is returned.
+func (app *Application) findAPIKey(c *gin.Context, id string) (models.APIKey, bool) {
+	key, err := app.APIKeys.GetAPIKey(c.Request.Context(), id)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && key.MerchantID != merchantID(c)) {
+		utils.NewErrorResponse(c, http.StatusNotFound, "API key not found", nil)
+		return models.APIKey{}, false
+	} else if err != nil {
+		app.ErrorLog.Printf("failed to retrieve API key %s: %v", id, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return models.APIKey{}, false
+	}
+
+	return key, true
+}
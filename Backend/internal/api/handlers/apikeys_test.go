@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/apikey"
+	"github.com/Lionel-Wilson/payment-gateway/internal/rbac"
+	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupAPIKeyRouter returns a router serving the API key endpoints on behalf of the given merchant.
+func setupAPIKeyRouter(app *Application, merchantID string) *gin.Engine {
+	router := gin.New()
+	router.POST("/api/v1/api-keys", asMerchant(merchantID, app.CreateAPIKey))
+	router.GET("/api/v1/api-keys", asMerchant(merchantID, app.ListAPIKeys))
+	router.POST("/api/v1/api-keys/:id/rotate", asMerchant(merchantID, app.RotateAPIKey))
+	router.DELETE("/api/v1/api-keys/:id", asMerchant(merchantID, app.RevokeAPIKey))
+
+	return router
+}
+
+// createTestAPIKey creates a secret test key for the given merchant and returns it.
+func createTestAPIKey(t *testing.T, app *Application, merchantID string) models.APIKey {
+	t.Helper()
+
+	rr := sendAPIKeyRequest(setupAPIKeyRouter(app, merchantID), "POST", "/api/v1/api-keys", `{"kind":"secret","mode":"test"}`)
+	require.Equal(t, http.StatusCreated, rr.Code)
+
+	var key models.APIKey
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &key))
+
+	return key
+}
+
+func sendAPIKeyRequest(router *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	app := setupTestApp()
+	key := createTestAPIKey(t, app, "merchant-1")
+
+	assert.Regexp(t, `^KEY-[0-9a-f]{32}$`, key.ID)
+	assert.Regexp(t, `^sk_test_[0-9a-f]{48}$`, key.Key)
+	assert.Equal(t, apikey.Secret, key.Kind)
+	assert.Equal(t, apikey.Test, key.Mode)
+	assert.Equal(t, key.Key[len(key.Key)-4:], key.Last4)
+	assert.Equal(t, testNow, key.CreatedAt)
+
+	stored, err := app.APIKeys.GetAPIKeyByHash(context.Background(), apikey.Hash(key.Key))
+	require.NoError(t, err)
+	assert.Equal(t, "merchant-1", stored.MerchantID)
+	assert.Empty(t, stored.Key, "keys are only stored hashed")
+
+	tests := []struct {
+		name               string
+		body               string
+		expectedStatusCode int
+		expectedMessage    string
+		expectedErrors     []string
+	}{
+		{
+			name:               "Publishable Live Key",
+			body:               `{"kind":"publishable","mode":"live"}`,
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name:               "Malformed Body",
+			body:               `{"kind":`,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedMessage:    "Invalid request payload",
+		},
+		{
+			name:               "Unknown Kind And Missing Mode",
+			body:               `{"kind":"restricted"}`,
+			expectedStatusCode: http.StatusUnprocessableEntity,
+			expectedMessage:    "Validation failed",
+			expectedErrors:     []string{"Kind must be one of: publishable, secret", "Mode is required"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := sendAPIKeyRequest(setupAPIKeyRouter(app, "merchant-1"), "POST", "/api/v1/api-keys", tt.body)
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+
+			if tt.expectedMessage != "" {
+				var errorResponse utils.ErrorResponse
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &errorResponse))
+				assert.Equal(t, tt.expectedMessage, errorResponse.Message)
+				assert.Equal(t, tt.expectedErrors, errorResponse.Errors)
+			}
+		})
+	}
+}
+
+func TestSecretKeysNeedEveryPermission(t *testing.T) {
+	app := setupTestApp()
+	secret := createTestAPIKey(t, app, "merchant-1")
+
+	router := gin.New()
+	for _, role := range rbac.Roles {
+		user := models.User{ID: "USR-" + string(role), MerchantID: "merchant-1", Role: role}
+		router.POST("/"+string(role)+"/api-keys", asUser(user, app.CreateAPIKey))
+		router.POST("/"+string(role)+"/api-keys/:id/rotate", asUser(user, app.RotateAPIKey))
+	}
+
+	tests := []struct {
+		name               string
+		role               rbac.Role
+		path               string
+		body               string
+		expectedStatusCode int
+	}{
+		{"Developer Creates Secret Key", rbac.Developer, "/api-keys", `{"kind":"secret","mode":"live"}`, http.StatusForbidden},
+		{"Developer Creates Publishable Key", rbac.Developer, "/api-keys", `{"kind":"publishable","mode":"live"}`, http.StatusCreated},
+		{"Developer Rotates Secret Key", rbac.Developer, "/api-keys/" + secret.ID + "/rotate", `{"gracePeriodSeconds":60}`, http.StatusForbidden},
+		{"Admin Creates Secret Key", rbac.Admin, "/api-keys", `{"kind":"secret","mode":"live"}`, http.StatusCreated},
+		{"Admin Rotates Secret Key", rbac.Admin, "/api-keys/" + secret.ID + "/rotate", `{"gracePeriodSeconds":60}`, http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := sendAPIKeyRequest(router, "POST", "/"+string(tt.role)+tt.path, tt.body)
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+		})
+	}
+}
+
+func TestListAPIKeys(t *testing.T) {
+	app := setupTestApp()
+	first := createTestAPIKey(t, app, "merchant-1")
+	createTestAPIKey(t, app, "merchant-2")
+	second := createTestAPIKey(t, app, "merchant-1")
+
+	rr := sendAPIKeyRequest(setupAPIKeyRouter(app, "merchant-1"), "GET", "/api/v1/api-keys", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var keys []models.APIKey
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &keys))
+	if assert.Len(t, keys, 2, "only the merchant's own keys are listed") {
+		assert.Equal(t, first.ID, keys[0].ID)
+		assert.Equal(t, second.ID, keys[1].ID)
+		assert.Empty(t, keys[0].Key, "keys are only shown when they are created")
+	}
+}
+
+func TestRotateAPIKey(t *testing.T) {
+	tests := []struct {
+		name               string
+		body               string
+		expectedStatusCode int
+		expectedExpiry     time.Time
+	}{
+		{
+			name:               "Immediately",
+			body:               "",
+			expectedStatusCode: http.StatusCreated,
+			expectedExpiry:     testNow,
+		},
+		{
+			name:               "With Grace Period",
+			body:               `{"gracePeriodSeconds":3600}`,
+			expectedStatusCode: http.StatusCreated,
+			expectedExpiry:     testNow.Add(time.Hour),
+		},
+		{
+			name:               "Grace Period Too Long",
+			body:               `{"gracePeriodSeconds":604801}`,
+			expectedStatusCode: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := setupTestApp()
+			old := createTestAPIKey(t, app, "merchant-1")
+
+			rr := sendAPIKeyRequest(setupAPIKeyRouter(app, "merchant-1"), "POST", "/api/v1/api-keys/"+old.ID+"/rotate", tt.body)
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+
+			stored, err := app.APIKeys.GetAPIKey(context.Background(), old.ID)
+			require.NoError(t, err)
+
+			if tt.expectedStatusCode != http.StatusCreated {
+				assert.Nil(t, stored.ExpiresAt)
+				return
+			}
+
+			var key models.APIKey
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &key))
+			assert.NotEqual(t, old.ID, key.ID)
+			assert.NotEqual(t, old.Key, key.Key)
+			assert.Equal(t, old.Kind, key.Kind)
+			assert.Equal(t, old.Mode, key.Mode)
+
+			if assert.NotNil(t, stored.ExpiresAt) {
+				assert.Equal(t, tt.expectedExpiry, *stored.ExpiresAt)
+			}
+		})
+	}
+
+	t.Run("Expired Key", func(t *testing.T) {
+		app := setupTestApp()
+		router := setupAPIKeyRouter(app, "merchant-1")
+		old := createTestAPIKey(t, app, "merchant-1")
+
+		sendAPIKeyRequest(router, "POST", "/api/v1/api-keys/"+old.ID+"/rotate", "")
+		rr := sendAPIKeyRequest(router, "POST", "/api/v1/api-keys/"+old.ID+"/rotate", "")
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+
+	t.Run("Another Merchant's Key", func(t *testing.T) {
+		app := setupTestApp()
+		old := createTestAPIKey(t, app, "merchant-1")
+
+		rr := sendAPIKeyRequest(setupAPIKeyRouter(app, "merchant-2"), "POST", "/api/v1/api-keys/"+old.ID+"/rotate", "")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	app := setupTestApp()
+	key := createTestAPIKey(t, app, "merchant-1")
+
+	rr := sendAPIKeyRequest(setupAPIKeyRouter(app, "merchant-2"), "DELETE", "/api/v1/api-keys/"+key.ID, "")
+	assert.Equal(t, http.StatusNotFound, rr.Code, "merchants cannot revoke each other's keys")
+
+	rr = sendAPIKeyRequest(setupAPIKeyRouter(app, "merchant-1"), "DELETE", "/api/v1/api-keys/"+key.ID, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var revoked models.APIKey
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &revoked))
+	if assert.NotNil(t, revoked.RevokedAt) {
+		assert.Equal(t, testNow, *revoked.RevokedAt)
+	}
+	assert.Empty(t, revoked.Key)
+
+	rr = sendAPIKeyRequest(setupAPIKeyRouter(app, "merchant-1"), "DELETE", "/api/v1/api-keys/KEY-404", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -1,9 +1,45 @@
 package handlers
 
-import "log"
+import (
+	"log"
+	"time"
 
-// Application represents the application with its logging configurations.
+	"github.com/Lionel-Wilson/payment-gateway/internal/bank"
+	"github.com/Lionel-Wilson/payment-gateway/internal/bin"
+	"github.com/Lionel-Wilson/payment-gateway/internal/currency"
+	"github.com/Lionel-Wilson/payment-gateway/internal/oauth"
+	"github.com/Lionel-Wilson/payment-gateway/internal/storage"
+	"github.com/Lionel-Wilson/payment-gateway/internal/vault"
+)
+
+// Application represents the application with its logging configurations and dependencies.
 type Application struct {
-	ErrorLog *log.Logger // Logger for error messages
-	InfoLog  *log.Logger // Logger for informational messages
+	ErrorLog         *log.Logger              // Logger for error messages
+	InfoLog          *log.Logger              // Logger for informational messages
+	Payments         storage.PaymentStore     // Store used to persist payment details
+	Refunds          storage.RefundStore      // Store used to persist refunds
+	Tokens           storage.TokenStore       // Store used to persist vault tokens
+	APIKeys          storage.APIKeyStore      // Store used to persist merchant API keys
+	Merchants        storage.MerchantStore    // Store used to persist merchants
+	OAuthClients     storage.OAuthClientStore // Store used to persist OAuth clients
+	Users            storage.UserStore        // Store used to persist dashboard users
+	Sessions         storage.SessionStore     // Store used to persist dashboard sessions
+	SessionTTL       time.Duration            // How long dashboard sessions last. Defaults to 8 hours when zero
+	AccessTokens     *oauth.Issuer            // Issuer of OAuth access tokens. The token endpoint is disabled when nil
+	Vault            *vault.Vault             // Vault used to encrypt tokenized cards. Tokenization is disabled when nil
+	Bank             bank.AcquiringBank       // Acquiring bank used to authorize and settle payments
+	BINs             bin.Database             // BIN table used to look up card issuers. Issuers are unknown when nil
+	Currencies       currency.AllowLists      // Currencies accepted from each merchant. Every currency is accepted when empty
+	AuthorizationTTL time.Duration            // How long an uncaptured authorization remains valid
+	MaxExpiryYears   int                      // How many years ahead a card's expiry date may be. Defaults to 20 when zero
+	Clock            func() time.Time         // Returns the current time. Defaults to time.Now when nil
+}
+
+// now returns the current time according to the application's clock.
+func (app *Application) now() time.Time {
+	if app.Clock != nil {
+		return app.Clock()
+	}
+
+	return time.Now()
 }
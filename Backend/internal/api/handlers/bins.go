@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/bin"
+	"github.com/Lionel-Wilson/payment-gateway/internal/card"
+	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// BIN lookups accept between 6 and 8 digits, the lengths of the BINs issued by card schemes.
+const (
+	minBINLookupLength = 6
+	maxBINLookupLength = 8
+)
+
+// RetrieveBIN retrieves what is known about the cards issued under a BIN.
+//
+// @Summary      Look up a BIN
+// @Description  Retrieves the issuer, country, funding source and product of the cards issued under a bank
+// @Description  identification number (BIN), the first 6 to 8 digits of a card number.
+// @Tags         BINs
+// @Accept       json
+// @Produce      json
+// @Param        bin  path      string  true  "BIN"
+// @Success      200  {object}  BINDetails
+// @Failure      400  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Router       /bins/{bin} [get]
+func (app *Application) RetrieveBIN(c *gin.Context) {
+	number := strings.TrimSpace(c.Param("bin"))
+	if len(number) < minBINLookupLength || len(number) > maxBINLookupLength || strings.Trim(number, "0123456789") != "" {
+		utils.NewErrorResponse(c, http.StatusBadRequest, "Invalid BIN provided", []string{fmt.Sprintf("BIN must be %d to %d digits", minBINLookupLength, maxBINLookupLength)})
+		return
+	}
+
+	record, ok := app.lookupBIN(number)
+	if !ok {
+		utils.NewErrorResponse(c, http.StatusNotFound, "BIN not found", nil)
+		return
+	}
+
+	brand, _ := card.Detect(number)
+	c.JSON(http.StatusOK, models.BINDetails{
+		BIN:     record.BIN,
+		Brand:   brand,
+		Issuer:  record.Issuer,
+		Country: record.Country,
+		Funding: record.Funding,
+		Product: record.Product,
+	})
+}
+
+// lookupBIN returns the BIN record of a card number. It reports false if the card's BIN is not known, or if the
+// application has no BIN table.
+func (app *Application) lookupBIN(number string) (bin.Record, bool) {
+	if app.BINs == nil {
+		return bin.Record{}, false
+	}
+
+	return app.BINs.Lookup(number)
+}
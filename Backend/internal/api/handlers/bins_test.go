@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/bin"
+	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testBINs returns a BIN table holding a credit and a debit BIN under the Visa test card's IIN.
+func testBINs(t *testing.T) bin.Database {
+	t.Helper()
+
+	index, err := bin.NewIndex([]bin.Record{
+		{BIN: "411111", Issuer: "Test Bank", Country: "GB", Funding: bin.Credit, Product: "Visa Classic"},
+		{BIN: "41111122", Issuer: "Test Bank", Country: "GB", Funding: bin.Debit, Product: "Visa Debit"},
+	})
+	require.NoError(t, err)
+
+	return index
+}
+
+func TestRetrieveBIN(t *testing.T) {
+	tests := []struct {
+		name               string
+		bins               bin.Database
+		bin                string
+		expectedStatusCode int
+		expectedResponse   models.BINDetails
+		expectedMessage    string
+	}{
+		{
+			name:               "Known BIN",
+			bins:               testBINs(t),
+			bin:                "411111",
+			expectedStatusCode: http.StatusOK,
+			expectedResponse:   models.BINDetails{BIN: "411111", Brand: "visa", Issuer: "Test Bank", Country: "GB", Funding: bin.Credit, Product: "Visa Classic"},
+		},
+		{
+			name:               "Longest Matching BIN",
+			bins:               testBINs(t),
+			bin:                "41111122",
+			expectedStatusCode: http.StatusOK,
+			expectedResponse:   models.BINDetails{BIN: "41111122", Brand: "visa", Issuer: "Test Bank", Country: "GB", Funding: bin.Debit, Product: "Visa Debit"},
+		},
+		{
+			name:               "Shorter Matching BIN",
+			bins:               testBINs(t),
+			bin:                "41111199",
+			expectedStatusCode: http.StatusOK,
+			expectedResponse:   models.BINDetails{BIN: "411111", Brand: "visa", Issuer: "Test Bank", Country: "GB", Funding: bin.Credit, Product: "Visa Classic"},
+		},
+		{name: "Unknown BIN", bins: testBINs(t), bin: "555555", expectedStatusCode: http.StatusNotFound, expectedMessage: "BIN not found"},
+		{name: "No BIN Table", bin: "411111", expectedStatusCode: http.StatusNotFound, expectedMessage: "BIN not found"},
+		{name: "Too Short", bins: testBINs(t), bin: "41111", expectedStatusCode: http.StatusBadRequest, expectedMessage: "Invalid BIN provided"},
+		{name: "Too Long", bins: testBINs(t), bin: "411111111", expectedStatusCode: http.StatusBadRequest, expectedMessage: "Invalid BIN provided"},
+		{name: "Not Digits", bins: testBINs(t), bin: "4111a1", expectedStatusCode: http.StatusBadRequest, expectedMessage: "Invalid BIN provided"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := setupTestApp()
+			app.BINs = tt.bins
+			router := gin.New()
+			router.GET("/api/v1/bins/:bin", app.RetrieveBIN)
+
+			req, _ := http.NewRequest("GET", "/api/v1/bins/"+tt.bin, nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+
+			if tt.expectedStatusCode == http.StatusOK {
+				var response models.BINDetails
+				err := json.Unmarshal(rr.Body.Bytes(), &response)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedResponse, response)
+			} else {
+				var errorResponse utils.ErrorResponse
+				err := json.Unmarshal(rr.Body.Bytes(), &errorResponse)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedMessage, errorResponse.Message)
+			}
+		})
+	}
+}
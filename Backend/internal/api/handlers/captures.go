@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/validators"
+	"github.com/Lionel-Wilson/payment-gateway/internal/bank"
+	"github.com/Lionel-Wilson/payment-gateway/internal/money"
+	"github.com/Lionel-Wilson/payment-gateway/internal/storage"
+	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// CapturePayment captures some or all of a previously authorized payment.
+//
+// @Summary      Capture a Payment
+// @Description  Captures some or all of an authorized payment. Omit the amount to capture the full authorized amount.
+// @Description  A payment can be captured once; any uncaptured remainder of a partial capture is released.
+// @Tags         Payments
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "Payment ID"
+// @Param CaptureRequestBody body CaptureRequest false "A JSON body" CaptureRequest()
+// @Success      201  {object}  CaptureResponse
+// @Failure      402  {object}  CaptureResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      409  {object}  ErrorResponse
+// @Failure      422  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Failure      502  {object}  CaptureResponse
+// @Failure      504  {object}  CaptureResponse
+// @Router       /payments/{id}/captures [post]
+func (app *Application) CapturePayment(c *gin.Context) {
+	id := strings.TrimSpace(c.Param("id"))
+	ctx := c.Request.Context()
+
+	// The body is optional, so an empty one captures the full amount
+	var captureRequest models.CaptureRequest
+	if err := c.ShouldBindJSON(&captureRequest); err != nil && !errors.Is(err, io.EOF) {
+		utils.NewErrorResponse(c, http.StatusBadRequest, "Invalid request payload", nil)
+		return
+	}
+
+	payment, ok := app.findPayment(c, id)
+	if !ok {
+		return
+	}
+
+	// A decimal amount can only be read once the payment's currency is known
+	amount, ok := resolveAmount(c, captureRequest.Amount, payment.CurrencyCode)
+	if !ok {
+		return
+	}
+	captureRequest.Amount = amount
+
+	if err := validate.Struct(captureRequest); err != nil {
+		utils.NewErrorResponse(c, http.StatusUnprocessableEntity, "Validation failed", validators.TranslateValidationErrors(err))
+		return
+	}
+
+	if !canTransition(c, payment, models.StatusCapturing, "Payment cannot be captured") {
+		return
+	}
+
+	if app.authorizationLapsed(c, payment) {
+		return
+	}
+
+	if amount.IsZero() {
+		amount = payment.Amount
+	}
+	if exceeds, err := amount.Cmp(payment.Amount); err != nil {
+		app.ErrorLog.Printf("failed to capture payment %s: %v", id, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	} else if exceeds > 0 {
+		utils.NewErrorResponse(c, http.StatusUnprocessableEntity, "Validation failed", []string{fmt.Sprintf("Amount must not exceed the authorized amount of %s", payment.Amount)})
+		return
+	}
+
+	// Reserve the capture on the payment before asking the bank, so that concurrent captures can never both reach it
+	startedAt := app.now().UTC()
+	capturing := payment
+	capturing.Status = models.StatusCapturing
+	capturing.CapturedAmount = amount
+	capturing.CaptureStartedAt = &startedAt
+
+	if !app.savePayment(c, capturing) {
+		return
+	}
+	capturing.Version++
+
+	contactingBank(c)
+	bankResponse, err := app.Bank.Capture(ctx, bankCapture(capturing))
+
+	response := models.CaptureResponse{
+		PaymentID: payment.ID,
+		Status:    capturing.Status,
+		Amount:    amount,
+	}
+
+	// A declined or rejected capture leaves the payment authorized, so it can be retried. One whose outcome is unknown
+	// leaves it capturing until it is reconciled with the bank, so that it can be neither captured again nor voided.
+	switch failure, failed := bankFailure(err); {
+	case failed:
+		if errors.Is(err, bank.ErrRejected) {
+			if err := app.releaseCapture(ctx, capturing); err != nil {
+				app.ErrorLog.Printf("failed to release capture of payment %s: %v", id, err)
+			}
+			response.Status = payment.Status
+		}
+		response.StatusCode = failure.StatusCode
+		response.ResponseSummary = failure.Summary
+		c.JSON(bankFailureStatus(failure.StatusCode), response)
+		return
+	case err != nil:
+		app.ErrorLog.Printf("failed to capture payment %s: %v", id, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	response.StatusCode = bankResponse.StatusCode
+	response.ResponseSummary = bankResponse.Summary
+
+	if !bankResponse.Approved {
+		if err := app.releaseCapture(ctx, capturing); err != nil {
+			app.ErrorLog.Printf("failed to release capture of payment %s: %v", id, err)
+		}
+		response.Status = payment.Status
+		c.JSON(http.StatusPaymentRequired, response)
+		return
+	}
+
+	// The funds have been captured even if this cannot be recorded, in which case the payment is left capturing and
+	// the capture is recorded when it is reconciled
+	if err := app.completeCapture(ctx, capturing, bankResponse); err != nil {
+		app.ErrorLog.Printf("failed to complete capture of payment %s: %v", id, err)
+	} else {
+		response.Status = models.StatusPaid
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// bankCapture returns the request asking the bank to capture a payment being captured. The payment's ID is used as
+// the reference, so that the bank captures the payment only once however often the request is sent.
+func bankCapture(capturing models.PaymentDetails) bank.CaptureRequest {
+	return bank.CaptureRequest{
+		Reference:     capturing.ID,
+		BankReference: capturing.BankReference,
+		Amount:        capturing.CapturedAmount,
+	}
+}
+
+// completeCapture marks a payment being captured as paid once the bank has approved the capture. It uses a fresh
+// context, so that the capture is recorded even if the client has gone away.
+func (app *Application) completeCapture(ctx context.Context, capturing models.PaymentDetails, bankResponse bank.Response) error {
+	captured := capturing
+	captured.Status = models.StatusPaid
+	captured.StatusCode = bankResponse.StatusCode
+	captured.ResponseSummary = bankResponse.Summary
+	captured.AuthorizationExpiresAt = nil
+	captured.CaptureStartedAt = nil
+
+	return app.Payments.UpdatePayment(context.WithoutCancel(ctx), captured)
+}
+
+// releaseCapture moves a payment whose capture did not go through back to authorized, so that it can be captured again
+// or voided until its authorization expires. It uses a fresh context, so that the payment is not left being captured
+// if the client has gone away.
+func (app *Application) releaseCapture(ctx context.Context, capturing models.PaymentDetails) error {
+	released := capturing
+	released.Status = models.StatusAuthorized
+	released.CapturedAmount = money.New(0, capturing.Amount.Currency)
+	released.CaptureStartedAt = nil
+
+	return app.Payments.UpdatePayment(context.WithoutCancel(ctx), released)
+}
+
+// ReconcileCaptures settles every capture started before the given time whose payment is still capturing, because the
+// bank timed out or failed or its answer could not be recorded. Each capture is sent to the bank again, which captures
+// a payment only once, and the payment is marked paid or moved back to authorized depending on the answer. Payments
+// whose capture outcome is still unknown are left capturing. It returns the number of captures settled.
+func (app *Application) ReconcileCaptures(ctx context.Context, before time.Time) (int, error) {
+	payments, err := app.Payments.ListCapturesStartedBefore(ctx, models.StatusCapturing, before)
+	if err != nil {
+		return 0, err
+	}
+
+	settled := 0
+	for _, payment := range payments {
+		bankResponse, err := app.Bank.Capture(ctx, bankCapture(payment))
+
+		switch _, failed := bankFailure(err); {
+		case failed && errors.Is(err, bank.ErrRejected):
+			err = app.releaseCapture(ctx, payment)
+		case err != nil:
+			app.ErrorLog.Printf("failed to reconcile capture of payment %s: %v", payment.ID, err)
+			continue
+		case !bankResponse.Approved:
+			err = app.releaseCapture(ctx, payment)
+		default:
+			err = app.completeCapture(ctx, payment, bankResponse)
+		}
+
+		// A payment changed in the meantime has already been settled by the request that captured it
+		if errors.Is(err, storage.ErrConflict) {
+			continue
+		} else if err != nil {
+			return settled, fmt.Errorf("reconcile capture of payment %s: %w", payment.ID, err)
+		}
+		settled++
+	}
+
+	return settled, nil
+}
+
+// RunCaptureReconciliation calls ReconcileCaptures every interval until ctx is cancelled, settling the captures that
+// have been capturing for at least an interval.
+func (app *Application) RunCaptureReconciliation(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			settled, err := app.ReconcileCaptures(ctx, app.now().Add(-interval))
+			if err != nil {
+				app.ErrorLog.Printf("failed to reconcile captures: %v", err)
+			} else if settled > 0 {
+				app.InfoLog.Printf("Reconciled %d captures", settled)
+			}
+		}
+	}
+}
+
+// ExpireAuthorizations marks every authorization that has lapsed without being captured as expired.
+// It returns the number of payments expired.
+func (app *Application) ExpireAuthorizations(ctx context.Context) (int, error) {
+	payments, err := app.Payments.ListAuthorizationsExpiringBefore(ctx, models.StatusAuthorized, app.now())
+	if err != nil {
+		return 0, err
+	}
+
+	for _, payment := range payments {
+		if err := app.expireAuthorization(ctx, payment); err != nil {
+			return 0, fmt.Errorf("expire authorization %s: %w", payment.ID, err)
+		}
+	}
+
+	return len(payments), nil
+}
+
+// RunAuthorizationExpiry calls ExpireAuthorizations every interval until ctx is cancelled.
+func (app *Application) RunAuthorizationExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, err := app.ExpireAuthorizations(ctx)
+			if err != nil {
+				app.ErrorLog.Printf("failed to expire authorizations: %v", err)
+			} else if expired > 0 {
+				app.InfoLog.Printf("Expired %d authorizations", expired)
+			}
+		}
+	}
+}
+
+// authorizationLapsed reports whether the authorization of an authorized payment has expired. If it has,
+// the payment is moved to the expired status and an error response is sent.
+func (app *Application) authorizationLapsed(c *gin.Context, payment models.PaymentDetails) bool {
+	if payment.AuthorizationExpiresAt == nil || app.now().Before(*payment.AuthorizationExpiresAt) {
+		return false
+	}
+
+	if err := app.expireAuthorization(c.Request.Context(), payment); err != nil {
+		app.ErrorLog.Printf("failed to expire authorization %s: %v", payment.ID, err)
+	}
+	utils.NewErrorResponse(c, http.StatusConflict, "Authorization has expired", nil)
+
+	return true
+}
+
+// expireAuthorization moves an authorized payment to the expired status.
+// A payment that was captured or otherwise changed in the meantime is left alone.
+func (app *Application) expireAuthorization(ctx context.Context, payment models.PaymentDetails) error {
+	if err := payment.Status.Transition(models.StatusExpired); err != nil {
+		return err
+	}
+
+	expired := payment
+	expired.Status = models.StatusExpired
+
+	err := app.Payments.UpdatePayment(ctx, expired)
+	if errors.Is(err, storage.ErrConflict) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,485 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/bank"
+	"github.com/Lionel-Wilson/payment-gateway/internal/money"
+	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureBank is an acquiring bank whose captures end with the given response or error. If started is not nil, each
+// capture is announced on it and then waits for release to be closed.
+type captureBank struct {
+	bank.AcquiringBank
+	response bank.Response
+	err      error
+	calls    *atomic.Int32
+	started  chan struct{}
+	release  chan struct{}
+}
+
+func (b captureBank) Capture(ctx context.Context, req bank.CaptureRequest) (bank.Response, error) {
+	if b.calls != nil {
+		b.calls.Add(1)
+	}
+	if b.started != nil {
+		b.started <- struct{}{}
+		<-b.release
+	}
+
+	return b.response, b.err
+}
+
+// authorizedPayment returns an uncaptured payment whose authorization expires at the given time.
+func authorizedPayment(id string, expiresAt time.Time) models.PaymentDetails {
+	return models.PaymentDetails{
+		ID:                     id,
+		FirstName:              "Jane",
+		LastName:               "Doe",
+		CardNumber:             utils.MaskCardNumber("4111111111111111"),
+		ExpiryDate:             "12/29",
+		Amount:                 money.New(20000, "USD"),
+		CurrencyCode:           "USD",
+		Status:                 "payment_authorized",
+		StatusCode:             10000,
+		BankReference:          "BNK-1",
+		CapturedAmount:         money.New(0, "USD"),
+		RefundedAmount:         money.New(0, "USD"),
+		AuthorizationExpiresAt: &expiresAt,
+	}
+}
+
+func TestAuthorizeOnly(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	app := setupTestApp()
+	app.AuthorizationTTL = 24 * time.Hour
+	app.Clock = func() time.Time { return now }
+
+	router := gin.New()
+	router.POST("/api/v1/payments", app.ProcessPayment)
+
+	capture := false
+	reqBody, _ := json.Marshal(models.ProcessPaymentRequest{
+		FirstName:    "John",
+		LastName:     "Doe",
+		CardNumber:   "4242424242424242",
+		ExpiryDate:   "12/29",
+		Amount:       money.New(10000, "USD"),
+		CurrencyCode: "USD",
+		CVV:          "123",
+		Capture:      &capture,
+	})
+	req, _ := http.NewRequest("POST", "/api/v1/payments", bytes.NewBuffer(reqBody))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	var response models.ProcessPaymentResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, models.StatusAuthorized, response.Status)
+
+	payment, err := app.Payments.GetPayment(context.Background(), response.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, money.New(0, "USD"), payment.CapturedAmount)
+	assert.Equal(t, now.Add(24*time.Hour), *payment.AuthorizationExpiresAt)
+}
+
+func TestCapturePayment(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	paid := authorizedPayment("PAY-12345", now.Add(time.Hour))
+	paid.Status = "payment_paid"
+
+	tests := []struct {
+		name                   string
+		setupPayments          []models.PaymentDetails
+		paymentID              string
+		body                   string
+		expectedStatusCode     int
+		expectedResponse       interface{}
+		expectedPaymentStatus  models.PaymentStatus
+		expectedCapturedAmount int64
+	}{
+		{
+			name:                   "Full Capture",
+			setupPayments:          []models.PaymentDetails{authorizedPayment("PAY-12345", now.Add(time.Hour))},
+			paymentID:              "PAY-12345",
+			expectedStatusCode:     http.StatusCreated,
+			expectedResponse:       "payment_paid",
+			expectedPaymentStatus:  "payment_paid",
+			expectedCapturedAmount: 20000,
+		},
+		{
+			name:                   "Partial Capture",
+			setupPayments:          []models.PaymentDetails{authorizedPayment("PAY-12345", now.Add(time.Hour))},
+			paymentID:              "PAY-12345",
+			body:                   `{"amount": 50.5}`,
+			expectedStatusCode:     http.StatusCreated,
+			expectedResponse:       "payment_paid",
+			expectedPaymentStatus:  "payment_paid",
+			expectedCapturedAmount: 5050,
+		},
+		{
+			name:                   "Partial Capture In Minor Units",
+			setupPayments:          []models.PaymentDetails{authorizedPayment("PAY-12345", now.Add(time.Hour))},
+			paymentID:              "PAY-12345",
+			body:                   `{"amount": {"value": 5050, "currency": "USD"}}`,
+			expectedStatusCode:     http.StatusCreated,
+			expectedResponse:       "payment_paid",
+			expectedPaymentStatus:  "payment_paid",
+			expectedCapturedAmount: 5050,
+		},
+		{
+			name:                  "Amount In Other Currency",
+			setupPayments:         []models.PaymentDetails{authorizedPayment("PAY-12345", now.Add(time.Hour))},
+			paymentID:             "PAY-12345",
+			body:                  `{"amount": {"value": 5050, "currency": "GBP"}}`,
+			expectedStatusCode:    http.StatusUnprocessableEntity,
+			expectedResponse:      "Validation failed",
+			expectedPaymentStatus: "payment_authorized",
+		},
+		{
+			name:                  "Amount Exceeds Authorization",
+			setupPayments:         []models.PaymentDetails{authorizedPayment("PAY-12345", now.Add(time.Hour))},
+			paymentID:             "PAY-12345",
+			body:                  `{"amount": 200.01}`,
+			expectedStatusCode:    http.StatusUnprocessableEntity,
+			expectedResponse:      "Validation failed",
+			expectedPaymentStatus: "payment_authorized",
+		},
+		{
+			name:                  "Negative Amount",
+			setupPayments:         []models.PaymentDetails{authorizedPayment("PAY-12345", now.Add(time.Hour))},
+			paymentID:             "PAY-12345",
+			body:                  `{"amount": -1}`,
+			expectedStatusCode:    http.StatusUnprocessableEntity,
+			expectedResponse:      "Validation failed",
+			expectedPaymentStatus: "payment_authorized",
+		},
+		{
+			name:                   "Already Captured",
+			setupPayments:          []models.PaymentDetails{paid},
+			paymentID:              "PAY-12345",
+			expectedStatusCode:     http.StatusConflict,
+			expectedResponse:       "Payment cannot be captured",
+			expectedPaymentStatus:  "payment_paid",
+			expectedCapturedAmount: 0,
+		},
+		{
+			name:                  "Expired Authorization",
+			setupPayments:         []models.PaymentDetails{authorizedPayment("PAY-12345", now)},
+			paymentID:             "PAY-12345",
+			expectedStatusCode:    http.StatusConflict,
+			expectedResponse:      "Authorization has expired",
+			expectedPaymentStatus: "payment_expired",
+		},
+		{
+			name:               "Non-Existent Payment",
+			setupPayments:      []models.PaymentDetails{},
+			paymentID:          "PAY-99999",
+			expectedStatusCode: http.StatusNotFound,
+			expectedResponse:   "Payment not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := seedPayments(t, tt.setupPayments)
+			app.Clock = func() time.Time { return now }
+
+			router := gin.New()
+			router.POST("/api/v1/payments/:id/captures", app.CapturePayment)
+
+			req, _ := http.NewRequest("POST", "/api/v1/payments/"+tt.paymentID+"/captures", bytes.NewBufferString(tt.body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+
+			if rr.Code == http.StatusCreated {
+				var response models.CaptureResponse
+				err := json.Unmarshal(rr.Body.Bytes(), &response)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedResponse, string(response.Status))
+				assert.Equal(t, money.New(tt.expectedCapturedAmount, "USD"), response.Amount)
+			} else {
+				var errorResponse utils.ErrorResponse
+				err := json.Unmarshal(rr.Body.Bytes(), &errorResponse)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedResponse, errorResponse.Message)
+			}
+
+			if tt.expectedPaymentStatus != "" {
+				payment, err := app.Payments.GetPayment(context.Background(), tt.paymentID)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedPaymentStatus, payment.Status)
+				assert.Equal(t, money.New(tt.expectedCapturedAmount, "USD"), payment.CapturedAmount)
+			}
+		})
+	}
+}
+
+func TestCaptureNotGoingThrough(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name                   string
+		response               bank.Response
+		err                    error
+		expectedStatusCode     int
+		expectedStatus         models.PaymentStatus
+		expectedCapturedAmount int64
+		expectedVoidStatusCode int
+	}{
+		{"Declined", bank.Response{StatusCode: bank.CodeDoNotHonour, Summary: "Declined - Do not honour"}, nil, http.StatusPaymentRequired, "payment_authorized", 0, http.StatusCreated},
+		{"Rejected", bank.Response{}, fmt.Errorf("%w with status 422: %w", bank.ErrRejected, bank.ErrSystemMalfunction), http.StatusBadGateway, "payment_authorized", 0, http.StatusCreated},
+		{"Timed Out", bank.Response{}, bank.ErrTimeout, http.StatusGatewayTimeout, "payment_capturing", 20000, http.StatusConflict},
+		{"Malfunction", bank.Response{}, bank.ErrSystemMalfunction, http.StatusBadGateway, "payment_capturing", 20000, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := seedPayments(t, []models.PaymentDetails{authorizedPayment("PAY-12345", now.Add(time.Hour))})
+			app.Clock = func() time.Time { return now }
+			app.Bank = captureBank{AcquiringBank: app.Bank, response: tt.response, err: tt.err}
+
+			router := gin.New()
+			router.POST("/api/v1/payments/:id/captures", app.CapturePayment)
+			router.POST("/api/v1/payments/:id/voids", app.VoidPayment)
+
+			req, _ := http.NewRequest("POST", "/api/v1/payments/PAY-12345/captures", bytes.NewBufferString(""))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+
+			var response models.CaptureResponse
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			assert.Equal(t, tt.expectedStatus, response.Status)
+
+			// A capture the bank turned down leaves the payment authorized, so the funds can be released, while one
+			// that may have gone through leaves it capturing until it is reconciled
+			payment, err := app.Payments.GetPayment(context.Background(), "PAY-12345")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, payment.Status)
+			assert.Equal(t, money.New(tt.expectedCapturedAmount, "USD"), payment.CapturedAmount)
+
+			req, _ = http.NewRequest("POST", "/api/v1/payments/PAY-12345/voids", bytes.NewBufferString(""))
+			rr = httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, tt.expectedVoidStatusCode, rr.Code)
+		})
+	}
+}
+
+func TestConcurrentCaptures(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	var calls atomic.Int32
+	capturer := captureBank{
+		response: bank.Response{Approved: true, StatusCode: bank.CodeApproved, Summary: "Approved"},
+		calls:    &calls,
+		started:  make(chan struct{}, 1),
+		release:  make(chan struct{}),
+	}
+
+	app := seedPayments(t, []models.PaymentDetails{authorizedPayment("PAY-12345", now.Add(time.Hour))})
+	app.Clock = func() time.Time { return now }
+	app.Bank = capturer
+
+	router := gin.New()
+	router.POST("/api/v1/payments/:id/captures", app.CapturePayment)
+	router.POST("/api/v1/payments/:id/voids", app.VoidPayment)
+
+	send := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", path, bytes.NewBufferString(""))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- send("/api/v1/payments/PAY-12345/captures") }()
+	<-capturer.started
+
+	// While the first capture is with the bank, the payment can be neither captured nor voided again
+	assert.Equal(t, http.StatusConflict, send("/api/v1/payments/PAY-12345/captures").Code)
+	assert.Equal(t, http.StatusConflict, send("/api/v1/payments/PAY-12345/voids").Code)
+
+	close(capturer.release)
+	assert.Equal(t, http.StatusCreated, (<-first).Code)
+	assert.Equal(t, int32(1), calls.Load())
+
+	payment, err := app.Payments.GetPayment(context.Background(), "PAY-12345")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusPaid, payment.Status)
+	assert.Equal(t, money.New(20000, "USD"), payment.CapturedAmount)
+}
+
+func TestCaptureFailsAfterAuthorization(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name                   string
+		err                    error
+		expectedStatusCode     int
+		expectedStatus         models.PaymentStatus
+		expectedVoidStatusCode int
+	}{
+		{"Rejected", fmt.Errorf("%w with status 422: %w", bank.ErrRejected, bank.ErrSystemMalfunction), http.StatusBadGateway, "payment_authorized", http.StatusCreated},
+		{"Timed Out", bank.ErrTimeout, http.StatusGatewayTimeout, "payment_capturing", http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := setupTestApp()
+			app.AuthorizationTTL = 24 * time.Hour
+			app.Clock = func() time.Time { return now }
+			app.Bank = captureBank{AcquiringBank: app.Bank, err: tt.err}
+
+			router := gin.New()
+			router.POST("/api/v1/payments", app.ProcessPayment)
+			router.POST("/api/v1/payments/:id/voids", app.VoidPayment)
+
+			reqBody, _ := json.Marshal(models.ProcessPaymentRequest{
+				FirstName:    "John",
+				LastName:     "Doe",
+				CardNumber:   "4242424242424242",
+				ExpiryDate:   "12/29",
+				Amount:       money.New(10000, "USD"),
+				CurrencyCode: "USD",
+				CVV:          "123",
+			})
+			req, _ := http.NewRequest("POST", "/api/v1/payments", bytes.NewBuffer(reqBody))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+
+			var response models.ProcessPaymentResponse
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			assert.Equal(t, tt.expectedStatus, response.Status)
+
+			// The authorization is kept, so that the funds held on the card can be captured or released once the
+			// outcome of the capture is known
+			payment, err := app.Payments.GetPayment(context.Background(), response.ID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, payment.Status)
+			assert.Equal(t, now.Add(24*time.Hour), *payment.AuthorizationExpiresAt)
+
+			req, _ = http.NewRequest("POST", "/api/v1/payments/"+response.ID+"/voids", bytes.NewBufferString(""))
+			rr = httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, tt.expectedVoidStatusCode, rr.Code)
+		})
+	}
+}
+
+func TestReconcileCaptures(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name                   string
+		response               bank.Response
+		err                    error
+		expectedSettled        int
+		expectedStatus         models.PaymentStatus
+		expectedCapturedAmount int64
+	}{
+		{
+			name:                   "Capture Went Through",
+			response:               bank.Response{Approved: true, StatusCode: bank.CodeApproved, Summary: "Approved"},
+			expectedSettled:        1,
+			expectedStatus:         "payment_paid",
+			expectedCapturedAmount: 20000,
+		},
+		{
+			name:                   "Capture Declined",
+			response:               bank.Response{StatusCode: bank.CodeDoNotHonour, Summary: "Declined - Do not honour"},
+			expectedSettled:        1,
+			expectedStatus:         "payment_authorized",
+			expectedCapturedAmount: 0,
+		},
+		{
+			name:                   "Capture Rejected",
+			err:                    fmt.Errorf("%w with status 422: %w", bank.ErrRejected, bank.ErrSystemMalfunction),
+			expectedSettled:        1,
+			expectedStatus:         "payment_authorized",
+			expectedCapturedAmount: 0,
+		},
+		{
+			name:                   "Bank Still Failing",
+			err:                    bank.ErrTimeout,
+			expectedSettled:        0,
+			expectedStatus:         "payment_capturing",
+			expectedCapturedAmount: 20000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := seedPayments(t, []models.PaymentDetails{authorizedPayment("PAY-12345", now.Add(time.Hour))})
+			app.Clock = func() time.Time { return now }
+			app.Bank = captureBank{AcquiringBank: app.Bank, err: bank.ErrTimeout}
+
+			router := gin.New()
+			router.POST("/api/v1/payments/:id/captures", app.CapturePayment)
+
+			req, _ := http.NewRequest("POST", "/api/v1/payments/PAY-12345/captures", bytes.NewBufferString(""))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			require.Equal(t, http.StatusGatewayTimeout, rr.Code)
+
+			// Captures started after the cut-off are still being made, so they are left alone
+			var calls atomic.Int32
+			app.Bank = captureBank{response: tt.response, err: tt.err, calls: &calls}
+
+			settled, err := app.ReconcileCaptures(context.Background(), now)
+			require.NoError(t, err)
+			assert.Equal(t, 0, settled)
+			assert.Equal(t, int32(0), calls.Load())
+
+			settled, err = app.ReconcileCaptures(context.Background(), now.Add(time.Minute))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedSettled, settled)
+			assert.Equal(t, int32(1), calls.Load())
+
+			payment, err := app.Payments.GetPayment(context.Background(), "PAY-12345")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, payment.Status)
+			assert.Equal(t, money.New(tt.expectedCapturedAmount, "USD"), payment.CapturedAmount)
+		})
+	}
+}
+
+func TestExpireAuthorizations(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	app := seedPayments(t, []models.PaymentDetails{
+		authorizedPayment("PAY-1", now.Add(-time.Minute)),
+		authorizedPayment("PAY-2", now.Add(time.Minute)),
+	})
+	app.Clock = func() time.Time { return now }
+
+	expired, err := app.ExpireAuthorizations(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, expired)
+
+	payment, _ := app.Payments.GetPayment(context.Background(), "PAY-1")
+	assert.Equal(t, models.StatusExpired, payment.Status)
+	payment, _ = app.Payments.GetPayment(context.Background(), "PAY-2")
+	assert.Equal(t, models.StatusAuthorized, payment.Status)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/signing"
+	"github.com/Lionel-Wilson/payment-gateway/internal/storage"
+	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// RetrieveMerchant retrieves the merchant making the request.
+//
+// @Summary      Retrieve the Merchant
+// @Description  Retrieves the merchant that the API key used for the request belongs to.
+// @Tags         Merchants
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  Merchant
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /merchant [get]
+func (app *Application) RetrieveMerchant(c *gin.Context) {
+	id := merchantID(c)
+
+	merchant, err := app.Merchants.GetMerchant(c.Request.Context(), id)
+	if errors.Is(err, storage.ErrNotFound) {
+		utils.NewErrorResponse(c, http.StatusNotFound, "Merchant not found", nil)
+		return
+	} else if err != nil {
+		app.ErrorLog.Printf("failed to retrieve merchant %s: %v", id, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, merchant)
+}
+
+// CreateSigningSecret creates a signing secret for the merchant making the request, replacing any it already has.
+//
+// @Summary      Create a Signing Secret
+// @Description  Creates a secret for signing requests to the payments endpoints, replacing the merchant's current
+// @Description  secret, which stops working immediately. The secret is only returned in this response, and not when it
+// @Description  is replayed for an Idempotency-Key, so it must be stored safely by the merchant.
+// @Tags         Merchants
+// @Accept       json
+// @Produce      json
+// @Success      201  {object}  SigningSecret
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /merchant/signing-secret [post]
+func (app *Application) CreateSigningSecret(c *gin.Context) {
+	id := merchantID(c)
+
+	secret, err := signing.NewSecret()
+	if err != nil {
+		app.ErrorLog.Printf("failed to generate signing secret for merchant %s: %v", id, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	err = app.Merchants.SetSigningSecret(c.Request.Context(), id, secret)
+	if errors.Is(err, storage.ErrNotFound) {
+		utils.NewErrorResponse(c, http.StatusNotFound, "Merchant not found", nil)
+		return
+	} else if err != nil {
+		app.ErrorLog.Printf("failed to set signing secret for merchant %s: %v", id, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	response := models.SigningSecret{Secret: secret, CreatedAt: app.now().UTC()}
+	app.secretJSON(c, http.StatusCreated, response, response.Redacted())
+}
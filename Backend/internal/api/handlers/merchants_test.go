@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupMerchantRouter returns a router serving the payment and refund endpoints on behalf of the given merchant.
+func setupMerchantRouter(app *Application, merchantID string) *gin.Engine {
+	router := gin.New()
+	router.GET("/api/v1/merchant", asMerchant(merchantID, app.RetrieveMerchant))
+	router.POST("/api/v1/merchant/signing-secret", asMerchant(merchantID, app.CreateSigningSecret))
+	router.POST("/api/v1/payments", asMerchant(merchantID, app.ProcessPayment))
+	router.GET("/api/v1/payments", asMerchant(merchantID, app.AllPayments))
+	router.GET("/api/v1/payments/:id", asMerchant(merchantID, app.RetrievePayment))
+	router.POST("/api/v1/payments/:id/captures", asMerchant(merchantID, app.CapturePayment))
+	router.POST("/api/v1/payments/:id/voids", asMerchant(merchantID, app.VoidPayment))
+	router.POST("/api/v1/payments/:id/refunds", asMerchant(merchantID, app.RefundPayment))
+	router.GET("/api/v1/payments/:id/refunds", asMerchant(merchantID, app.ListRefunds))
+	router.GET("/api/v1/payments/:id/refunds/:refundId", asMerchant(merchantID, app.RetrieveRefund))
+
+	return router
+}
+
+func TestRetrieveMerchant(t *testing.T) {
+	app := setupTestApp()
+	merchant := models.Merchant{ID: "merchant-1", Name: "Acme Ltd", CreatedAt: testNow}
+	require.NoError(t, app.Merchants.CreateMerchant(context.Background(), merchant))
+
+	rr := sendAPIKeyRequest(setupMerchantRouter(app, "merchant-1"), "GET", "/api/v1/merchant", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response models.Merchant
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, merchant, response)
+
+	rr = sendAPIKeyRequest(setupMerchantRouter(app, "merchant-404"), "GET", "/api/v1/merchant", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestCreateSigningSecret(t *testing.T) {
+	app := setupTestApp()
+	require.NoError(t, app.Merchants.CreateMerchant(context.Background(), models.Merchant{ID: "merchant-1", CreatedAt: testNow}))
+	router := setupMerchantRouter(app, "merchant-1")
+
+	var secrets []string
+	for i := 0; i < 2; i++ {
+		rr := sendAPIKeyRequest(router, "POST", "/api/v1/merchant/signing-secret", "")
+		require.Equal(t, http.StatusCreated, rr.Code)
+
+		var response models.SigningSecret
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.Regexp(t, `^sig_[0-9a-f]{64}$`, response.Secret)
+		assert.Equal(t, testNow, response.CreatedAt)
+		secrets = append(secrets, response.Secret)
+	}
+
+	// The second secret replaces the first
+	assert.NotEqual(t, secrets[0], secrets[1])
+	merchant, err := app.Merchants.GetMerchant(context.Background(), "merchant-1")
+	require.NoError(t, err)
+	assert.Equal(t, secrets[1], merchant.SigningSecret)
+
+	// The secret is never returned with the merchant
+	rr := sendAPIKeyRequest(router, "GET", "/api/v1/merchant", "")
+	assert.NotContains(t, rr.Body.String(), secrets[1])
+
+	rr = sendAPIKeyRequest(setupMerchantRouter(app, "merchant-404"), "POST", "/api/v1/merchant/signing-secret", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	t.Run("Redacted Response", func(t *testing.T) {
+		var redacted []byte
+		router := gin.New()
+		router.POST("/api/v1/merchant/signing-secret", asMerchant("merchant-1", app.CreateSigningSecret), func(c *gin.Context) {
+			redacted = c.MustGet(RedactedResponseKey).([]byte)
+		})
+
+		rr := sendAPIKeyRequest(router, "POST", "/api/v1/merchant/signing-secret", "")
+		require.Equal(t, http.StatusCreated, rr.Code)
+
+		var response models.SigningSecret
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.NotContains(t, string(redacted), response.Secret)
+		assert.JSONEq(t, `{"createdAt":"`+testNow.Format(time.RFC3339)+`"}`, string(redacted))
+	})
+}
+
+func TestMerchantIsolation(t *testing.T) {
+	app := setupTestApp()
+	owner := setupMerchantRouter(app, "merchant-1")
+	other := setupMerchantRouter(app, "merchant-2")
+
+	send := func(router *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := send(owner, "POST", "/api/v1/payments", `{
+		"firstName": "John", "lastName": "Doe", "cardNumber": "4111111111111111", "expiryDate": "12/29",
+		"amount": {"value": 10000, "currency": "USD"}, "cvv": "123"
+	}`)
+	require.Equal(t, http.StatusCreated, rr.Code)
+
+	var payment models.ProcessPaymentResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &payment))
+
+	stored, err := app.Payments.GetPayment(context.Background(), payment.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "merchant-1", stored.MerchantID)
+
+	rr = send(owner, "POST", "/api/v1/payments/"+payment.ID+"/refunds", `{"amount": 10}`)
+	require.Equal(t, http.StatusCreated, rr.Code)
+
+	var refund models.Refund
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &refund))
+
+	storedRefund, err := app.Refunds.GetRefund(context.Background(), refund.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "merchant-1", storedRefund.MerchantID)
+
+	// Another merchant cannot tell the payment exists
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{"GET", "/api/v1/payments", ""},
+		{"GET", "/api/v1/payments/" + payment.ID, ""},
+		{"POST", "/api/v1/payments/" + payment.ID + "/captures", ""},
+		{"POST", "/api/v1/payments/" + payment.ID + "/voids", ""},
+		{"POST", "/api/v1/payments/" + payment.ID + "/refunds", `{"amount": 10}`},
+		{"GET", "/api/v1/payments/" + payment.ID + "/refunds", ""},
+		{"GET", "/api/v1/payments/" + payment.ID + "/refunds/" + refund.ID, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			assert.Equal(t, http.StatusNotFound, send(other, tt.method, tt.path, tt.body).Code)
+		})
+	}
+
+	rr = send(owner, "GET", "/api/v1/payments", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var paymentsList []models.PaymentDetails
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &paymentsList))
+	if assert.Len(t, paymentsList, 1) {
+		assert.Equal(t, payment.ID, paymentsList[0].ID)
+	}
+
+	rr = send(owner, "GET", "/api/v1/payments/"+payment.ID+"/refunds/"+refund.ID, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/oauth"
+	"github.com/Lionel-Wilson/payment-gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// IssueAccessToken issues an access token to an OAuth client with the client credentials grant.
+//
+// @Summary      Issue an Access Token
+// @Description  Issues a short-lived access token to a platform partner acting on behalf of one of its merchants,
+// @Description  using the OAuth 2.0 client credentials grant. The client authenticates with HTTP Basic
+// @Description  authentication or the client_id and client_secret parameters. The token grants the requested scopes,
+// @Description  or every scope of the client when none are requested, and is sent as a bearer token like an API key.
+// @Tags         OAuth
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Param        grant_type     formData  string  true   "Must be client_credentials"
+// @Param        scope          formData  string  false  "Space-separated scopes, e.g. payments:write payments:read"
+// @Param        merchant_id    formData  string  false  "The merchant to act on behalf of. Required when the client acts for several merchants"
+// @Param        client_id      formData  string  false  "The client ID, when not using HTTP Basic authentication"
+// @Param        client_secret  formData  string  false  "The client secret, when not using HTTP Basic authentication"
+// @Success      200  {object}  AccessTokenResponse
+// @Failure      400  {object}  OAuthErrorResponse
+// @Failure      401  {object}  OAuthErrorResponse
+// @Failure      500  {object}  OAuthErrorResponse
+// @Failure      503  {object}  OAuthErrorResponse
+// @Router       /oauth/token [post]
+func (app *Application) IssueAccessToken(c *gin.Context) {
+	// Token responses must never be cached
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	if app.AccessTokens == nil {
+		oauthError(c, http.StatusServiceUnavailable, "temporarily_unavailable", "Access tokens are not enabled")
+		return
+	}
+
+	clientID, secret, ok := c.Request.BasicAuth()
+	if !ok {
+		clientID, secret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+	if clientID == "" || secret == "" {
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "Missing client credentials")
+		return
+	}
+
+	switch grantType := c.PostForm("grant_type"); grantType {
+	case "client_credentials":
+	case "":
+		oauthError(c, http.StatusBadRequest, "invalid_request", "grant_type is required")
+		return
+	default:
+		oauthError(c, http.StatusBadRequest, "unsupported_grant_type", "Only the client_credentials grant is supported")
+		return
+	}
+
+	client, err := app.OAuthClients.GetOAuthClient(c.Request.Context(), clientID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		app.ErrorLog.Printf("failed to retrieve OAuth client %s: %v", clientID, err)
+		oauthError(c, http.StatusInternalServerError, "server_error", "Something went wrong. Please try again later.")
+		return
+	}
+	if err != nil || client.RevokedAt != nil ||
+		subtle.ConstantTimeCompare([]byte(oauth.HashSecret(secret)), []byte(client.SecretHash)) != 1 {
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "Invalid client credentials")
+		return
+	}
+
+	scopes, err := oauth.ParseScope(c.PostForm("scope"))
+	if err != nil {
+		oauthError(c, http.StatusBadRequest, "invalid_scope", "Unknown scope")
+		return
+	}
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	for _, scope := range scopes {
+		if !oauth.Contains(client.Scopes, scope) {
+			oauthError(c, http.StatusBadRequest, "invalid_scope", "The client cannot be granted "+string(scope))
+			return
+		}
+	}
+
+	merchantID := c.PostForm("merchant_id")
+	if merchantID == "" && len(client.MerchantIDs) == 1 {
+		merchantID = client.MerchantIDs[0]
+	}
+	if merchantID == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "merchant_id is required")
+		return
+	}
+	if !contains(client.MerchantIDs, merchantID) {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "The client cannot act on behalf of merchant "+merchantID)
+		return
+	}
+
+	token, _, err := app.AccessTokens.Issue(client.ID, merchantID, scopes, app.now())
+	if err != nil {
+		app.ErrorLog.Printf("failed to issue access token to OAuth client %s: %v", client.ID, err)
+		oauthError(c, http.StatusInternalServerError, "server_error", "Something went wrong. Please try again later.")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.AccessTokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(app.AccessTokens.TTL().Seconds()),
+		Scope:       oauth.FormatScope(scopes),
+	})
+}
+
+// oauthError sends an error response in the format defined by RFC 6749, which OAuth client libraries expect from the
+// token endpoint instead of the gateway's usual error responses.
+func oauthError(c *gin.Context, status int, code, description string) {
+	c.JSON(status, models.OAuthErrorResponse{Error: code, ErrorDescription: description})
+}
+
+// contains reports whether values contains value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
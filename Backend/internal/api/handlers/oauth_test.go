@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/oauth"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssueAccessToken(t *testing.T) {
+	app := setupTestApp()
+	ctx := context.Background()
+
+	// createClient stores an OAuth client and returns its secret
+	createClient := func(id string, scopes []oauth.Scope, merchantIDs []string, revoked bool) string {
+		secret, err := oauth.GenerateSecret()
+		require.NoError(t, err)
+
+		client := models.OAuthClient{
+			ID: id, Name: id, SecretHash: oauth.HashSecret(secret), Scopes: scopes, MerchantIDs: merchantIDs, CreatedAt: testNow,
+		}
+		if revoked {
+			client.RevokedAt = &testNow
+		}
+		require.NoError(t, app.OAuthClients.CreateOAuthClient(ctx, client))
+
+		return secret
+	}
+
+	allScopes := []oauth.Scope{oauth.PaymentsWrite, oauth.PaymentsRead}
+	partnerSecret := createClient("CLI-1", allScopes, []string{"merchant-1", "merchant-2"}, false)
+	singleSecret := createClient("CLI-2", []oauth.Scope{oauth.PaymentsRead}, []string{"merchant-1"}, false)
+	revokedSecret := createClient("CLI-3", allScopes, []string{"merchant-1"}, true)
+
+	router := gin.New()
+	router.POST("/oauth/token", app.IssueAccessToken)
+
+	tests := []struct {
+		name               string
+		basicAuth          []string
+		form               url.Values
+		expectedStatusCode int
+		expectedError      string
+		expectedMerchantID string
+		expectedScope      string
+	}{
+		{
+			name:               "Basic Authentication",
+			basicAuth:          []string{"CLI-1", partnerSecret},
+			form:               url.Values{"grant_type": {"client_credentials"}, "merchant_id": {"merchant-2"}, "scope": {"payments:read"}},
+			expectedStatusCode: http.StatusOK,
+			expectedMerchantID: "merchant-2",
+			expectedScope:      "payments:read",
+		},
+		{
+			name:               "Credentials In Form",
+			form:               url.Values{"grant_type": {"client_credentials"}, "client_id": {"CLI-1"}, "client_secret": {partnerSecret}, "merchant_id": {"merchant-1"}},
+			expectedStatusCode: http.StatusOK,
+			expectedMerchantID: "merchant-1",
+			expectedScope:      "payments:write payments:read",
+		},
+		{
+			name:               "Only Merchant Is Implied",
+			basicAuth:          []string{"CLI-2", singleSecret},
+			form:               url.Values{"grant_type": {"client_credentials"}},
+			expectedStatusCode: http.StatusOK,
+			expectedMerchantID: "merchant-1",
+			expectedScope:      "payments:read",
+		},
+		{
+			name:               "Missing Merchant",
+			basicAuth:          []string{"CLI-1", partnerSecret},
+			form:               url.Values{"grant_type": {"client_credentials"}},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedError:      "invalid_request",
+		},
+		{
+			name:               "Other Merchant",
+			basicAuth:          []string{"CLI-2", singleSecret},
+			form:               url.Values{"grant_type": {"client_credentials"}, "merchant_id": {"merchant-2"}},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedError:      "invalid_request",
+		},
+		{
+			name:               "Scope Not Granted To Client",
+			basicAuth:          []string{"CLI-2", singleSecret},
+			form:               url.Values{"grant_type": {"client_credentials"}, "scope": {"payments:read payments:write"}},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedError:      "invalid_scope",
+		},
+		{
+			name:               "Unknown Scope",
+			basicAuth:          []string{"CLI-1", partnerSecret},
+			form:               url.Values{"grant_type": {"client_credentials"}, "merchant_id": {"merchant-1"}, "scope": {"admin"}},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedError:      "invalid_scope",
+		},
+		{
+			name:               "Unsupported Grant",
+			basicAuth:          []string{"CLI-1", partnerSecret},
+			form:               url.Values{"grant_type": {"password"}},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedError:      "unsupported_grant_type",
+		},
+		{
+			name:               "Missing Grant",
+			basicAuth:          []string{"CLI-1", partnerSecret},
+			form:               url.Values{},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedError:      "invalid_request",
+		},
+		{
+			name:               "Wrong Secret",
+			basicAuth:          []string{"CLI-1", singleSecret},
+			form:               url.Values{"grant_type": {"client_credentials"}},
+			expectedStatusCode: http.StatusUnauthorized,
+			expectedError:      "invalid_client",
+		},
+		{
+			name:               "Unknown Client",
+			basicAuth:          []string{"CLI-404", partnerSecret},
+			form:               url.Values{"grant_type": {"client_credentials"}},
+			expectedStatusCode: http.StatusUnauthorized,
+			expectedError:      "invalid_client",
+		},
+		{
+			name:               "Revoked Client",
+			basicAuth:          []string{"CLI-3", revokedSecret},
+			form:               url.Values{"grant_type": {"client_credentials"}},
+			expectedStatusCode: http.StatusUnauthorized,
+			expectedError:      "invalid_client",
+		},
+		{
+			name:               "Missing Credentials",
+			form:               url.Values{"grant_type": {"client_credentials"}},
+			expectedStatusCode: http.StatusUnauthorized,
+			expectedError:      "invalid_client",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/oauth/token", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.basicAuth != nil {
+				req.SetBasicAuth(tt.basicAuth[0], tt.basicAuth[1])
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+			assert.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+
+			if tt.expectedStatusCode != http.StatusOK {
+				var response models.OAuthErrorResponse
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+				assert.Equal(t, tt.expectedError, response.Error)
+				return
+			}
+
+			var response models.AccessTokenResponse
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			assert.Equal(t, "Bearer", response.TokenType)
+			assert.Equal(t, 900, response.ExpiresIn)
+			assert.Equal(t, tt.expectedScope, response.Scope)
+
+			clientID := tt.form.Get("client_id")
+			if tt.basicAuth != nil {
+				clientID = tt.basicAuth[0]
+			}
+
+			claims, err := app.AccessTokens.Verify(response.AccessToken, testNow.Add(time.Minute))
+			require.NoError(t, err)
+			assert.Equal(t, clientID, claims.Subject)
+			assert.Equal(t, tt.expectedMerchantID, claims.MerchantID)
+			assert.Equal(t, tt.expectedScope, claims.Scope)
+		})
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		app.AccessTokens = nil
+		defer func() { app.AccessTokens = setupTestApp().AccessTokens }()
+
+		req, _ := http.NewRequest("POST", "/oauth/token", strings.NewReader("grant_type=client_credentials"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth("CLI-1", partnerSecret)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	})
+}
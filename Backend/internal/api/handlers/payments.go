@@ -1,33 +1,63 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
 	"github.com/Lionel-Wilson/payment-gateway/internal/api/validators"
+	"github.com/Lionel-Wilson/payment-gateway/internal/bank"
+	"github.com/Lionel-Wilson/payment-gateway/internal/card"
+	"github.com/Lionel-Wilson/payment-gateway/internal/currency"
+	"github.com/Lionel-Wilson/payment-gateway/internal/money"
+	"github.com/Lionel-Wilson/payment-gateway/internal/storage"
 	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 )
 
-var (
-	validate *validator.Validate              // Validator for struct validation
-	payments map[string]models.PaymentDetails // In-memory store for payment details
-	mu       sync.Mutex                       // Mutex to ensure thread-safe access to the payments map
+var validate *validator.Validate // Validator for struct validation
+
+const (
+	// MerchantIDKey is the gin context key holding the ID of the merchant making a request.
+	MerchantIDKey = "merchantID"
+	// APIKeyKey is the gin context key holding the models.APIKey a request was authenticated with.
+	APIKeyKey = "apiKey"
+	// AccessTokenKey is the gin context key holding the oauth.Claims of the access token a request was authenticated
+	// with.
+	AccessTokenKey = "accessToken"
+	// UserKey is the gin context key holding the models.User of the dashboard session a request was authenticated with.
+	UserKey = "user"
+	// SessionKey is the gin context key holding the models.Session a request was authenticated with.
+	SessionKey = "session"
+	// RedactedResponseKey is the gin context key holding the JSON body, without its secret, of a response that carries
+	// a secret. It is stored and replayed in place of the response, so that the secret is only ever sent once.
+	RedactedResponseKey = "redactedResponse"
+	// BankContactedKey is the gin context key set once a request has asked the acquiring bank to act. From then on the
+	// request may have moved funds even if it fails, so it must not be processed again.
+	BankContactedKey = "bankContacted"
 )
 
 func init() {
 	validate = validator.New()
 	validate.RegisterValidation("expirydate", validators.ExpiryDateValidation)
-	payments = make(map[string]models.PaymentDetails)
+	validate.RegisterValidationCtx("unexpired", validators.UnexpiredValidation)
+	validate.RegisterValidationCtx("expirylimit", validators.ExpiryLimitValidation)
+	validate.RegisterValidation("currency", validators.CurrencyValidation)
+	validate.RegisterValidation("cardnumber", validators.CardNumberValidation)
+	validate.RegisterValidation("cvv", validators.CVVValidation)
+	validate.RegisterCustomTypeFunc(validators.MoneyValue, money.Money{})
 }
 
 // ProcessPayment handles the processing of a payment.
 //
 // @Summary      Process a Payment
-// @Description  Processes a payment through the payment gateway.
+// @Description  Processes a payment through the payment gateway. Set capture to false to only authorize the payment
+// @Description  and capture it later.
 // @Tags         Payments
 // @Accept       json
 // @Produce      json
@@ -36,6 +66,8 @@ func init() {
 // @Failure      402  {object}  ErrorResponse
 // @Failure      422  {object}  ErrorResponse
 // @Failure      500  {object}  ErrorResponse
+// @Failure      502  {object}  ProcessPaymentResponse
+// @Failure      504  {object}  ProcessPaymentResponse
 // @Router       /payments [post]
 func (app *Application) ProcessPayment(c *gin.Context) {
 	var paymentDetails models.ProcessPaymentRequest
@@ -45,26 +77,73 @@ func (app *Application) ProcessPayment(c *gin.Context) {
 		return
 	}
 
-	response, err := createPayment(&paymentDetails)
+	// Trim whitespace from payment details
+	utils.TrimWhitespace(&paymentDetails)
+
+	// A token stands in for card details stored in the vault
+	if paymentDetails.Token != "" && !app.useToken(c, &paymentDetails) {
+		return
+	}
+
+	paymentDetails.ExpiryDate = expiryDate(paymentDetails.ExpiryDate, paymentDetails.ExpiryMonth, paymentDetails.ExpiryYear)
+
+	// The currency may be given with an amount in minor units instead of separately
+	if paymentDetails.CurrencyCode == "" {
+		paymentDetails.CurrencyCode = paymentDetails.Amount.Currency
+	}
+	paymentDetails.CurrencyCode = strings.ToUpper(paymentDetails.CurrencyCode)
+
+	if currency.IsValid(paymentDetails.CurrencyCode) && !app.Currencies.For(merchantID(c)).Allows(paymentDetails.CurrencyCode) {
+		utils.NewErrorResponse(c, http.StatusUnprocessableEntity, "Validation failed", []string{fmt.Sprintf("CurrencyCode %s is not accepted", paymentDetails.CurrencyCode)})
+		return
+	}
+
+	amount, ok := resolveAmount(c, paymentDetails.Amount, paymentDetails.CurrencyCode)
+	if !ok {
+		return
+	}
+	paymentDetails.Amount = amount
+
+	response, err := app.createPayment(c.Request.Context(), merchantID(c), &paymentDetails, func() { contactingBank(c) })
 	if err != nil {
-		errMsg := validators.TranslateValidationErrors(err)
-		utils.NewErrorResponse(c, http.StatusUnprocessableEntity, "Validation failed", errMsg)
+		var validationErrs validator.ValidationErrors
+		if errors.As(err, &validationErrs) {
+			errMsg := validators.TranslateValidationErrors(err)
+			utils.NewErrorResponse(c, http.StatusUnprocessableEntity, "Validation failed", errMsg)
+			return
+		}
+
+		app.ErrorLog.Printf("failed to create payment: %v", err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
 		return
 	}
 
-	if response.Status == "payment_paid" {
+	switch response.Status {
+	case models.StatusPaid:
 		c.JSON(http.StatusCreated, response)
-	} else if response.Status == "payment_declined" {
+	case models.StatusAuthorized:
+		// A payment to be captured straight away is left authorized when the capture does not go through
+		if paymentDetails.Capture != nil && !*paymentDetails.Capture {
+			c.JSON(http.StatusCreated, response)
+		} else {
+			c.JSON(captureFailureStatus(response.StatusCode), response)
+		}
+	case models.StatusCapturing:
+		c.JSON(bankFailureStatus(response.StatusCode), response)
+	case models.StatusDeclined:
 		c.JSON(http.StatusPaymentRequired, response)
-	} else {
+	case models.StatusFailed:
+		c.JSON(bankFailureStatus(response.StatusCode), response)
+	default:
 		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
 	}
 }
 
-// RetrievePayment retrieves the details of a previously made payment using its identifier.
+// RetrievePayment retrieves the details of a payment made by the merchant making the request using its identifier.
 //
 // @Summary      Retrieve Payment Details
-// @Description  Retrieves the details of a previously made payment using its identifier.
+// @Description  Retrieves the details of a previously made payment using its identifier. Payments made by other
+// @Description  merchants are not found.
 // @Tags         Payments
 // @Accept       json
 // @Produce      json
@@ -79,24 +158,18 @@ func (app *Application) RetrievePayment(c *gin.Context) {
 		return
 	}
 
-	id = strings.TrimSpace(id)
-
-	mu.Lock()
-	payment, exists := payments[id]
-	mu.Unlock()
-
-	if !exists {
-		utils.NewErrorResponse(c, http.StatusNotFound, "Payment not found", nil)
+	payment, ok := app.findPayment(c, strings.TrimSpace(id))
+	if !ok {
 		return
 	}
 
 	c.JSON(http.StatusOK, payment)
 }
 
-// AllPayments retrieves the details of all previously made payments.
+// AllPayments retrieves the details of all payments made by the merchant making the request.
 //
 // @Summary      Retrieve all payments
-// @Description  Retrieves the details of all previously made payments.
+// @Description  Retrieves the details of all payments previously made by the merchant.
 // @Tags         Payments
 // @Accept       json
 // @Produce      json
@@ -104,58 +177,288 @@ func (app *Application) RetrievePayment(c *gin.Context) {
 // @Failure      404  {object}  ErrorResponse
 // @Router       /payments [get]
 func (app *Application) AllPayments(c *gin.Context) {
-	mu.Lock()
-	defer mu.Unlock()
-
-	if len(payments) == 0 {
-		utils.NewErrorResponse(c, http.StatusNotFound, "No payments available", nil)
+	paymentsList, err := app.Payments.ListPayments(c.Request.Context(), merchantID(c))
+	if err != nil {
+		app.ErrorLog.Printf("failed to list payments: %v", err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
 		return
 	}
 
-	paymentsList := []models.PaymentDetails{}
-	for _, payment := range payments {
-		paymentsList = append(paymentsList, payment)
+	if len(paymentsList) == 0 {
+		utils.NewErrorResponse(c, http.StatusNotFound, "No payments available", nil)
+		return
 	}
 
 	c.JSON(http.StatusOK, paymentsList)
 }
 
-func createPayment(paymentDetails *models.ProcessPaymentRequest) (models.ProcessPaymentResponse, error) {
-	// Trim whitespace from payment details
-	utils.TrimWhitespace(paymentDetails)
-
+// createPayment validates and processes a payment on behalf of the given merchant.
+func (app *Application) createPayment(ctx context.Context, merchantID string, paymentDetails *models.ProcessPaymentRequest, contactingBank func()) (models.ProcessPaymentResponse, error) {
 	// Validate payment details
-	err := validate.Struct(paymentDetails)
+	err := app.validateCard(ctx, paymentDetails)
 	if err != nil {
 		return models.ProcessPaymentResponse{}, err
 	}
 
-	// Simulate bank processing
-	id, status, statusCode, summary := utils.SimulateBank()
+	// Expiry dates are stored and sent to the bank in MM/YY format
+	expiry, _ := card.ParseExpiry(paymentDetails.ExpiryDate)
+
+	id := newPaymentID()
+	capture := paymentDetails.Capture == nil || *paymentDetails.Capture
+	brand, _ := card.Detect(paymentDetails.CardNumber)
+	issuer, _ := app.lookupBIN(paymentDetails.CardNumber)
+
+	// Record the payment before contacting the bank, so that it is never lost once the card may have been charged
+	payment := models.PaymentDetails{
+		ID:             id,
+		MerchantID:     merchantID,
+		FirstName:      paymentDetails.FirstName,
+		LastName:       paymentDetails.LastName,
+		CardNumber:     utils.MaskCardNumber(paymentDetails.CardNumber),
+		CardBrand:      brand,
+		CardLast4:      card.Last4(paymentDetails.CardNumber),
+		CardIssuer:     issuer.Issuer,
+		CardCountry:    issuer.Country,
+		CardFunding:    issuer.Funding,
+		CardProduct:    issuer.Product,
+		ExpiryDate:     expiry.String(),
+		Amount:         paymentDetails.Amount,
+		CurrencyCode:   paymentDetails.CurrencyCode,
+		Status:         models.StatusPending,
+		CapturedAmount: money.New(0, paymentDetails.Amount.Currency),
+		RefundedAmount: money.New(0, paymentDetails.Amount.Currency),
+	}
+
+	err = app.Payments.CreatePayment(ctx, payment)
+	if err != nil {
+		return models.ProcessPaymentResponse{}, err
+	}
 
-	// Lock payments map before updating
-	mu.Lock()
-	defer mu.Unlock()
+	// Authorize the payment with the acquiring bank, capturing the funds straight away if requested
+	contactingBank()
+	authorization, err := app.Bank.Authorize(ctx, bank.AuthorizationRequest{
+		Reference: id,
+		Card: bank.Card{
+			Number:     paymentDetails.CardNumber,
+			ExpiryDate: expiry.String(),
+			CVV:        paymentDetails.CVV,
+			HolderName: paymentDetails.FirstName + " " + paymentDetails.LastName,
+		},
+		Amount: paymentDetails.Amount,
+	})
 
-	// Update payments map with new payment details
-	payments[id] = models.PaymentDetails{
-		ID:           id,
-		FirstName:    paymentDetails.FirstName,
-		LastName:     paymentDetails.LastName,
-		CardNumber:   utils.MaskCardNumber(paymentDetails.CardNumber),
-		ExpiryDate:   paymentDetails.ExpiryDate,
-		Amount:       paymentDetails.Amount,
-		CurrencyCode: paymentDetails.CurrencyCode,
-		Status:       status,
-		StatusCode:   statusCode,
+	bankResponse := authorization
+	captured, capturing := false, false
+	captureStartedAt := app.now().UTC()
+	if err == nil && authorization.Approved && capture {
+		// A capture the bank declines or rejects leaves the payment authorized, so that the funds held on the card can
+		// still be captured or voided later. One whose outcome is unknown leaves it capturing until it is reconciled.
+		captureResponse, captureErr := app.Bank.Capture(ctx, bank.CaptureRequest{
+			Reference:     id,
+			BankReference: authorization.BankReference,
+			Amount:        paymentDetails.Amount,
+		})
+
+		switch failure, failed := bankFailure(captureErr); {
+		case failed:
+			bankResponse = failure
+			capturing = !errors.Is(captureErr, bank.ErrRejected)
+		case captureErr != nil:
+			app.ErrorLog.Printf("failed to capture payment %s: %v", id, captureErr)
+			bankResponse = bank.Response{StatusCode: bank.CodeSystemMalfunction, Summary: bank.ErrSystemMalfunction.Summary}
+			capturing = true
+		default:
+			bankResponse = captureResponse
+			captured = captureResponse.Approved
+		}
+	}
+
+	processed := payment
+	processed.BankReference = authorization.BankReference
+
+	switch failure, failed := bankFailure(err); {
+	case failed:
+		processed.Status = models.StatusFailed
+		bankResponse = failure
+	case err != nil:
+		return models.ProcessPaymentResponse{}, fmt.Errorf("process payment %s with bank: %w", id, err)
+	case !authorization.Approved:
+		processed.Status = models.StatusDeclined
+	case captured:
+		processed.Status = models.StatusPaid
+		processed.CapturedAmount = paymentDetails.Amount
+	default:
+		processed.Status = models.StatusAuthorized
+		expiresAt := app.now().Add(app.AuthorizationTTL).UTC()
+		processed.AuthorizationExpiresAt = &expiresAt
+		if capturing {
+			processed.Status = models.StatusCapturing
+			processed.CapturedAmount = paymentDetails.Amount
+			processed.CaptureStartedAt = &captureStartedAt
+		}
+	}
+	processed.StatusCode = bankResponse.StatusCode
+	processed.ResponseSummary = bankResponse.Summary
+
+	if err := payment.Status.Transition(processed.Status); err != nil {
+		return models.ProcessPaymentResponse{}, err
+	}
+
+	// Persist the outcome of the payment
+	err = app.Payments.UpdatePayment(ctx, processed)
+	if err != nil {
+		return models.ProcessPaymentResponse{}, err
 	}
 
 	// Prepare response
 	response := models.ProcessPaymentResponse{
 		ID:              id,
-		Status:          status,
-		ResponseSummary: summary,
+		Status:          processed.Status,
+		CardBrand:       processed.CardBrand,
+		CardLast4:       processed.CardLast4,
+		CardIssuer:      processed.CardIssuer,
+		CardCountry:     processed.CardCountry,
+		CardFunding:     processed.CardFunding,
+		CardProduct:     processed.CardProduct,
+		StatusCode:      processed.StatusCode,
+		ResponseSummary: bankResponse.Summary,
 	}
 
 	return response, nil
 }
+
+// newPaymentID returns a unique identifier for a new payment.
+func newPaymentID() string {
+	return fmt.Sprintf("PAY-%d", time.Now().UnixNano())
+}
+
+// findPayment retrieves the payment with the given ID. Payments of other merchants are reported as not found, so
+// that merchants cannot learn which IDs exist. If the payment cannot be retrieved, an error response is sent and
+// false is returned.
+func (app *Application) findPayment(c *gin.Context, id string) (models.PaymentDetails, bool) {
+	payment, err := app.Payments.GetPayment(c.Request.Context(), id)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && payment.MerchantID != merchantID(c)) {
+		utils.NewErrorResponse(c, http.StatusNotFound, "Payment not found", nil)
+		return models.PaymentDetails{}, false
+	} else if err != nil {
+		app.ErrorLog.Printf("failed to retrieve payment %s: %v", id, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return models.PaymentDetails{}, false
+	}
+
+	return payment, true
+}
+
+// validateCard validates a request holding card details, checking the expiry date against the application's clock.
+func (app *Application) validateCard(ctx context.Context, request interface{}) error {
+	rules := validators.ExpiryRules{Now: app.now, MaxYears: app.MaxExpiryYears}
+	return validate.StructCtx(validators.WithExpiryRules(ctx, rules), request)
+}
+
+// expiryDate returns the expiry date of a card given either as a date or as separate month and year fields.
+func expiryDate(date string, month, year int) string {
+	if date == "" && (month != 0 || year != 0) {
+		return fmt.Sprintf("%02d/%02d", month, year)
+	}
+
+	return date
+}
+
+// merchantID returns the ID of the merchant making the request, or an empty string if the request does not
+// identify one.
+func merchantID(c *gin.Context) string {
+	return c.GetString(MerchantIDKey)
+}
+
+// resolveAmount returns an amount from a request body in the given currency, converting an amount given as a
+// decimal into minor units. If the amount cannot be represented in the currency, a 422 response is sent and false
+// is returned. An amount without any currency is returned unchanged, so that validation reports the missing currency.
+func resolveAmount(c *gin.Context, amount money.Money, currency string) (money.Money, bool) {
+	if currency == "" && amount.Currency == "" {
+		return amount, true
+	}
+
+	resolved, err := amount.Resolve(currency)
+	if err == nil {
+		return resolved, true
+	}
+
+	var message string
+	switch {
+	case errors.Is(err, money.ErrTooPrecise):
+		message = fmt.Sprintf("Amount must have at most %d decimal places in %s", money.Exponent(currency), strings.ToUpper(currency))
+	case errors.Is(err, money.ErrCurrencyMismatch):
+		message = fmt.Sprintf("Amount must be in %s", strings.ToUpper(currency))
+	case errors.Is(err, money.ErrOverflow):
+		message = "Amount is too large"
+	default:
+		message = "Amount is invalid"
+	}
+	utils.NewErrorResponse(c, http.StatusUnprocessableEntity, "Validation failed", []string{message})
+
+	return money.Money{}, false
+}
+
+// canTransition reports whether a payment may move to the next status. If it may not, a 409 response with the
+// given message is sent and false is returned.
+func canTransition(c *gin.Context, payment models.PaymentDetails, next models.PaymentStatus, message string) bool {
+	if err := payment.Status.Transition(next); err != nil {
+		utils.NewErrorResponse(c, http.StatusConflict, message, []string{fmt.Sprintf("Payment status is %s", payment.Status)})
+		return false
+	}
+
+	return true
+}
+
+// savePayment stores the changes made to a payment since it was retrieved. If the changes cannot be saved,
+// for example because another request modified the payment first, an error response is sent and false is returned.
+func (app *Application) savePayment(c *gin.Context, payment models.PaymentDetails) bool {
+	err := app.Payments.UpdatePayment(c.Request.Context(), payment)
+	if errors.Is(err, storage.ErrConflict) {
+		utils.NewErrorResponse(c, http.StatusConflict, "Payment was modified by another request", nil)
+		return false
+	} else if err != nil {
+		app.ErrorLog.Printf("failed to save payment %s: %v", payment.ID, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return false
+	}
+
+	return true
+}
+
+// contactingBank records on a request that the acquiring bank is about to be asked to act on it, so that the request
+// is not processed again if it fails afterwards.
+func contactingBank(c *gin.Context) {
+	c.Set(BankContactedKey, true)
+}
+
+// bankFailure converts an error returned by the acquiring bank into a response describing the failure.
+// It reports false if err is not a bank error, in which case it should be handled as an internal error.
+func bankFailure(err error) (bank.Response, bool) {
+	var bankErr *bank.Error
+	if !errors.As(err, &bankErr) {
+		return bank.Response{}, false
+	}
+
+	return bank.Response{StatusCode: bankErr.StatusCode, Summary: bankErr.Summary}, true
+}
+
+// captureFailureStatus returns the HTTP status code used to report a capture that did not go through with the given
+// status code: a 402 if the bank declined it, and otherwise that of a bank failure.
+func captureFailureStatus(statusCode int) int {
+	switch statusCode {
+	case bank.CodeTimeout, bank.CodeSystemMalfunction:
+		return bankFailureStatus(statusCode)
+	default:
+		return http.StatusPaymentRequired
+	}
+}
+
+// bankFailureStatus returns the HTTP status code used to report a bank failure with the given status code.
+func bankFailureStatus(statusCode int) int {
+	if statusCode == bank.CodeTimeout {
+		return http.StatusGatewayTimeout
+	}
+
+	return http.StatusBadGateway
+}
@@ -2,42 +2,120 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"io"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/bank"
+	"github.com/Lionel-Wilson/payment-gateway/internal/bin"
+	"github.com/Lionel-Wilson/payment-gateway/internal/card"
+	"github.com/Lionel-Wilson/payment-gateway/internal/currency"
+	"github.com/Lionel-Wilson/payment-gateway/internal/envelope"
+	"github.com/Lionel-Wilson/payment-gateway/internal/money"
+	"github.com/Lionel-Wilson/payment-gateway/internal/oauth"
+	"github.com/Lionel-Wilson/payment-gateway/internal/storage"
+	"github.com/Lionel-Wilson/payment-gateway/internal/vault"
 	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
 	"github.com/gin-gonic/gin"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// testNow is the time returned by the clock of the test application, so that card expiry dates in tests do not
+// pass.
+var testNow = time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
 func setupTestApp() *Application {
-	return &Application{}
+	store := storage.NewMemoryStore()
+
+	keyring, _ := envelope.NewKeyring("test", map[string][]byte{"test": bytes.Repeat([]byte{1}, envelope.KeySize)})
+	issuer, _ := oauth.NewIssuer(bytes.Repeat([]byte{2}, oauth.MinKeySize), "payment-gateway", 15*time.Minute)
+
+	return &Application{
+		ErrorLog:     log.New(io.Discard, "", 0),
+		InfoLog:      log.New(io.Discard, "", 0),
+		Payments:     store,
+		Refunds:      store,
+		Tokens:       store,
+		APIKeys:      store,
+		Merchants:    store,
+		OAuthClients: store,
+		Users:        store,
+		Sessions:     store,
+		AccessTokens: issuer,
+		Vault:        vault.New(keyring),
+		Bank:         bank.NewSimulator(bank.ModeDeterministic),
+		Clock:        func() time.Time { return testNow },
+	}
+}
+
+// seedPayments returns a test application whose store contains the given payments.
+func seedPayments(t *testing.T, payments []models.PaymentDetails) *Application {
+	t.Helper()
+
+	app := setupTestApp()
+	for _, payment := range payments {
+		err := app.Payments.CreatePayment(context.Background(), payment)
+		assert.NoError(t, err)
+	}
+
+	return app
 }
 
 func TestProcessPayment(t *testing.T) {
+	validPayment := func(cardNumber string, amount int64) models.ProcessPaymentRequest {
+		return models.ProcessPaymentRequest{
+			FirstName:    "John",
+			LastName:     "Doe",
+			CardNumber:   cardNumber,
+			ExpiryDate:   "12/29",
+			Amount:       money.New(amount, "USD"),
+			CurrencyCode: "USD",
+			CVV:          "123",
+		}
+	}
+
 	tests := []struct {
-		name                string
-		input               models.ProcessPaymentRequest
-		expectedStatusCodes []int
-		expectedResponse    interface{}
+		name               string
+		input              models.ProcessPaymentRequest
+		expectedStatusCode int
+		expectedResponse   interface{}
 	}{
 		{
-			name: "Valid Payment",
-			input: models.ProcessPaymentRequest{
-				FirstName:    "John",
-				LastName:     "Doe",
-				CardNumber:   "4658587360641032",
-				ExpiryDate:   "12/24",
-				Amount:       100.0,
-				CurrencyCode: "USD",
-				CVV:          "123",
-			},
-			expectedStatusCodes: []int{http.StatusCreated, http.StatusPaymentRequired},
-			expectedResponse:    "payment_paid",
+			name:               "Valid Payment",
+			input:              validPayment("4658587360641032", 10000),
+			expectedStatusCode: http.StatusCreated,
+			expectedResponse:   "payment_paid",
+		},
+		{
+			name:               "Declined Test Card",
+			input:              validPayment("4000000000009995", 10000),
+			expectedStatusCode: http.StatusPaymentRequired,
+			expectedResponse:   "payment_declined",
+		},
+		{
+			name:               "Declined Test Amount",
+			input:              validPayment("4658587360641032", 10005),
+			expectedStatusCode: http.StatusPaymentRequired,
+			expectedResponse:   "payment_declined",
+		},
+		{
+			name:               "Bank Timeout",
+			input:              validPayment("4000000000000119", 10000),
+			expectedStatusCode: http.StatusGatewayTimeout,
+			expectedResponse:   "payment_failed",
+		},
+		{
+			name:               "Bank System Malfunction",
+			input:              validPayment("4658587360641032", 10096),
+			expectedStatusCode: http.StatusBadGateway,
+			expectedResponse:   "payment_failed",
 		},
 		{
 			name: "Invalid Card Number",
@@ -46,24 +124,24 @@ func TestProcessPayment(t *testing.T) {
 				LastName:     "Doe",
 				CardNumber:   "1234567890123456",
 				ExpiryDate:   "12/29",
-				Amount:       500,
+				Amount:       money.New(50000, "USD"),
 				CurrencyCode: "USD",
 				CVV:          "123",
 			},
-			expectedStatusCodes: []int{http.StatusUnprocessableEntity},
-			expectedResponse:    "Validation failed",
+			expectedStatusCode: http.StatusUnprocessableEntity,
+			expectedResponse:   "Validation failed",
 		},
 		{
 			name: "Invalid Payment Request",
 			input: models.ProcessPaymentRequest{
 				FirstName:    "John",
 				CardNumber:   "4111111111111111",
-				Amount:       -100.0,
+				Amount:       money.New(-10000, "USD"),
 				CurrencyCode: "USD",
 				CVV:          "123",
 			},
-			expectedStatusCodes: []int{http.StatusUnprocessableEntity},
-			expectedResponse:    "Validation failed",
+			expectedStatusCode: http.StatusUnprocessableEntity,
+			expectedResponse:   "Validation failed",
 		},
 	}
 
@@ -80,24 +158,412 @@ func TestProcessPayment(t *testing.T) {
 			rr := httptest.NewRecorder()
 			router.ServeHTTP(rr, req)
 
-			assert.Contains(t, tt.expectedStatusCodes, rr.Code)
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
 
-			if rr.Code == http.StatusCreated {
-				var response models.ProcessPaymentResponse
-				err := json.Unmarshal(rr.Body.Bytes(), &response)
+			if rr.Code == http.StatusUnprocessableEntity {
+				var errorResponse utils.ErrorResponse
+				err := json.Unmarshal(rr.Body.Bytes(), &errorResponse)
 				assert.NoError(t, err)
-				assert.Equal(t, tt.expectedResponse, response.Status)
-			} else if rr.Code == http.StatusPaymentRequired {
+				assert.Contains(t, errorResponse.Message, tt.expectedResponse)
+			} else {
 				var response models.ProcessPaymentResponse
 				err := json.Unmarshal(rr.Body.Bytes(), &response)
 				assert.NoError(t, err)
-				assert.Equal(t, "payment_declined", response.Status)
-			} else {
+				assert.Equal(t, tt.expectedResponse, string(response.Status))
+
+				payment, err := app.Payments.GetPayment(context.Background(), response.ID)
+				assert.NoError(t, err)
+				assert.Equal(t, response.StatusCode, payment.StatusCode)
+			}
+		})
+	}
+}
+
+func TestProcessPaymentAmounts(t *testing.T) {
+	const cardholder = `"firstName": "John", "lastName": "Doe", "cardNumber": "4658587360641032", "expiryDate": "12/29", "cvv": "123"`
+
+	tests := []struct {
+		name               string
+		body               string
+		expectedStatusCode int
+		expectedAmount     money.Money
+		expectedErrors     []string
+	}{
+		{
+			name:               "Minor Units",
+			body:               `{` + cardholder + `, "amount": {"value": 1050, "currency": "GBP"}, "currencyCode": "GBP"}`,
+			expectedStatusCode: http.StatusCreated,
+			expectedAmount:     money.New(1050, "GBP"),
+		},
+		{
+			name:               "Minor Units Without Currency Code",
+			body:               `{` + cardholder + `, "amount": {"value": 1050, "currency": "JPY"}}`,
+			expectedStatusCode: http.StatusCreated,
+			expectedAmount:     money.New(1050, "JPY"),
+		},
+		{
+			name:               "Decimal Amount",
+			body:               `{` + cardholder + `, "amount": 10.5, "currencyCode": "GBP"}`,
+			expectedStatusCode: http.StatusCreated,
+			expectedAmount:     money.New(1050, "GBP"),
+		},
+		{
+			name:               "Decimal String In Dinars",
+			body:               `{` + cardholder + `, "amount": "1.234", "currencyCode": "KWD"}`,
+			expectedStatusCode: http.StatusCreated,
+			expectedAmount:     money.New(1234, "KWD"),
+		},
+		{
+			name:               "Decimal Amount Too Precise",
+			body:               `{` + cardholder + `, "amount": 10.5, "currencyCode": "JPY"}`,
+			expectedStatusCode: http.StatusUnprocessableEntity,
+			expectedErrors:     []string{"Amount must have at most 0 decimal places in JPY"},
+		},
+		{
+			name:               "Currency Mismatch",
+			body:               `{` + cardholder + `, "amount": {"value": 1050, "currency": "GBP"}, "currencyCode": "USD"}`,
+			expectedStatusCode: http.StatusUnprocessableEntity,
+			expectedErrors:     []string{"Amount must be in USD"},
+		},
+		{
+			name:               "Zero Amount",
+			body:               `{` + cardholder + `, "amount": {"value": 0, "currency": "GBP"}}`,
+			expectedStatusCode: http.StatusUnprocessableEntity,
+			expectedErrors:     []string{"Amount is required"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := setupTestApp()
+			router := gin.New()
+			router.POST("/api/v1/payments", app.ProcessPayment)
+
+			req, _ := http.NewRequest("POST", "/api/v1/payments", bytes.NewBufferString(tt.body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+
+			if rr.Code == http.StatusUnprocessableEntity {
 				var errorResponse utils.ErrorResponse
 				err := json.Unmarshal(rr.Body.Bytes(), &errorResponse)
 				assert.NoError(t, err)
-				assert.Contains(t, errorResponse.Message, tt.expectedResponse)
+				assert.Equal(t, tt.expectedErrors, errorResponse.Errors)
+				return
 			}
+
+			var response models.ProcessPaymentResponse
+			err := json.Unmarshal(rr.Body.Bytes(), &response)
+			assert.NoError(t, err)
+
+			payment, err := app.Payments.GetPayment(context.Background(), response.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedAmount, payment.Amount)
+			assert.Equal(t, tt.expectedAmount, payment.CapturedAmount)
+			assert.Equal(t, tt.expectedAmount.Currency, payment.CurrencyCode)
+		})
+	}
+}
+
+func TestProcessPaymentCurrencies(t *testing.T) {
+	const cardholder = `"firstName": "John", "lastName": "Doe", "cardNumber": "4658587360641032", "expiryDate": "12/29", "cvv": "123"`
+
+	currencies := currency.AllowLists{
+		Default:   currency.AllowList{"GBP", "EUR"},
+		Merchants: map[string]currency.AllowList{"merchant-1": {"USD"}},
+	}
+
+	tests := []struct {
+		name               string
+		merchantID         string
+		body               string
+		expectedStatusCode int
+		expectedCurrency   string
+		expectedErrors     []string
+	}{
+		{
+			name:               "Accepted Currency",
+			body:               `{` + cardholder + `, "amount": 10.5, "currencyCode": "GBP"}`,
+			expectedStatusCode: http.StatusCreated,
+			expectedCurrency:   "GBP",
+		},
+		{
+			name:               "Lower Case Currency",
+			body:               `{` + cardholder + `, "amount": 10.5, "currencyCode": "eur"}`,
+			expectedStatusCode: http.StatusCreated,
+			expectedCurrency:   "EUR",
+		},
+		{
+			name:               "Unknown Currency",
+			body:               `{` + cardholder + `, "amount": 10.5, "currencyCode": "ABC"}`,
+			expectedStatusCode: http.StatusUnprocessableEntity,
+			expectedErrors:     []string{"CurrencyCode must be a valid ISO 4217 currency code"},
+		},
+		{
+			name:               "Currency Not Accepted",
+			body:               `{` + cardholder + `, "amount": 10.5, "currencyCode": "USD"}`,
+			expectedStatusCode: http.StatusUnprocessableEntity,
+			expectedErrors:     []string{"CurrencyCode USD is not accepted"},
+		},
+		{
+			name:               "Currency Accepted From Merchant",
+			merchantID:         "merchant-1",
+			body:               `{` + cardholder + `, "amount": 10.5, "currencyCode": "USD"}`,
+			expectedStatusCode: http.StatusCreated,
+			expectedCurrency:   "USD",
+		},
+		{
+			name:               "Currency Not Accepted From Merchant",
+			merchantID:         "merchant-1",
+			body:               `{` + cardholder + `, "amount": 10.5, "currencyCode": "GBP"}`,
+			expectedStatusCode: http.StatusUnprocessableEntity,
+			expectedErrors:     []string{"CurrencyCode GBP is not accepted"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := setupTestApp()
+			app.Currencies = currencies
+
+			router := gin.New()
+			router.POST("/api/v1/payments", func(c *gin.Context) {
+				if tt.merchantID != "" {
+					c.Set(MerchantIDKey, tt.merchantID)
+				}
+				app.ProcessPayment(c)
+			})
+
+			req, _ := http.NewRequest("POST", "/api/v1/payments", bytes.NewBufferString(tt.body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+
+			if rr.Code == http.StatusUnprocessableEntity {
+				var errorResponse utils.ErrorResponse
+				err := json.Unmarshal(rr.Body.Bytes(), &errorResponse)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedErrors, errorResponse.Errors)
+				return
+			}
+
+			var response models.ProcessPaymentResponse
+			err := json.Unmarshal(rr.Body.Bytes(), &response)
+			assert.NoError(t, err)
+
+			payment, err := app.Payments.GetPayment(context.Background(), response.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedCurrency, payment.CurrencyCode)
+			assert.Equal(t, tt.expectedCurrency, payment.Amount.Currency)
+		})
+	}
+}
+
+func TestProcessPaymentCardBrands(t *testing.T) {
+	tests := []struct {
+		name               string
+		cardNumber         string
+		cvv                string
+		expectedStatusCode int
+		expectedBrand      card.Brand
+		expectedLast4      string
+		expectedErrors     []string
+	}{
+		{name: "Visa", cardNumber: "4111111111111111", cvv: "123", expectedStatusCode: http.StatusCreated, expectedBrand: card.Visa, expectedLast4: "1111"},
+		{name: "Mastercard", cardNumber: "5555555555554444", cvv: "123", expectedStatusCode: http.StatusCreated, expectedBrand: card.Mastercard, expectedLast4: "4444"},
+		{name: "Amex", cardNumber: "378282246310005", cvv: "1234", expectedStatusCode: http.StatusCreated, expectedBrand: card.Amex, expectedLast4: "0005"},
+		{
+			name:               "Amex With Three Digit CVV",
+			cardNumber:         "378282246310005",
+			cvv:                "123",
+			expectedStatusCode: http.StatusUnprocessableEntity,
+			expectedErrors:     []string{"CVV must be 3 digits, or 4 digits for American Express cards"},
+		},
+		{
+			name:               "Visa With Four Digit CVV",
+			cardNumber:         "4111111111111111",
+			cvv:                "1234",
+			expectedStatusCode: http.StatusUnprocessableEntity,
+			expectedErrors:     []string{"CVV must be 3 digits, or 4 digits for American Express cards"},
+		},
+		{
+			name:               "Wrong Length For Brand",
+			cardNumber:         "37828224631000",
+			cvv:                "1234",
+			expectedStatusCode: http.StatusUnprocessableEntity,
+			expectedErrors:     []string{"CardNumber must be a valid credit card number"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := setupTestApp()
+			router := gin.New()
+			router.POST("/api/v1/payments", app.ProcessPayment)
+
+			reqBody, _ := json.Marshal(models.ProcessPaymentRequest{
+				FirstName:    "John",
+				LastName:     "Doe",
+				CardNumber:   tt.cardNumber,
+				ExpiryDate:   "12/29",
+				Amount:       money.New(10000, "USD"),
+				CurrencyCode: "USD",
+				CVV:          tt.cvv,
+			})
+			req, _ := http.NewRequest("POST", "/api/v1/payments", bytes.NewBuffer(reqBody))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+
+			if rr.Code == http.StatusUnprocessableEntity {
+				var errorResponse utils.ErrorResponse
+				err := json.Unmarshal(rr.Body.Bytes(), &errorResponse)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedErrors, errorResponse.Errors)
+				return
+			}
+
+			var response models.ProcessPaymentResponse
+			err := json.Unmarshal(rr.Body.Bytes(), &response)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedBrand, response.CardBrand)
+			assert.Equal(t, tt.expectedLast4, response.CardLast4)
+
+			payment, err := app.Payments.GetPayment(context.Background(), response.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedBrand, payment.CardBrand)
+			assert.Equal(t, tt.expectedLast4, payment.CardLast4)
+		})
+	}
+}
+
+func TestProcessPaymentExpiry(t *testing.T) {
+	const expired = "ExpiryDate is in the past, so the card has expired"
+	const malformed = "ExpiryDate must be in MM/YY or MM/YYYY format"
+	const tooFar = "ExpiryDate is too far in the future"
+
+	tests := []struct {
+		name               string
+		expiryDate         string
+		expiryMonth        int
+		expiryYear         int
+		maxExpiryYears     int
+		expectedStatusCode int
+		expectedExpiryDate string
+		expectedErrors     []string
+	}{
+		{name: "Two Digit Year", expiryDate: "12/29", expectedStatusCode: http.StatusCreated, expectedExpiryDate: "12/29"},
+		{name: "Four Digit Year", expiryDate: "12/2029", expectedStatusCode: http.StatusCreated, expectedExpiryDate: "12/29"},
+		{name: "Separate Fields", expiryMonth: 3, expiryYear: 2029, expectedStatusCode: http.StatusCreated, expectedExpiryDate: "03/29"},
+		{name: "Separate Fields With Two Digit Year", expiryMonth: 3, expiryYear: 29, expectedStatusCode: http.StatusCreated, expectedExpiryDate: "03/29"},
+		{name: "Expires This Month", expiryDate: "07/24", expectedStatusCode: http.StatusCreated, expectedExpiryDate: "07/24"},
+		{name: "Expired Last Month", expiryDate: "06/24", expectedStatusCode: http.StatusUnprocessableEntity, expectedErrors: []string{expired}},
+		{name: "Expired Years Ago", expiryDate: "12/2019", expectedStatusCode: http.StatusUnprocessableEntity, expectedErrors: []string{expired}},
+		{name: "Expired Separate Fields", expiryMonth: 1, expiryYear: 2020, expectedStatusCode: http.StatusUnprocessableEntity, expectedErrors: []string{expired}},
+		{name: "Invalid Month", expiryDate: "13/29", expectedStatusCode: http.StatusUnprocessableEntity, expectedErrors: []string{malformed}},
+		{name: "Invalid Separate Month", expiryMonth: 13, expiryYear: 2029, expectedStatusCode: http.StatusUnprocessableEntity, expectedErrors: []string{malformed}},
+		{name: "Wrong Format", expiryDate: "2029-12", expectedStatusCode: http.StatusUnprocessableEntity, expectedErrors: []string{malformed}},
+		{name: "Too Far Ahead", expiryDate: "12/2050", expectedStatusCode: http.StatusUnprocessableEntity, expectedErrors: []string{tooFar}},
+		{name: "Beyond Configured Limit", expiryDate: "12/29", maxExpiryYears: 5, expectedStatusCode: http.StatusUnprocessableEntity, expectedErrors: []string{tooFar}},
+		{name: "Within Configured Limit", expiryDate: "07/29", maxExpiryYears: 5, expectedStatusCode: http.StatusCreated, expectedExpiryDate: "07/29"},
+		{name: "Missing", expectedStatusCode: http.StatusUnprocessableEntity, expectedErrors: []string{"ExpiryDate is required"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := setupTestApp()
+			app.MaxExpiryYears = tt.maxExpiryYears
+			router := gin.New()
+			router.POST("/api/v1/payments", app.ProcessPayment)
+
+			reqBody, _ := json.Marshal(models.ProcessPaymentRequest{
+				FirstName:    "John",
+				LastName:     "Doe",
+				CardNumber:   "4111111111111111",
+				ExpiryDate:   tt.expiryDate,
+				ExpiryMonth:  tt.expiryMonth,
+				ExpiryYear:   tt.expiryYear,
+				Amount:       money.New(10000, "USD"),
+				CurrencyCode: "USD",
+				CVV:          "123",
+			})
+			req, _ := http.NewRequest("POST", "/api/v1/payments", bytes.NewBuffer(reqBody))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+
+			if rr.Code == http.StatusUnprocessableEntity {
+				var errorResponse utils.ErrorResponse
+				err := json.Unmarshal(rr.Body.Bytes(), &errorResponse)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedErrors, errorResponse.Errors)
+				return
+			}
+
+			var response models.ProcessPaymentResponse
+			err := json.Unmarshal(rr.Body.Bytes(), &response)
+			assert.NoError(t, err)
+
+			payment, err := app.Payments.GetPayment(context.Background(), response.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedExpiryDate, payment.ExpiryDate)
+		})
+	}
+}
+
+func TestProcessPaymentCardIssuer(t *testing.T) {
+	tests := []struct {
+		name            string
+		cardNumber      string
+		expectedIssuer  string
+		expectedCountry string
+		expectedFunding bin.Funding
+		expectedProduct string
+	}{
+		{name: "Known BIN", cardNumber: "4111111111111111", expectedIssuer: "Test Bank", expectedCountry: "GB", expectedFunding: bin.Credit, expectedProduct: "Visa Classic"},
+		{name: "Unknown BIN", cardNumber: "5555555555554444"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := setupTestApp()
+			app.BINs = testBINs(t)
+			router := gin.New()
+			router.POST("/api/v1/payments", app.ProcessPayment)
+
+			reqBody, _ := json.Marshal(models.ProcessPaymentRequest{
+				FirstName:    "John",
+				LastName:     "Doe",
+				CardNumber:   tt.cardNumber,
+				ExpiryDate:   "12/29",
+				Amount:       money.New(10000, "USD"),
+				CurrencyCode: "USD",
+				CVV:          "123",
+			})
+			req, _ := http.NewRequest("POST", "/api/v1/payments", bytes.NewBuffer(reqBody))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusCreated, rr.Code)
+
+			var response models.ProcessPaymentResponse
+			err := json.Unmarshal(rr.Body.Bytes(), &response)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedIssuer, response.CardIssuer)
+			assert.Equal(t, tt.expectedCountry, response.CardCountry)
+			assert.Equal(t, tt.expectedFunding, response.CardFunding)
+			assert.Equal(t, tt.expectedProduct, response.CardProduct)
+
+			payment, err := app.Payments.GetPayment(context.Background(), response.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedIssuer, payment.CardIssuer)
+			assert.Equal(t, tt.expectedCountry, payment.CardCountry)
+			assert.Equal(t, tt.expectedFunding, payment.CardFunding)
+			assert.Equal(t, tt.expectedProduct, payment.CardProduct)
 		})
 	}
 }
@@ -105,21 +571,21 @@ func TestProcessPayment(t *testing.T) {
 func TestRetrievePaymentDetails(t *testing.T) {
 	tests := []struct {
 		name               string
-		setupPayments      map[string]models.PaymentDetails
+		setupPayments      []models.PaymentDetails
 		paymentID          string
 		expectedStatusCode int
 		expectedResponse   interface{}
 	}{
 		{
 			name: "Valid Payment",
-			setupPayments: map[string]models.PaymentDetails{
-				"PAY-12345": {
+			setupPayments: []models.PaymentDetails{
+				{
 					ID:           "PAY-12345",
 					FirstName:    "Jane",
 					LastName:     "Doe",
 					CardNumber:   utils.MaskCardNumber("4111111111111111"),
 					ExpiryDate:   "12/24",
-					Amount:       200.0,
+					Amount:       money.New(20000, "USD"),
 					CurrencyCode: "USD",
 					Status:       "payment_paid",
 					StatusCode:   10000,
@@ -133,7 +599,7 @@ func TestRetrievePaymentDetails(t *testing.T) {
 				LastName:     "Doe",
 				CardNumber:   utils.MaskCardNumber("4111111111111111"),
 				ExpiryDate:   "12/24",
-				Amount:       200.0,
+				Amount:       money.New(20000, "USD"),
 				CurrencyCode: "USD",
 				Status:       "payment_paid",
 				StatusCode:   10000,
@@ -141,22 +607,18 @@ func TestRetrievePaymentDetails(t *testing.T) {
 		},
 		{
 			name:               "Non-Existent Payment",
-			setupPayments:      map[string]models.PaymentDetails{},
+			setupPayments:      []models.PaymentDetails{},
 			paymentID:          "PAY-99999",
 			expectedStatusCode: http.StatusNotFound,
 			expectedResponse:   "Payment not found",
 		},
 	}
 
-	app := setupTestApp()
-	router := gin.New()
-	router.GET("/api/v1/payments/:id", app.RetrievePayment)
-
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mu.Lock()
-			payments = tt.setupPayments
-			mu.Unlock()
+			app := seedPayments(t, tt.setupPayments)
+			router := gin.New()
+			router.GET("/api/v1/payments/:id", app.RetrievePayment)
 
 			req, _ := http.NewRequest("GET", "/api/v1/payments/"+tt.paymentID, nil)
 			rr := httptest.NewRecorder()
@@ -182,37 +644,37 @@ func TestRetrievePaymentDetails(t *testing.T) {
 func TestAllPayments(t *testing.T) {
 	tests := []struct {
 		name               string
-		setupPayments      map[string]models.PaymentDetails
+		setupPayments      []models.PaymentDetails
 		expectedStatusCode int
 		expectedResponse   interface{}
 	}{
 		{
 			name:               "No Payments",
-			setupPayments:      map[string]models.PaymentDetails{},
+			setupPayments:      []models.PaymentDetails{},
 			expectedStatusCode: http.StatusNotFound,
 			expectedResponse:   "No payments available",
 		},
 		{
 			name: "With Payments",
-			setupPayments: map[string]models.PaymentDetails{
-				"PAY-12345": {
+			setupPayments: []models.PaymentDetails{
+				{
 					ID:           "PAY-12345",
 					FirstName:    "Jane",
 					LastName:     "Doe",
 					CardNumber:   utils.MaskCardNumber("4111111111111111"),
 					ExpiryDate:   "12/24",
-					Amount:       200.0,
+					Amount:       money.New(20000, "USD"),
 					CurrencyCode: "USD",
 					Status:       "payment_paid",
 					StatusCode:   10000,
 				},
-				"PAY-67890": {
+				{
 					ID:           "PAY-67890",
 					FirstName:    "John",
 					LastName:     "Smith",
 					CardNumber:   utils.MaskCardNumber("4222222222222222"),
 					ExpiryDate:   "11/23",
-					Amount:       150.0,
+					Amount:       money.New(15000, "EUR"),
 					CurrencyCode: "EUR",
 					Status:       "payment_paid",
 					StatusCode:   10000,
@@ -226,7 +688,7 @@ func TestAllPayments(t *testing.T) {
 					LastName:     "Doe",
 					CardNumber:   utils.MaskCardNumber("4111111111111111"),
 					ExpiryDate:   "12/24",
-					Amount:       200.0,
+					Amount:       money.New(20000, "USD"),
 					CurrencyCode: "USD",
 					Status:       "payment_paid",
 					StatusCode:   10000,
@@ -237,7 +699,7 @@ func TestAllPayments(t *testing.T) {
 					LastName:     "Smith",
 					CardNumber:   utils.MaskCardNumber("4222222222222222"),
 					ExpiryDate:   "11/23",
-					Amount:       150.0,
+					Amount:       money.New(15000, "EUR"),
 					CurrencyCode: "EUR",
 					Status:       "payment_paid",
 					StatusCode:   10000,
@@ -246,15 +708,11 @@ func TestAllPayments(t *testing.T) {
 		},
 	}
 
-	app := setupTestApp()
-	router := gin.New()
-	router.GET("/api/v1/payments", app.AllPayments)
-
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mu.Lock()
-			payments = tt.setupPayments
-			mu.Unlock()
+			app := seedPayments(t, tt.setupPayments)
+			router := gin.New()
+			router.GET("/api/v1/payments", app.AllPayments)
 
 			req, _ := http.NewRequest("GET", "/api/v1/payments", nil)
 			rr := httptest.NewRecorder()
@@ -0,0 +1,374 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/validators"
+	"github.com/Lionel-Wilson/payment-gateway/internal/bank"
+	"github.com/Lionel-Wilson/payment-gateway/internal/money"
+	"github.com/Lionel-Wilson/payment-gateway/internal/storage"
+	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// releaseAttempts is how many times releaseRefund retries when the payment is modified concurrently.
+const releaseAttempts = 5
+
+// RefundPayment returns some or all of the captured amount of a payment to the cardholder.
+//
+// @Summary      Refund a Payment
+// @Description  Refunds some or all of a captured payment. Omit the amount to refund everything that has not been
+// @Description  refunded yet. A payment can be refunded several times, up to the amount captured. If the bank times
+// @Description  out or fails, the refund stays pending with its amount reserved until the bank's answer is known.
+// @Tags         Refunds
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "Payment ID"
+// @Param RefundRequestBody body RefundRequest false "A JSON body" RefundRequest()
+// @Success      201  {object}  Refund
+// @Failure      402  {object}  Refund
+// @Failure      404  {object}  ErrorResponse
+// @Failure      409  {object}  ErrorResponse
+// @Failure      422  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Failure      502  {object}  Refund
+// @Failure      504  {object}  Refund
+// @Router       /payments/{id}/refunds [post]
+func (app *Application) RefundPayment(c *gin.Context) {
+	id := strings.TrimSpace(c.Param("id"))
+	ctx := c.Request.Context()
+
+	// The body is optional, so an empty one refunds the full refundable amount
+	var refundRequest models.RefundRequest
+	if err := c.ShouldBindJSON(&refundRequest); err != nil && !errors.Is(err, io.EOF) {
+		utils.NewErrorResponse(c, http.StatusBadRequest, "Invalid request payload", nil)
+		return
+	}
+
+	utils.TrimWhitespace(&refundRequest)
+
+	payment, ok := app.findPayment(c, id)
+	if !ok {
+		return
+	}
+
+	// A decimal amount can only be read once the payment's currency is known
+	amount, ok := resolveAmount(c, refundRequest.Amount, payment.CurrencyCode)
+	if !ok {
+		return
+	}
+	refundRequest.Amount = amount
+
+	if err := validate.Struct(refundRequest); err != nil {
+		utils.NewErrorResponse(c, http.StatusUnprocessableEntity, "Validation failed", validators.TranslateValidationErrors(err))
+		return
+	}
+
+	if !canTransition(c, payment, models.StatusRefunded, "Payment cannot be refunded") {
+		return
+	}
+
+	refundable, err := payment.CapturedAmount.Sub(payment.RefundedAmount)
+	if err != nil {
+		app.ErrorLog.Printf("failed to refund payment %s: %v", payment.ID, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	if amount.IsZero() {
+		amount = refundable
+	}
+	if exceeds, err := amount.Cmp(refundable); err != nil {
+		app.ErrorLog.Printf("failed to refund payment %s: %v", payment.ID, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	} else if exceeds > 0 {
+		utils.NewErrorResponse(c, http.StatusUnprocessableEntity, "Validation failed", []string{fmt.Sprintf("Amount must not exceed the refundable amount of %s", refundable)})
+		return
+	}
+
+	// Reserve the amount on the payment before asking the bank, so that concurrent refunds can never
+	// return more than was captured
+	reserved := payment
+	reserved.RefundedAmount, err = payment.RefundedAmount.Add(amount)
+	if err != nil {
+		app.ErrorLog.Printf("failed to refund payment %s: %v", payment.ID, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+	reserved.Status = refundedStatus(reserved)
+
+	if !app.savePayment(c, reserved) {
+		return
+	}
+
+	refund := models.Refund{
+		ID:           newRefundID(),
+		PaymentID:    payment.ID,
+		MerchantID:   payment.MerchantID,
+		Amount:       amount,
+		CurrencyCode: payment.CurrencyCode,
+		Status:       models.RefundPending,
+		Reason:       refundRequest.Reason,
+		CreatedAt:    app.now().UTC(),
+	}
+
+	if err := app.Refunds.CreateRefund(ctx, refund); err != nil {
+		app.ErrorLog.Printf("failed to create refund of payment %s: %v", payment.ID, err)
+		app.releaseRefund(ctx, payment.ID, amount)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	contactingBank(c)
+	bankResponse, err := app.Bank.Refund(ctx, bank.RefundRequest{
+		Reference:     refund.ID,
+		BankReference: payment.BankReference,
+		Amount:        amount,
+	})
+
+	status := http.StatusCreated
+	switch failure, failed := bankFailure(err); {
+	case failed && errors.Is(err, bank.ErrRejected):
+		refund.Status = models.RefundFailed
+		bankResponse = failure
+		status = bankFailureStatus(failure.StatusCode)
+	case failed:
+		// The bank may have made the refund without being able to say so, so it stays pending with its amount
+		// reserved until it is reconciled
+		bankResponse = failure
+		status = bankFailureStatus(failure.StatusCode)
+	case err != nil:
+		app.ErrorLog.Printf("failed to refund payment %s: %v", payment.ID, err)
+		status = http.StatusInternalServerError
+	case !bankResponse.Approved:
+		refund.Status = models.RefundDeclined
+		status = http.StatusPaymentRequired
+	default:
+		refund.Status = models.RefundSucceeded
+		refund.BankReference = bankResponse.BankReference
+	}
+	refund.StatusCode = bankResponse.StatusCode
+	refund.ResponseSummary = bankResponse.Summary
+
+	if err := app.saveRefund(ctx, refund); err != nil {
+		app.ErrorLog.Printf("failed to save refund %s: %v", refund.ID, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	if status == http.StatusInternalServerError {
+		utils.NewErrorResponse(c, status, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	c.JSON(status, refund)
+}
+
+// saveRefund saves the outcome of a refund. If the refund definitely did not go through, the amount reserved for it
+// is given back, so that it can be refunded again. It uses a fresh context, so that the bank's answer is recorded
+// even if the client has gone away.
+func (app *Application) saveRefund(ctx context.Context, refund models.Refund) error {
+	ctx = context.WithoutCancel(ctx)
+
+	if err := app.Refunds.UpdateRefund(ctx, refund); err != nil {
+		return err
+	}
+
+	if refund.Status == models.RefundDeclined || refund.Status == models.RefundFailed {
+		app.releaseRefund(ctx, refund.PaymentID, refund.Amount)
+	}
+
+	return nil
+}
+
+// ReconcileRefunds asks the bank again for the outcome of every refund left pending since before the given time,
+// because the bank timed out or failed while it was being made. The refund is resent with its original reference,
+// which the bank processes once, so a refund that did go through is not made twice. Refunds whose outcome is still
+// unknown stay pending. It returns the number of refunds settled.
+func (app *Application) ReconcileRefunds(ctx context.Context, before time.Time) (int, error) {
+	refunds, err := app.Refunds.ListRefundsCreatedBefore(ctx, models.RefundPending, before)
+	if err != nil {
+		return 0, err
+	}
+
+	settled := 0
+	for _, refund := range refunds {
+		payment, err := app.Payments.GetPayment(ctx, refund.PaymentID)
+		if err != nil {
+			return settled, fmt.Errorf("reconcile refund %s: %w", refund.ID, err)
+		}
+
+		bankResponse, err := app.Bank.Refund(ctx, bank.RefundRequest{
+			Reference:     refund.ID,
+			BankReference: payment.BankReference,
+			Amount:        refund.Amount,
+		})
+
+		switch failure, failed := bankFailure(err); {
+		case failed && errors.Is(err, bank.ErrRejected):
+			refund.Status = models.RefundFailed
+			bankResponse = failure
+		case err != nil:
+			app.ErrorLog.Printf("failed to reconcile refund %s: %v", refund.ID, err)
+			continue
+		case !bankResponse.Approved:
+			refund.Status = models.RefundDeclined
+		default:
+			refund.Status = models.RefundSucceeded
+			refund.BankReference = bankResponse.BankReference
+		}
+		refund.StatusCode = bankResponse.StatusCode
+		refund.ResponseSummary = bankResponse.Summary
+
+		if err := app.saveRefund(ctx, refund); err != nil {
+			return settled, fmt.Errorf("reconcile refund %s: %w", refund.ID, err)
+		}
+		settled++
+	}
+
+	return settled, nil
+}
+
+// RunRefundReconciliation calls ReconcileRefunds every interval until ctx is cancelled. Only refunds pending for at
+// least an interval are reconciled, so that refunds still being made are left alone.
+func (app *Application) RunRefundReconciliation(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			settled, err := app.ReconcileRefunds(ctx, app.now().Add(-interval))
+			if err != nil {
+				app.ErrorLog.Printf("failed to reconcile refunds: %v", err)
+			} else if settled > 0 {
+				app.InfoLog.Printf("Reconciled %d refunds", settled)
+			}
+		}
+	}
+}
+
+// ListRefunds retrieves every refund of a payment.
+//
+// @Summary      List Refunds
+// @Description  Retrieves every refund of a payment in the order they were requested.
+// @Tags         Refunds
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "Payment ID"
+// @Success      200  {array}   Refund
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /payments/{id}/refunds [get]
+func (app *Application) ListRefunds(c *gin.Context) {
+	id := strings.TrimSpace(c.Param("id"))
+
+	payment, ok := app.findPayment(c, id)
+	if !ok {
+		return
+	}
+
+	refundsList, err := app.Refunds.ListRefunds(c.Request.Context(), payment.ID)
+	if err != nil {
+		app.ErrorLog.Printf("failed to list refunds of payment %s: %v", payment.ID, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, refundsList)
+}
+
+// RetrieveRefund retrieves a single refund of a payment.
+//
+// @Summary      Retrieve Refund Details
+// @Description  Retrieves the details of a refund of a payment using its identifier.
+// @Tags         Refunds
+// @Accept       json
+// @Produce      json
+// @Param        id        path      string  true  "Payment ID"
+// @Param        refundId  path      string  true  "Refund ID"
+// @Success      200  {object}  Refund
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /payments/{id}/refunds/{refundId} [get]
+func (app *Application) RetrieveRefund(c *gin.Context) {
+	id := strings.TrimSpace(c.Param("id"))
+	refundID := strings.TrimSpace(c.Param("refundId"))
+
+	refund, err := app.Refunds.GetRefund(c.Request.Context(), refundID)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && (refund.PaymentID != id || refund.MerchantID != merchantID(c))) {
+		utils.NewErrorResponse(c, http.StatusNotFound, "Refund not found", nil)
+		return
+	} else if err != nil {
+		app.ErrorLog.Printf("failed to retrieve refund %s: %v", refundID, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, refund)
+}
+
+// newRefundID returns a unique identifier for a new refund.
+func newRefundID() string {
+	return fmt.Sprintf("REF-%d", time.Now().UnixNano())
+}
+
+// refundedStatus returns the status of a captured payment given how much of it has been refunded.
+func refundedStatus(payment models.PaymentDetails) models.PaymentStatus {
+	switch {
+	case payment.RefundedAmount.Amount <= 0:
+		return models.StatusPaid
+	case payment.RefundedAmount.Amount < payment.CapturedAmount.Amount:
+		return models.StatusPartiallyRefunded
+	default:
+		return models.StatusRefunded
+	}
+}
+
+// releaseRefund gives back an amount reserved for a refund that did not go through. The payment may be
+// modified by other refunds in the meantime, so the release is retried on conflict. It uses a fresh context, so that
+// the amount is not left reserved if the client has gone away.
+func (app *Application) releaseRefund(ctx context.Context, paymentID string, amount money.Money) {
+	ctx = context.WithoutCancel(ctx)
+
+	for attempt := 0; attempt < releaseAttempts; attempt++ {
+		payment, err := app.Payments.GetPayment(ctx, paymentID)
+		if err != nil {
+			app.ErrorLog.Printf("failed to release refund of payment %s: %v", paymentID, err)
+			return
+		}
+
+		released := payment
+		released.RefundedAmount, err = payment.RefundedAmount.Sub(amount)
+		if err != nil {
+			app.ErrorLog.Printf("failed to release refund of payment %s: %v", paymentID, err)
+			return
+		}
+		released.Status = refundedStatus(released)
+
+		if err := payment.Status.Transition(released.Status); err != nil {
+			app.ErrorLog.Printf("failed to release refund of payment %s: %v", paymentID, err)
+			return
+		}
+
+		err = app.Payments.UpdatePayment(ctx, released)
+		if !errors.Is(err, storage.ErrConflict) {
+			if err != nil {
+				app.ErrorLog.Printf("failed to release refund of payment %s: %v", paymentID, err)
+			}
+			return
+		}
+	}
+
+	app.ErrorLog.Printf("failed to release refund of payment %s: payment kept changing", paymentID)
+}
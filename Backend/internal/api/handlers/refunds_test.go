@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/bank"
+	"github.com/Lionel-Wilson/payment-gateway/internal/money"
+	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// refundBank is an acquiring bank whose refunds always end with the given response or error.
+type refundBank struct {
+	bank.AcquiringBank
+	response bank.Response
+	err      error
+}
+
+func (b refundBank) Refund(ctx context.Context, req bank.RefundRequest) (bank.Response, error) {
+	return b.response, b.err
+}
+
+// capturedPayment returns a payment captured in full that has been refunded by the given amount.
+func capturedPayment(id string, refunded int64) models.PaymentDetails {
+	payment := authorizedPayment(id, time.Time{})
+	payment.Status = "payment_paid"
+	payment.AuthorizationExpiresAt = nil
+	payment.CapturedAmount = payment.Amount
+	payment.RefundedAmount = money.New(refunded, payment.CurrencyCode)
+	if refunded > 0 {
+		payment.Status = "payment_partially_refunded"
+	}
+
+	return payment
+}
+
+func TestRefundPayment(t *testing.T) {
+	tests := []struct {
+		name                   string
+		setupPayments          []models.PaymentDetails
+		bank                   bank.AcquiringBank
+		paymentID              string
+		requestBody            string
+		expectedStatusCode     int
+		expectedResponse       interface{}
+		expectedPaymentStatus  models.PaymentStatus
+		expectedRefundedAmount int64
+	}{
+		{
+			name:                   "Full Refund",
+			setupPayments:          []models.PaymentDetails{capturedPayment("PAY-12345", 0)},
+			paymentID:              "PAY-12345",
+			expectedStatusCode:     http.StatusCreated,
+			expectedResponse:       "refund_succeeded",
+			expectedPaymentStatus:  "payment_refunded",
+			expectedRefundedAmount: 20000,
+		},
+		{
+			name:                   "Partial Refund",
+			setupPayments:          []models.PaymentDetails{capturedPayment("PAY-12345", 0)},
+			paymentID:              "PAY-12345",
+			requestBody:            `{"amount": 50.25, "reason": "Item returned"}`,
+			expectedStatusCode:     http.StatusCreated,
+			expectedResponse:       "refund_succeeded",
+			expectedPaymentStatus:  "payment_partially_refunded",
+			expectedRefundedAmount: 5025,
+		},
+		{
+			name:                   "Partial Refund In Minor Units",
+			setupPayments:          []models.PaymentDetails{capturedPayment("PAY-12345", 0)},
+			paymentID:              "PAY-12345",
+			requestBody:            `{"amount": {"value": 5025, "currency": "USD"}}`,
+			expectedStatusCode:     http.StatusCreated,
+			expectedResponse:       "refund_succeeded",
+			expectedPaymentStatus:  "payment_partially_refunded",
+			expectedRefundedAmount: 5025,
+		},
+		{
+			name:                   "Amount Too Precise",
+			setupPayments:          []models.PaymentDetails{capturedPayment("PAY-12345", 0)},
+			paymentID:              "PAY-12345",
+			requestBody:            `{"amount": 50.255}`,
+			expectedStatusCode:     http.StatusUnprocessableEntity,
+			expectedResponse:       "Validation failed",
+			expectedPaymentStatus:  "payment_paid",
+			expectedRefundedAmount: 0,
+		},
+		{
+			name:                   "Refund Of Remainder",
+			setupPayments:          []models.PaymentDetails{capturedPayment("PAY-12345", 15000)},
+			paymentID:              "PAY-12345",
+			requestBody:            `{"amount": 50}`,
+			expectedStatusCode:     http.StatusCreated,
+			expectedResponse:       "refund_succeeded",
+			expectedPaymentStatus:  "payment_refunded",
+			expectedRefundedAmount: 20000,
+		},
+		{
+			name:                   "Amount Exceeds Refundable Amount",
+			setupPayments:          []models.PaymentDetails{capturedPayment("PAY-12345", 15000)},
+			paymentID:              "PAY-12345",
+			requestBody:            `{"amount": 50.01}`,
+			expectedStatusCode:     http.StatusUnprocessableEntity,
+			expectedResponse:       "Validation failed",
+			expectedPaymentStatus:  "payment_partially_refunded",
+			expectedRefundedAmount: 15000,
+		},
+		{
+			name:                  "Authorized Payment",
+			setupPayments:         []models.PaymentDetails{authorizedPayment("PAY-12345", time.Now().Add(time.Hour))},
+			paymentID:             "PAY-12345",
+			expectedStatusCode:    http.StatusConflict,
+			expectedResponse:      "Payment cannot be refunded",
+			expectedPaymentStatus: "payment_authorized",
+		},
+		{
+			name: "Declined Payment",
+			setupPayments: []models.PaymentDetails{func() models.PaymentDetails {
+				payment := capturedPayment("PAY-12345", 0)
+				payment.Status = models.StatusDeclined
+				return payment
+			}()},
+			paymentID:             "PAY-12345",
+			expectedStatusCode:    http.StatusConflict,
+			expectedResponse:      "Payment cannot be refunded",
+			expectedPaymentStatus: "payment_declined",
+		},
+		{
+			name:                  "Declined Refund",
+			setupPayments:         []models.PaymentDetails{capturedPayment("PAY-12345", 0)},
+			bank:                  refundBank{response: bank.Response{StatusCode: bank.CodeDoNotHonour, Summary: "Do not honour"}},
+			paymentID:             "PAY-12345",
+			expectedStatusCode:    http.StatusPaymentRequired,
+			expectedResponse:      "refund_declined",
+			expectedPaymentStatus: "payment_paid",
+		},
+		{
+			name:                   "Bank Timeout",
+			setupPayments:          []models.PaymentDetails{capturedPayment("PAY-12345", 5000)},
+			bank:                   refundBank{err: bank.ErrTimeout},
+			paymentID:              "PAY-12345",
+			expectedStatusCode:     http.StatusGatewayTimeout,
+			expectedResponse:       "refund_pending",
+			expectedPaymentStatus:  "payment_refunded",
+			expectedRefundedAmount: 20000,
+		},
+		{
+			name:                   "Bank Server Error",
+			setupPayments:          []models.PaymentDetails{capturedPayment("PAY-12345", 5000)},
+			bank:                   refundBank{err: bank.ErrSystemMalfunction},
+			paymentID:              "PAY-12345",
+			requestBody:            `{"amount": 50}`,
+			expectedStatusCode:     http.StatusBadGateway,
+			expectedResponse:       "refund_pending",
+			expectedPaymentStatus:  "payment_partially_refunded",
+			expectedRefundedAmount: 10000,
+		},
+		{
+			name:                   "Rejected Refund",
+			setupPayments:          []models.PaymentDetails{capturedPayment("PAY-12345", 5000)},
+			bank:                   refundBank{err: fmt.Errorf("%w with status 422: %w", bank.ErrRejected, bank.ErrSystemMalfunction)},
+			paymentID:              "PAY-12345",
+			expectedStatusCode:     http.StatusBadGateway,
+			expectedResponse:       "refund_failed",
+			expectedPaymentStatus:  "payment_partially_refunded",
+			expectedRefundedAmount: 5000,
+		},
+		{
+			name:               "Non-Existent Payment",
+			setupPayments:      []models.PaymentDetails{},
+			paymentID:          "PAY-99999",
+			expectedStatusCode: http.StatusNotFound,
+			expectedResponse:   "Payment not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := seedPayments(t, tt.setupPayments)
+			if tt.bank != nil {
+				app.Bank = tt.bank
+			}
+
+			router := gin.New()
+			router.POST("/api/v1/payments/:id/refunds", app.RefundPayment)
+
+			req, _ := http.NewRequest("POST", "/api/v1/payments/"+tt.paymentID+"/refunds", bytes.NewBufferString(tt.requestBody))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+
+			switch rr.Code {
+			case http.StatusCreated, http.StatusPaymentRequired, http.StatusBadGateway, http.StatusGatewayTimeout:
+				var response models.Refund
+				err := json.Unmarshal(rr.Body.Bytes(), &response)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedResponse, string(response.Status))
+				assert.Equal(t, tt.paymentID, response.PaymentID)
+
+				stored, err := app.Refunds.GetRefund(context.Background(), response.ID)
+				assert.NoError(t, err)
+				assert.Equal(t, response.Status, stored.Status)
+			default:
+				var errorResponse utils.ErrorResponse
+				err := json.Unmarshal(rr.Body.Bytes(), &errorResponse)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedResponse, errorResponse.Message)
+			}
+
+			if tt.expectedPaymentStatus != "" {
+				payment, err := app.Payments.GetPayment(context.Background(), tt.paymentID)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedPaymentStatus, payment.Status)
+				assert.Equal(t, money.New(tt.expectedRefundedAmount, "USD"), payment.RefundedAmount)
+			}
+		})
+	}
+}
+
+func TestListRefunds(t *testing.T) {
+	app := seedPayments(t, []models.PaymentDetails{capturedPayment("PAY-12345", 0), capturedPayment("PAY-67890", 0)})
+
+	router := gin.New()
+	router.POST("/api/v1/payments/:id/refunds", app.RefundPayment)
+	router.GET("/api/v1/payments/:id/refunds", app.ListRefunds)
+	router.GET("/api/v1/payments/:id/refunds/:refundId", app.RetrieveRefund)
+
+	var created []models.Refund
+	for _, body := range []string{`{"amount": 20, "reason": "Damaged"}`, `{"amount": 30}`} {
+		req, _ := http.NewRequest("POST", "/api/v1/payments/PAY-12345/refunds", bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusCreated, rr.Code)
+
+		var refund models.Refund
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &refund))
+		created = append(created, refund)
+	}
+
+	req, _ := http.NewRequest("GET", "/api/v1/payments/PAY-12345/refunds", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var refundsList []models.Refund
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &refundsList))
+	assert.Equal(t, created, refundsList)
+	assert.Equal(t, "Damaged", refundsList[0].Reason)
+
+	req, _ = http.NewRequest("GET", "/api/v1/payments/PAY-67890/refunds", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `[]`, rr.Body.String())
+
+	req, _ = http.NewRequest("GET", "/api/v1/payments/PAY-12345/refunds/"+created[1].ID, nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var refund models.Refund
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &refund))
+	assert.Equal(t, created[1], refund)
+
+	// A refund can only be retrieved through the payment it belongs to
+	req, _ = http.NewRequest("GET", "/api/v1/payments/PAY-67890/refunds/"+created[1].ID, nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestReconcileRefunds(t *testing.T) {
+	tests := []struct {
+		name                   string
+		bank                   bank.AcquiringBank
+		expectedSettled        int
+		expectedRefundStatus   models.RefundStatus
+		expectedPaymentStatus  models.PaymentStatus
+		expectedRefundedAmount int64
+	}{
+		{
+			name:                   "Refund Went Through",
+			bank:                   refundBank{response: bank.Response{Approved: true, StatusCode: bank.CodeApproved, Summary: "Approved", BankReference: "BNK-2"}},
+			expectedSettled:        1,
+			expectedRefundStatus:   "refund_succeeded",
+			expectedPaymentStatus:  "payment_partially_refunded",
+			expectedRefundedAmount: 5000,
+		},
+		{
+			name:                   "Refund Declined",
+			bank:                   refundBank{response: bank.Response{StatusCode: bank.CodeDoNotHonour, Summary: "Do not honour"}},
+			expectedSettled:        1,
+			expectedRefundStatus:   "refund_declined",
+			expectedPaymentStatus:  "payment_paid",
+			expectedRefundedAmount: 0,
+		},
+		{
+			name:                   "Refund Rejected",
+			bank:                   refundBank{err: fmt.Errorf("%w with status 422: %w", bank.ErrRejected, bank.ErrSystemMalfunction)},
+			expectedSettled:        1,
+			expectedRefundStatus:   "refund_failed",
+			expectedPaymentStatus:  "payment_paid",
+			expectedRefundedAmount: 0,
+		},
+		{
+			name:                   "Bank Still Failing",
+			bank:                   refundBank{err: bank.ErrTimeout},
+			expectedSettled:        0,
+			expectedRefundStatus:   "refund_pending",
+			expectedPaymentStatus:  "payment_partially_refunded",
+			expectedRefundedAmount: 5000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := seedPayments(t, []models.PaymentDetails{capturedPayment("PAY-12345", 0)})
+			app.Bank = refundBank{err: bank.ErrTimeout}
+
+			router := gin.New()
+			router.POST("/api/v1/payments/:id/refunds", app.RefundPayment)
+
+			req, _ := http.NewRequest("POST", "/api/v1/payments/PAY-12345/refunds", bytes.NewBufferString(`{"amount": 50}`))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			require.Equal(t, http.StatusGatewayTimeout, rr.Code)
+
+			var pending models.Refund
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &pending))
+
+			// Refunds made after the cut-off are still being made, so they are left alone
+			app.Bank = tt.bank
+			settled, err := app.ReconcileRefunds(context.Background(), pending.CreatedAt)
+			require.NoError(t, err)
+			assert.Equal(t, 0, settled)
+
+			settled, err = app.ReconcileRefunds(context.Background(), pending.CreatedAt.Add(time.Second))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedSettled, settled)
+
+			refund, err := app.Refunds.GetRefund(context.Background(), pending.ID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedRefundStatus, refund.Status)
+
+			payment, err := app.Payments.GetPayment(context.Background(), "PAY-12345")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedPaymentStatus, payment.Status)
+			assert.Equal(t, money.New(tt.expectedRefundedAmount, "USD"), payment.RefundedAmount)
+		})
+	}
+}
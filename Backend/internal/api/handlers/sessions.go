@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/account"
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/validators"
+	"github.com/Lionel-Wilson/payment-gateway/internal/storage"
+	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultSessionTTL is how long dashboard sessions last when the application does not say.
+const defaultSessionTTL = 8 * time.Hour
+
+// CreateSession logs a dashboard user in.
+//
+// @Summary      Log In
+// @Description  Exchanges a dashboard user's email address and password for a session token, which is sent in the
+// @Description  "Authorization: Bearer" header of later requests until the session expires or the user logs out.
+// @Tags         Sessions
+// @Accept       json
+// @Produce      json
+// @Param        LoginRequestBody body LoginRequest true "A JSON body"
+// @Success      201  {object}  Session
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      422  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /sessions [post]
+func (app *Application) CreateSession(c *gin.Context) {
+	var loginRequest models.LoginRequest
+	if err := c.ShouldBindJSON(&loginRequest); err != nil {
+		utils.NewErrorResponse(c, http.StatusBadRequest, "Invalid request payload", nil)
+		return
+	}
+
+	if err := validate.Struct(loginRequest); err != nil {
+		utils.NewErrorResponse(c, http.StatusUnprocessableEntity, "Validation failed", validators.TranslateValidationErrors(err))
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	// Unknown and disabled users are rejected like wrong passwords, and take as long to check, so that the response
+	// does not reveal which email addresses have accounts
+	user, err := app.Users.GetUserByEmail(ctx, account.NormalizeEmail(loginRequest.Email))
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		app.ErrorLog.Printf("failed to retrieve user by email: %v", err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	if !account.CheckPassword(user.PasswordHash, loginRequest.Password) || user.DisabledAt != nil {
+		utils.NewErrorResponse(c, http.StatusUnauthorized, "Invalid email or password", nil)
+		return
+	}
+
+	token, err := account.NewSessionToken()
+	if err != nil {
+		app.ErrorLog.Printf("failed to generate session token for user %s: %v", user.ID, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	ttl := app.SessionTTL
+	if ttl <= 0 {
+		ttl = defaultSessionTTL
+	}
+
+	now := app.now().UTC()
+	session := models.Session{
+		ID:         account.HashSessionToken(token),
+		UserID:     user.ID,
+		MerchantID: user.MerchantID,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(ttl),
+	}
+
+	if err := app.Sessions.CreateSession(ctx, session); err != nil {
+		app.ErrorLog.Printf("failed to create session for user %s: %v", user.ID, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	session.Token = token
+	session.User = &user
+	c.JSON(http.StatusCreated, session)
+}
+
+// RetrieveSession retrieves the session the request was made with, and the user it belongs to.
+//
+// @Summary      Retrieve the Current Session
+// @Description  Retrieves the session whose token the request was made with, including the logged in user and
+// @Description  their role, so that the dashboard can show only what the user is allowed to do.
+// @Tags         Sessions
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  Session
+// @Failure      401  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Router       /sessions/current [get]
+func (app *Application) RetrieveSession(c *gin.Context) {
+	session, user, ok := currentSession(c)
+	if !ok {
+		return
+	}
+
+	session.User = &user
+	c.JSON(http.StatusOK, session)
+}
+
+// DeleteSession logs out of the session the request was made with.
+//
+// @Summary      Log Out
+// @Description  Ends the session whose token the request was made with, so that the token stops working.
+// @Tags         Sessions
+// @Accept       json
+// @Produce      json
+// @Success      204
+// @Failure      401  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /sessions/current [delete]
+func (app *Application) DeleteSession(c *gin.Context) {
+	session, _, ok := currentSession(c)
+	if !ok {
+		return
+	}
+
+	err := app.Sessions.DeleteSession(c.Request.Context(), session.ID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		app.ErrorLog.Printf("failed to delete session of user %s: %v", session.UserID, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// currentSession returns the session the request was authenticated with and its user. If the request was made
+// with an API key or access token instead, a 404 is sent and false is returned.
+func currentSession(c *gin.Context) (models.Session, models.User, bool) {
+	session, sessionOK := c.Get(SessionKey)
+	user, userOK := c.Get(UserKey)
+	if !sessionOK || !userOK {
+		utils.NewErrorResponse(c, http.StatusNotFound, "Session not found", []string{"The request was not made with a session token"})
+		return models.Session{}, models.User{}, false
+	}
+
+	return session.(models.Session), user.(models.User), true
+}
+
+// RunSessionExpiry deletes expired sessions every interval until ctx is cancelled. Expired sessions are rejected
+// whether or not they have been deleted, so this only keeps the store from growing.
+func (app *Application) RunSessionExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := app.Sessions.DeleteSessionsExpiredBefore(ctx, app.now())
+			if err != nil {
+				app.ErrorLog.Printf("failed to delete expired sessions: %v", err)
+			} else if deleted > 0 {
+				app.InfoLog.Printf("Deleted %d expired sessions", deleted)
+			}
+		}
+	}
+}
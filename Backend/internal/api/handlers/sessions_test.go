@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/account"
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/rbac"
+	"github.com/Lionel-Wilson/payment-gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateSession(t *testing.T) {
+	app := setupTestApp()
+	user := createTestUser(t, app, "merchant-1", "jane@example.com", rbac.Support)
+	disabled := createTestUser(t, app, "merchant-1", "john@example.com", rbac.Admin)
+	require.NoError(t, app.Users.DisableUser(context.Background(), disabled.ID, testNow))
+
+	router := gin.New()
+	router.POST("/api/v1/sessions", app.CreateSession)
+
+	tests := []struct {
+		name               string
+		body               string
+		expectedStatusCode int
+		expectedMessage    string
+	}{
+		{"Valid Credentials", `{"email":"Jane@Example.com","password":"correct horse battery staple"}`, http.StatusCreated, ""},
+		{"Wrong Password", `{"email":"jane@example.com","password":"incorrect horse battery staple"}`, http.StatusUnauthorized, "Invalid email or password"},
+		{"Unknown Email", `{"email":"nobody@example.com","password":"correct horse battery staple"}`, http.StatusUnauthorized, "Invalid email or password"},
+		{"Disabled User", `{"email":"john@example.com","password":"correct horse battery staple"}`, http.StatusUnauthorized, "Invalid email or password"},
+		{"Missing Password", `{"email":"jane@example.com"}`, http.StatusUnprocessableEntity, "Validation failed"},
+		{"Invalid JSON", `{"email":`, http.StatusBadRequest, "Invalid request payload"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := sendAPIKeyRequest(router, "POST", "/api/v1/sessions", tt.body)
+			require.Equal(t, tt.expectedStatusCode, rr.Code)
+			if tt.expectedStatusCode != http.StatusCreated {
+				assert.Contains(t, rr.Body.String(), tt.expectedMessage)
+				return
+			}
+
+			var session models.Session
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &session))
+			assert.Regexp(t, `^sess_[0-9a-f]{64}$`, session.Token)
+			assert.Equal(t, testNow, session.CreatedAt)
+			assert.Equal(t, testNow.Add(defaultSessionTTL), session.ExpiresAt)
+			require.NotNil(t, session.User)
+			assert.Equal(t, user.ID, session.User.ID)
+			assert.Equal(t, rbac.Support, session.User.Role)
+
+			// Only the hash of the token is stored
+			stored, err := app.Sessions.GetSession(context.Background(), account.HashSessionToken(session.Token))
+			require.NoError(t, err)
+			assert.Equal(t, user.ID, stored.UserID)
+			assert.Equal(t, "merchant-1", stored.MerchantID)
+		})
+	}
+}
+
+func TestCurrentSession(t *testing.T) {
+	app := setupTestApp()
+	user := models.User{ID: "USR-1", MerchantID: "merchant-1", Email: "jane@example.com", Role: rbac.Finance, CreatedAt: testNow}
+	session := models.Session{ID: "hash", UserID: user.ID, MerchantID: user.MerchantID, CreatedAt: testNow, ExpiresAt: testNow.Add(time.Hour)}
+	require.NoError(t, app.Sessions.CreateSession(context.Background(), session))
+
+	withSession := func(next gin.HandlerFunc) gin.HandlerFunc {
+		return asUser(user, func(c *gin.Context) {
+			c.Set(SessionKey, session)
+			next(c)
+		})
+	}
+
+	router := gin.New()
+	router.GET("/api/v1/sessions/current", withSession(app.RetrieveSession))
+	router.DELETE("/api/v1/sessions/current", withSession(app.DeleteSession))
+	router.GET("/api/v1/sessions/key", asMerchant("merchant-1", app.RetrieveSession))
+
+	rr := sendAPIKeyRequest(router, "GET", "/api/v1/sessions/current", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var response models.Session
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Empty(t, response.Token)
+	require.NotNil(t, response.User)
+	assert.Equal(t, rbac.Finance, response.User.Role)
+	assert.Equal(t, session.ExpiresAt, response.ExpiresAt)
+
+	rr = sendAPIKeyRequest(router, "DELETE", "/api/v1/sessions/current", "")
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	_, err := app.Sessions.GetSession(context.Background(), session.ID)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	// Requests made with an API key have no session
+	rr = sendAPIKeyRequest(router, "GET", "/api/v1/sessions/key", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
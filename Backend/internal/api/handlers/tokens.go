@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/validators"
+	"github.com/Lionel-Wilson/payment-gateway/internal/card"
+	"github.com/Lionel-Wilson/payment-gateway/internal/storage"
+	"github.com/Lionel-Wilson/payment-gateway/internal/vault"
+	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// CreateToken stores a card in the vault in exchange for a token.
+//
+// @Summary      Tokenize a Card
+// @Description  Stores a card in the vault, encrypted, and returns a token that can be charged instead of sending the
+// @Description  card details again. Only the merchant that created a token can use it.
+// @Tags         Tokens
+// @Accept       json
+// @Produce      json
+// @Param        TokenRequestBody body TokenRequest true "A JSON body"
+// @Success      201  {object}  Token
+// @Failure      400  {object}  ErrorResponse
+// @Failure      422  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Failure      503  {object}  ErrorResponse
+// @Router       /tokens [post]
+func (app *Application) CreateToken(c *gin.Context) {
+	if !app.tokenizationEnabled(c) {
+		return
+	}
+
+	var tokenRequest models.TokenRequest
+	if err := c.ShouldBindJSON(&tokenRequest); err != nil {
+		utils.NewErrorResponse(c, http.StatusBadRequest, "Invalid request payload", nil)
+		return
+	}
+
+	utils.TrimWhitespace(&tokenRequest)
+	tokenRequest.ExpiryDate = expiryDate(tokenRequest.ExpiryDate, tokenRequest.ExpiryMonth, tokenRequest.ExpiryYear)
+
+	if err := app.validateCard(c.Request.Context(), tokenRequest); err != nil {
+		var validationErrs validator.ValidationErrors
+		if errors.As(err, &validationErrs) {
+			utils.NewErrorResponse(c, http.StatusUnprocessableEntity, "Validation failed", validators.TranslateValidationErrors(err))
+			return
+		}
+
+		app.ErrorLog.Printf("failed to validate token request: %v", err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	id, err := vault.NewTokenID()
+	if err != nil {
+		app.ErrorLog.Printf("failed to generate token ID: %v", err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	// Expiry dates are stored in MM/YY format
+	expiry, _ := card.ParseExpiry(tokenRequest.ExpiryDate)
+	keyID, encrypted, err := app.Vault.Seal(id, vault.Card{
+		Number:     tokenRequest.CardNumber,
+		ExpiryDate: expiry.String(),
+		FirstName:  tokenRequest.FirstName,
+		LastName:   tokenRequest.LastName,
+	})
+	if err != nil {
+		app.ErrorLog.Printf("failed to encrypt card for token %s: %v", id, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	brand, _ := card.Detect(tokenRequest.CardNumber)
+	token := models.Token{
+		ID:            id,
+		MerchantID:    merchantID(c),
+		CardBrand:     brand,
+		CardLast4:     card.Last4(tokenRequest.CardNumber),
+		EncryptedCard: encrypted,
+		KeyID:         keyID,
+		CreatedAt:     app.now().UTC(),
+	}
+
+	if err := app.Tokens.CreateToken(c.Request.Context(), token); err != nil {
+		app.ErrorLog.Printf("failed to create token %s: %v", id, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	c.JSON(http.StatusCreated, token)
+}
+
+// RetrieveToken retrieves a token created by the merchant making the request.
+//
+// @Summary      Retrieve a Token
+// @Description  Retrieves a token, showing the brand and last four digits of its card and whether it has been revoked.
+// @Tags         Tokens
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "Token ID"
+// @Success      200  {object}  Token
+// @Failure      404  {object}  ErrorResponse
+// @Router       /tokens/{id} [get]
+func (app *Application) RetrieveToken(c *gin.Context) {
+	token, ok := app.findToken(c, strings.TrimSpace(c.Param("id")))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, token)
+}
+
+// RevokeToken revokes a token created by the merchant making the request, so that it can no longer be charged.
+//
+// @Summary      Revoke a Token
+// @Description  Revokes a token so that it can no longer be charged. Revoking a revoked token has no effect.
+// @Tags         Tokens
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "Token ID"
+// @Success      200  {object}  Token
+// @Failure      404  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /tokens/{id} [delete]
+func (app *Application) RevokeToken(c *gin.Context) {
+	token, ok := app.findToken(c, strings.TrimSpace(c.Param("id")))
+	if !ok {
+		return
+	}
+
+	if err := app.Tokens.RevokeToken(c.Request.Context(), token.ID, app.now()); err != nil {
+		app.ErrorLog.Printf("failed to revoke token %s: %v", token.ID, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	token, ok = app.findToken(c, token.ID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, token)
+}
+
+// findToken retrieves the token with the given ID. Tokens created by other merchants are reported as not found.
+// If the token cannot be retrieved, an error response is sent and false is returned.
+func (app *Application) findToken(c *gin.Context, id string) (models.Token, bool) {
+	token, err := app.Tokens.GetToken(c.Request.Context(), id)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && token.MerchantID != merchantID(c)) {
+		utils.NewErrorResponse(c, http.StatusNotFound, "Token not found", nil)
+		return models.Token{}, false
+	} else if err != nil {
+		app.ErrorLog.Printf("failed to retrieve token %s: %v", id, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return models.Token{}, false
+	}
+
+	return token, true
+}
+
+// useToken replaces the token in a payment request with the card details it stands for. If the token cannot be
+// used, an error response is sent and false is returned.
+func (app *Application) useToken(c *gin.Context, paymentDetails *models.ProcessPaymentRequest) bool {
+	if !app.tokenizationEnabled(c) {
+		return false
+	}
+
+	if paymentDetails.CardNumber != "" || paymentDetails.ExpiryDate != "" || paymentDetails.ExpiryMonth != 0 || paymentDetails.ExpiryYear != 0 {
+		utils.NewErrorResponse(c, http.StatusUnprocessableEntity, "Validation failed", []string{"Token cannot be combined with card details"})
+		return false
+	}
+
+	token, err := app.Tokens.GetToken(c.Request.Context(), paymentDetails.Token)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && token.MerchantID != merchantID(c)) {
+		utils.NewErrorResponse(c, http.StatusUnprocessableEntity, "Validation failed", []string{"Token was not found"})
+		return false
+	} else if err != nil {
+		app.ErrorLog.Printf("failed to retrieve token %s: %v", paymentDetails.Token, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return false
+	}
+
+	if token.RevokedAt != nil {
+		utils.NewErrorResponse(c, http.StatusUnprocessableEntity, "Validation failed", []string{"Token has been revoked"})
+		return false
+	}
+
+	stored, err := app.Vault.Open(token.ID, token.KeyID, token.EncryptedCard)
+	if err != nil {
+		app.ErrorLog.Printf("failed to decrypt card for token %s: %v", token.ID, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return false
+	}
+
+	paymentDetails.CardNumber = stored.Number
+	paymentDetails.ExpiryDate = stored.ExpiryDate
+
+	// The cardholder's name may be updated with the payment
+	if paymentDetails.FirstName == "" && paymentDetails.LastName == "" {
+		paymentDetails.FirstName = stored.FirstName
+		paymentDetails.LastName = stored.LastName
+	}
+
+	return true
+}
+
+// tokenizationEnabled reports whether the application has a vault. If it does not, a 503 response is sent.
+func (app *Application) tokenizationEnabled(c *gin.Context) bool {
+	if app.Vault == nil {
+		utils.NewErrorResponse(c, http.StatusServiceUnavailable, "Card tokenization is not configured", nil)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/apikey"
+	"github.com/Lionel-Wilson/payment-gateway/internal/money"
+	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// asMerchant returns a handler that calls next on behalf of the given merchant, as if with one of its secret keys.
+func asMerchant(merchantID string, next gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(MerchantIDKey, merchantID)
+		c.Set(APIKeyKey, models.APIKey{ID: "KEY-" + merchantID, MerchantID: merchantID, Kind: apikey.Secret})
+		next(c)
+	}
+}
+
+// createTestToken tokenizes the Visa test card for the given merchant and returns the token.
+func createTestToken(t *testing.T, app *Application, merchantID string) models.Token {
+	t.Helper()
+
+	router := gin.New()
+	router.POST("/api/v1/tokens", asMerchant(merchantID, app.CreateToken))
+
+	reqBody, _ := json.Marshal(models.TokenRequest{
+		FirstName:  "John",
+		LastName:   "Doe",
+		CardNumber: "4111111111111111",
+		ExpiryDate: "12/2029",
+	})
+	req, _ := http.NewRequest("POST", "/api/v1/tokens", bytes.NewBuffer(reqBody))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusCreated, rr.Code)
+
+	var token models.Token
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &token))
+
+	return token
+}
+
+func TestCreateToken(t *testing.T) {
+	app := setupTestApp()
+	token := createTestToken(t, app, "merchant-1")
+
+	assert.Regexp(t, `^TOK-[0-9a-f]{32}$`, token.ID)
+	assert.Equal(t, "visa", string(token.CardBrand))
+	assert.Equal(t, "1111", token.CardLast4)
+	assert.Equal(t, testNow, token.CreatedAt)
+	assert.Nil(t, token.RevokedAt)
+
+	stored, err := app.Tokens.GetToken(context.Background(), token.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "merchant-1", stored.MerchantID)
+	assert.NotContains(t, string(stored.EncryptedCard), "4111111111111111", "card numbers are stored encrypted")
+
+	card, err := app.Vault.Open(token.ID, stored.KeyID, stored.EncryptedCard)
+	assert.NoError(t, err)
+	assert.Equal(t, "4111111111111111", card.Number)
+	assert.Equal(t, "12/29", card.ExpiryDate)
+
+	tests := []struct {
+		name               string
+		body               string
+		disableVault       bool
+		expectedStatusCode int
+		expectedMessage    string
+		expectedErrors     []string
+	}{
+		{
+			name:               "Expired Card",
+			body:               `{"firstName": "John", "lastName": "Doe", "cardNumber": "4111111111111111", "expiryMonth": 1, "expiryYear": 2020}`,
+			expectedStatusCode: http.StatusUnprocessableEntity,
+			expectedMessage:    "Validation failed",
+			expectedErrors:     []string{"ExpiryDate is in the past, so the card has expired"},
+		},
+		{
+			name:               "Invalid Card Number",
+			body:               `{"firstName": "John", "lastName": "Doe", "cardNumber": "4111111111111112", "expiryDate": "12/29"}`,
+			expectedStatusCode: http.StatusUnprocessableEntity,
+			expectedMessage:    "Validation failed",
+			expectedErrors:     []string{"CardNumber must be a valid credit card number"},
+		},
+		{
+			name:               "Invalid JSON",
+			body:               `{"cardNumber": 4111111111111111}`,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedMessage:    "Invalid request payload",
+		},
+		{
+			name:               "Tokenization Not Configured",
+			body:               `{"firstName": "John", "lastName": "Doe", "cardNumber": "4111111111111111", "expiryDate": "12/29"}`,
+			disableVault:       true,
+			expectedStatusCode: http.StatusServiceUnavailable,
+			expectedMessage:    "Card tokenization is not configured",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := setupTestApp()
+			if tt.disableVault {
+				app.Vault = nil
+			}
+			router := gin.New()
+			router.POST("/api/v1/tokens", app.CreateToken)
+
+			req, _ := http.NewRequest("POST", "/api/v1/tokens", bytes.NewBufferString(tt.body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+
+			var errorResponse utils.ErrorResponse
+			err := json.Unmarshal(rr.Body.Bytes(), &errorResponse)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedMessage, errorResponse.Message)
+			assert.Equal(t, tt.expectedErrors, errorResponse.Errors)
+		})
+	}
+}
+
+func TestRetrieveAndRevokeToken(t *testing.T) {
+	app := setupTestApp()
+	token := createTestToken(t, app, "merchant-1")
+
+	request := func(method, merchantID, id string) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.GET("/api/v1/tokens/:id", asMerchant(merchantID, app.RetrieveToken))
+		router.DELETE("/api/v1/tokens/:id", asMerchant(merchantID, app.RevokeToken))
+
+		req, _ := http.NewRequest(method, "/api/v1/tokens/"+id, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	rr := request("GET", "merchant-1", token.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"id": "`+token.ID+`", "cardBrand": "visa", "cardLast4": "1111", "createdAt": "2024-07-01T12:00:00Z"}`, rr.Body.String())
+
+	assert.Equal(t, http.StatusNotFound, request("GET", "merchant-2", token.ID).Code, "tokens are scoped to their merchant")
+	assert.Equal(t, http.StatusNotFound, request("DELETE", "merchant-2", token.ID).Code)
+	assert.Equal(t, http.StatusNotFound, request("GET", "merchant-1", "TOK-404").Code)
+
+	revokedAt := testNow.Add(time.Hour)
+	app.Clock = func() time.Time { return revokedAt }
+
+	rr = request("DELETE", "merchant-1", token.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var revoked models.Token
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &revoked))
+	if assert.NotNil(t, revoked.RevokedAt) {
+		assert.Equal(t, revokedAt, *revoked.RevokedAt)
+	}
+
+	assert.Equal(t, http.StatusOK, request("DELETE", "merchant-1", token.ID).Code, "revoking a revoked token has no effect")
+}
+
+func TestProcessPaymentWithToken(t *testing.T) {
+	tests := []struct {
+		name               string
+		merchantID         string
+		body               string
+		revoke             bool
+		expectedStatusCode int
+		expectedErrors     []string
+	}{
+		{
+			name:               "Token",
+			merchantID:         "merchant-1",
+			body:               `{"token": "%s", "amount": {"value": 10000, "currency": "USD"}}`,
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name:               "Token With CVV",
+			merchantID:         "merchant-1",
+			body:               `{"token": "%s", "cvv": "123", "amount": {"value": 10000, "currency": "USD"}}`,
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name:               "Token With Wrong Length CVV",
+			merchantID:         "merchant-1",
+			body:               `{"token": "%s", "cvv": "1234", "amount": {"value": 10000, "currency": "USD"}}`,
+			expectedStatusCode: http.StatusUnprocessableEntity,
+			expectedErrors:     []string{"CVV must be 3 digits, or 4 digits for American Express cards"},
+		},
+		{
+			name:               "Token Of Another Merchant",
+			merchantID:         "merchant-2",
+			body:               `{"token": "%s", "amount": {"value": 10000, "currency": "USD"}}`,
+			expectedStatusCode: http.StatusUnprocessableEntity,
+			expectedErrors:     []string{"Token was not found"},
+		},
+		{
+			name:               "Revoked Token",
+			merchantID:         "merchant-1",
+			body:               `{"token": "%s", "amount": {"value": 10000, "currency": "USD"}}`,
+			revoke:             true,
+			expectedStatusCode: http.StatusUnprocessableEntity,
+			expectedErrors:     []string{"Token has been revoked"},
+		},
+		{
+			name:               "Token With Card Details",
+			merchantID:         "merchant-1",
+			body:               `{"token": "%s", "cardNumber": "4111111111111111", "amount": {"value": 10000, "currency": "USD"}}`,
+			expectedStatusCode: http.StatusUnprocessableEntity,
+			expectedErrors:     []string{"Token cannot be combined with card details"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := setupTestApp()
+			token := createTestToken(t, app, "merchant-1")
+			if tt.revoke {
+				require.NoError(t, app.Tokens.RevokeToken(context.Background(), token.ID, testNow))
+			}
+
+			router := gin.New()
+			router.POST("/api/v1/payments", asMerchant(tt.merchantID, app.ProcessPayment))
+
+			body := bytes.NewBufferString(fmt.Sprintf(tt.body, token.ID))
+			req, _ := http.NewRequest("POST", "/api/v1/payments", body)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+
+			if rr.Code != http.StatusCreated {
+				var errorResponse utils.ErrorResponse
+				err := json.Unmarshal(rr.Body.Bytes(), &errorResponse)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedErrors, errorResponse.Errors)
+				return
+			}
+
+			var response models.ProcessPaymentResponse
+			err := json.Unmarshal(rr.Body.Bytes(), &response)
+			assert.NoError(t, err)
+			assert.Equal(t, models.StatusPaid, response.Status)
+
+			payment, err := app.Payments.GetPayment(context.Background(), response.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, "John", payment.FirstName)
+			assert.Equal(t, "************1111", payment.CardNumber)
+			assert.Equal(t, "12/29", payment.ExpiryDate)
+			assert.Equal(t, money.New(10000, "USD"), payment.Amount)
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/account"
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/validators"
+	"github.com/Lionel-Wilson/payment-gateway/internal/storage"
+	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateUser creates a dashboard user for the merchant making the request.
+//
+// @Summary      Create a User
+// @Description  Creates a user who can log in to the merchant's dashboard. What they can do is determined by their
+// @Description  role: admin, developer, support or finance.
+// @Tags         Users
+// @Accept       json
+// @Produce      json
+// @Param        CreateUserRequestBody body CreateUserRequest true "A JSON body"
+// @Success      201  {object}  User
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      409  {object}  ErrorResponse
+// @Failure      422  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /users [post]
+func (app *Application) CreateUser(c *gin.Context) {
+	var userRequest models.CreateUserRequest
+	if err := c.ShouldBindJSON(&userRequest); err != nil {
+		utils.NewErrorResponse(c, http.StatusBadRequest, "Invalid request payload", nil)
+		return
+	}
+
+	// The password is not trimmed, since its spaces may be deliberate
+	password := userRequest.Password
+	utils.TrimWhitespace(&userRequest)
+	userRequest.Password = password
+
+	if err := validate.Struct(userRequest); err != nil {
+		utils.NewErrorResponse(c, http.StatusUnprocessableEntity, "Validation failed", validators.TranslateValidationErrors(err))
+		return
+	}
+
+	id, err := account.NewUserID()
+	if err != nil {
+		app.ErrorLog.Printf("failed to generate user ID: %v", err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	hash, err := account.HashPassword(userRequest.Password)
+	if err != nil {
+		app.ErrorLog.Printf("failed to hash password of user %s: %v", id, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	user := models.User{
+		ID:           id,
+		MerchantID:   merchantID(c),
+		Email:        account.NormalizeEmail(userRequest.Email),
+		Name:         userRequest.Name,
+		Role:         userRequest.Role,
+		PasswordHash: hash,
+		CreatedAt:    app.now().UTC(),
+	}
+
+	err = app.Users.CreateUser(c.Request.Context(), user)
+	if errors.Is(err, storage.ErrDuplicate) {
+		utils.NewErrorResponse(c, http.StatusConflict, "Email address is already in use", nil)
+		return
+	} else if err != nil {
+		app.ErrorLog.Printf("failed to create user %s: %v", id, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	c.JSON(http.StatusCreated, user)
+}
+
+// ListUsers lists the dashboard users of the merchant making the request.
+//
+// @Summary      List Users
+// @Description  Lists the dashboard users of the merchant, including disabled users, in the order they were created.
+// @Tags         Users
+// @Accept       json
+// @Produce      json
+// @Success      200  {array}   User
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /users [get]
+func (app *Application) ListUsers(c *gin.Context) {
+	users, err := app.Users.ListUsers(c.Request.Context(), merchantID(c))
+	if err != nil {
+		app.ErrorLog.Printf("failed to list users: %v", err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// UpdateUser changes the role of a dashboard user of the merchant making the request.
+//
+// @Summary      Update a User
+// @Description  Changes the role of a dashboard user, which takes effect on their next request. Users cannot change
+// @Description  their own role.
+// @Tags         Users
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "User ID"
+// @Param        UpdateUserRequestBody body UpdateUserRequest true "A JSON body"
+// @Success      200  {object}  User
+// @Failure      400  {object}  ErrorResponse
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      422  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /users/{id} [patch]
+func (app *Application) UpdateUser(c *gin.Context) {
+	var updateRequest models.UpdateUserRequest
+	if err := c.ShouldBindJSON(&updateRequest); err != nil {
+		utils.NewErrorResponse(c, http.StatusBadRequest, "Invalid request payload", nil)
+		return
+	}
+
+	utils.TrimWhitespace(&updateRequest)
+
+	if err := validate.Struct(updateRequest); err != nil {
+		utils.NewErrorResponse(c, http.StatusUnprocessableEntity, "Validation failed", validators.TranslateValidationErrors(err))
+		return
+	}
+
+	user, ok := app.findOtherUser(c, strings.TrimSpace(c.Param("id")), "Users cannot change their own role")
+	if !ok {
+		return
+	}
+
+	if err := app.Users.UpdateUserRole(c.Request.Context(), user.ID, updateRequest.Role); err != nil {
+		app.ErrorLog.Printf("failed to update role of user %s: %v", user.ID, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	user.Role = updateRequest.Role
+	c.JSON(http.StatusOK, user)
+}
+
+// DisableUser disables a dashboard user of the merchant making the request, so that they can no longer log in.
+//
+// @Summary      Disable a User
+// @Description  Disables a dashboard user, ending their sessions and stopping them logging in again. Disabling a
+// @Description  disabled user has no effect. Users cannot disable themselves.
+// @Tags         Users
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "User ID"
+// @Success      200  {object}  User
+// @Failure      401  {object}  ErrorResponse
+// @Failure      403  {object}  ErrorResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      422  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Router       /users/{id} [delete]
+func (app *Application) DisableUser(c *gin.Context) {
+	user, ok := app.findOtherUser(c, strings.TrimSpace(c.Param("id")), "Users cannot disable themselves")
+	if !ok {
+		return
+	}
+
+	if err := app.Users.DisableUser(c.Request.Context(), user.ID, app.now().UTC()); err != nil {
+		app.ErrorLog.Printf("failed to disable user %s: %v", user.ID, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	user, ok = app.findUser(c, user.ID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// findUser retrieves the user with the given ID. Users of other merchants are reported as not found.
+// If the user cannot be retrieved, an error response is sent and false is returned.
+func (app *Application) findUser(c *gin.Context, id string) (models.User, bool) {
+	user, err := app.Users.GetUser(c.Request.Context(), id)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && user.MerchantID != merchantID(c)) {
+		utils.NewErrorResponse(c, http.StatusNotFound, "User not found", nil)
+		return models.User{}, false
+	} else if err != nil {
+		app.ErrorLog.Printf("failed to retrieve user %s: %v", id, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return models.User{}, false
+	}
+
+	return user, true
+}
+
+// findOtherUser retrieves the user with the given ID like findUser, but also rejects the user making the request,
+// so that an admin cannot lock themselves out. The reason is sent in the error response.
+func (app *Application) findOtherUser(c *gin.Context, id, reason string) (models.User, bool) {
+	if current, ok := c.Get(UserKey); ok && current.(models.User).ID == id {
+		utils.NewErrorResponse(c, http.StatusUnprocessableEntity, "User cannot be changed", []string{reason})
+		return models.User{}, false
+	}
+
+	return app.findUser(c, id)
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/account"
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/rbac"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// asUser runs next as if the request had been made with a session of the given user.
+func asUser(user models.User, next gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(MerchantIDKey, user.MerchantID)
+		c.Set(UserKey, user)
+		next(c)
+	}
+}
+
+// setupUserRouter returns a router serving the user endpoints on behalf of the given merchant.
+func setupUserRouter(app *Application, merchantID string) *gin.Engine {
+	router := gin.New()
+	router.POST("/api/v1/users", asMerchant(merchantID, app.CreateUser))
+	router.GET("/api/v1/users", asMerchant(merchantID, app.ListUsers))
+	router.PATCH("/api/v1/users/:id", asMerchant(merchantID, app.UpdateUser))
+	router.DELETE("/api/v1/users/:id", asMerchant(merchantID, app.DisableUser))
+
+	return router
+}
+
+// createTestUser creates a user through the API for the given merchant and returns it.
+func createTestUser(t *testing.T, app *Application, merchantID, email string, role rbac.Role) models.User {
+	t.Helper()
+
+	body, _ := json.Marshal(models.CreateUserRequest{Email: email, Name: "Jane Doe", Role: role, Password: "correct horse battery staple"})
+	rr := sendAPIKeyRequest(setupUserRouter(app, merchantID), "POST", "/api/v1/users", string(body))
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	var user models.User
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &user))
+	return user
+}
+
+func TestCreateUser(t *testing.T) {
+	app := setupTestApp()
+	router := setupUserRouter(app, "merchant-1")
+
+	user := createTestUser(t, app, "merchant-1", " Jane@Example.com ", rbac.Support)
+	assert.Regexp(t, `^USR-[0-9a-f]{32}$`, user.ID)
+	assert.Equal(t, "jane@example.com", user.Email)
+	assert.Equal(t, rbac.Support, user.Role)
+	assert.Equal(t, testNow, user.CreatedAt)
+
+	stored, err := app.Users.GetUser(context.Background(), user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "merchant-1", stored.MerchantID)
+	assert.True(t, account.CheckPassword(stored.PasswordHash, "correct horse battery staple"))
+
+	tests := []struct {
+		name               string
+		body               string
+		expectedStatusCode int
+		expectedMessage    string
+	}{
+		{"Duplicate Email", `{"email":"JANE@example.com","name":"Jane","role":"admin","password":"correct horse battery staple"}`, http.StatusConflict, "Email address is already in use"},
+		{"Invalid Email", `{"email":"jane","name":"Jane","role":"admin","password":"correct horse battery staple"}`, http.StatusUnprocessableEntity, "Validation failed"},
+		{"Unknown Role", `{"email":"john@example.com","name":"John","role":"owner","password":"correct horse battery staple"}`, http.StatusUnprocessableEntity, "Validation failed"},
+		{"Short Password", `{"email":"john@example.com","name":"John","role":"admin","password":"password"}`, http.StatusUnprocessableEntity, "Validation failed"},
+		{"Invalid JSON", `{"email":`, http.StatusBadRequest, "Invalid request payload"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := sendAPIKeyRequest(router, "POST", "/api/v1/users", tt.body)
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.expectedMessage)
+			assert.NotContains(t, rr.Body.String(), "correct horse")
+		})
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	app := setupTestApp()
+	first := createTestUser(t, app, "merchant-1", "jane@example.com", rbac.Admin)
+	second := createTestUser(t, app, "merchant-1", "john@example.com", rbac.Finance)
+	createTestUser(t, app, "merchant-2", "other@example.com", rbac.Admin)
+
+	rr := sendAPIKeyRequest(setupUserRouter(app, "merchant-1"), "GET", "/api/v1/users", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var users []models.User
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &users))
+	assert.Equal(t, []models.User{first, second}, users)
+	assert.NotContains(t, rr.Body.String(), "$2a$", "password hashes are never returned")
+}
+
+func TestUpdateAndDisableUser(t *testing.T) {
+	app := setupTestApp()
+	admin := createTestUser(t, app, "merchant-1", "admin@example.com", rbac.Admin)
+	user := createTestUser(t, app, "merchant-1", "jane@example.com", rbac.Support)
+	other := createTestUser(t, app, "merchant-2", "other@example.com", rbac.Support)
+	admin.MerchantID = "merchant-1" // The merchant is not part of the response
+
+	router := gin.New()
+	router.PATCH("/api/v1/users/:id", asUser(admin, app.UpdateUser))
+	router.DELETE("/api/v1/users/:id", asUser(admin, app.DisableUser))
+
+	tests := []struct {
+		name               string
+		method             string
+		path               string
+		body               string
+		expectedStatusCode int
+		expectedRole       rbac.Role
+		expectedDisabled   bool
+	}{
+		{"Change Role", "PATCH", "/api/v1/users/" + user.ID, `{"role":"finance"}`, http.StatusOK, rbac.Finance, false},
+		{"Unknown Role", "PATCH", "/api/v1/users/" + user.ID, `{"role":"owner"}`, http.StatusUnprocessableEntity, "", false},
+		{"Change Own Role", "PATCH", "/api/v1/users/" + admin.ID, `{"role":"support"}`, http.StatusUnprocessableEntity, "", false},
+		{"Change Role Of Other Merchant's User", "PATCH", "/api/v1/users/" + other.ID, `{"role":"admin"}`, http.StatusNotFound, "", false},
+		{"Disable", "DELETE", "/api/v1/users/" + user.ID, "", http.StatusOK, rbac.Finance, true},
+		{"Disable Again", "DELETE", "/api/v1/users/" + user.ID, "", http.StatusOK, rbac.Finance, true},
+		{"Disable Self", "DELETE", "/api/v1/users/" + admin.ID, "", http.StatusUnprocessableEntity, "", false},
+		{"Disable Other Merchant's User", "DELETE", "/api/v1/users/" + other.ID, "", http.StatusNotFound, "", false},
+		{"Disable Unknown User", "DELETE", "/api/v1/users/USR-404", "", http.StatusNotFound, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := sendAPIKeyRequest(router, tt.method, tt.path, tt.body)
+			require.Equal(t, tt.expectedStatusCode, rr.Code, rr.Body.String())
+			if tt.expectedStatusCode != http.StatusOK {
+				return
+			}
+
+			var response models.User
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			assert.Equal(t, tt.expectedRole, response.Role)
+			assert.Equal(t, tt.expectedDisabled, response.DisabledAt != nil)
+		})
+	}
+
+	stored, err := app.Users.GetUser(context.Background(), other.ID)
+	require.NoError(t, err)
+	assert.Equal(t, rbac.Support, stored.Role)
+	assert.Nil(t, stored.DisabledAt)
+}
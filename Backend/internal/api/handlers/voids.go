@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/bank"
+	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// VoidPayment releases the funds held by an authorized payment that has not been captured.
+//
+// @Summary      Void a Payment
+// @Description  Voids an authorized payment before it is captured, releasing the funds held on the customer's card.
+// @Tags         Payments
+// @Accept       json
+// @Produce      json
+// @Param        id   path      string  true  "Payment ID"
+// @Success      201  {object}  VoidResponse
+// @Failure      402  {object}  VoidResponse
+// @Failure      404  {object}  ErrorResponse
+// @Failure      409  {object}  ErrorResponse
+// @Failure      500  {object}  ErrorResponse
+// @Failure      502  {object}  VoidResponse
+// @Failure      504  {object}  VoidResponse
+// @Router       /payments/{id}/voids [post]
+func (app *Application) VoidPayment(c *gin.Context) {
+	id := strings.TrimSpace(c.Param("id"))
+
+	payment, ok := app.findPayment(c, id)
+	if !ok {
+		return
+	}
+
+	if !canTransition(c, payment, models.StatusVoided, "Payment cannot be voided") {
+		return
+	}
+
+	if app.authorizationLapsed(c, payment) {
+		return
+	}
+
+	contactingBank(c)
+	bankResponse, err := app.Bank.Void(c.Request.Context(), bank.VoidRequest{
+		Reference:     payment.ID,
+		BankReference: payment.BankReference,
+	})
+
+	response := models.VoidResponse{
+		PaymentID: payment.ID,
+		Status:    payment.Status,
+	}
+
+	// A failed or declined void leaves the payment authorized, so it can be retried
+	if failure, failed := bankFailure(err); failed {
+		response.StatusCode = failure.StatusCode
+		response.ResponseSummary = failure.Summary
+		c.JSON(bankFailureStatus(failure.StatusCode), response)
+		return
+	} else if err != nil {
+		app.ErrorLog.Printf("failed to void payment %s: %v", id, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		return
+	}
+
+	response.StatusCode = bankResponse.StatusCode
+	response.ResponseSummary = bankResponse.Summary
+
+	if !bankResponse.Approved {
+		c.JSON(http.StatusPaymentRequired, response)
+		return
+	}
+
+	voided := payment
+	voided.Status = models.StatusVoided
+	voided.StatusCode = bankResponse.StatusCode
+	voided.ResponseSummary = bankResponse.Summary
+	voided.AuthorizationExpiresAt = nil
+
+	if !app.savePayment(c, voided) {
+		return
+	}
+
+	response.Status = voided.Status
+	c.JSON(http.StatusCreated, response)
+}
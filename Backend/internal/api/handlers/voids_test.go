@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVoidPayment(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	paid := authorizedPayment("PAY-12345", now.Add(time.Hour))
+	paid.Status = "payment_paid"
+
+	tests := []struct {
+		name                  string
+		setupPayments         []models.PaymentDetails
+		paymentID             string
+		expectedStatusCode    int
+		expectedResponse      interface{}
+		expectedPaymentStatus models.PaymentStatus
+	}{
+		{
+			name:                  "Authorized Payment",
+			setupPayments:         []models.PaymentDetails{authorizedPayment("PAY-12345", now.Add(time.Hour))},
+			paymentID:             "PAY-12345",
+			expectedStatusCode:    http.StatusCreated,
+			expectedResponse:      "payment_voided",
+			expectedPaymentStatus: "payment_voided",
+		},
+		{
+			name:                  "Captured Payment",
+			setupPayments:         []models.PaymentDetails{paid},
+			paymentID:             "PAY-12345",
+			expectedStatusCode:    http.StatusConflict,
+			expectedResponse:      "Payment cannot be voided",
+			expectedPaymentStatus: "payment_paid",
+		},
+		{
+			name:                  "Expired Authorization",
+			setupPayments:         []models.PaymentDetails{authorizedPayment("PAY-12345", now.Add(-time.Hour))},
+			paymentID:             "PAY-12345",
+			expectedStatusCode:    http.StatusConflict,
+			expectedResponse:      "Authorization has expired",
+			expectedPaymentStatus: "payment_expired",
+		},
+		{
+			name:               "Non-Existent Payment",
+			setupPayments:      []models.PaymentDetails{},
+			paymentID:          "PAY-99999",
+			expectedStatusCode: http.StatusNotFound,
+			expectedResponse:   "Payment not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := seedPayments(t, tt.setupPayments)
+			app.Clock = func() time.Time { return now }
+
+			router := gin.New()
+			router.POST("/api/v1/payments/:id/voids", app.VoidPayment)
+
+			req, _ := http.NewRequest("POST", "/api/v1/payments/"+tt.paymentID+"/voids", nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+
+			if rr.Code == http.StatusCreated {
+				var response models.VoidResponse
+				err := json.Unmarshal(rr.Body.Bytes(), &response)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedResponse, string(response.Status))
+				assert.Equal(t, "Approved", response.ResponseSummary)
+			} else {
+				var errorResponse utils.ErrorResponse
+				err := json.Unmarshal(rr.Body.Bytes(), &errorResponse)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedResponse, errorResponse.Message)
+			}
+
+			if tt.expectedPaymentStatus != "" {
+				payment, err := app.Payments.GetPayment(context.Background(), tt.paymentID)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedPaymentStatus, payment.Status)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package middlewares
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/account"
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/handlers"
+	"github.com/Lionel-Wilson/payment-gateway/internal/apikey"
+	"github.com/Lionel-Wilson/payment-gateway/internal/oauth"
+	"github.com/Lionel-Wilson/payment-gateway/internal/storage"
+	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyConfig configures the APIKeyAuth middleware.
+type APIKeyConfig struct {
+	Store        storage.APIKeyStore  // Store holding the merchants' API keys
+	AccessTokens *oauth.Issuer        // Issuer of the OAuth access tokens accepted in place of keys. Tokens are rejected when nil
+	Sessions     storage.SessionStore // Store holding dashboard sessions. Session tokens are rejected when nil
+	Users        storage.UserStore    // Store holding dashboard users. Required when Sessions is set
+	Clock        func() time.Time     // Returns the current time. Defaults to time.Now when nil
+	ErrorLog     *log.Logger          // Logger for errors that prevent a key from being checked
+}
+
+func (config APIKeyConfig) now() time.Time {
+	if config.Clock != nil {
+		return config.Clock()
+	}
+
+	return time.Now()
+}
+
+// APIKeyAuth authenticates requests by the API key in their "Authorization: Bearer" header. The key's merchant is
+// stored in the context under handlers.MerchantIDKey, and the key itself under handlers.APIKeyKey. Requests without
+// a key, or with a key that is unknown, revoked or expired, are rejected with a 401.
+//
+// Depending on the config, two other bearer tokens are accepted in place of a key. An OAuth access token stores the
+// merchant it acts for under handlers.MerchantIDKey, and its claims under handlers.AccessTokenKey. A dashboard session
+// token stores the user's merchant under handlers.MerchantIDKey, and the user under handlers.UserKey.
+func APIKeyAuth(config APIKeyConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scheme, key, _ := strings.Cut(c.GetHeader("Authorization"), " ")
+		if !strings.EqualFold(scheme, "Bearer") || key == "" {
+			unauthorized(c, "Missing API key")
+			return
+		}
+
+		switch _, _, err := apikey.Parse(key); {
+		case err == nil:
+			authenticateAPIKey(c, config, key)
+		case config.Sessions != nil && account.IsSessionToken(key):
+			authenticateSession(c, config, key)
+		case config.AccessTokens != nil:
+			authenticateAccessToken(c, config, key)
+		default:
+			unauthorized(c, "Invalid API key")
+		}
+	}
+}
+
+// authenticateAPIKey authenticates a request made with an API key.
+func authenticateAPIKey(c *gin.Context, config APIKeyConfig, key string) {
+	stored, err := config.Store.GetAPIKeyByHash(c.Request.Context(), apikey.Hash(key))
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && !stored.Active(config.now())) {
+		unauthorized(c, "Invalid API key")
+		return
+	} else if err != nil {
+		config.ErrorLog.Printf("failed to retrieve API key: %v", err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		c.Abort()
+		return
+	}
+
+	c.Set(handlers.MerchantIDKey, stored.MerchantID)
+	c.Set(handlers.APIKeyKey, stored)
+	c.Next()
+}
+
+// authenticateAccessToken authenticates a request made with an OAuth access token.
+func authenticateAccessToken(c *gin.Context, config APIKeyConfig, token string) {
+	claims, err := config.AccessTokens.Verify(token, config.now())
+	if err != nil {
+		unauthorized(c, "Invalid access token")
+		return
+	}
+
+	c.Set(handlers.MerchantIDKey, claims.MerchantID)
+	c.Set(handlers.AccessTokenKey, claims)
+	c.Next()
+}
+
+// authenticateSession authenticates a request made with a dashboard session token. The user is looked up on every
+// request, so that changing their role or disabling them takes effect immediately.
+func authenticateSession(c *gin.Context, config APIKeyConfig, token string) {
+	ctx := c.Request.Context()
+
+	session, err := config.Sessions.GetSession(ctx, account.HashSessionToken(token))
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && !config.now().Before(session.ExpiresAt)) {
+		unauthorized(c, "Invalid session")
+		return
+	} else if err != nil {
+		config.ErrorLog.Printf("failed to retrieve session: %v", err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		c.Abort()
+		return
+	}
+
+	user, err := config.Users.GetUser(ctx, session.UserID)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && (user.DisabledAt != nil || user.MerchantID != session.MerchantID)) {
+		unauthorized(c, "Invalid session")
+		return
+	} else if err != nil {
+		config.ErrorLog.Printf("failed to retrieve user %s: %v", session.UserID, err)
+		utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+		c.Abort()
+		return
+	}
+
+	c.Set(handlers.MerchantIDKey, user.MerchantID)
+	c.Set(handlers.UserKey, user)
+	c.Set(handlers.SessionKey, session)
+	c.Next()
+}
+
+// unauthorized rejects a request that is not authenticated.
+func unauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="api"`)
+	utils.NewErrorResponse(c, http.StatusUnauthorized, message, nil)
+	c.Abort()
+}
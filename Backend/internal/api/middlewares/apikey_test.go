@@ -0,0 +1,185 @@
+package middlewares
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/handlers"
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/apikey"
+	"github.com/Lionel-Wilson/payment-gateway/internal/oauth"
+	"github.com/Lionel-Wilson/payment-gateway/internal/rbac"
+	"github.com/Lionel-Wilson/payment-gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyAuth(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	store := storage.NewMemoryStore()
+
+	// storeKey stores a new key for merchant-1 and returns it
+	storeKey := func(kind apikey.Kind, change func(*models.APIKey)) string {
+		secret, err := apikey.Generate(kind, apikey.Test)
+		require.NoError(t, err)
+		id, err := apikey.NewID()
+		require.NoError(t, err)
+
+		key := models.APIKey{ID: id, MerchantID: "merchant-1", Kind: kind, Mode: apikey.Test, Hash: apikey.Hash(secret), CreatedAt: now}
+		if change != nil {
+			change(&key)
+		}
+		require.NoError(t, store.CreateAPIKey(context.Background(), key))
+
+		return secret
+	}
+
+	secretKey := storeKey(apikey.Secret, nil)
+	publishableKey := storeKey(apikey.Publishable, nil)
+	revokedKey := storeKey(apikey.Secret, func(key *models.APIKey) { key.RevokedAt = &now })
+	expiredKey := storeKey(apikey.Secret, func(key *models.APIKey) { key.ExpiresAt = &now })
+	gracePeriod := now.Add(time.Minute)
+	rotatedKey := storeKey(apikey.Secret, func(key *models.APIKey) { key.ExpiresAt = &gracePeriod })
+	unknownKey, _ := apikey.Generate(apikey.Secret, apikey.Test)
+
+	router := gin.New()
+	router.Use(APIKeyAuth(APIKeyConfig{
+		Store:    store,
+		Clock:    func() time.Time { return now },
+		ErrorLog: log.New(io.Discard, "", 0),
+	}))
+	router.GET("/tokens", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(handlers.MerchantIDKey))
+	})
+	router.GET("/payments", RequirePermission(rbac.PaymentsRead), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(handlers.MerchantIDKey))
+	})
+
+	tests := []struct {
+		name               string
+		path               string
+		authorization      string
+		expectedStatusCode int
+	}{
+		{"Secret Key", "/payments", "Bearer " + secretKey, http.StatusOK},
+		{"Lowercase Scheme", "/payments", "bearer " + secretKey, http.StatusOK},
+		{"Rotated Key In Grace Period", "/payments", "Bearer " + rotatedKey, http.StatusOK},
+		{"Publishable Key", "/tokens", "Bearer " + publishableKey, http.StatusOK},
+		{"Publishable Key For Secret Route", "/payments", "Bearer " + publishableKey, http.StatusForbidden},
+		{"Missing Header", "/payments", "", http.StatusUnauthorized},
+		{"Basic Authentication", "/payments", "Basic " + secretKey, http.StatusUnauthorized},
+		{"Malformed Key", "/payments", "Bearer sk_test_123", http.StatusUnauthorized},
+		{"Unknown Key", "/payments", "Bearer " + unknownKey, http.StatusUnauthorized},
+		{"Revoked Key", "/payments", "Bearer " + revokedKey, http.StatusUnauthorized},
+		{"Expired Key", "/payments", "Bearer " + expiredKey, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+			if tt.expectedStatusCode == http.StatusOK {
+				assert.Equal(t, "merchant-1", rr.Body.String())
+			}
+			if tt.expectedStatusCode == http.StatusUnauthorized {
+				assert.Equal(t, `Bearer realm="api"`, rr.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestAccessTokenAuth(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	store := storage.NewMemoryStore()
+
+	secret, err := apikey.Generate(apikey.Secret, apikey.Test)
+	require.NoError(t, err)
+	require.NoError(t, store.CreateAPIKey(context.Background(), models.APIKey{
+		ID: "KEY-1", MerchantID: "merchant-1", Kind: apikey.Secret, Mode: apikey.Test, Hash: apikey.Hash(secret), CreatedAt: now,
+	}))
+	publishable, err := apikey.Generate(apikey.Publishable, apikey.Test)
+	require.NoError(t, err)
+	require.NoError(t, store.CreateAPIKey(context.Background(), models.APIKey{
+		ID: "KEY-2", MerchantID: "merchant-1", Kind: apikey.Publishable, Mode: apikey.Test, Hash: apikey.Hash(publishable), CreatedAt: now,
+	}))
+
+	issuer, err := oauth.NewIssuer([]byte(strings.Repeat("k", oauth.MinKeySize)), "payment-gateway", 15*time.Minute)
+	require.NoError(t, err)
+	issue := func(scopes ...oauth.Scope) string {
+		token, _, err := issuer.Issue("CLI-1", "merchant-2", scopes, now)
+		require.NoError(t, err)
+		return token
+	}
+	readToken := issue(oauth.PaymentsRead)
+	writeToken := issue(oauth.PaymentsWrite, oauth.RefundsWrite)
+	expiredToken, _, err := issuer.Issue("CLI-1", "merchant-2", []oauth.Scope{oauth.PaymentsRead}, now.Add(-time.Hour))
+	require.NoError(t, err)
+
+	config := APIKeyConfig{
+		Store:        store,
+		AccessTokens: issuer,
+		Clock:        func() time.Time { return now },
+		ErrorLog:     log.New(io.Discard, "", 0),
+	}
+	respond := func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(handlers.MerchantIDKey))
+	}
+
+	router := gin.New()
+	router.GET("/payments", APIKeyAuth(config), RequirePermission(rbac.PaymentsRead), respond)
+	router.POST("/payments", APIKeyAuth(config), RequirePermission(rbac.PaymentsWrite), respond)
+	router.GET("/api-keys", APIKeyAuth(config), RequirePermission(rbac.APIKeysRead), respond)
+
+	withoutTokens := config
+	withoutTokens.AccessTokens = nil
+	router.GET("/tokens/:id", APIKeyAuth(withoutTokens), respond)
+
+	tests := []struct {
+		name               string
+		method             string
+		path               string
+		key                string
+		expectedStatusCode int
+		expectedMerchantID string
+	}{
+		{"Token With Scope", "GET", "/payments", readToken, http.StatusOK, "merchant-2"},
+		{"Token With Other Scopes", "POST", "/payments", writeToken, http.StatusOK, "merchant-2"},
+		{"Token Without Scope", "POST", "/payments", readToken, http.StatusForbidden, ""},
+		{"Expired Token", "GET", "/payments", expiredToken, http.StatusUnauthorized, ""},
+		{"Forged Token", "GET", "/payments", readToken + "x", http.StatusUnauthorized, ""},
+		{"Secret Key Has Every Scope", "POST", "/payments", secret, http.StatusOK, "merchant-1"},
+		{"Publishable Key Has No Scopes", "GET", "/payments", publishable, http.StatusForbidden, ""},
+		{"Token For Secret Key Route", "GET", "/api-keys", writeToken, http.StatusForbidden, ""},
+		{"Token Where Tokens Are Not Accepted", "GET", "/tokens/TOK-1", readToken, http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.key)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+			if tt.expectedStatusCode == http.StatusOK {
+				assert.Equal(t, tt.expectedMerchantID, rr.Body.String())
+			}
+			if tt.name == "Token Without Scope" {
+				assert.Contains(t, rr.Header().Get("WWW-Authenticate"), `error="insufficient_scope"`)
+			}
+		})
+	}
+}
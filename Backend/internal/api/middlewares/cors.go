@@ -12,8 +12,9 @@ func CorsMiddleware() gin.HandlerFunc {
 	// Define the CORS configuration options
 	corsConfig := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:4200"},
-		AllowedMethods:   []string{"GET", "POST"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowedMethods:   []string{"GET", "POST", "PATCH", "DELETE"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "Idempotency-Key"},
+		ExposedHeaders:   []string{"Retry-After", RateLimitLimitHeader, RateLimitRemainingHeader, RateLimitResetHeader},
 		AllowCredentials: true,
 	})
 
@@ -0,0 +1,193 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/handlers"
+	"github.com/Lionel-Wilson/payment-gateway/internal/storage"
+	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// IdempotencyKeyHeader is the request header carrying a client-chosen key that identifies a request.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses that were replayed for a retried request.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	// maxIdempotencyKeyLength is the longest Idempotency-Key accepted.
+	maxIdempotencyKeyLength = 255
+)
+
+// IdempotencyConfig configures the Idempotency middleware.
+type IdempotencyConfig struct {
+	Store    storage.IdempotencyStore // Store used to persist keys and the responses sent for them
+	TTL      time.Duration            // How long a key is remembered after it is first used
+	Clock    func() time.Time         // Returns the current time. Defaults to time.Now when nil
+	ErrorLog *log.Logger              // Logger for errors that do not affect the response
+}
+
+func (config IdempotencyConfig) now() time.Time {
+	if config.Clock != nil {
+		return config.Clock()
+	}
+
+	return time.Now()
+}
+
+// Idempotency makes mutating requests safe to retry. When a request carries an Idempotency-Key header, the
+// response sent for it is stored, and any later request with the same key and the same method, path and body
+// receives that response again instead of being processed a second time. Reusing a key for a different request
+// is rejected with a 422, and a retry arriving while the original is still being processed with a 409. A request
+// that fails with a 500 can be retried with the same key, unless it failed after the bank was asked to act on it,
+// as recorded under handlers.BankContactedKey, in which case the 500 is replayed.
+// Responses carrying a secret, such as a new API key, are stored and replayed without it: the handler keeps the
+// redacted response under handlers.RedactedResponseKey, so that the secret is never stored. Requests without the
+// header, and GET, HEAD and OPTIONS requests, are processed as usual. Keys are scoped to the merchant making the
+// request, so merchants cannot collide with, or replay, each other's keys; the middleware must therefore run after
+// APIKeyAuth.
+func Idempotency(config IdempotencyConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" || !isMutating(c.Request.Method) {
+			c.Next()
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			utils.NewErrorResponse(c, http.StatusBadRequest, "Invalid Idempotency-Key header", []string{"Idempotency-Key must be at most 255 characters"})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			utils.NewErrorResponse(c, http.StatusBadRequest, "Invalid request payload", nil)
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		if merchantID := c.GetString(handlers.MerchantIDKey); merchantID != "" {
+			key = merchantID + "/" + key
+		}
+
+		ctx := c.Request.Context()
+		now := config.now()
+		fingerprint := requestFingerprint(c.Request, body)
+
+		record, reserved, err := config.Store.ReserveIdempotencyKey(ctx, storage.IdempotencyRecord{
+			Key:         key,
+			Fingerprint: fingerprint,
+			ExpiresAt:   now.Add(config.TTL),
+		}, now)
+		if err != nil {
+			config.ErrorLog.Printf("failed to reserve idempotency key %q: %v", key, err)
+			utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+			c.Abort()
+			return
+		}
+
+		if !reserved {
+			replay(c, record, fingerprint)
+			c.Abort()
+			return
+		}
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		c.Next()
+
+		// Internal errors are not a final answer, so the request may be retried with the same key, unless the bank
+		// had already been asked to act on it and may have moved funds. The key is handled with a fresh context, so
+		// that it is not left reserved if the client has gone away.
+		storeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+
+		response := writer.body.Bytes()
+		if redacted, ok := c.Get(handlers.RedactedResponseKey); ok {
+			response, _ = redacted.([]byte)
+		}
+
+		if writer.Status() == http.StatusInternalServerError && !c.GetBool(handlers.BankContactedKey) {
+			err = config.Store.ReleaseIdempotencyKey(storeCtx, key)
+		} else {
+			err = config.Store.CompleteIdempotencyKey(storeCtx, key, writer.Status(), writer.Header().Get("Content-Type"), response)
+		}
+		if err != nil {
+			config.ErrorLog.Printf("failed to save idempotency key %q: %v", key, err)
+		}
+	}
+}
+
+// RunIdempotencyKeyExpiry deletes expired idempotency keys every interval until ctx is cancelled.
+func RunIdempotencyKeyExpiry(ctx context.Context, config IdempotencyConfig, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := config.Store.DeleteIdempotencyKeysExpiredBefore(ctx, config.now()); err != nil {
+				config.ErrorLog.Printf("failed to delete expired idempotency keys: %v", err)
+			}
+		}
+	}
+}
+
+// replay answers a request whose key has already been used.
+func replay(c *gin.Context, record storage.IdempotencyRecord, fingerprint string) {
+	switch {
+	case record.Fingerprint != fingerprint:
+		utils.NewErrorResponse(c, http.StatusUnprocessableEntity, "Idempotency-Key has already been used for a different request", nil)
+	case !record.Completed:
+		utils.NewErrorResponse(c, http.StatusConflict, "A request with this Idempotency-Key is still being processed", nil)
+	default:
+		c.Header(IdempotentReplayedHeader, "true")
+		c.Data(record.StatusCode, record.ContentType, record.Body)
+	}
+}
+
+// requestFingerprint identifies a request by its method, path and body.
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// isMutating reports whether requests with the given method may change state.
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	default:
+		return true
+	}
+}
+
+// recordingWriter keeps a copy of the response body written through it.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
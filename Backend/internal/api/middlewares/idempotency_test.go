@@ -0,0 +1,318 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/handlers"
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/apikey"
+	"github.com/Lionel-Wilson/payment-gateway/internal/bank"
+	"github.com/Lionel-Wilson/payment-gateway/internal/money"
+	"github.com/Lionel-Wilson/payment-gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupIdempotentRouter returns a router whose POST /payments handler counts how often it runs and answers with
+// the given status, and GET /payments handler always runs.
+func setupIdempotentRouter(config IdempotencyConfig, status *int, calls *int) *gin.Engine {
+	router := gin.New()
+	router.Use(Idempotency(config))
+
+	router.POST("/payments", func(c *gin.Context) {
+		*calls++
+		body, _ := io.ReadAll(c.Request.Body)
+		c.JSON(*status, gin.H{"call": *calls, "body": string(body)})
+	})
+	router.GET("/payments", func(c *gin.Context) {
+		*calls++
+		c.JSON(http.StatusOK, gin.H{"call": *calls})
+	})
+
+	return router
+}
+
+// countingRefundBank is an acquiring bank that approves every refund and counts how many it was asked to make.
+type countingRefundBank struct {
+	bank.AcquiringBank
+	calls int
+}
+
+func (b *countingRefundBank) Refund(ctx context.Context, req bank.RefundRequest) (bank.Response, error) {
+	b.calls++
+	return bank.Response{Approved: true, StatusCode: bank.CodeApproved, Summary: "Approved", BankReference: "BNK-2"}, nil
+}
+
+// failingRefundStore is a refund store that cannot save the outcome of a refund.
+type failingRefundStore struct {
+	storage.RefundStore
+}
+
+func (s failingRefundStore) UpdateRefund(ctx context.Context, refund models.Refund) error {
+	return errors.New("database is unavailable")
+}
+
+func TestIdempotency(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	send := func(router *gin.Engine, method, key, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, "/payments", bytes.NewBufferString(body))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	newConfig := func() IdempotencyConfig {
+		return IdempotencyConfig{
+			Store:    storage.NewMemoryStore(),
+			TTL:      time.Hour,
+			Clock:    func() time.Time { return now },
+			ErrorLog: log.New(io.Discard, "", 0),
+		}
+	}
+
+	t.Run("Identical Retry Is Replayed", func(t *testing.T) {
+		status, calls := http.StatusCreated, 0
+		router := setupIdempotentRouter(newConfig(), &status, &calls)
+
+		first := send(router, "POST", "key-1", `{"amount":10}`)
+		second := send(router, "POST", "key-1", `{"amount":10}`)
+
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, http.StatusCreated, second.Code)
+		assert.Equal(t, first.Body.String(), second.Body.String())
+		assert.Equal(t, "application/json; charset=utf-8", second.Header().Get("Content-Type"))
+		assert.Equal(t, "true", second.Header().Get(IdempotentReplayedHeader))
+		assert.Empty(t, first.Header().Get(IdempotentReplayedHeader))
+	})
+
+	t.Run("Declines Are Replayed", func(t *testing.T) {
+		status, calls := http.StatusPaymentRequired, 0
+		router := setupIdempotentRouter(newConfig(), &status, &calls)
+
+		send(router, "POST", "key-1", `{"amount":10}`)
+		status = http.StatusCreated
+		retry := send(router, "POST", "key-1", `{"amount":10}`)
+
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, http.StatusPaymentRequired, retry.Code)
+	})
+
+	t.Run("Conflicting Body Is Rejected", func(t *testing.T) {
+		status, calls := http.StatusCreated, 0
+		router := setupIdempotentRouter(newConfig(), &status, &calls)
+
+		send(router, "POST", "key-1", `{"amount":10}`)
+		conflicting := send(router, "POST", "key-1", `{"amount":20}`)
+
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, http.StatusUnprocessableEntity, conflicting.Code)
+	})
+
+	t.Run("Request In Progress", func(t *testing.T) {
+		config := newConfig()
+		status, calls := http.StatusCreated, 0
+		router := setupIdempotentRouter(config, &status, &calls)
+
+		_, _, err := config.Store.ReserveIdempotencyKey(context.Background(), storage.IdempotencyRecord{
+			Key:         "key-1",
+			Fingerprint: requestFingerprint(httptest.NewRequest("POST", "/payments", nil), []byte(`{"amount":10}`)),
+			ExpiresAt:   now.Add(time.Hour),
+		}, now)
+		assert.NoError(t, err)
+
+		rr := send(router, "POST", "key-1", `{"amount":10}`)
+
+		assert.Equal(t, 0, calls)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("Internal Errors Can Be Retried", func(t *testing.T) {
+		status, calls := http.StatusInternalServerError, 0
+		router := setupIdempotentRouter(newConfig(), &status, &calls)
+
+		send(router, "POST", "key-1", `{"amount":10}`)
+		status = http.StatusCreated
+		retry := send(router, "POST", "key-1", `{"amount":10}`)
+
+		assert.Equal(t, 2, calls)
+		assert.Equal(t, http.StatusCreated, retry.Code)
+	})
+
+	t.Run("Internal Errors After Contacting The Bank Are Replayed", func(t *testing.T) {
+		payments := storage.NewMemoryStore()
+		require.NoError(t, payments.CreatePayment(context.Background(), models.PaymentDetails{
+			ID:             "PAY-12345",
+			MerchantID:     "merchant-1",
+			Amount:         money.New(20000, "USD"),
+			CurrencyCode:   "USD",
+			Status:         models.StatusPaid,
+			BankReference:  "BNK-1",
+			CapturedAmount: money.New(20000, "USD"),
+			RefundedAmount: money.New(0, "USD"),
+		}))
+
+		refunder := &countingRefundBank{}
+		app := &handlers.Application{
+			Payments: payments,
+			Refunds:  failingRefundStore{RefundStore: payments},
+			Bank:     refunder,
+			Clock:    func() time.Time { return now },
+			ErrorLog: log.New(io.Discard, "", 0),
+		}
+
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set(handlers.MerchantIDKey, "merchant-1")
+		}, Idempotency(newConfig()))
+		router.POST("/payments/:id/refunds", app.RefundPayment)
+
+		sendRefund := func() *httptest.ResponseRecorder {
+			req, _ := http.NewRequest("POST", "/payments/PAY-12345/refunds", bytes.NewBufferString(`{"amount": 50}`))
+			req.Header.Set(IdempotencyKeyHeader, "key-1")
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			return rr
+		}
+
+		// The refund went through but could not be recorded, so a retry must not refund the payment again
+		first := sendRefund()
+		require.Equal(t, http.StatusInternalServerError, first.Code)
+
+		retry := sendRefund()
+		assert.Equal(t, http.StatusInternalServerError, retry.Code)
+		assert.Equal(t, "true", retry.Header().Get(IdempotentReplayedHeader))
+		assert.Equal(t, 1, refunder.calls)
+	})
+
+	t.Run("Expired Key Can Be Reused", func(t *testing.T) {
+		config := newConfig()
+		status, calls := http.StatusCreated, 0
+		router := setupIdempotentRouter(config, &status, &calls)
+
+		send(router, "POST", "key-1", `{"amount":10}`)
+		now = now.Add(2 * time.Hour)
+		defer func() { now = now.Add(-2 * time.Hour) }()
+		send(router, "POST", "key-1", `{"amount":20}`)
+
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("Without Key", func(t *testing.T) {
+		status, calls := http.StatusCreated, 0
+		router := setupIdempotentRouter(newConfig(), &status, &calls)
+
+		send(router, "POST", "", `{"amount":10}`)
+		send(router, "POST", "", `{"amount":10}`)
+
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("Read Requests Are Not Recorded", func(t *testing.T) {
+		status, calls := http.StatusCreated, 0
+		router := setupIdempotentRouter(newConfig(), &status, &calls)
+
+		send(router, "GET", "key-1", "")
+		send(router, "GET", "key-1", "")
+
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("Keys Are Scoped To Merchants", func(t *testing.T) {
+		calls := 0
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set(handlers.MerchantIDKey, c.GetHeader("X-Merchant"))
+		}, Idempotency(newConfig()))
+		router.POST("/payments", func(c *gin.Context) {
+			calls++
+			c.JSON(http.StatusCreated, gin.H{"merchant": c.GetHeader("X-Merchant")})
+		})
+
+		sendAs := func(merchantID string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest("POST", "/payments", bytes.NewBufferString(`{"amount":10}`))
+			req.Header.Set(IdempotencyKeyHeader, "key-1")
+			req.Header.Set("X-Merchant", merchantID)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			return rr
+		}
+
+		sendAs("merchant-1")
+		other := sendAs("merchant-2")
+		retry := sendAs("merchant-1")
+
+		assert.Equal(t, 2, calls)
+		assert.Equal(t, `{"merchant":"merchant-2"}`, other.Body.String())
+		assert.Equal(t, "true", retry.Header().Get(IdempotentReplayedHeader))
+	})
+
+	t.Run("Secrets Are Not Stored", func(t *testing.T) {
+		config := newConfig()
+		app := &handlers.Application{
+			APIKeys:  storage.NewMemoryStore(),
+			Clock:    func() time.Time { return now },
+			ErrorLog: log.New(io.Discard, "", 0),
+		}
+
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set(handlers.MerchantIDKey, "merchant-1")
+			c.Set(handlers.APIKeyKey, models.APIKey{ID: "KEY-1", MerchantID: "merchant-1", Kind: apikey.Secret})
+		}, Idempotency(config))
+		router.POST("/api-keys", app.CreateAPIKey)
+
+		sendKeyRequest := func() *httptest.ResponseRecorder {
+			req, _ := http.NewRequest("POST", "/api-keys", bytes.NewBufferString(`{"kind":"secret","mode":"live"}`))
+			req.Header.Set(IdempotencyKeyHeader, "key-1")
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			return rr
+		}
+
+		first := sendKeyRequest()
+		require.Equal(t, http.StatusCreated, first.Code)
+
+		var created models.APIKey
+		require.NoError(t, json.Unmarshal(first.Body.Bytes(), &created))
+		require.NotEmpty(t, created.Key)
+
+		record, reserved, err := config.Store.ReserveIdempotencyKey(context.Background(), storage.IdempotencyRecord{Key: "merchant-1/key-1"}, now)
+		require.NoError(t, err)
+		require.False(t, reserved)
+		assert.NotContains(t, string(record.Body), created.Key)
+
+		retry := sendKeyRequest()
+		assert.Equal(t, http.StatusCreated, retry.Code)
+		assert.Equal(t, "true", retry.Header().Get(IdempotentReplayedHeader))
+		assert.NotContains(t, retry.Body.String(), created.Key)
+
+		var replayed models.APIKey
+		require.NoError(t, json.Unmarshal(retry.Body.Bytes(), &replayed))
+		assert.Equal(t, created.ID, replayed.ID)
+		assert.Equal(t, created.Last4, replayed.Last4)
+	})
+
+	t.Run("Key Too Long", func(t *testing.T) {
+		status, calls := http.StatusCreated, 0
+		router := setupIdempotentRouter(newConfig(), &status, &calls)
+
+		rr := send(router, "POST", string(bytes.Repeat([]byte("k"), 256)), `{"amount":10}`)
+
+		assert.Equal(t, 0, calls)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
@@ -0,0 +1,64 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/handlers"
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/apikey"
+	"github.com/Lionel-Wilson/payment-gateway/internal/oauth"
+	"github.com/Lionel-Wilson/payment-gateway/internal/rbac"
+	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission rejects requests whose credentials do not grant permission with a 403. Secret API keys have
+// every permission and publishable keys only rbac.PublishableKeyPermissions. OAuth access tokens have the permissions
+// named by their scopes, and dashboard users those of their role. It must run after APIKeyAuth.
+func RequirePermission(permission rbac.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if value, ok := c.Get(handlers.UserKey); ok {
+			if user, ok := value.(models.User); !ok || !user.Role.Can(permission) {
+				utils.NewErrorResponse(c, http.StatusForbidden, "Your role does not allow this", []string{"The " + string(permission) + " permission is required"})
+				c.Abort()
+				return
+			}
+
+			c.Next()
+			return
+		}
+
+		if value, ok := c.Get(handlers.AccessTokenKey); ok {
+			if claims, ok := value.(oauth.Claims); !ok || !claims.HasScope(oauth.Scope(permission)) {
+				c.Header("WWW-Authenticate", `Bearer realm="api", error="insufficient_scope", scope="`+string(permission)+`"`)
+				utils.NewErrorResponse(c, http.StatusForbidden, "Insufficient scope", []string{"The access token must grant " + string(permission)})
+				c.Abort()
+				return
+			}
+
+			c.Next()
+			return
+		}
+
+		value, _ := c.Get(handlers.APIKeyKey)
+		key, ok := value.(models.APIKey)
+		if !ok || (key.Kind != apikey.Secret && !publishableKeyCan(permission)) {
+			utils.NewErrorResponse(c, http.StatusForbidden, "A secret API key is required", nil)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// publishableKeyCan reports whether publishable keys have permission.
+func publishableKeyCan(permission rbac.Permission) bool {
+	for _, p := range rbac.PublishableKeyPermissions {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,167 @@
+package middlewares
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/account"
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/handlers"
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/rbac"
+	"github.com/Lionel-Wilson/payment-gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionAuth(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	store := storage.NewMemoryStore()
+	ctx := context.Background()
+
+	// login stores a user of merchant-1 with a session, and returns the session token
+	login := func(id string, role rbac.Role, expiresAt time.Time, change func(*models.User)) string {
+		user := models.User{ID: id, MerchantID: "merchant-1", Email: id + "@example.com", Name: id, Role: role, CreatedAt: now}
+		if change != nil {
+			change(&user)
+		}
+		require.NoError(t, store.CreateUser(ctx, user))
+
+		token, err := account.NewSessionToken()
+		require.NoError(t, err)
+		require.NoError(t, store.CreateSession(ctx, models.Session{
+			ID: account.HashSessionToken(token), UserID: id, MerchantID: "merchant-1", CreatedAt: now, ExpiresAt: expiresAt,
+		}))
+
+		return token
+	}
+
+	later := now.Add(time.Hour)
+	admin := login("USR-1", rbac.Admin, later, nil)
+	developer := login("USR-2", rbac.Developer, later, nil)
+	support := login("USR-3", rbac.Support, later, nil)
+	finance := login("USR-4", rbac.Finance, later, nil)
+	expired := login("USR-5", rbac.Admin, now, nil)
+	disabled := login("USR-6", rbac.Admin, later, func(user *models.User) { user.DisabledAt = &now })
+	unknown, err := account.NewSessionToken()
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.Use(APIKeyAuth(APIKeyConfig{
+		Store:    store,
+		Sessions: store,
+		Users:    store,
+		Clock:    func() time.Time { return now },
+		ErrorLog: log.New(io.Discard, "", 0),
+	}))
+	respond := func(c *gin.Context) {
+		user, _ := c.Get(handlers.UserKey)
+		c.String(http.StatusOK, c.GetString(handlers.MerchantIDKey)+" "+user.(models.User).ID)
+	}
+	router.GET("/payments/:id", RequirePermission(rbac.PaymentsRead), respond)
+	router.POST("/payments/:id/refunds", RequirePermission(rbac.RefundsWrite), respond)
+	router.POST("/api-keys/:id/rotate", RequirePermission(rbac.APIKeysWrite), respond)
+	router.POST("/users", RequirePermission(rbac.UsersWrite), respond)
+
+	tests := []struct {
+		name               string
+		method             string
+		path               string
+		token              string
+		expectedStatusCode int
+		expectedUserID     string
+	}{
+		{"Support Retrieves Payment", "GET", "/payments/PAY-1", support, http.StatusOK, "USR-3"},
+		{"Support Refunds Payment", "POST", "/payments/PAY-1/refunds", support, http.StatusForbidden, ""},
+		{"Support Rotates Key", "POST", "/api-keys/KEY-1/rotate", support, http.StatusForbidden, ""},
+		{"Finance Refunds Payment", "POST", "/payments/PAY-1/refunds", finance, http.StatusOK, "USR-4"},
+		{"Finance Rotates Key", "POST", "/api-keys/KEY-1/rotate", finance, http.StatusForbidden, ""},
+		{"Developer Rotates Key", "POST", "/api-keys/KEY-1/rotate", developer, http.StatusOK, "USR-2"},
+		{"Developer Refunds Payment", "POST", "/payments/PAY-1/refunds", developer, http.StatusForbidden, ""},
+		{"Developer Creates User", "POST", "/users", developer, http.StatusForbidden, ""},
+		{"Admin Creates User", "POST", "/users", admin, http.StatusOK, "USR-1"},
+		{"Expired Session", "GET", "/payments/PAY-1", expired, http.StatusUnauthorized, ""},
+		{"Disabled User", "GET", "/payments/PAY-1", disabled, http.StatusUnauthorized, ""},
+		{"Unknown Session", "GET", "/payments/PAY-1", unknown, http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+			if tt.expectedStatusCode == http.StatusOK {
+				assert.Equal(t, "merchant-1 "+tt.expectedUserID, rr.Body.String())
+			}
+		})
+	}
+
+	t.Run("Developer Cannot Mint Secret Keys", func(t *testing.T) {
+		app := &handlers.Application{
+			APIKeys:  store,
+			Clock:    func() time.Time { return now },
+			ErrorLog: log.New(io.Discard, "", 0),
+		}
+
+		router := gin.New()
+		router.Use(APIKeyAuth(APIKeyConfig{
+			Store:    store,
+			Sessions: store,
+			Users:    store,
+			Clock:    func() time.Time { return now },
+			ErrorLog: log.New(io.Discard, "", 0),
+		}))
+		router.POST("/api-keys", RequirePermission(rbac.APIKeysWrite), app.CreateAPIKey)
+		router.POST("/payments/:id/refunds", RequirePermission(rbac.RefundsWrite), func(c *gin.Context) {
+			c.Status(http.StatusCreated)
+		})
+
+		send := func(path, token, body string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			return rr
+		}
+
+		// mint creates a key with the session token, and returns the new key if it was created
+		mint := func(token, kind string) (int, string) {
+			rr := send("/api-keys", token, `{"kind":"`+kind+`","mode":"live"}`)
+
+			var key models.APIKey
+			_ = json.Unmarshal(rr.Body.Bytes(), &key)
+			return rr.Code, key.Key
+		}
+
+		status, _ := mint(developer, "secret")
+		assert.Equal(t, http.StatusForbidden, status)
+
+		status, publishable := mint(developer, "publishable")
+		require.Equal(t, http.StatusCreated, status)
+		assert.Equal(t, http.StatusForbidden, send("/payments/PAY-1/refunds", publishable, "").Code)
+
+		status, secret := mint(admin, "secret")
+		require.Equal(t, http.StatusCreated, status)
+		assert.Equal(t, http.StatusCreated, send("/payments/PAY-1/refunds", secret, "").Code)
+	})
+
+	t.Run("Role Changes Take Effect Immediately", func(t *testing.T) {
+		require.NoError(t, store.UpdateUserRole(ctx, "USR-3", rbac.Finance))
+
+		req, _ := http.NewRequest("POST", "/payments/PAY-1/refunds", nil)
+		req.Header.Set("Authorization", "Bearer "+support)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+}
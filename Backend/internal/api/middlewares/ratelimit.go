@@ -0,0 +1,179 @@
+package middlewares
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/handlers"
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/oauth"
+	"github.com/Lionel-Wilson/payment-gateway/internal/ratelimit"
+	"github.com/Lionel-Wilson/payment-gateway/internal/storage"
+	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// RateLimitLimitHeader is the response header holding how many requests the tightest limit allows per period.
+	RateLimitLimitHeader = "RateLimit-Limit"
+	// RateLimitRemainingHeader is the response header holding how many more requests the tightest limit allows now.
+	RateLimitRemainingHeader = "RateLimit-Remaining"
+	// RateLimitResetHeader is the response header holding how many seconds until the tightest limit is fully restored.
+	RateLimitResetHeader = "RateLimit-Reset"
+)
+
+// RateLimitConfig configures the RateLimit middleware.
+type RateLimitConfig struct {
+	Store    storage.RateLimitStore // Store holding the token buckets
+	Rules    ratelimit.Rules        // Limits of each route
+	Clock    func() time.Time       // Returns the current time. Defaults to time.Now when nil
+	ErrorLog *log.Logger            // Logger for errors that prevent a limit from being checked
+}
+
+func (config RateLimitConfig) now() time.Time {
+	if config.Clock != nil {
+		return config.Clock()
+	}
+
+	return time.Now()
+}
+
+// rateLimitResultKey is the gin context key holding the ratelimit.Result of the tightest bucket a request has taken
+// a token from so far, so that its RateLimit-* headers describe the tightest of all its buckets.
+const rateLimitResultKey = "rateLimitResult"
+
+// rateLimitBucket is a token bucket a request takes a token from.
+type rateLimitBucket struct {
+	name  string          // What the bucket is keyed by
+	value string          // The value of the key, or empty if the request has none
+	limit ratelimit.Limit // The limit of the bucket
+}
+
+// RateLimitIP limits the requests to each route from each client IP address with token buckets, with the limit the
+// route's rule gives IP addresses. It must run before APIKeyAuth, so that requests with invalid credentials, such as
+// guessed API keys, are limited too. Otherwise it behaves like RateLimit.
+func RateLimitIP(config RateLimitConfig) gin.HandlerFunc {
+	return rateLimit(config, func(c *gin.Context, rule ratelimit.Rule) []rateLimitBucket {
+		return []rateLimitBucket{{"ip", c.ClientIP(), rule.IP}}
+	})
+}
+
+// RateLimit limits the requests to each route with token buckets. A request takes a token from the buckets of its
+// credential (API key, OAuth client or dashboard user) and its merchant, in that order, each with the limit the
+// route's rule gives it. If a bucket is empty, the request is rejected with a 429 and a Retry-After header, and takes
+// nothing from the buckets after it. Every response carries RateLimit-* headers describing the tightest limit,
+// including that of RateLimitIP. It must run after APIKeyAuth, and RateLimitIP before it. Requests are let through if
+// the store fails, so that an outage of a shared store does not stop payments.
+func RateLimit(config RateLimitConfig) gin.HandlerFunc {
+	return rateLimit(config, func(c *gin.Context, rule ratelimit.Rule) []rateLimitBucket {
+		return []rateLimitBucket{
+			{"apiKey", credentialID(c), rule.APIKey},
+			{"merchant", c.GetString(handlers.MerchantIDKey), rule.Merchant},
+		}
+	})
+}
+
+// rateLimit returns a middleware taking a token from each of the buckets a request falls in.
+func rateLimit(config RateLimitConfig, buckets func(*gin.Context, ratelimit.Rule) []rateLimitBucket) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.Request.Method + " " + c.FullPath()
+		rule := config.Rules.For(c.Request.Method, c.FullPath())
+		now := config.now()
+
+		var tightest *ratelimit.Result
+		if value, ok := c.Get(rateLimitResultKey); ok {
+			if result, ok := value.(ratelimit.Result); ok {
+				tightest = &result
+			}
+		}
+
+		for _, bucket := range buckets(c, rule) {
+			if bucket.value == "" || bucket.limit.IsZero() {
+				continue
+			}
+
+			result, err := config.Store.TakeRateLimitToken(c.Request.Context(), route+" "+bucket.name+"="+bucket.value, bucket.limit, now)
+			if err != nil {
+				config.ErrorLog.Printf("failed to take rate limit token: %v", err)
+				continue
+			}
+
+			if tightest == nil || !result.Allowed || result.Remaining < tightest.Remaining {
+				tightest = &result
+			}
+			if !result.Allowed {
+				break
+			}
+		}
+
+		if tightest == nil {
+			c.Next()
+			return
+		}
+
+		c.Set(rateLimitResultKey, *tightest)
+		c.Header(RateLimitLimitHeader, strconv.Itoa(tightest.Limit.Requests))
+		c.Header(RateLimitRemainingHeader, strconv.Itoa(tightest.Remaining))
+		c.Header(RateLimitResetHeader, strconv.Itoa(ceilSeconds(tightest.Reset)))
+
+		if !tightest.Allowed {
+			retryAfter := max(1, ceilSeconds(tightest.RetryAfter))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			utils.NewErrorResponse(c, http.StatusTooManyRequests, "Too many requests", []string{"Retry after " + strconv.Itoa(retryAfter) + " seconds"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RunRateLimitBucketExpiry deletes unused token buckets every interval until ctx is cancelled. Only buckets unused
+// for longer than the longest period are deleted, since they are full, and a missing bucket starts full.
+func RunRateLimitBucketExpiry(ctx context.Context, config RateLimitConfig, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			before := config.now().Add(-config.Rules.LongestPeriod())
+			if _, err := config.Store.DeleteRateLimitBucketsUsedBefore(ctx, before); err != nil {
+				config.ErrorLog.Printf("failed to delete unused rate limit buckets: %v", err)
+			}
+		}
+	}
+}
+
+// credentialID returns the ID of the API key, OAuth client or dashboard user a request was authenticated with, or
+// an empty string if it was not authenticated.
+func credentialID(c *gin.Context) string {
+	if value, ok := c.Get(handlers.APIKeyKey); ok {
+		if key, ok := value.(models.APIKey); ok {
+			return key.ID
+		}
+	}
+	if value, ok := c.Get(handlers.AccessTokenKey); ok {
+		if claims, ok := value.(oauth.Claims); ok {
+			return claims.Subject
+		}
+	}
+	if value, ok := c.Get(handlers.UserKey); ok {
+		if user, ok := value.(models.User); ok {
+			return user.ID
+		}
+	}
+
+	return ""
+}
+
+// ceilSeconds returns d in whole seconds, rounded up.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
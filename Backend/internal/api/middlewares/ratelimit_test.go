@@ -0,0 +1,158 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/handlers"
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/ratelimit"
+	"github.com/Lionel-Wilson/payment-gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingRateLimitStore is a RateLimitStore that is always unavailable.
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) TakeRateLimitToken(context.Context, string, ratelimit.Limit, time.Time) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("store unavailable")
+}
+
+func (failingRateLimitStore) DeleteRateLimitBucketsUsedBefore(context.Context, time.Time) (int, error) {
+	return 0, errors.New("store unavailable")
+}
+
+func TestRateLimit(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	config := RateLimitConfig{
+		Store: storage.NewMemoryStore(),
+		Rules: ratelimit.Rules{
+			Routes: map[string]ratelimit.Rule{
+				"POST /payments": {
+					IP:       ratelimit.Limit{Requests: 3, Period: time.Minute},
+					APIKey:   ratelimit.Limit{Requests: 2, Period: time.Minute},
+					Merchant: ratelimit.Limit{Requests: 3, Period: time.Minute},
+				},
+			},
+		},
+		Clock:    func() time.Time { return now },
+		ErrorLog: log.New(io.Discard, "", 0),
+	}
+
+	// newRouter returns a router authenticating requests by the X-Key and X-Merchant headers
+	newRouter := func(config RateLimitConfig) *gin.Engine {
+		router := gin.New()
+		require.NoError(t, router.SetTrustedProxies(nil))
+		router.Use(RateLimitIP(config), func(c *gin.Context) {
+			c.Set(handlers.MerchantIDKey, c.GetHeader("X-Merchant"))
+			c.Set(handlers.APIKeyKey, models.APIKey{ID: c.GetHeader("X-Key")})
+		})
+		router.Use(RateLimit(config))
+		router.POST("/payments", func(c *gin.Context) { c.Status(http.StatusCreated) })
+		router.GET("/payments", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+		return router
+	}
+	router := newRouter(config)
+
+	send := func(router *gin.Engine, method, key, ip string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, "/payments", nil)
+		req.Header.Set("X-Key", key)
+		req.Header.Set("X-Merchant", "merchant-1")
+		req.Header.Set("X-Forwarded-For", "203.0.113.99")
+		req.RemoteAddr = ip + ":50000"
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	tests := []struct {
+		name               string
+		method             string
+		key                string
+		ip                 string
+		wait               time.Duration
+		expectedStatusCode int
+		expectedLimit      string
+		expectedRemaining  string
+		expectedRetryAfter string
+	}{
+		{"First Request", "POST", "KEY-1", "10.0.0.1", 0, http.StatusCreated, "2", "1", ""},
+		{"Second Request", "POST", "KEY-1", "10.0.0.1", 0, http.StatusCreated, "2", "0", ""},
+		{"API Key Limit Reached", "POST", "KEY-1", "10.0.0.1", 0, http.StatusTooManyRequests, "2", "0", "30"},
+		{"Other Key And IP", "POST", "KEY-2", "10.0.0.2", 0, http.StatusCreated, "3", "0", ""},
+		{"Merchant Limit Reached", "POST", "KEY-2", "10.0.0.2", 0, http.StatusTooManyRequests, "3", "0", "20"},
+		{"Route Without Limits", "GET", "KEY-1", "10.0.0.1", 0, http.StatusOK, "", "", ""},
+		{"IP Limit Reached", "POST", "KEY-3", "10.0.0.1", 0, http.StatusTooManyRequests, "3", "0", "20"},
+		{"Buckets Refilled", "POST", "KEY-1", "10.0.0.3", time.Minute, http.StatusCreated, "2", "1", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.wait)
+			rr := send(router, tt.method, tt.key, tt.ip)
+
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+			assert.Equal(t, tt.expectedLimit, rr.Header().Get(RateLimitLimitHeader))
+			assert.Equal(t, tt.expectedRemaining, rr.Header().Get(RateLimitRemainingHeader))
+			assert.Equal(t, tt.expectedRetryAfter, rr.Header().Get("Retry-After"))
+			if tt.expectedStatusCode == http.StatusTooManyRequests {
+				assert.Contains(t, rr.Body.String(), "Too many requests")
+			}
+		})
+	}
+
+	t.Run("Invalid Keys Are Limited", func(t *testing.T) {
+		store := storage.NewMemoryStore()
+		config := RateLimitConfig{
+			Store: store,
+			Rules: ratelimit.Rules{
+				Default: ratelimit.Rule{IP: ratelimit.Limit{Requests: 3, Period: time.Minute}},
+			},
+			Clock:    func() time.Time { return now },
+			ErrorLog: log.New(io.Discard, "", 0),
+		}
+
+		router := gin.New()
+		require.NoError(t, router.SetTrustedProxies(nil))
+		router.Use(RateLimitIP(config), APIKeyAuth(APIKeyConfig{
+			Store:    store,
+			Clock:    func() time.Time { return now },
+			ErrorLog: log.New(io.Discard, "", 0),
+		}), RateLimit(config))
+		router.GET("/payments", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+		var codes []int
+		for i := 0; i < 5; i++ {
+			req, _ := http.NewRequest("GET", "/payments", nil)
+			req.Header.Set("Authorization", "Bearer sk_test_guess"+strconv.Itoa(i))
+			req.RemoteAddr = "10.0.0.9:50000"
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			codes = append(codes, rr.Code)
+		}
+
+		assert.Equal(t, []int{
+			http.StatusUnauthorized, http.StatusUnauthorized, http.StatusUnauthorized,
+			http.StatusTooManyRequests, http.StatusTooManyRequests,
+		}, codes)
+	})
+
+	t.Run("Unavailable Store", func(t *testing.T) {
+		unavailable := config
+		unavailable.Store = failingRateLimitStore{}
+
+		rr := send(newRouter(unavailable), "POST", "KEY-1", "10.0.0.1")
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Empty(t, rr.Header().Get(RateLimitLimitHeader))
+	})
+}
@@ -8,6 +8,7 @@ import (
 // It adds the following headers:
 // - X-XSS-Protection: Enables cross-site scripting (XSS) protection.
 // - X-Frame-Options: Prevents the page from being displayed in an iframe (clickjacking protection).
+// - Strict-Transport-Security: Tells browsers to only use HTTPS for a year, on requests made over HTTPS.
 // This middleware should be added to the Gin router to apply these headers to all responses.
 func SecureHeaders() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -15,6 +16,10 @@ func SecureHeaders() gin.HandlerFunc {
 		c.Writer.Header().Set("X-XSS-Protection", "1; mode=block")
 		// Set the X-Frame-Options header to deny framing of the page
 		c.Writer.Header().Set("X-Frame-Options", "deny")
+		// Set the Strict-Transport-Security header so that browsers never fall back to HTTP
+		if c.Request.TLS != nil {
+			c.Writer.Header().Set("Strict-Transport-Security", "max-age=31536000")
+		}
 		// Proceed to the next middleware or handler
 		c.Next()
 	}
@@ -0,0 +1,151 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/handlers"
+	"github.com/Lionel-Wilson/payment-gateway/internal/signing"
+	"github.com/Lionel-Wilson/payment-gateway/internal/storage"
+	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// maxNonceLength is the longest X-Signature-Nonce accepted.
+const maxNonceLength = 128
+
+// SignatureConfig configures the RequestSignature middleware.
+type SignatureConfig struct {
+	Merchants storage.MerchantStore // Store holding the merchants' signing secrets
+	Nonces    signing.NonceCache    // Cache of the nonces of requests already received
+	Window    time.Duration         // How far a request's timestamp may be from the current time
+	Clock     func() time.Time      // Returns the current time. Defaults to time.Now when nil
+	ErrorLog  *log.Logger           // Logger for errors that prevent a signature from being checked
+}
+
+func (config SignatureConfig) now() time.Time {
+	if config.Clock != nil {
+		return config.Clock()
+	}
+
+	return time.Now()
+}
+
+// RequestSignature rejects requests that are not signed with the signing secret of the merchant making them, with a
+// 401. A request is signed with the X-Signature-Timestamp, X-Signature-Nonce and X-Signature headers, and covers its
+// method, path and body. Requests whose timestamp is further than the window from the current time, and requests
+// reusing the nonce of a request received within the window, are rejected, so a captured request cannot be replayed.
+// The middleware must run after APIKeyAuth, and before Idempotency so that rejected requests do not use up their
+// idempotency keys. Dashboard users may read without signing, since the browser has no signing secret, but their
+// requests that change anything must be signed like any other.
+func RequestSignature(config SignatureConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get(handlers.UserKey); ok && !isMutating(c.Request.Method) {
+			c.Next()
+			return
+		}
+
+		timestampHeader := c.GetHeader(signing.TimestampHeader)
+		nonce := c.GetHeader(signing.NonceHeader)
+		signature := c.GetHeader(signing.SignatureHeader)
+		if timestampHeader == "" || nonce == "" || signature == "" {
+			rejectSignature(c, "Missing request signature", []string{"X-Signature-Timestamp, X-Signature-Nonce and X-Signature are required"})
+			return
+		}
+
+		if len(nonce) > maxNonceLength {
+			rejectSignature(c, "Invalid request signature", []string{"X-Signature-Nonce must be at most 128 characters"})
+			return
+		}
+
+		timestamp, err := signing.ParseTimestamp(timestampHeader)
+		if err != nil {
+			rejectSignature(c, "Invalid request signature", []string{"X-Signature-Timestamp must be a Unix time in seconds"})
+			return
+		}
+
+		now := config.now()
+		if timestamp.Before(now.Add(-config.Window)) || timestamp.After(now.Add(config.Window)) {
+			rejectSignature(c, "Request signature has expired", nil)
+			return
+		}
+
+		ctx := c.Request.Context()
+		merchantID := c.GetString(handlers.MerchantIDKey)
+		merchant, err := config.Merchants.GetMerchant(ctx, merchantID)
+		if errors.Is(err, storage.ErrNotFound) || (err == nil && merchant.SigningSecret == "") {
+			rejectSignature(c, "Invalid request signature", []string{"Merchant has no signing secret"})
+			return
+		} else if err != nil {
+			config.ErrorLog.Printf("failed to retrieve merchant %s: %v", merchantID, err)
+			utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			utils.NewErrorResponse(c, http.StatusBadRequest, "Invalid request payload", nil)
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		request := signing.Request{
+			Timestamp: timestamp,
+			Nonce:     nonce,
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.RequestURI(),
+			Body:      body,
+		}
+		if !signing.Verify(merchant.SigningSecret, request, signature) {
+			rejectSignature(c, "Invalid request signature", nil)
+			return
+		}
+
+		// Nonces are only recorded for valid signatures, so that nobody else can use up a merchant's nonces. A nonce
+		// is remembered until its timestamp leaves the window, after which the timestamp alone rejects a replay.
+		added, err := config.Nonces.Add(ctx, merchantID+"/"+nonce, now, timestamp.Add(config.Window))
+		if err != nil {
+			config.ErrorLog.Printf("failed to record nonce: %v", err)
+			utils.NewErrorResponse(c, http.StatusInternalServerError, "Something went wrong. Please try again later.", nil)
+			c.Abort()
+			return
+		}
+		if !added {
+			rejectSignature(c, "Request has already been received", []string{"X-Signature-Nonce must be unique to each request"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RunNonceExpiry deletes expired nonces from store every interval until ctx is cancelled. It is only needed when the
+// nonces are kept in a store rather than in a signing.MemoryNonceCache, which removes them itself.
+func RunNonceExpiry(ctx context.Context, config SignatureConfig, store storage.NonceStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := store.DeleteNoncesExpiredBefore(ctx, config.now()); err != nil {
+				config.ErrorLog.Printf("failed to delete expired nonces: %v", err)
+			}
+		}
+	}
+}
+
+// rejectSignature rejects a request whose signature cannot be accepted.
+func rejectSignature(c *gin.Context, message string, details []string) {
+	utils.NewErrorResponse(c, http.StatusUnauthorized, message, details)
+	c.Abort()
+}
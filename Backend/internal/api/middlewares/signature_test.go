@@ -0,0 +1,191 @@
+package middlewares
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/handlers"
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/signing"
+	"github.com/Lionel-Wilson/payment-gateway/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestSignature(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	store := storage.NewMemoryStore()
+	ctx := context.Background()
+	require.NoError(t, store.CreateMerchant(ctx, models.Merchant{ID: "merchant-1", SigningSecret: "sig_1"}))
+	require.NoError(t, store.CreateMerchant(ctx, models.Merchant{ID: "merchant-2"}))
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(handlers.MerchantIDKey, c.GetHeader("X-Merchant"))
+		if id := c.GetHeader("X-User"); id != "" {
+			c.Set(handlers.UserKey, models.User{ID: id, MerchantID: c.GetHeader("X-Merchant")})
+		}
+	})
+	router.Use(RequestSignature(SignatureConfig{
+		Merchants: store,
+		Nonces:    signing.NewMemoryNonceCache(),
+		Window:    5 * time.Minute,
+		Clock:     func() time.Time { return now },
+		ErrorLog:  log.New(io.Discard, "", 0),
+	}))
+	router.POST("/payments", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	})
+	router.GET("/payments", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	body := `{"amount":10}`
+
+	// signed returns the headers of a request signed by merchant-1
+	signed := func(timestamp time.Time, nonce, path, body string) map[string]string {
+		signature := signing.Sign("sig_1", signing.Request{
+			Timestamp: timestamp, Nonce: nonce, Method: "POST", Path: path, Body: []byte(body),
+		})
+
+		return map[string]string{
+			"X-Merchant":            "merchant-1",
+			signing.TimestampHeader: strconv.FormatInt(timestamp.Unix(), 10),
+			signing.NonceHeader:     nonce,
+			signing.SignatureHeader: signature,
+		}
+	}
+
+	// with returns headers with one header changed
+	with := func(headers map[string]string, name, value string) map[string]string {
+		changed := make(map[string]string, len(headers))
+		for k, v := range headers {
+			changed[k] = v
+		}
+		changed[name] = value
+
+		return changed
+	}
+
+	tests := []struct {
+		name               string
+		path               string
+		body               string
+		headers            map[string]string
+		expectedStatusCode int
+		expectedMessage    string
+	}{
+		{"Signed Request", "/payments", body, signed(now, "nonce-1", "/payments", body), http.StatusOK, ""},
+		{"Replayed Request", "/payments", body, signed(now, "nonce-1", "/payments", body), http.StatusUnauthorized, "Request has already been received"},
+		{"Timestamp Within Window", "/payments", body, signed(now.Add(-4*time.Minute), "nonce-2", "/payments", body), http.StatusOK, ""},
+		{"Signed With Query", "/payments?capture=false", body, signed(now, "nonce-3", "/payments?capture=false", body), http.StatusOK, ""},
+		{"Expired Timestamp", "/payments", body, signed(now.Add(-6*time.Minute), "nonce-4", "/payments", body), http.StatusUnauthorized, "Request signature has expired"},
+		{"Future Timestamp", "/payments", body, signed(now.Add(6*time.Minute), "nonce-5", "/payments", body), http.StatusUnauthorized, "Request signature has expired"},
+		{"Changed Body", "/payments", `{"amount":1000}`, signed(now, "nonce-6", "/payments", body), http.StatusUnauthorized, "Invalid request signature"},
+		{"Changed Path", "/payments?capture=false", body, signed(now, "nonce-7", "/payments", body), http.StatusUnauthorized, "Invalid request signature"},
+		{"Other Merchant", "/payments", body, with(signed(now, "nonce-8", "/payments", body), "X-Merchant", "merchant-2"), http.StatusUnauthorized, "Invalid request signature"},
+		{"Unknown Merchant", "/payments", body, with(signed(now, "nonce-9", "/payments", body), "X-Merchant", "merchant-404"), http.StatusUnauthorized, "Invalid request signature"},
+		{"Malformed Timestamp", "/payments", body, with(signed(now, "nonce-10", "/payments", body), signing.TimestampHeader, now.Format(time.RFC3339)), http.StatusUnauthorized, "Invalid request signature"},
+		{"Long Nonce", "/payments", body, signed(now, strings.Repeat("n", 129), "/payments", body), http.StatusUnauthorized, "Invalid request signature"},
+		{"Missing Signature", "/payments", body, with(signed(now, "nonce-11", "/payments", body), signing.SignatureHeader, ""), http.StatusUnauthorized, "Missing request signature"},
+		{"Unsigned Dashboard User", "/payments", body, map[string]string{"X-Merchant": "merchant-1", "X-User": "USR-1"}, http.StatusUnauthorized, "Missing request signature"},
+		{"Signed Dashboard User", "/payments", body, with(signed(now, "nonce-12", "/payments", body), "X-User", "USR-1"), http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			for name, value := range tt.headers {
+				if value != "" {
+					req.Header.Set(name, value)
+				}
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+			if tt.expectedStatusCode == http.StatusOK {
+				assert.Equal(t, tt.body, rr.Body.String(), "the body is passed on to the handler")
+			} else {
+				assert.Contains(t, rr.Body.String(), tt.expectedMessage)
+			}
+		})
+	}
+
+	t.Run("Dashboard Users Can Read Without Signing", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/payments", nil)
+		req.Header.Set("X-Merchant", "merchant-1")
+		req.Header.Set("X-User", "USR-1")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("Nonces Are Shared Between Instances", func(t *testing.T) {
+		// Two instances sharing a store reject a request replayed from one to the other
+		nonces := signing.NonceCacheFunc(storage.NewMemoryStore().AddNonce)
+		newInstance := func() *gin.Engine {
+			instance := gin.New()
+			instance.Use(func(c *gin.Context) {
+				c.Set(handlers.MerchantIDKey, c.GetHeader("X-Merchant"))
+			})
+			instance.Use(RequestSignature(SignatureConfig{
+				Merchants: store,
+				Nonces:    nonces,
+				Window:    5 * time.Minute,
+				Clock:     func() time.Time { return now },
+				ErrorLog:  log.New(io.Discard, "", 0),
+			}))
+			instance.POST("/payments", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			return instance
+		}
+
+		headers := signed(now, "nonce-14", "/payments", body)
+		for _, tt := range []struct {
+			instance           *gin.Engine
+			expectedStatusCode int
+		}{
+			{newInstance(), http.StatusOK},
+			{newInstance(), http.StatusUnauthorized},
+		} {
+			req, _ := http.NewRequest("POST", "/payments", strings.NewReader(body))
+			for name, value := range headers {
+				req.Header.Set(name, value)
+			}
+			rr := httptest.NewRecorder()
+			tt.instance.ServeHTTP(rr, req)
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+		}
+	})
+
+	t.Run("Rejected Requests Do Not Use Up Nonces", func(t *testing.T) {
+		headers := signed(now, "nonce-13", "/payments", body)
+
+		for _, tt := range []struct {
+			body               string
+			expectedStatusCode int
+		}{
+			{`{"amount":1000}`, http.StatusUnauthorized},
+			{body, http.StatusOK},
+		} {
+			req, _ := http.NewRequest("POST", "/payments", strings.NewReader(tt.body))
+			for name, value := range headers {
+				req.Header.Set(name, value)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package middlewares
+
+import (
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/handlers"
+	"github.com/Lionel-Wilson/payment-gateway/internal/certs"
+	"github.com/Lionel-Wilson/payment-gateway/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// RedirectToHTTPS redirects GET and HEAD requests to the same URL over HTTPS, on the port of httpsAddr. Other
+// requests are rejected with a 400 rather than redirected: their body has already been sent in plain text, and
+// following a redirect would hide that from the client. It is meant for a router serving plain HTTP alongside
+// the HTTPS one.
+func RedirectToHTTPS(httpsAddr string) gin.HandlerFunc {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			utils.NewErrorResponse(c, http.StatusBadRequest, "HTTPS is required", []string{"Send the request to https://" + httpsHost(c.Request.Host, port)})
+			c.Abort()
+			return
+		}
+
+		c.Redirect(http.StatusMovedPermanently, "https://"+httpsHost(c.Request.Host, port)+c.Request.URL.RequestURI())
+		c.Abort()
+	}
+}
+
+// httpsHost returns host with its port replaced by port, which is left out when it is the HTTPS default.
+func httpsHost(host, port string) string {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+
+	if port == "" || port == "443" {
+		return host
+	}
+
+	return net.JoinHostPort(host, port)
+}
+
+// RequireClientCertificate rejects requests on behalf of the given merchants with a 403 unless they were made over
+// a TLS connection with a verified client certificate whose URI subject alternative name is the merchant's
+// certs.MerchantURI in trustDomain. The subject common name is ignored, since any name can be put there by a CA that
+// also issues certificates for other purposes. Dashboard users may read the merchant's data without a certificate,
+// since browsers do not usually hold the merchant's certificate, but need one like any other client to change it.
+// It must run after APIKeyAuth, and the server must verify client certificates against the trusted certificate
+// authorities.
+func RequireClientCertificate(trustDomain string, merchantIDs []string) gin.HandlerFunc {
+	required := make(map[string]bool, len(merchantIDs))
+	for _, id := range merchantIDs {
+		required[id] = true
+	}
+
+	return func(c *gin.Context) {
+		merchantID := c.GetString(handlers.MerchantIDKey)
+		if _, ok := c.Get(handlers.UserKey); (ok && !isMutating(c.Request.Method)) || !required[merchantID] {
+			c.Next()
+			return
+		}
+
+		state := c.Request.TLS
+		if state == nil || len(state.VerifiedChains) == 0 {
+			utils.NewErrorResponse(c, http.StatusForbidden, "A client certificate is required", nil)
+			c.Abort()
+			return
+		}
+
+		if !identifies(state.VerifiedChains[0][0], certs.MerchantURI(trustDomain, merchantID)) {
+			utils.NewErrorResponse(c, http.StatusForbidden, "Client certificate does not belong to the merchant", nil)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// identifies reports whether uri is one of the URI subject alternative names of certificate.
+func identifies(certificate *x509.Certificate, uri *url.URL) bool {
+	for _, name := range certificate.URIs {
+		if name.String() == uri.String() {
+			return true
+		}
+	}
+
+	return false
+}
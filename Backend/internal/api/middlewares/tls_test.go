@@ -0,0 +1,124 @@
+package middlewares
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/handlers"
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/certs"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		name               string
+		httpsAddr          string
+		method             string
+		url                string
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"Default Port", ":443", "GET", "http://gateway.example.com/api/v1/payments?limit=10", http.StatusMovedPermanently, "https://gateway.example.com/api/v1/payments?limit=10"},
+		{"Other Port", ":8443", "GET", "http://localhost:8080/swagger/index.html", http.StatusMovedPermanently, "https://localhost:8443/swagger/index.html"},
+		{"Head", ":8443", "HEAD", "http://localhost/api/v1/health", http.StatusMovedPermanently, "https://localhost:8443/api/v1/health"},
+		{"Post", ":8443", "POST", "http://localhost:8080/api/v1/payments", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(RedirectToHTTPS(tt.httpsAddr))
+
+			req, _ := http.NewRequest(tt.method, tt.url, nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+			assert.Equal(t, tt.expectedLocation, rr.Header().Get("Location"))
+			if tt.expectedStatusCode == http.StatusBadRequest {
+				assert.Contains(t, rr.Body.String(), "https://localhost:8443")
+			}
+		})
+	}
+}
+
+func TestRequireClientCertificate(t *testing.T) {
+	now := time.Now()
+	ca, err := certs.NewAuthority("Test CA", now, time.Hour)
+	require.NoError(t, err)
+
+	// verified returns the state of a connection with a verified client certificate for commonName, naming the
+	// merchant with the given ID in the given trust domain if merchantID is not empty
+	verified := func(commonName, trustDomain, merchantID string) *tls.ConnectionState {
+		var uri *url.URL
+		if merchantID != "" {
+			uri = certs.MerchantURI(trustDomain, merchantID)
+		}
+		client, err := ca.IssueClient(commonName, uri, now, time.Hour)
+		require.NoError(t, err)
+
+		return &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{client.Certificate},
+			VerifiedChains:   [][]*x509.Certificate{{client.Certificate, ca.Certificate}},
+		}
+	}
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(handlers.MerchantIDKey, c.GetHeader("X-Merchant"))
+		if id := c.GetHeader("X-User"); id != "" {
+			c.Set(handlers.UserKey, models.User{ID: id})
+		}
+	})
+	router.Use(RequireClientCertificate("payment-gateway", []string{"merchant-1"}))
+	router.GET("/payments", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.POST("/payments", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name               string
+		method             string
+		merchantID         string
+		userID             string
+		state              *tls.ConnectionState
+		expectedStatusCode int
+	}{
+		{"Merchant Certificate", "GET", "merchant-1", "", verified("merchant-1", "payment-gateway", "merchant-1"), http.StatusOK},
+		{"Other Merchant's Certificate", "GET", "merchant-1", "", verified("merchant-2", "payment-gateway", "merchant-2"), http.StatusForbidden},
+		{"Common Name Only", "GET", "merchant-1", "", verified("merchant-1", "", ""), http.StatusForbidden},
+		{"Other Merchant With Common Name", "GET", "merchant-1", "", verified("merchant-1", "payment-gateway", "merchant-2"), http.StatusForbidden},
+		{"Other Trust Domain", "GET", "merchant-1", "", verified("merchant-1", "other-service", "merchant-1"), http.StatusForbidden},
+		{"No Certificate", "GET", "merchant-1", "", &tls.ConnectionState{}, http.StatusForbidden},
+		{"Plain HTTP", "GET", "merchant-1", "", nil, http.StatusForbidden},
+		{"Dashboard User Reading", "GET", "merchant-1", "USR-1", &tls.ConnectionState{}, http.StatusOK},
+		{"Dashboard User Writing", "POST", "merchant-1", "USR-1", &tls.ConnectionState{}, http.StatusForbidden},
+		{"Dashboard User Writing With Certificate", "POST", "merchant-1", "USR-1", verified("merchant-1", "payment-gateway", "merchant-1"), http.StatusOK},
+		{"Merchant Without Requirement", "GET", "merchant-2", "", &tls.ConnectionState{}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, "/payments", nil)
+			req.Header.Set("X-Merchant", tt.merchantID)
+			if tt.userID != "" {
+				req.Header.Set("X-User", tt.userID)
+			}
+			req.TLS = tt.state
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+		})
+	}
+}
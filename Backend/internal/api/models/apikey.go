@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/apikey"
+)
+
+// APIKeyRequest represents a request to create an API key.
+type APIKeyRequest struct {
+	Kind apikey.Kind `json:"kind" example:"secret" validate:"required,oneof=publishable secret"` // The kind of key. Publishable keys can only tokenize cards and look up BINs.
+	Mode apikey.Mode `json:"mode" example:"test" validate:"required,oneof=live test"`            // Whether the key makes live or test payments.
+}
+
+// RotateAPIKeyRequest represents a request to replace an API key with a new one.
+type RotateAPIKeyRequest struct {
+	GracePeriodSeconds int `json:"gracePeriodSeconds" example:"86400" validate:"min=0,max=604800"` // How long the old key keeps working, up to a week. The old key stops working immediately when zero.
+}
+
+// APIKey represents a key a merchant authenticates with. The key itself is only returned when it is created.
+type APIKey struct {
+	ID         string      `json:"id" example:"KEY-3f9a0c5e8b7d4a1f9e2c6b0d8a4f7e1c"`                                // The unique identifier of the key.
+	MerchantID string      `json:"-"`                                                                                // The merchant the key authenticates.
+	Key        string      `json:"key,omitempty" example:"sk_test_4f1c0e9a8b7d6c5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c"` // The key, only returned when it is created.
+	Kind       apikey.Kind `json:"kind" example:"secret"`                                                            // The kind of key.
+	Mode       apikey.Mode `json:"mode" example:"test"`                                                              // Whether the key makes live or test payments.
+	Last4      string      `json:"last4" example:"4d3e"`                                                             // The last four characters of the key.
+	Hash       string      `json:"-"`                                                                                // The hash of the key, by which it is looked up.
+	CreatedAt  time.Time   `json:"createdAt" example:"2024-07-01T12:00:00Z"`                                         // When the key was created.
+	ExpiresAt  *time.Time  `json:"expiresAt,omitempty" example:"2024-07-02T12:00:00Z"`                               // When the key stops working, if it has been rotated.
+	RevokedAt  *time.Time  `json:"revokedAt,omitempty" example:"2024-07-02T12:00:00Z"`                               // When the key was revoked, if it has been.
+}
+
+// Active reports whether the key can be used at the given time.
+func (k APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// Redacted returns the key without the key itself.
+func (k APIKey) Redacted() APIKey {
+	k.Key = ""
+	return k
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"github.com/Lionel-Wilson/payment-gateway/internal/bin"
+	"github.com/Lionel-Wilson/payment-gateway/internal/card"
+)
+
+// BINDetails represents what is known about the cards issued under a bank identification number (BIN).
+type BINDetails struct {
+	BIN     string      `json:"bin" example:"411111"`           // The BIN of the matching record, which may be shorter than the BIN looked up.
+	Brand   card.Brand  `json:"brand" example:"visa"`           // The card scheme, detected from the BIN.
+	Issuer  string      `json:"issuer" example:"Example Bank"`  // The bank that issues the cards.
+	Country string      `json:"country" example:"GB"`           // The ISO 3166 country code of the issuer.
+	Funding bin.Funding `json:"funding" example:"credit"`       // Whether the cards are credit, debit, prepaid or charge cards.
+	Product string      `json:"product" example:"Visa Classic"` // The card product.
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Merchant represents a business that takes payments through the gateway. Every payment, refund, token and API key
+// belongs to a merchant, and is only visible to it.
+type Merchant struct {
+	ID        string    `json:"id" example:"MER-3f9a0c5e8b7d4a1f9e2c6b0d8a4f7e1c"` // The unique identifier of the merchant.
+	Name      string    `json:"name" example:"Acme Ltd"`                           // The merchant's business name.
+	CreatedAt time.Time `json:"createdAt" example:"2024-07-01T12:00:00Z"`          // When the merchant was created.
+
+	SigningSecret string `json:"-"` // The secret the merchant signs requests with, or empty if it has none.
+}
+
+// SigningSecret is returned when a merchant's signing secret is created or replaced. The secret is only returned in
+// this response.
+type SigningSecret struct {
+	Secret    string    `json:"secret,omitempty" example:"sig_5d1f8a3c9e7b2d4f6a0c8e1b3d5f7a9c2e4b6d8f0a1c3e5b7d9f2a4c6e8b0d1f"` // The signing secret.
+	CreatedAt time.Time `json:"createdAt" example:"2024-07-01T12:00:00Z"`                                                        // When the secret was created.
+}
+
+// Redacted returns the signing secret response without the secret itself.
+func (s SigningSecret) Redacted() SigningSecret {
+	s.Secret = ""
+	return s
+}
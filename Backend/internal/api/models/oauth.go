@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/oauth"
+)
+
+// OAuthClient represents a platform partner that obtains access tokens to act on behalf of merchants. Its secret is
+// only shown when it is created.
+type OAuthClient struct {
+	ID          string        `json:"id" example:"CLI-9b2e4d6f8a0c1e3b5d7f9a2c4e6b8d0f"`  // The client ID.
+	Name        string        `json:"name" example:"Acme Platform"`                       // The partner's name.
+	SecretHash  string        `json:"-"`                                                  // The hash of the client secret.
+	Scopes      []oauth.Scope `json:"scopes" example:"payments:write,payments:read"`      // The scopes the client may request.
+	MerchantIDs []string      `json:"merchantIds"`                                        // The merchants the client may act on behalf of.
+	CreatedAt   time.Time     `json:"createdAt" example:"2024-07-01T12:00:00Z"`           // When the client was created.
+	RevokedAt   *time.Time    `json:"revokedAt,omitempty" example:"2024-07-02T12:00:00Z"` // When the client was revoked, if it has been.
+}
+
+// AccessTokenResponse is returned by the token endpoint, as defined by RFC 6749.
+type AccessTokenResponse struct {
+	AccessToken string `json:"access_token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.eyJpc3MiOi...In0.2oV1..."` // The access token.
+	TokenType   string `json:"token_type" example:"Bearer"`                                                          // Always Bearer.
+	ExpiresIn   int    `json:"expires_in" example:"900"`                                                             // How many seconds the token is valid for.
+	Scope       string `json:"scope" example:"payments:write payments:read"`                                         // The scopes the token grants.
+}
+
+// OAuthErrorResponse is returned by the token endpoint when a token cannot be issued, as defined by RFC 6749.
+type OAuthErrorResponse struct {
+	Error            string `json:"error" example:"invalid_client"`                                   // The error code.
+	ErrorDescription string `json:"error_description,omitempty" example:"Invalid client credentials"` // A description of the error.
+}
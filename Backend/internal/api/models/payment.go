@@ -1,35 +1,95 @@
 package models
 
+import (
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/bin"
+	"github.com/Lionel-Wilson/payment-gateway/internal/card"
+	"github.com/Lionel-Wilson/payment-gateway/internal/money"
+)
+
 // ProcessPaymentRequest represents a request to process a payment.
-// It includes details like the cardholder's name, card number, expiry date, amount, currency, and CVV.
+// It includes details like the cardholder's name, card number, expiry date, amount, currency, and CVV,
+// or a vault token standing in for the card details, and whether the funds should be captured immediately
+// or only authorized.
 type ProcessPaymentRequest struct {
-	FirstName    string  `json:"firstName" example:"John" validate:"required,alpha"`                    // The first name of the cardholder. Required and must be alphabetic.
-	LastName     string  `json:"lastName" example:"Doe" validate:"required,alpha"`                      // The last name of the cardholder. Required and must be alphabetic.
-	CardNumber   string  `json:"cardNumber" example:"4111111111111111" validate:"required,credit_card"` // The credit card number. Required and must be a valid credit card number.
-	ExpiryDate   string  `json:"expiryDate" example:"12/29" validate:"required,expirydate"`             // The expiry date of the credit card in MM/YY format. Required with custom validation.
-	Amount       float64 `json:"amount" example:"500" validate:"required,gt=0"`                         // The amount to be charged. Required and must be greater than 0.
-	CurrencyCode string  `json:"currencyCode" example:"GBP" validate:"required,len=3,alpha"`            // The currency code for the transaction. Required, must be 3 alphabetic characters.
-	CVV          string  `json:"cvv" example:"123" validate:"required,len=3,numeric"`                   // The CVV of the credit card. Required, must be exactly 3 numeric characters.
+	FirstName    string      `json:"firstName" example:"John" validate:"required,alpha"`                              // The first name of the cardholder. Required and must be alphabetic.
+	LastName     string      `json:"lastName" example:"Doe" validate:"required,alpha"`                                // The last name of the cardholder. Required and must be alphabetic.
+	Token        string      `json:"token,omitempty" example:"TOK-3f9a0c5e8b7d4a1f9e2c6b0d8a4f7e1c"`                  // A vault token to charge instead of sending card details. Optional.
+	CardNumber   string      `json:"cardNumber" example:"4111111111111111" validate:"required,cardnumber"`            // The credit card number. Required unless a token is given, must be a valid card number of a supported brand.
+	ExpiryDate   string      `json:"expiryDate" example:"12/29" validate:"required,expirydate,unexpired,expirylimit"` // The expiry date of the credit card in MM/YY or MM/YYYY format. Required unless given as expiryMonth and expiryYear, must not have passed.
+	ExpiryMonth  int         `json:"expiryMonth,omitempty" example:"12"`                                              // The expiry month of the credit card, from 1 to 12. An alternative to expiryDate, given with expiryYear.
+	ExpiryYear   int         `json:"expiryYear,omitempty" example:"2029"`                                             // The expiry year of the credit card, with two or four digits. An alternative to expiryDate, given with expiryMonth.
+	Amount       money.Money `json:"amount" validate:"required,gt=0"`                                                 // The amount to be charged, in minor units or as a decimal in currencyCode. Required and must be greater than 0.
+	CurrencyCode string      `json:"currencyCode" example:"GBP" validate:"required,currency"`                         // The ISO 4217 currency code for the transaction. Required unless given with the amount, must be a currency the merchant accepts.
+	CVV          string      `json:"cvv" example:"123" validate:"required_without=Token,omitempty,cvv=CardNumber"`    // The CVV of the credit card. Required unless a token is given, must be 3 digits, or 4 for American Express.
+	Capture      *bool       `json:"capture,omitempty" example:"true"`                                                // Whether to capture the funds immediately. Defaults to true; when false the payment is only authorized.
 }
 
 // ProcessPaymentResponse represents a response after processing a payment.
-// It includes an ID, status, and a response summary.
+// It includes an ID, status, the card's brand, last four digits and issuer details, status code, and a response summary.
 type ProcessPaymentResponse struct {
-	ID              string `json:"id" example:"PAY-1625843728243722000"` // The unique identifier for the payment transaction.
-	Status          string `json:"status" example:"payment_paid"`        // The status of the payment transaction.
-	ResponseSummary string `json:"responseSummary" example:"Approved"`   // A summary of the payment response.
+	ID              string        `json:"id" example:"PAY-1625843728243722000"` // The unique identifier for the payment transaction.
+	Status          PaymentStatus `json:"status" example:"payment_paid"`        // The status of the payment transaction.
+	CardBrand       card.Brand    `json:"cardBrand" example:"visa"`             // The card scheme, detected from the card number.
+	CardLast4       string        `json:"cardLast4" example:"1111"`             // The last four digits of the card number.
+	CardIssuer      string        `json:"cardIssuer" example:"Example Bank"`    // The bank that issued the card, if its BIN is known.
+	CardCountry     string        `json:"cardCountry" example:"GB"`             // The ISO 3166 country code of the card's issuer, if its BIN is known.
+	CardFunding     bin.Funding   `json:"cardFunding" example:"credit"`         // Whether the card is a credit, debit, prepaid or charge card, if its BIN is known.
+	CardProduct     string        `json:"cardProduct" example:"Visa Classic"`   // The card product, if its BIN is known.
+	StatusCode      int           `json:"statusCode" example:"10000"`           // The status code returned by the acquiring bank.
+	ResponseSummary string        `json:"responseSummary" example:"Approved"`   // A summary of the payment response.
 }
 
 // PaymentDetails represents the details of a processed payment.
 // It includes the payment ID, cardholder's name, masked card number, expiry date, amount, currency, status, and status code.
 type PaymentDetails struct {
-	ID           string  `json:"id" example:"PAY-1625843728243722000"`  // The unique identifier for the payment transaction.
-	FirstName    string  `json:"firstName" example:"John"`              // The first name of the cardholder.
-	LastName     string  `json:"lastName" example:"Doe"`                // The last name of the cardholder.
-	CardNumber   string  `json:"cardNumber" example:"************1111"` // The masked credit card number.
-	ExpiryDate   string  `json:"expiryDate" example:"12/29"`            // The expiry date of the credit card in MM/YY format.
-	Amount       float64 `json:"amount" example:"500"`                  // The amount charged in the transaction.
-	CurrencyCode string  `json:"currencyCode" example:"GBP"`            // The currency code for the transaction.
-	Status       string  `json:"status" example:"payment_paid"`         // The status of the payment transaction.
-	StatusCode   int     `json:"statusCode" example:"10000"`            // The status code of the payment transaction.
+	ID                     string        `json:"id" example:"PAY-1625843728243722000"`                            // The unique identifier for the payment transaction.
+	MerchantID             string        `json:"-"`                                                               // The merchant that made the payment.
+	FirstName              string        `json:"firstName" example:"John"`                                        // The first name of the cardholder.
+	LastName               string        `json:"lastName" example:"Doe"`                                          // The last name of the cardholder.
+	CardNumber             string        `json:"cardNumber" example:"************1111"`                           // The masked credit card number.
+	CardBrand              card.Brand    `json:"cardBrand" example:"visa"`                                        // The card scheme, detected from the card number.
+	CardLast4              string        `json:"cardLast4" example:"1111"`                                        // The last four digits of the card number.
+	CardIssuer             string        `json:"cardIssuer" example:"Example Bank"`                               // The bank that issued the card, if its BIN is known.
+	CardCountry            string        `json:"cardCountry" example:"GB"`                                        // The ISO 3166 country code of the card's issuer, if its BIN is known.
+	CardFunding            bin.Funding   `json:"cardFunding" example:"credit"`                                    // Whether the card is a credit, debit, prepaid or charge card, if its BIN is known.
+	CardProduct            string        `json:"cardProduct" example:"Visa Classic"`                              // The card product, if its BIN is known.
+	ExpiryDate             string        `json:"expiryDate" example:"12/29"`                                      // The expiry date of the credit card in MM/YY format.
+	Amount                 money.Money   `json:"amount"`                                                          // The amount charged in the transaction.
+	CurrencyCode           string        `json:"currencyCode" example:"GBP"`                                      // The currency code for the transaction.
+	Status                 PaymentStatus `json:"status" example:"payment_paid"`                                   // The status of the payment transaction.
+	StatusCode             int           `json:"statusCode" example:"10000"`                                      // The status code of the payment transaction.
+	ResponseSummary        string        `json:"responseSummary" example:"Approved"`                              // A summary of the bank's most recent response.
+	BankReference          string        `json:"bankReference" example:"BNK-1625843728243722000"`                 // The acquiring bank's reference for the transaction.
+	CapturedAmount         money.Money   `json:"capturedAmount"`                                                  // The amount captured so far.
+	RefundedAmount         money.Money   `json:"refundedAmount"`                                                  // The amount refunded so far, including refunds still being processed.
+	AuthorizationExpiresAt *time.Time    `json:"authorizationExpiresAt,omitempty" example:"2024-07-05T12:00:00Z"` // When an uncaptured authorization lapses.
+	CaptureStartedAt       *time.Time    `json:"-"`                                                               // When the bank was last asked to capture the payment, while it is being captured.
+	Version                int           `json:"-"`                                                               // Incremented on every update, to detect concurrent changes.
+}
+
+// CaptureRequest represents a request to capture a previously authorized payment.
+// The amount may be omitted to capture the full authorized amount.
+type CaptureRequest struct {
+	Amount money.Money `json:"amount" validate:"omitempty,gt=0"` // The amount to capture, in minor units or as a decimal in the payment's currency. Optional, must be greater than 0 and no more than the authorized amount.
+}
+
+// CaptureResponse represents a response after capturing a payment.
+// It includes the payment ID, the payment's new status, the captured amount, and the bank's response.
+type CaptureResponse struct {
+	PaymentID       string        `json:"paymentId" example:"PAY-1625843728243722000"` // The unique identifier of the captured payment.
+	Status          PaymentStatus `json:"status" example:"payment_paid"`               // The status of the payment after the capture.
+	Amount          money.Money   `json:"amount"`                                      // The amount captured.
+	StatusCode      int           `json:"statusCode" example:"10000"`                  // The status code returned by the acquiring bank.
+	ResponseSummary string        `json:"responseSummary" example:"Approved"`          // A summary of the capture response.
+}
+
+// VoidResponse represents a response after voiding a payment.
+// It includes the payment ID, the payment's new status, and the bank's response.
+type VoidResponse struct {
+	PaymentID       string        `json:"paymentId" example:"PAY-1625843728243722000"` // The unique identifier of the voided payment.
+	Status          PaymentStatus `json:"status" example:"payment_voided"`             // The status of the payment after the void.
+	StatusCode      int           `json:"statusCode" example:"10000"`                  // The status code returned by the acquiring bank.
+	ResponseSummary string        `json:"responseSummary" example:"Approved"`          // A summary of the void response.
 }
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/money"
+)
+
+// RefundRequest represents a request to refund a captured payment.
+// The amount may be omitted to refund everything that has not been refunded yet.
+type RefundRequest struct {
+	Amount money.Money `json:"amount" validate:"omitempty,gt=0"`                            // The amount to refund, in minor units or as a decimal in the payment's currency. Optional, must be greater than 0 and no more than the refundable amount.
+	Reason string      `json:"reason" example:"Item returned" validate:"omitempty,max=255"` // Why the payment is being refunded. Optional, at most 255 characters.
+}
+
+// Refund represents the details of a refund of a payment.
+// A payment can be refunded several times, up to the amount captured.
+type Refund struct {
+	ID              string       `json:"id" example:"REF-1625843728243722000"`            // The unique identifier for the refund.
+	PaymentID       string       `json:"paymentId" example:"PAY-1625843728243722000"`     // The unique identifier of the refunded payment.
+	MerchantID      string       `json:"-"`                                               // The merchant that made the refunded payment.
+	Amount          money.Money  `json:"amount"`                                          // The amount refunded.
+	CurrencyCode    string       `json:"currencyCode" example:"GBP"`                      // The currency code of the refund.
+	Status          RefundStatus `json:"status" example:"refund_succeeded"`               // The status of the refund.
+	StatusCode      int          `json:"statusCode" example:"10000"`                      // The status code returned by the acquiring bank.
+	ResponseSummary string       `json:"responseSummary" example:"Approved"`              // A summary of the bank's response.
+	Reason          string       `json:"reason,omitempty" example:"Item returned"`        // Why the payment was refunded.
+	BankReference   string       `json:"bankReference" example:"BNK-1625843728243722000"` // The acquiring bank's reference for the refund.
+	CreatedAt       time.Time    `json:"createdAt" example:"2024-07-01T12:00:00Z"`        // When the refund was requested.
+}
@@ -0,0 +1,78 @@
+package models
+
+import "fmt"
+
+// PaymentStatus is the stage a payment has reached in its lifecycle.
+// A payment can only move between statuses as allowed by paymentTransitions.
+type PaymentStatus string
+
+const (
+	StatusPending           PaymentStatus = "payment_pending"            // The payment has been created and is waiting for the bank.
+	StatusAuthorized        PaymentStatus = "payment_authorized"         // The funds are held on the card and waiting to be captured.
+	StatusCapturing         PaymentStatus = "payment_capturing"          // A capture has been sent to the bank.
+	StatusPaid              PaymentStatus = "payment_paid"               // The funds have been captured.
+	StatusDeclined          PaymentStatus = "payment_declined"           // The bank declined the authorization.
+	StatusFailed            PaymentStatus = "payment_failed"             // The bank failed to process the authorization.
+	StatusExpired           PaymentStatus = "payment_expired"            // The authorization lapsed before it was captured.
+	StatusVoided            PaymentStatus = "payment_voided"             // The authorization was released before it was captured.
+	StatusPartiallyRefunded PaymentStatus = "payment_partially_refunded" // Some of the captured funds have been refunded.
+	StatusRefunded          PaymentStatus = "payment_refunded"           // All of the captured funds have been refunded.
+)
+
+// paymentTransitions lists the statuses each status can move to. Statuses without an entry are final.
+// A refunded payment can move back to an earlier status when a refund that reserved its amount does not go through,
+// and a payment being captured moves back to authorized when the capture does not go through. A payment captured
+// straight away is left capturing when the outcome of its capture is unknown.
+var paymentTransitions = map[PaymentStatus][]PaymentStatus{
+	StatusPending:           {StatusAuthorized, StatusCapturing, StatusPaid, StatusDeclined, StatusFailed},
+	StatusAuthorized:        {StatusCapturing, StatusExpired, StatusVoided},
+	StatusCapturing:         {StatusPaid, StatusAuthorized},
+	StatusPaid:              {StatusPartiallyRefunded, StatusRefunded},
+	StatusPartiallyRefunded: {StatusPaid, StatusPartiallyRefunded, StatusRefunded},
+	StatusRefunded:          {StatusPaid, StatusPartiallyRefunded},
+}
+
+// CanTransitionTo reports whether a payment with status s may move to status next.
+func (s PaymentStatus) CanTransitionTo(next PaymentStatus) bool {
+	for _, allowed := range paymentTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Transition returns a *TransitionError if a payment with status s may not move to status next.
+func (s PaymentStatus) Transition(next PaymentStatus) error {
+	if !s.CanTransitionTo(next) {
+		return &TransitionError{From: s, To: next}
+	}
+
+	return nil
+}
+
+// IsFinal reports whether a payment with status s can no longer change.
+func (s PaymentStatus) IsFinal() bool {
+	return len(paymentTransitions[s]) == 0
+}
+
+// TransitionError is returned when a payment is asked to make a move its status does not allow.
+type TransitionError struct {
+	From PaymentStatus // The payment's current status
+	To   PaymentStatus // The status the payment was asked to move to
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("payment cannot move from %s to %s", e.From, e.To)
+}
+
+// RefundStatus is the stage a refund has reached. Every refund starts pending and ends in one of the other statuses.
+type RefundStatus string
+
+const (
+	RefundPending   RefundStatus = "refund_pending"   // The refund has been created and is waiting for the bank.
+	RefundSucceeded RefundStatus = "refund_succeeded" // The bank returned the funds to the cardholder.
+	RefundDeclined  RefundStatus = "refund_declined"  // The bank declined the refund.
+	RefundFailed    RefundStatus = "refund_failed"    // The bank failed to process the refund.
+)
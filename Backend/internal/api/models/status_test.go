@@ -0,0 +1,66 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaymentStatusTransition(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    PaymentStatus
+		to      PaymentStatus
+		allowed bool
+	}{
+		{name: "Authorize", from: StatusPending, to: StatusAuthorized, allowed: true},
+		{name: "Charge", from: StatusPending, to: StatusPaid, allowed: true},
+		{name: "Decline", from: StatusPending, to: StatusDeclined, allowed: true},
+		{name: "Charge With Unknown Capture", from: StatusPending, to: StatusCapturing, allowed: true},
+		{name: "Start Capture", from: StatusAuthorized, to: StatusCapturing, allowed: true},
+		{name: "Capture", from: StatusCapturing, to: StatusPaid, allowed: true},
+		{name: "Release Capture", from: StatusCapturing, to: StatusAuthorized, allowed: true},
+		{name: "Void", from: StatusAuthorized, to: StatusVoided, allowed: true},
+		{name: "Expire", from: StatusAuthorized, to: StatusExpired, allowed: true},
+		{name: "Partial Refund", from: StatusPaid, to: StatusPartiallyRefunded, allowed: true},
+		{name: "Further Partial Refund", from: StatusPartiallyRefunded, to: StatusPartiallyRefunded, allowed: true},
+		{name: "Release Refund", from: StatusRefunded, to: StatusPaid, allowed: true},
+		{name: "Refund Declined Payment", from: StatusDeclined, to: StatusRefunded, allowed: false},
+		{name: "Refund Authorization", from: StatusAuthorized, to: StatusRefunded, allowed: false},
+		{name: "Capture Twice", from: StatusPaid, to: StatusPaid, allowed: false},
+		{name: "Capture Without Reserving", from: StatusAuthorized, to: StatusPaid, allowed: false},
+		{name: "Capture Concurrently", from: StatusCapturing, to: StatusCapturing, allowed: false},
+		{name: "Void During Capture", from: StatusCapturing, to: StatusVoided, allowed: false},
+		{name: "Void Captured Payment", from: StatusPaid, to: StatusVoided, allowed: false},
+		{name: "Capture Expired Authorization", from: StatusExpired, to: StatusPaid, allowed: false},
+		{name: "Refund Fully Refunded Payment", from: StatusRefunded, to: StatusRefunded, allowed: false},
+		{name: "Unknown Status", from: "payment_unknown", to: StatusPaid, allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.allowed, tt.from.CanTransitionTo(tt.to))
+
+			err := tt.from.Transition(tt.to)
+			if tt.allowed {
+				assert.NoError(t, err)
+				return
+			}
+
+			var transitionErr *TransitionError
+			assert.True(t, errors.As(err, &transitionErr))
+			assert.Equal(t, tt.from, transitionErr.From)
+			assert.Equal(t, tt.to, transitionErr.To)
+		})
+	}
+}
+
+func TestPaymentStatusIsFinal(t *testing.T) {
+	for _, status := range []PaymentStatus{StatusDeclined, StatusFailed, StatusExpired, StatusVoided} {
+		assert.True(t, status.IsFinal(), status)
+	}
+	for _, status := range []PaymentStatus{StatusPending, StatusAuthorized, StatusCapturing, StatusPaid, StatusPartiallyRefunded, StatusRefunded} {
+		assert.False(t, status.IsFinal(), status)
+	}
+}
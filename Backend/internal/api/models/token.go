@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/card"
+)
+
+// TokenRequest represents a request to store a card in the vault in exchange for a token.
+// The CVV is not accepted, as it must never be stored.
+type TokenRequest struct {
+	FirstName   string `json:"firstName" example:"John" validate:"required,alpha"`                              // The first name of the cardholder. Required and must be alphabetic.
+	LastName    string `json:"lastName" example:"Doe" validate:"required,alpha"`                                // The last name of the cardholder. Required and must be alphabetic.
+	CardNumber  string `json:"cardNumber" example:"4111111111111111" validate:"required,cardnumber"`            // The credit card number. Required and must be a valid card number of a supported brand.
+	ExpiryDate  string `json:"expiryDate" example:"12/29" validate:"required,expirydate,unexpired,expirylimit"` // The expiry date of the credit card in MM/YY or MM/YYYY format. Required unless given as expiryMonth and expiryYear, must not have passed.
+	ExpiryMonth int    `json:"expiryMonth,omitempty" example:"12"`                                              // The expiry month of the credit card, from 1 to 12. An alternative to expiryDate, given with expiryYear.
+	ExpiryYear  int    `json:"expiryYear,omitempty" example:"2029"`                                             // The expiry year of the credit card, with two or four digits. An alternative to expiryDate, given with expiryMonth.
+}
+
+// Token represents a card stored in the vault. Payments can be made with the token instead of the card details
+// until it is revoked, by the merchant that created it only.
+type Token struct {
+	ID            string     `json:"id" example:"TOK-3f9a0c5e8b7d4a1f9e2c6b0d8a4f7e1c"`  // The unique, unguessable identifier of the token.
+	MerchantID    string     `json:"-"`                                                  // The merchant that created the token.
+	CardBrand     card.Brand `json:"cardBrand" example:"visa"`                           // The card scheme, detected from the card number.
+	CardLast4     string     `json:"cardLast4" example:"1111"`                           // The last four digits of the card number.
+	EncryptedCard []byte     `json:"-"`                                                  // The card details, encrypted by the vault.
+	KeyID         string     `json:"-"`                                                  // The ID of the master key that wraps the card's encryption key.
+	CreatedAt     time.Time  `json:"createdAt" example:"2024-07-01T12:00:00Z"`           // When the token was created.
+	RevokedAt     *time.Time `json:"revokedAt,omitempty" example:"2024-07-02T12:00:00Z"` // When the token was revoked, if it has been.
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/rbac"
+)
+
+// CreateUserRequest represents a request to create a dashboard user.
+type CreateUserRequest struct {
+	Email    string    `json:"email" example:"jane@example.com" validate:"required,email,max=254"`                // The email address the user logs in with.
+	Name     string    `json:"name" example:"Jane Doe" validate:"required,max=100"`                               // The user's name.
+	Role     rbac.Role `json:"role" example:"support" validate:"required,oneof=admin developer support finance"`  // What the user can do.
+	Password string    `json:"password" example:"correct horse battery staple" validate:"required,min=12,max=72"` // The user's password.
+}
+
+// UpdateUserRequest represents a request to change the role of a dashboard user.
+type UpdateUserRequest struct {
+	Role rbac.Role `json:"role" example:"finance" validate:"required,oneof=admin developer support finance"` // What the user can do.
+}
+
+// LoginRequest represents a request to log in to the dashboard.
+type LoginRequest struct {
+	Email    string `json:"email" example:"jane@example.com" validate:"required"`                // The email address of the user.
+	Password string `json:"password" example:"correct horse battery staple" validate:"required"` // The user's password.
+}
+
+// User represents a person who uses the merchant's dashboard. What they can do is determined by their role.
+type User struct {
+	ID           string     `json:"id" example:"USR-7c1e3a5f9b2d4e6a8c0f1b3d5e7a9c2f"`   // The unique identifier of the user.
+	MerchantID   string     `json:"-"`                                                   // The merchant the user belongs to.
+	Email        string     `json:"email" example:"jane@example.com"`                    // The email address the user logs in with.
+	Name         string     `json:"name" example:"Jane Doe"`                             // The user's name.
+	Role         rbac.Role  `json:"role" example:"support"`                              // What the user can do.
+	PasswordHash string     `json:"-"`                                                   // The bcrypt hash of the user's password.
+	CreatedAt    time.Time  `json:"createdAt" example:"2024-07-01T12:00:00Z"`            // When the user was created.
+	DisabledAt   *time.Time `json:"disabledAt,omitempty" example:"2024-07-02T12:00:00Z"` // When the user was disabled, if they have been.
+}
+
+// Session represents a dashboard user's login. The token is only returned when the user logs in.
+type Session struct {
+	ID         string    `json:"-"`                                                                                               // The hash of the session token, by which it is looked up.
+	Token      string    `json:"token,omitempty" example:"sess_1f3a5c7e9b2d4f6a8c0e1b3d5f7a9c2e4b6d8f0a1c3e5b7d9f2a4c6e8b0d1f3a"` // The session token, only returned when the user logs in.
+	UserID     string    `json:"-"`                                                                                               // The user who logged in.
+	MerchantID string    `json:"-"`                                                                                               // The merchant the user belongs to.
+	User       *User     `json:"user,omitempty"`                                                                                  // The user who logged in.
+	CreatedAt  time.Time `json:"createdAt" example:"2024-07-01T12:00:00Z"`                                                        // When the user logged in.
+	ExpiresAt  time.Time `json:"expiresAt" example:"2024-07-01T20:00:00Z"`                                                        // When the session ends.
+}
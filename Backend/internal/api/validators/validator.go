@@ -1,18 +1,115 @@
 package validators
 
 import (
+	"context"
 	"fmt"
-	"regexp"
+	"reflect"
+	"strings"
+	"time"
 
+	"github.com/Lionel-Wilson/payment-gateway/internal/card"
+	"github.com/Lionel-Wilson/payment-gateway/internal/currency"
+	"github.com/Lionel-Wilson/payment-gateway/internal/money"
 	"github.com/go-playground/validator/v10"
 )
 
-// ExpiryDateValidation is a custom validator function that checks if a field's value matches the "MM/YY" format.
-// It uses a regular expression to perform the validation.
+// DefaultMaxExpiryYears is how many years ahead an expiry date may be when ExpiryRules does not say.
+const DefaultMaxExpiryYears = 20
+
+// ExpiryRules are the limits card expiry dates are checked against. They are passed to the "unexpired" and
+// "expirylimit" validations through the context given to Validate.StructCtx, so that the current time can be set.
+type ExpiryRules struct {
+	Now      func() time.Time // Returns the current time. Defaults to time.Now when nil
+	MaxYears int              // How many years ahead an expiry date may be. Defaults to DefaultMaxExpiryYears when zero
+}
+
+type expiryRulesKey struct{}
+
+// WithExpiryRules returns a copy of ctx carrying the rules used to check expiry dates.
+func WithExpiryRules(ctx context.Context, rules ExpiryRules) context.Context {
+	return context.WithValue(ctx, expiryRulesKey{}, rules)
+}
+
+// expiryRules returns the rules carried by ctx, with defaults for any that are not set.
+func expiryRules(ctx context.Context) (now time.Time, maxYears int) {
+	rules, _ := ctx.Value(expiryRulesKey{}).(ExpiryRules)
+
+	now = time.Now()
+	if rules.Now != nil {
+		now = rules.Now()
+	}
+
+	maxYears = rules.MaxYears
+	if maxYears == 0 {
+		maxYears = DefaultMaxExpiryYears
+	}
+
+	return now, maxYears
+}
+
+// ExpiryDateValidation is a custom validator function that checks if a field's value is an expiry date in the
+// "MM/YY" or "MM/YYYY" format.
 func ExpiryDateValidation(fl validator.FieldLevel) bool {
-	expiryDate := fl.Field().String()
-	match, _ := regexp.MatchString(`^(0[1-9]|1[0-2])\/([0-9]{2})$`, expiryDate)
-	return match
+	_, err := card.ParseExpiry(fl.Field().String())
+	return err == nil
+}
+
+// UnexpiredValidation is a custom validator function that checks if a field's value is an expiry date that has
+// not passed yet. Malformed dates pass, so that they are only reported by ExpiryDateValidation.
+func UnexpiredValidation(ctx context.Context, fl validator.FieldLevel) bool {
+	expiry, err := card.ParseExpiry(fl.Field().String())
+	if err != nil {
+		return true
+	}
+
+	now, _ := expiryRules(ctx)
+	return !expiry.Expired(now)
+}
+
+// ExpiryLimitValidation is a custom validator function that checks if a field's value is an expiry date no more
+// than the maximum number of years ahead. Malformed dates pass, so that they are only reported by
+// ExpiryDateValidation.
+func ExpiryLimitValidation(ctx context.Context, fl validator.FieldLevel) bool {
+	expiry, err := card.ParseExpiry(fl.Field().String())
+	if err != nil {
+		return true
+	}
+
+	now, maxYears := expiryRules(ctx)
+	return !expiry.BeyondYears(now, maxYears)
+}
+
+// CardNumberValidation is a custom validator function that checks if a field's value is a card number of a known
+// brand, with a length that brand issues and a valid Luhn check digit.
+func CardNumberValidation(fl validator.FieldLevel) bool {
+	return card.ValidNumber(fl.Field().String())
+}
+
+// CVVValidation is a custom validator function that checks if a field's value is a CVV of the length used by the
+// brand of the card number held in the sibling field named by the tag's parameter, e.g. "cvv=CardNumber".
+func CVVValidation(fl validator.FieldLevel) bool {
+	cardNumber := fl.Parent().FieldByName(fl.Param())
+	if !cardNumber.IsValid() {
+		return false
+	}
+
+	return card.ValidCVV(cardNumber.String(), fl.Field().String())
+}
+
+// CurrencyValidation is a custom validator function that checks if a field's value is an ISO 4217 currency code
+// in the currency registry.
+func CurrencyValidation(fl validator.FieldLevel) bool {
+	return currency.IsValid(fl.Field().String())
+}
+
+// MoneyValue is a custom type function that lets money.Money fields be validated by their amount in minor units,
+// so that tags such as "required" and "gt=0" apply to the amount.
+func MoneyValue(field reflect.Value) interface{} {
+	if amount, ok := field.Interface().(money.Money); ok {
+		return amount.Amount
+	}
+
+	return nil
 }
 
 // TranslateValidationErrors translates validation errors into a slice of readable error messages.
@@ -29,23 +126,39 @@ func TranslateValidationErrors(err error) []string {
 }
 
 // getValidationErrorMessage returns a human-readable error message based on the validation tag of the field error.
-// It handles different validation tags such as "required", "alpha", "credit_card", "expirydate", "gt", "len", and "numeric".
+// It handles different validation tags such as "required", "alpha", "credit_card", "cardnumber", "cvv", "expirydate", "unexpired", "expirylimit", "currency", "gt", "len", "numeric", "oneof", "min", "max" and "email".
 func getValidationErrorMessage(err validator.FieldError) string {
 	switch err.Tag() {
 	case "required":
 		return "is required"
 	case "alpha":
 		return "must only contain alphabetic characters"
-	case "credit_card":
+	case "credit_card", "cardnumber":
 		return "must be a valid credit card number"
+	case "cvv":
+		return "must be 3 digits, or 4 digits for American Express cards"
 	case "expirydate":
-		return "must be in MM/YY format"
+		return "must be in MM/YY or MM/YYYY format"
+	case "unexpired":
+		return "is in the past, so the card has expired"
+	case "expirylimit":
+		return "is too far in the future"
+	case "currency":
+		return "must be a valid ISO 4217 currency code"
 	case "gt":
 		return fmt.Sprintf("must be greater than %s", err.Param())
 	case "len":
 		return fmt.Sprintf("must be exactly %s characters", err.Param())
 	case "numeric":
 		return "must be numeric"
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", strings.ReplaceAll(err.Param(), " ", ", "))
+	case "min":
+		return fmt.Sprintf("must be at least %s", err.Param())
+	case "max":
+		return fmt.Sprintf("must be at most %s", err.Param())
+	case "email":
+		return "must be a valid email address"
 	default:
 		return "is invalid"
 	}
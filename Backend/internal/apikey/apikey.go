@@ -0,0 +1,104 @@
+// Package apikey generates and parses the API keys merchants authenticate with. Keys are only shown to merchants
+// when they are created; the gateway stores their hashes.
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// ErrMalformedKey is returned when a string is not an API key.
+var ErrMalformedKey = errors.New("malformed API key")
+
+// Kind is the kind of an API key, which determines what it can be used for.
+type Kind string
+
+const (
+	// Publishable keys can be embedded in web pages and apps. They can only tokenize cards and look up BINs.
+	Publishable Kind = "publishable"
+	// Secret keys can use the whole API, and must never leave the merchant's servers.
+	Secret Kind = "secret"
+)
+
+// Mode is the environment an API key belongs to.
+type Mode string
+
+const (
+	Live Mode = "live" // Live keys make real payments
+	Test Mode = "test" // Test keys are for integrating with the gateway
+)
+
+// secretSize is the number of random bytes in a key.
+const secretSize = 24
+
+// prefixes maps the kinds of key to the prefix of their keys.
+var prefixes = map[Kind]string{
+	Publishable: "pk",
+	Secret:      "sk",
+}
+
+// Generate returns a new key of the given kind and mode, e.g. "sk_test_" followed by 48 hexadecimal digits.
+func Generate(kind Kind, mode Mode) (string, error) {
+	prefix, ok := prefixes[kind]
+	if !ok || (mode != Live && mode != Test) {
+		return "", errors.New("unknown API key kind or mode")
+	}
+
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return prefix + "_" + string(mode) + "_" + hex.EncodeToString(secret), nil
+}
+
+// Parse returns the kind and mode of a key. It returns ErrMalformedKey if key was not returned by Generate.
+func Parse(key string) (Kind, Mode, error) {
+	parts := strings.Split(key, "_")
+	if len(parts) != 3 || len(parts[2]) != 2*secretSize || strings.Trim(parts[2], "0123456789abcdef") != "" {
+		return "", "", ErrMalformedKey
+	}
+
+	var kind Kind
+	for k, prefix := range prefixes {
+		if parts[0] == prefix {
+			kind = k
+		}
+	}
+
+	mode := Mode(parts[1])
+	if kind == "" || (mode != Live && mode != Test) {
+		return "", "", ErrMalformedKey
+	}
+
+	return kind, mode, nil
+}
+
+// Hash returns the hash a key is stored and looked up by. Keys are long and random, so a fast hash cannot be
+// reversed by guessing.
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Last4 returns the last four characters of a key, which identify it to merchants.
+func Last4(key string) string {
+	if len(key) < 4 {
+		return key
+	}
+
+	return key[len(key)-4:]
+}
+
+// NewID returns a new ID for an API key, which can be shown without revealing the key.
+func NewID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	return "KEY-" + hex.EncodeToString(id), nil
+}
@@ -0,0 +1,75 @@
+package apikey
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		kind   Kind
+		mode   Mode
+		prefix string
+	}{
+		{Publishable, Live, "pk_live_"},
+		{Publishable, Test, "pk_test_"},
+		{Secret, Live, "sk_live_"},
+		{Secret, Test, "sk_test_"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			key, err := Generate(tt.kind, tt.mode)
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(key, tt.prefix))
+			assert.Len(t, key, len(tt.prefix)+48)
+
+			kind, mode, err := Parse(key)
+			require.NoError(t, err)
+			assert.Equal(t, tt.kind, kind)
+			assert.Equal(t, tt.mode, mode)
+
+			other, err := Generate(tt.kind, tt.mode)
+			require.NoError(t, err)
+			assert.NotEqual(t, key, other)
+		})
+	}
+
+	_, err := Generate("restricted", Live)
+	assert.Error(t, err)
+}
+
+func TestParse(t *testing.T) {
+	secret := strings.Repeat("a1", 24)
+
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"Empty", ""},
+		{"Unknown Prefix", "rk_live_" + secret},
+		{"Unknown Mode", "sk_prod_" + secret},
+		{"Short Secret", "sk_live_" + secret[:46]},
+		{"Uppercase Secret", "sk_live_" + strings.ToUpper(secret)},
+		{"Extra Part", "sk_live_" + secret + "_x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Parse(tt.key)
+			assert.ErrorIs(t, err, ErrMalformedKey)
+		})
+	}
+}
+
+func TestHash(t *testing.T) {
+	key := "sk_test_" + strings.Repeat("a1", 24)
+
+	assert.Equal(t, Hash(key), Hash(key))
+	assert.NotEqual(t, Hash(key), Hash("pk_test_"+strings.Repeat("a1", 24)))
+	assert.NotContains(t, Hash(key), "a1a1")
+	assert.Equal(t, "a1a1", Last4(key))
+}
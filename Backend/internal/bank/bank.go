@@ -0,0 +1,94 @@
+// Package bank defines how the payment gateway talks to the acquiring bank that authorizes and settles card payments.
+package bank
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/money"
+)
+
+// Response codes returned by the acquiring bank.
+const (
+	CodeApproved          = 10000 // Approved
+	CodeDoNotHonour       = 20005 // Declined - Do not honour
+	CodeStolenCard        = 20043 // Stolen card
+	CodeExpiredCard       = 20054 // Expired card
+	CodeTimeout           = 20068 // Response received too late
+	CodeSystemMalfunction = 20096 // System malfunction
+	CodeInsufficientFunds = 50280 // Insufficient funds
+)
+
+var (
+	// ErrTimeout is returned when the bank did not answer in time. The outcome of the request is unknown.
+	ErrTimeout = &Error{StatusCode: CodeTimeout, Summary: "Response received too late"}
+	// ErrSystemMalfunction is returned when the bank failed to process the request.
+	ErrSystemMalfunction = &Error{StatusCode: CodeSystemMalfunction, Summary: "System malfunction"}
+	// ErrRejected is wrapped by the errors of requests the bank refused without processing them. Unlike a
+	// timeout or a malfunction, it means the request definitely did not go through.
+	ErrRejected = errors.New("bank rejected request")
+)
+
+// Error is returned when the bank could not be reached or did not return a usable answer.
+type Error struct {
+	StatusCode int    `json:"statusCode"` // The response code describing the failure
+	Summary    string `json:"summary"`    // A human-readable description of the failure
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("bank: %s (%d)", e.Summary, e.StatusCode)
+}
+
+// Card holds the card details forwarded to the acquiring bank.
+type Card struct {
+	Number     string `json:"number"`     // The full card number (PAN)
+	ExpiryDate string `json:"expiryDate"` // The card expiry date in MM/YY format
+	CVV        string `json:"cvv"`        // The card verification value
+	HolderName string `json:"holderName"` // The cardholder's full name
+}
+
+// AuthorizationRequest asks the bank to reserve funds on a card.
+type AuthorizationRequest struct {
+	Reference string      `json:"reference"` // The gateway's payment ID, used to correlate bank calls with payments
+	Card      Card        `json:"card"`      // The card to authorize
+	Amount    money.Money `json:"amount"`    // The amount to authorize
+}
+
+// CaptureRequest asks the bank to settle some or all of a previously authorized amount.
+type CaptureRequest struct {
+	Reference     string      `json:"reference"`     // The gateway's payment ID
+	BankReference string      `json:"bankReference"` // The bank's reference returned when the payment was authorized
+	Amount        money.Money `json:"amount"`        // The amount to capture
+}
+
+// VoidRequest asks the bank to release an authorization that has not been captured.
+type VoidRequest struct {
+	Reference     string `json:"reference"`     // The gateway's payment ID
+	BankReference string `json:"bankReference"` // The bank's reference returned when the payment was authorized
+}
+
+// RefundRequest asks the bank to return some or all of a captured amount to the cardholder.
+type RefundRequest struct {
+	Reference     string      `json:"reference"`     // The gateway's refund ID, so that each refund of a payment is processed once
+	BankReference string      `json:"bankReference"` // The bank's reference returned when the payment was authorized
+	Amount        money.Money `json:"amount"`        // The amount to refund
+}
+
+// Response is the bank's answer to any request.
+type Response struct {
+	Approved      bool   `json:"approved"`      // Whether the bank accepted the request
+	StatusCode    int    `json:"statusCode"`    // The bank's response code, e.g. 10000 for approved
+	Summary       string `json:"summary"`       // A human-readable description of the response code
+	BankReference string `json:"bankReference"` // The bank's reference for the transaction
+}
+
+// AcquiringBank is implemented by every client capable of processing card payments with an acquiring bank.
+// A declined request is reported through Response.Approved; a non-nil error, usually an *Error, means
+// the bank could not be reached or did not return a usable answer.
+type AcquiringBank interface {
+	Authorize(ctx context.Context, req AuthorizationRequest) (Response, error)
+	Capture(ctx context.Context, req CaptureRequest) (Response, error)
+	Void(ctx context.Context, req VoidRequest) (Response, error)
+	Refund(ctx context.Context, req RefundRequest) (Response, error)
+}
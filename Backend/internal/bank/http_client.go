@@ -0,0 +1,125 @@
+package bank
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTPClientConfig configures an HTTPClient.
+type HTTPClientConfig struct {
+	BaseURL      string        // The bank's base URL, e.g. "http://bank-simulator:8081"
+	Timeout      time.Duration // How long to wait for each attempt before giving up on it
+	MaxRetries   int           // How many times to retry a request that timed out or failed with a 5xx status
+	RetryBackoff time.Duration // Delay before the first retry, doubled for each subsequent retry
+}
+
+// HTTPClient is an AcquiringBank that talks to a bank over its JSON HTTP API, such as the one served by
+// cmd/bank-simulator. Every request carries the gateway's payment reference, which the bank uses to
+// recognise retries, so requests that timed out or failed with a server error are safe to retry.
+type HTTPClient struct {
+	config HTTPClientConfig
+	client *http.Client
+}
+
+// NewHTTPClient returns an HTTPClient for the bank at config.BaseURL.
+func NewHTTPClient(config HTTPClientConfig) *HTTPClient {
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+
+	return &HTTPClient{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+	}
+}
+
+// Authorize sends the authorization to the bank's /authorizations endpoint.
+func (c *HTTPClient) Authorize(ctx context.Context, req AuthorizationRequest) (Response, error) {
+	return c.post(ctx, "/authorizations", req)
+}
+
+// Capture sends the capture to the bank's /captures endpoint.
+func (c *HTTPClient) Capture(ctx context.Context, req CaptureRequest) (Response, error) {
+	return c.post(ctx, "/captures", req)
+}
+
+// Void sends the void to the bank's /voids endpoint.
+func (c *HTTPClient) Void(ctx context.Context, req VoidRequest) (Response, error) {
+	return c.post(ctx, "/voids", req)
+}
+
+// Refund sends the refund to the bank's /refunds endpoint.
+func (c *HTTPClient) Refund(ctx context.Context, req RefundRequest) (Response, error) {
+	return c.post(ctx, "/refunds", req)
+}
+
+// post sends body to the given path, retrying timeouts and server errors with exponential backoff.
+func (c *HTTPClient) post(ctx context.Context, path string, body any) (Response, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return Response{}, err
+	}
+
+	backoff := c.config.RetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		response, retryable, err := c.attempt(ctx, path, payload)
+		if err == nil || !retryable || attempt >= c.config.MaxRetries {
+			return response, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return Response{}, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// attempt sends a single request. It reports whether a failed request may be retried.
+func (c *HTTPClient) attempt(ctx context.Context, path string, payload []byte) (Response, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.BaseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return Response{}, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			return Response{}, true, ErrTimeout
+		}
+		return Response{}, true, fmt.Errorf("%w: %v", ErrSystemMalfunction, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		var response Response
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			return Response{}, false, fmt.Errorf("%w: invalid response body: %v", ErrSystemMalfunction, err)
+		}
+		return response, false, nil
+	}
+
+	// Error responses carry a response code and summary where the bank was able to provide one
+	bankErr := &Error{}
+	if err := json.NewDecoder(resp.Body).Decode(bankErr); err != nil || bankErr.StatusCode == 0 {
+		bankErr = ErrSystemMalfunction
+		if resp.StatusCode == http.StatusGatewayTimeout {
+			bankErr = ErrTimeout
+		}
+	}
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return Response{}, true, bankErr
+	}
+
+	return Response{}, false, fmt.Errorf("%w with status %d: %w", ErrRejected, resp.StatusCode, bankErr)
+}
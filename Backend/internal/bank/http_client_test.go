@@ -0,0 +1,64 @@
+package bank
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/money"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPClientRetries(t *testing.T) {
+	tests := []struct {
+		name             string
+		statuses         []int
+		maxRetries       int
+		expectedAttempts int
+		expectedErr      error
+	}{
+		{name: "Succeeds First Time", statuses: []int{200}, maxRetries: 2, expectedAttempts: 1},
+		{name: "Succeeds After Server Errors", statuses: []int{503, 502, 200}, maxRetries: 2, expectedAttempts: 3},
+		{name: "Gives Up After Max Retries", statuses: []int{503, 503, 503}, maxRetries: 1, expectedAttempts: 2, expectedErr: ErrSystemMalfunction},
+		{name: "Reports Bank Timeout", statuses: []int{504}, maxRetries: 0, expectedAttempts: 1, expectedErr: ErrTimeout},
+		{name: "Does Not Retry Client Errors", statuses: []int{400, 200}, maxRetries: 2, expectedAttempts: 1, expectedErr: ErrSystemMalfunction},
+		{name: "Reports Client Errors As Rejected", statuses: []int{422}, maxRetries: 2, expectedAttempts: 1, expectedErr: ErrRejected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tt.statuses[attempts]
+				attempts++
+
+				w.WriteHeader(status)
+				if status == http.StatusOK {
+					json.NewEncoder(w).Encode(Response{Approved: true, StatusCode: CodeApproved, BankReference: "BNK-1"})
+				}
+			}))
+			defer server.Close()
+
+			client := NewHTTPClient(HTTPClientConfig{
+				BaseURL:      server.URL,
+				Timeout:      time.Second,
+				MaxRetries:   tt.maxRetries,
+				RetryBackoff: time.Millisecond,
+			})
+
+			response, err := client.Capture(context.Background(), CaptureRequest{Reference: "PAY-1", BankReference: "BNK-1", Amount: money.New(1000, "GBP")})
+			assert.Equal(t, tt.expectedAttempts, attempts)
+
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.True(t, response.Approved)
+		})
+	}
+}
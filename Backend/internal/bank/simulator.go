@@ -0,0 +1,142 @@
+package bank
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/money"
+)
+
+// SimulatorMode selects how the Simulator decides the outcome of an authorization.
+type SimulatorMode string
+
+const (
+	// ModeRandom approves or declines authorizations at random.
+	ModeRandom SimulatorMode = "random"
+	// ModeDeterministic decides every outcome from the card number and amount, so that each
+	// response can be reproduced on demand. See Outcome for the rules.
+	ModeDeterministic SimulatorMode = "deterministic"
+)
+
+// Simulator is an AcquiringBank that needs no network access. Captures, voids and refunds are
+// always approved; the outcome of an authorization depends on the simulator's mode.
+type Simulator struct {
+	mode SimulatorMode
+}
+
+// NewSimulator returns a new Simulator running in the given mode.
+func NewSimulator(mode SimulatorMode) *Simulator {
+	return &Simulator{mode: mode}
+}
+
+// testCards maps the magic test card numbers understood by the deterministic simulator to their outcome.
+var testCards = map[string]Outcome{
+	"4242424242424242": OutcomeApproved,
+	"5555555555554444": OutcomeApproved,
+	"4000000000009995": OutcomeInsufficientFunds,
+	"4000000000000002": OutcomeDoNotHonour,
+	"4000000000009979": OutcomeStolenCard,
+	"4000000000000069": OutcomeExpiredCard,
+	"4000000000000119": OutcomeTimeout,
+	"4000000000000127": OutcomeSystemMalfunction,
+}
+
+// testAmountSuffixes maps the last two digits of an amount in minor units (e.g. the 51 in 100.51)
+// to their outcome. The suffixes follow the ISO 8583 response codes for the same outcome.
+var testAmountSuffixes = map[int]Outcome{
+	5:  OutcomeDoNotHonour,
+	43: OutcomeStolenCard,
+	51: OutcomeInsufficientFunds,
+	54: OutcomeExpiredCard,
+	68: OutcomeTimeout,
+	96: OutcomeSystemMalfunction,
+}
+
+// Outcome is a possible result of an authorization.
+type Outcome int
+
+// Outcomes produced by the simulator.
+const (
+	OutcomeApproved Outcome = iota
+	OutcomeInsufficientFunds
+	OutcomeDoNotHonour
+	OutcomeStolenCard
+	OutcomeExpiredCard
+	OutcomeTimeout
+	OutcomeSystemMalfunction
+)
+
+// DeterministicOutcome returns the outcome the deterministic simulator produces for an authorization.
+// Magic test card numbers always produce their own outcome; any other card is decided by the last two
+// digits of the amount in minor units, and is approved if they match no rule.
+func DeterministicOutcome(cardNumber string, amount money.Money) Outcome {
+	if outcome, ok := testCards[cardNumber]; ok {
+		return outcome
+	}
+
+	suffix := int(amount.Amount % 100)
+	if outcome, ok := testAmountSuffixes[suffix]; ok {
+		return outcome
+	}
+
+	return OutcomeApproved
+}
+
+// Authorize approves or declines the authorization according to the simulator's mode.
+// The timeout and system malfunction outcomes are reported as ErrTimeout and ErrSystemMalfunction.
+func (s *Simulator) Authorize(ctx context.Context, req AuthorizationRequest) (Response, error) {
+	outcome := OutcomeApproved
+	if s.mode == ModeDeterministic {
+		outcome = DeterministicOutcome(req.Card.Number, req.Amount)
+	} else if rand.Intn(2) == 1 {
+		outcome = OutcomeInsufficientFunds
+	}
+
+	return outcome.response(newBankReference())
+}
+
+// Capture approves the capture.
+func (s *Simulator) Capture(ctx context.Context, req CaptureRequest) (Response, error) {
+	return OutcomeApproved.response(req.BankReference)
+}
+
+// Void approves the void.
+func (s *Simulator) Void(ctx context.Context, req VoidRequest) (Response, error) {
+	return OutcomeApproved.response(req.BankReference)
+}
+
+// Refund approves the refund.
+func (s *Simulator) Refund(ctx context.Context, req RefundRequest) (Response, error) {
+	return OutcomeApproved.response(req.BankReference)
+}
+
+// response returns the bank response or error corresponding to the outcome.
+func (o Outcome) response(bankReference string) (Response, error) {
+	switch o {
+	case OutcomeApproved:
+		return Response{Approved: true, StatusCode: CodeApproved, Summary: "Approved", BankReference: bankReference}, nil
+	case OutcomeInsufficientFunds:
+		return declined(CodeInsufficientFunds, "Insufficient funds", bankReference), nil
+	case OutcomeDoNotHonour:
+		return declined(CodeDoNotHonour, "Declined - Do not honour", bankReference), nil
+	case OutcomeStolenCard:
+		return declined(CodeStolenCard, "Stolen card", bankReference), nil
+	case OutcomeExpiredCard:
+		return declined(CodeExpiredCard, "Expired card", bankReference), nil
+	case OutcomeTimeout:
+		return Response{}, ErrTimeout
+	default:
+		return Response{}, ErrSystemMalfunction
+	}
+}
+
+func declined(statusCode int, summary string, bankReference string) Response {
+	return Response{Approved: false, StatusCode: statusCode, Summary: summary, BankReference: bankReference}
+}
+
+// newBankReference returns a unique reference in the format used by the simulated bank.
+func newBankReference() string {
+	return fmt.Sprintf("BNK-%d", time.Now().UnixNano())
+}
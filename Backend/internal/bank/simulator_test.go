@@ -0,0 +1,65 @@
+package bank
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/money"
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeterministicSimulator(t *testing.T) {
+	tests := []struct {
+		name               string
+		cardNumber         string
+		amount             int64
+		expectedApproved   bool
+		expectedStatusCode int
+		expectedErr        error
+	}{
+		{name: "Approved Test Card", cardNumber: "4242424242424242", amount: 10051, expectedApproved: true, expectedStatusCode: CodeApproved},
+		{name: "Insufficient Funds Test Card", cardNumber: "4000000000009995", amount: 10000, expectedStatusCode: CodeInsufficientFunds},
+		{name: "Do Not Honour Test Card", cardNumber: "4000000000000002", amount: 10000, expectedStatusCode: CodeDoNotHonour},
+		{name: "Stolen Test Card", cardNumber: "4000000000009979", amount: 10000, expectedStatusCode: CodeStolenCard},
+		{name: "Expired Test Card", cardNumber: "4000000000000069", amount: 10000, expectedStatusCode: CodeExpiredCard},
+		{name: "Timeout Test Card", cardNumber: "4000000000000119", amount: 10000, expectedErr: ErrTimeout},
+		{name: "System Malfunction Test Card", cardNumber: "4000000000000127", amount: 10000, expectedErr: ErrSystemMalfunction},
+		{name: "Ordinary Amount", cardNumber: "4111111111111111", amount: 10050, expectedApproved: true, expectedStatusCode: CodeApproved},
+		{name: "Do Not Honour Amount", cardNumber: "4111111111111111", amount: 10005, expectedStatusCode: CodeDoNotHonour},
+		{name: "Stolen Card Amount", cardNumber: "4111111111111111", amount: 1243, expectedStatusCode: CodeStolenCard},
+		{name: "Insufficient Funds Amount", cardNumber: "4111111111111111", amount: 51, expectedStatusCode: CodeInsufficientFunds},
+		{name: "Expired Card Amount", cardNumber: "4111111111111111", amount: 754, expectedStatusCode: CodeExpiredCard},
+		{name: "Timeout Amount", cardNumber: "4111111111111111", amount: 168, expectedErr: ErrTimeout},
+		{name: "System Malfunction Amount", cardNumber: "4111111111111111", amount: 196, expectedErr: ErrSystemMalfunction},
+	}
+
+	simulator := NewSimulator(ModeDeterministic)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := simulator.Authorize(context.Background(), AuthorizationRequest{
+				Reference: "PAY-1",
+				Card:      Card{Number: tt.cardNumber},
+				Amount:    money.New(tt.amount, "GBP"),
+			})
+
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedApproved, response.Approved)
+			assert.Equal(t, tt.expectedStatusCode, response.StatusCode)
+			assert.NotEmpty(t, response.BankReference)
+		})
+	}
+}
+
+func TestTestCardsAreValidCardNumbers(t *testing.T) {
+	validate := validator.New()
+	for cardNumber := range testCards {
+		assert.NoError(t, validate.Var(cardNumber, "credit_card"), cardNumber)
+	}
+}
@@ -0,0 +1,90 @@
+package banksim
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/bank"
+	"github.com/Lionel-Wilson/payment-gateway/internal/money"
+)
+
+// Operations understood by the simulated bank.
+const (
+	OperationAuthorize = "authorize"
+	OperationCapture   = "capture"
+	OperationVoid      = "void"
+	OperationRefund    = "refund"
+)
+
+// ScriptedResponse forces the simulated bank to answer matching requests with a fixed response.
+// Empty match fields match any request.
+type ScriptedResponse struct {
+	Operation  string        `json:"operation,omitempty"`  // The operation to match, e.g. "authorize"
+	CardNumber string        `json:"cardNumber,omitempty"` // The card number to match (authorizations only)
+	Amount     *money.Money  `json:"amount,omitempty"`     // The amount to match, in the request's currency if given as a decimal
+	Reference  string        `json:"reference,omitempty"`  // The gateway payment reference to match
+	Delay      Duration      `json:"delay,omitempty"`      // How long to wait before answering, e.g. "2s"
+	HTTPStatus int           `json:"httpStatus,omitempty"` // The HTTP status to answer with. Defaults to 200
+	Response   bank.Response `json:"response"`             // The body sent with a 200 response
+	Error      *bank.Error   `json:"error,omitempty"`      // The body sent with any other status
+}
+
+// matches reports whether the scripted response applies to the given request.
+func (s ScriptedResponse) matches(operation string, req request) bool {
+	return (s.Operation == "" || s.Operation == operation) &&
+		(s.CardNumber == "" || s.CardNumber == req.Card.Number) &&
+		(s.Amount == nil || s.matchesAmount(req.Amount)) &&
+		(s.Reference == "" || s.Reference == req.Reference)
+}
+
+// matchesAmount reports whether the scripted amount equals the requested amount. A decimal amount such as
+// 99.99 is read in the currency of the request.
+func (s ScriptedResponse) matchesAmount(amount money.Money) bool {
+	scripted, err := s.Amount.Resolve(amount.Currency)
+	if err != nil {
+		return false
+	}
+
+	return scripted == amount
+}
+
+// LoadScript reads a JSON array of scripted responses from the file at path.
+func LoadScript(path string) ([]ScriptedResponse, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var script []ScriptedResponse
+	if err := json.Unmarshal(data, &script); err != nil {
+		return nil, fmt.Errorf("parse script %s: %w", path, err)
+	}
+
+	return script, nil
+}
+
+// Duration is a time.Duration encoded in JSON as a string such as "1.5s".
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON formats the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
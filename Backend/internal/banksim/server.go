@@ -0,0 +1,257 @@
+// Package banksim implements an HTTP service that behaves like an acquiring bank, for exercising the
+// gateway's bank client across a real network boundary.
+package banksim
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/bank"
+	"github.com/Lionel-Wilson/payment-gateway/internal/money"
+	"github.com/gin-gonic/gin"
+)
+
+// Config controls how the simulated bank behaves.
+type Config struct {
+	Mode          bank.SimulatorMode // How the outcome of unscripted authorizations is decided
+	Latency       time.Duration      // Delay added before answering every request
+	LatencyJitter time.Duration      // Maximum random delay added on top of Latency
+	ErrorRate     float64            // Fraction of requests, between 0 and 1, answered with 503 Service Unavailable
+	TimeoutDelay  time.Duration      // How long to stall before answering a request whose outcome is a timeout
+	Script        []ScriptedResponse // Fixed responses, checked in order before any other rule
+	MaxAnswers    int                // Most answers remembered for retries. Defaults to DefaultMaxAnswers when zero
+}
+
+// DefaultMaxAnswers is how many answers are remembered for retries when Config.MaxAnswers is not set.
+const DefaultMaxAnswers = 10000
+
+// Server serves the simulated bank's JSON API. Answers are remembered per operation and payment
+// reference, so a retried request receives the same answer as the original. Only the most recently used
+// answers are remembered, so that a long-running simulator does not grow without bound.
+type Server struct {
+	config    Config
+	simulator *bank.Simulator
+	errorLog  *log.Logger
+
+	mu      sync.Mutex
+	answers *list.List               // Previous answers, most recently used first
+	index   map[string]*list.Element // Elements of answers keyed by operation and reference
+	random  *rand.Rand               // Source of latency jitter and injected errors, guarded by mu
+}
+
+// answer is an HTTP status and the body sent with it.
+type answer struct {
+	status int
+	body   any
+}
+
+// rememberedAnswer is an answer kept for replay, with the key it was sent for.
+type rememberedAnswer struct {
+	key    string
+	answer answer
+}
+
+// request holds the fields of every bank request that the simulator inspects.
+type request struct {
+	Reference     string      `json:"reference"`
+	BankReference string      `json:"bankReference"`
+	Card          bank.Card   `json:"card"`
+	Amount        money.Money `json:"amount"`
+}
+
+// NewServer returns a Server configured by config.
+func NewServer(config Config, errorLog *log.Logger) *Server {
+	return &Server{
+		config:    config,
+		simulator: bank.NewSimulator(config.Mode),
+		errorLog:  errorLog,
+		answers:   list.New(),
+		index:     make(map[string]*list.Element),
+		random:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Routes registers the simulated bank's endpoints on the router.
+func (s *Server) Routes(r gin.IRouter) {
+	r.POST("/authorizations", s.handle(OperationAuthorize))
+	r.POST("/captures", s.handle(OperationCapture))
+	r.POST("/voids", s.handle(OperationVoid))
+	r.POST("/refunds", s.handle(OperationRefund))
+}
+
+func (s *Server) handle(operation string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req request
+		if err := c.ShouldBindJSON(&req); err != nil || req.Reference == "" {
+			c.JSON(http.StatusBadRequest, &bank.Error{StatusCode: http.StatusBadRequest, Summary: "Invalid request"})
+			return
+		}
+
+		key := operation + ":" + req.Reference
+
+		if previous, replay := s.recall(key); replay {
+			c.JSON(previous.status, previous.body)
+			return
+		}
+
+		ans := s.answer(c.Request.Context(), operation, req)
+		if c.Request.Context().Err() != nil {
+			// The client gave up waiting, so there is nobody to answer
+			return
+		}
+
+		// Only final answers are remembered, so that retries of failed requests can succeed
+		if ans.status == http.StatusOK {
+			s.remember(key, ans)
+		}
+
+		c.JSON(ans.status, ans.body)
+	}
+}
+
+// recall returns the answer previously sent for key, if it is still remembered.
+func (s *Server) recall(key string) (answer, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.index[key]
+	if !ok {
+		return answer{}, false
+	}
+	s.answers.MoveToFront(element)
+
+	return element.Value.(*rememberedAnswer).answer, true
+}
+
+// remember keeps the answer sent for key, forgetting the least recently used answer once the configured number
+// of answers is remembered.
+func (s *Server) remember(key string, ans answer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.index[key]; ok {
+		element.Value.(*rememberedAnswer).answer = ans
+		s.answers.MoveToFront(element)
+		return
+	}
+	s.index[key] = s.answers.PushFront(&rememberedAnswer{key: key, answer: ans})
+
+	maxAnswers := s.config.MaxAnswers
+	if maxAnswers <= 0 {
+		maxAnswers = DefaultMaxAnswers
+	}
+	for s.answers.Len() > maxAnswers {
+		oldest := s.answers.Back()
+		s.answers.Remove(oldest)
+		delete(s.index, oldest.Value.(*rememberedAnswer).key)
+	}
+}
+
+// answer decides how to answer the request, waiting for any configured delay.
+func (s *Server) answer(ctx context.Context, operation string, req request) answer {
+	for _, scripted := range s.config.Script {
+		if !scripted.matches(operation, req) {
+			continue
+		}
+
+		sleep(ctx, time.Duration(scripted.Delay))
+
+		status := scripted.HTTPStatus
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if status != http.StatusOK {
+			body := scripted.Error
+			if body == nil {
+				body = bank.ErrSystemMalfunction
+			}
+			return answer{status: status, body: body}
+		}
+
+		response := scripted.Response
+		if response.BankReference == "" {
+			response.BankReference = req.BankReference
+		}
+		return answer{status: http.StatusOK, body: response}
+	}
+
+	s.mu.Lock()
+	delay := s.config.Latency
+	if s.config.LatencyJitter > 0 {
+		delay += time.Duration(s.random.Int63n(int64(s.config.LatencyJitter)))
+	}
+	injectError := s.random.Float64() < s.config.ErrorRate
+	s.mu.Unlock()
+
+	sleep(ctx, delay)
+
+	if injectError {
+		return answer{status: http.StatusServiceUnavailable, body: bank.ErrSystemMalfunction}
+	}
+
+	response, err := s.simulate(ctx, operation, req)
+
+	var bankErr *bank.Error
+	switch {
+	case errors.Is(err, bank.ErrTimeout):
+		sleep(ctx, s.config.TimeoutDelay)
+		return answer{status: http.StatusGatewayTimeout, body: bank.ErrTimeout}
+	case errors.As(err, &bankErr):
+		return answer{status: http.StatusInternalServerError, body: bankErr}
+	case err != nil:
+		s.errorLog.Printf("simulate %s %s: %v", operation, req.Reference, err)
+		return answer{status: http.StatusInternalServerError, body: bank.ErrSystemMalfunction}
+	}
+
+	return answer{status: http.StatusOK, body: response}
+}
+
+// simulate passes the request to the in-process simulator.
+func (s *Server) simulate(ctx context.Context, operation string, req request) (bank.Response, error) {
+	switch operation {
+	case OperationAuthorize:
+		return s.simulator.Authorize(ctx, bank.AuthorizationRequest{
+			Reference: req.Reference,
+			Card:      req.Card,
+			Amount:    req.Amount,
+		})
+	case OperationCapture:
+		return s.simulator.Capture(ctx, bank.CaptureRequest{
+			Reference:     req.Reference,
+			BankReference: req.BankReference,
+			Amount:        req.Amount,
+		})
+	case OperationVoid:
+		return s.simulator.Void(ctx, bank.VoidRequest{
+			Reference:     req.Reference,
+			BankReference: req.BankReference,
+		})
+	default:
+		return s.simulator.Refund(ctx, bank.RefundRequest{
+			Reference:     req.Reference,
+			BankReference: req.BankReference,
+			Amount:        req.Amount,
+		})
+	}
+}
+
+// sleep waits for d, returning early if ctx is cancelled.
+func sleep(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
@@ -0,0 +1,174 @@
+package banksim
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/bank"
+	"github.com/Lionel-Wilson/payment-gateway/internal/money"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestClient starts a simulated bank with the given config and returns a client connected to it.
+func newTestClient(t *testing.T, config Config, clientConfig bank.HTTPClientConfig) *bank.HTTPClient {
+	t.Helper()
+
+	router := gin.New()
+	NewServer(config, log.New(io.Discard, "", 0)).Routes(router)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	clientConfig.BaseURL = server.URL
+	return bank.NewHTTPClient(clientConfig)
+}
+
+func authorization(reference string, cardNumber string, amount int64) bank.AuthorizationRequest {
+	return bank.AuthorizationRequest{
+		Reference: reference,
+		Card:      bank.Card{Number: cardNumber, ExpiryDate: "12/29", CVV: "123", HolderName: "Jane Doe"},
+		Amount:    money.New(amount, "GBP"),
+	}
+}
+
+func TestServer(t *testing.T) {
+	approvedAmount := money.New(1000, "GBP")
+
+	var decimalScript []ScriptedResponse
+	err := json.Unmarshal([]byte(`[{"operation": "authorize", "amount": 10.00, "response": {"statusCode": 20062}}]`), &decimalScript)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name               string
+		config             Config
+		request            bank.AuthorizationRequest
+		expectedApproved   bool
+		expectedStatusCode int
+		expectedErr        error
+	}{
+		{
+			name:               "Approved",
+			config:             Config{Mode: bank.ModeDeterministic},
+			request:            authorization("PAY-1", "4242424242424242", 1000),
+			expectedApproved:   true,
+			expectedStatusCode: bank.CodeApproved,
+		},
+		{
+			name:               "Declined",
+			config:             Config{Mode: bank.ModeDeterministic},
+			request:            authorization("PAY-1", "4000000000009979", 1000),
+			expectedStatusCode: bank.CodeStolenCard,
+		},
+		{
+			name:        "Timeout",
+			config:      Config{Mode: bank.ModeDeterministic, TimeoutDelay: time.Second},
+			request:     authorization("PAY-1", "4000000000000119", 1000),
+			expectedErr: bank.ErrTimeout,
+		},
+		{
+			name:        "Slower Than Client Timeout",
+			config:      Config{Mode: bank.ModeDeterministic, Latency: time.Second},
+			request:     authorization("PAY-1", "4242424242424242", 1000),
+			expectedErr: bank.ErrTimeout,
+		},
+		{
+			name:        "System Malfunction",
+			config:      Config{Mode: bank.ModeDeterministic},
+			request:     authorization("PAY-1", "4000000000000127", 1000),
+			expectedErr: bank.ErrSystemMalfunction,
+		},
+		{
+			name:        "Injected Errors",
+			config:      Config{Mode: bank.ModeDeterministic, ErrorRate: 1},
+			request:     authorization("PAY-1", "4242424242424242", 1000),
+			expectedErr: bank.ErrSystemMalfunction,
+		},
+		{
+			name: "Scripted Response",
+			config: Config{Mode: bank.ModeDeterministic, Script: []ScriptedResponse{
+				{Operation: OperationCapture, Response: bank.Response{Approved: true, StatusCode: bank.CodeApproved}},
+				{Operation: OperationAuthorize, Amount: &approvedAmount, Response: bank.Response{StatusCode: 20062, Summary: "Restricted card"}},
+			}},
+			request:            authorization("PAY-1", "4242424242424242", 1000),
+			expectedStatusCode: 20062,
+		},
+		{
+			name:               "Scripted Decimal Amount",
+			config:             Config{Mode: bank.ModeDeterministic, Script: decimalScript},
+			request:            authorization("PAY-1", "4242424242424242", 1000),
+			expectedStatusCode: 20062,
+		},
+		{
+			name:               "Scripted Decimal Amount In Other Currency",
+			config:             Config{Mode: bank.ModeDeterministic, Script: decimalScript},
+			request:            bank.AuthorizationRequest{Reference: "PAY-1", Card: bank.Card{Number: "4242424242424242"}, Amount: money.New(1000, "JPY")},
+			expectedApproved:   true,
+			expectedStatusCode: bank.CodeApproved,
+		},
+		{
+			name: "Scripted Error",
+			config: Config{Mode: bank.ModeDeterministic, Script: []ScriptedResponse{
+				{CardNumber: "4242424242424242", HTTPStatus: 502, Error: &bank.Error{StatusCode: 20091, Summary: "Issuer unavailable"}},
+			}},
+			request:     authorization("PAY-1", "4242424242424242", 1000),
+			expectedErr: &bank.Error{StatusCode: 20091, Summary: "Issuer unavailable"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, tt.config, bank.HTTPClientConfig{Timeout: 100 * time.Millisecond, MaxRetries: 1})
+
+			response, err := client.Authorize(context.Background(), tt.request)
+			if tt.expectedErr != nil {
+				assert.Equal(t, tt.expectedErr, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedApproved, response.Approved)
+			assert.Equal(t, tt.expectedStatusCode, response.StatusCode)
+		})
+	}
+}
+
+func TestServerReplaysRetriedRequests(t *testing.T) {
+	client := newTestClient(t, Config{Mode: bank.ModeDeterministic}, bank.HTTPClientConfig{Timeout: time.Second})
+
+	first, err := client.Authorize(context.Background(), authorization("PAY-1", "4242424242424242", 1000))
+	assert.NoError(t, err)
+
+	retry, err := client.Authorize(context.Background(), authorization("PAY-1", "4242424242424242", 1000))
+	assert.NoError(t, err)
+	assert.Equal(t, first, retry)
+
+	other, err := client.Authorize(context.Background(), authorization("PAY-2", "4242424242424242", 1000))
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.BankReference, other.BankReference)
+}
+
+func TestServerForgetsLeastRecentlyUsedAnswers(t *testing.T) {
+	client := newTestClient(t, Config{Mode: bank.ModeDeterministic, MaxAnswers: 2}, bank.HTTPClientConfig{Timeout: time.Second})
+
+	authorize := func(reference string) bank.Response {
+		response, err := client.Authorize(context.Background(), authorization(reference, "4242424242424242", 1000))
+		assert.NoError(t, err)
+		return response
+	}
+
+	first := authorize("PAY-1")
+	second := authorize("PAY-2")
+
+	// Retrying PAY-1 makes it the most recently used, so PAY-2 is forgotten when PAY-3 is answered
+	assert.Equal(t, first, authorize("PAY-1"))
+	authorize("PAY-3")
+
+	assert.Equal(t, first, authorize("PAY-1"))
+	assert.NotEqual(t, second.BankReference, authorize("PAY-2").BankReference)
+}
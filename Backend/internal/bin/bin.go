@@ -0,0 +1,177 @@
+// Package bin looks up the issuer of a payment card from its bank identification number (BIN), the leading digits
+// of the card number, using a table of BIN ranges loaded from a local CSV or JSON file.
+package bin
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Funding is the source of the funds behind a card.
+type Funding string
+
+// Funding sources a BIN can have.
+const (
+	Credit  Funding = "credit"
+	Debit   Funding = "debit"
+	Prepaid Funding = "prepaid"
+	Charge  Funding = "charge"
+)
+
+// Record describes the cards issued under one BIN.
+type Record struct {
+	BIN     string  `json:"bin"`     // The leading digits of the card numbers, e.g. "411111"
+	Issuer  string  `json:"issuer"`  // The name of the issuing bank
+	Country string  `json:"country"` // The ISO 3166-1 alpha-2 code of the issuer's country, e.g. "GB"
+	Funding Funding `json:"funding"` // Whether the cards are credit, debit, prepaid or charge cards
+	Product string  `json:"product"` // The card product, e.g. "Visa Classic"
+}
+
+// Database looks up the BIN record of card numbers.
+type Database interface {
+	// Lookup returns the record with the longest BIN that prefixes number. It reports false if no BIN matches.
+	Lookup(number string) (Record, bool)
+}
+
+// MinLength and MaxLength bound the number of digits in a BIN.
+const (
+	MinLength = 6
+	MaxLength = 11
+)
+
+// validate returns an error if the record does not have a BIN of digits, a two-letter country and a known
+// funding source.
+func (r Record) validate() error {
+	if len(r.BIN) < MinLength || len(r.BIN) > MaxLength || !isDigits(r.BIN) {
+		return fmt.Errorf("BIN %q must be %d to %d digits", r.BIN, MinLength, MaxLength)
+	}
+
+	if len(r.Country) != 2 || strings.ToUpper(r.Country) != r.Country || !isLetters(r.Country) {
+		return fmt.Errorf("BIN %s: country %q must be a two-letter ISO 3166 code", r.BIN, r.Country)
+	}
+
+	switch r.Funding {
+	case Credit, Debit, Prepaid, Charge:
+	default:
+		return fmt.Errorf("BIN %s: unknown funding %q", r.BIN, r.Funding)
+	}
+
+	return nil
+}
+
+// Load reads the BIN table in the file at path into an index. Files with a .json extension hold an array of
+// records; any other file is read as CSV with a header row naming the bin, issuer, country, funding and product
+// columns, in any order.
+func Load(path string) (*Index, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []Record
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		records, err = readJSON(file)
+	} else {
+		records, err = readCSV(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read BIN table %s: %w", path, err)
+	}
+
+	index, err := NewIndex(records)
+	if err != nil {
+		return nil, fmt.Errorf("BIN table %s: %w", path, err)
+	}
+
+	return index, nil
+}
+
+func readJSON(r io.Reader) ([]Record, error) {
+	var records []Record
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return nil, err
+	}
+
+	for i := range records {
+		records[i].Country = strings.ToUpper(strings.TrimSpace(records[i].Country))
+		records[i].Funding = Funding(strings.ToLower(strings.TrimSpace(string(records[i].Funding))))
+	}
+
+	return records, nil
+}
+
+// csvColumns lists the columns every CSV BIN table must have.
+var csvColumns = []string{"bin", "issuer", "country", "funding", "product"}
+
+func readCSV(r io.Reader) ([]Record, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("missing header row")
+	} else if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range csvColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing %s column", name)
+		}
+	}
+
+	var records []Record
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		field := func(name string) string {
+			return strings.TrimSpace(row[columns[name]])
+		}
+
+		records = append(records, Record{
+			BIN:     field("bin"),
+			Issuer:  field("issuer"),
+			Country: strings.ToUpper(field("country")),
+			Funding: Funding(strings.ToLower(field("funding"))),
+			Product: field("product"),
+		})
+	}
+}
+
+// isDigits reports whether s contains only ASCII digits.
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isLetters reports whether s contains only ASCII letters.
+func isLetters(s string) bool {
+	for _, r := range s {
+		if (r < 'A' || r > 'Z') && (r < 'a' || r > 'z') {
+			return false
+		}
+	}
+
+	return true
+}
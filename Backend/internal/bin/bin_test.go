@@ -0,0 +1,141 @@
+package bin
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCSV = `bin,issuer,country,funding,product
+411111,Test Bank,GB,credit,Visa Classic
+41111111,Test Bank,gb,Debit,Visa Debit
+555555,Other Bank,US,prepaid,Mastercard Prepaid
+`
+
+// writeFile writes content to the file with the given name in dir and returns its path.
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
+
+func TestIndexLookup(t *testing.T) {
+	index, err := Load(writeFile(t, t.TempDir(), "bins.csv", testCSV))
+	require.NoError(t, err)
+	assert.Equal(t, 3, index.Len())
+
+	tests := []struct {
+		number          string
+		expectedOK      bool
+		expectedBIN     string
+		expectedFunding Funding
+		expectedCountry string
+	}{
+		{number: "4111111111111111", expectedOK: true, expectedBIN: "41111111", expectedFunding: Debit, expectedCountry: "GB"},
+		{number: "4111119999999999", expectedOK: true, expectedBIN: "411111", expectedFunding: Credit, expectedCountry: "GB"},
+		{number: "411111", expectedOK: true, expectedBIN: "411111", expectedFunding: Credit, expectedCountry: "GB"},
+		{number: "5555555555554444", expectedOK: true, expectedBIN: "555555", expectedFunding: Prepaid, expectedCountry: "US"},
+		{number: "41111", expectedOK: false},
+		{number: "4000000000000002", expectedOK: false},
+		{number: "", expectedOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.number, func(t *testing.T) {
+			record, ok := index.Lookup(tt.number)
+			assert.Equal(t, tt.expectedOK, ok)
+			assert.Equal(t, tt.expectedBIN, record.BIN)
+			assert.Equal(t, tt.expectedFunding, record.Funding)
+			assert.Equal(t, tt.expectedCountry, record.Country)
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	index, err := Load(writeFile(t, dir, "bins.json",
+		`[{"bin": "378282", "issuer": "Amex Bank", "country": "us", "funding": "charge", "product": "Green"}]`))
+	require.NoError(t, err)
+	record, ok := index.Lookup("378282246310005")
+	assert.True(t, ok)
+	assert.Equal(t, Record{BIN: "378282", Issuer: "Amex Bank", Country: "US", Funding: Charge, Product: "Green"}, record)
+
+	index, err = Load(writeFile(t, dir, "reordered.csv", "country,bin,product,issuer,funding\nFR,497010,Carte Bleue,Banque,debit\n"))
+	require.NoError(t, err)
+	record, ok = index.Lookup("4970101234567890")
+	assert.True(t, ok)
+	assert.Equal(t, "FR", record.Country)
+	assert.Equal(t, "Banque", record.Issuer)
+
+	tests := []struct {
+		name          string
+		file          string
+		content       string
+		expectedError string
+	}{
+		{name: "Missing Column", file: "missing.csv", content: "bin,issuer,country,funding\n", expectedError: "missing product column"},
+		{name: "Empty CSV", file: "empty.csv", content: "", expectedError: "missing header row"},
+		{name: "Short BIN", file: "short.csv", content: "bin,issuer,country,funding,product\n4111,Bank,GB,credit,Visa\n", expectedError: `BIN "4111" must be 6 to 11 digits`},
+		{name: "Invalid Country", file: "country.csv", content: "bin,issuer,country,funding,product\n411111,Bank,GBR,credit,Visa\n", expectedError: `country "GBR"`},
+		{name: "Unknown Funding", file: "funding.csv", content: "bin,issuer,country,funding,product\n411111,Bank,GB,loan,Visa\n", expectedError: `unknown funding "loan"`},
+		{name: "Duplicate BIN", file: "duplicate.csv", content: "bin,issuer,country,funding,product\n411111,Bank,GB,credit,Visa\n411111,Bank,GB,debit,Visa\n", expectedError: "duplicate BIN 411111"},
+		{name: "Invalid JSON", file: "invalid.json", content: `{"bin": "411111"}`, expectedError: "read BIN table"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeFile(t, dir, tt.file, tt.content))
+			assert.ErrorContains(t, err, tt.expectedError)
+		})
+	}
+
+	_, err = Load(filepath.Join(dir, "missing.csv"))
+	assert.Error(t, err)
+}
+
+func TestTableReload(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "bins.csv", testCSV)
+
+	table, err := Open(path)
+	require.NoError(t, err)
+	assert.Equal(t, 3, table.Len())
+
+	reloaded, err := table.Reload()
+	assert.NoError(t, err)
+	assert.False(t, reloaded, "an unchanged file is not reloaded")
+
+	// A file that fails to load leaves the current records in place
+	require.NoError(t, os.WriteFile(path, []byte("bin,issuer\n"), 0o600))
+	reloaded, err = table.Reload()
+	assert.Error(t, err)
+	assert.False(t, reloaded)
+	_, ok := table.Lookup("5555555555554444")
+	assert.True(t, ok)
+	reloaded, err = table.Reload()
+	assert.NoError(t, err, "a broken file is not reloaded until it changes again")
+	assert.False(t, reloaded)
+
+	require.NoError(t, os.WriteFile(path, []byte("bin,issuer,country,funding,product\n400000,New Bank,DE,debit,Visa\n"), 0o600))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go table.Watch(ctx, time.Millisecond, log.New(io.Discard, "", 0), log.New(io.Discard, "", 0))
+
+	assert.Eventually(t, func() bool {
+		_, ok := table.Lookup("4000000000000002")
+		return ok
+	}, time.Second, time.Millisecond)
+	_, ok = table.Lookup("5555555555554444")
+	assert.False(t, ok)
+	assert.Equal(t, 1, table.Len())
+}
@@ -0,0 +1,76 @@
+package bin
+
+import "fmt"
+
+// Index is an immutable prefix tree of BIN records, keyed digit by digit, so that a lookup takes one step per digit
+// of the BIN whatever the size of the table.
+type Index struct {
+	root node
+	size int
+}
+
+type node struct {
+	children [10]*node
+	record   *Record // The record whose BIN ends at this node, if any
+}
+
+// NewIndex builds an index of the given records. It returns an error if a record is invalid or two records have
+// the same BIN.
+func NewIndex(records []Record) (*Index, error) {
+	index := &Index{}
+
+	for _, record := range records {
+		if err := record.validate(); err != nil {
+			return nil, err
+		}
+
+		n := &index.root
+		for _, digit := range record.BIN {
+			child := n.children[digit-'0']
+			if child == nil {
+				child = &node{}
+				n.children[digit-'0'] = child
+			}
+			n = child
+		}
+
+		if n.record != nil {
+			return nil, fmt.Errorf("duplicate BIN %s", record.BIN)
+		}
+		record := record
+		n.record = &record
+		index.size++
+	}
+
+	return index, nil
+}
+
+// Lookup returns the record with the longest BIN that prefixes number. It reports false if no BIN matches.
+func (i *Index) Lookup(number string) (Record, bool) {
+	var found *Record
+
+	n := &i.root
+	for _, digit := range number {
+		if digit < '0' || digit > '9' {
+			break
+		}
+
+		if n = n.children[digit-'0']; n == nil {
+			break
+		}
+		if n.record != nil {
+			found = n.record
+		}
+	}
+
+	if found == nil {
+		return Record{}, false
+	}
+
+	return *found, true
+}
+
+// Len returns the number of records in the index.
+func (i *Index) Len() int {
+	return i.size
+}
@@ -0,0 +1,88 @@
+package bin
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Table is a BIN database loaded from a file, which is reloaded when the file changes. Lookups are served from the
+// last table loaded successfully, so a broken file never replaces a working one.
+type Table struct {
+	path  string
+	index atomic.Pointer[Index]
+
+	mu      sync.Mutex // Serializes reloads
+	modTime time.Time  // The modification time of the file when it was last read
+	size    int64      // The size of the file when it was last read
+}
+
+// Open loads the BIN table in the file at path. See Load for the supported formats.
+func Open(path string) (*Table, error) {
+	t := &Table{path: path}
+	if _, err := t.Reload(); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Lookup returns the record with the longest BIN that prefixes number. It reports false if no BIN matches.
+func (t *Table) Lookup(number string) (Record, bool) {
+	return t.index.Load().Lookup(number)
+}
+
+// Len returns the number of records in the table.
+func (t *Table) Len() int {
+	return t.index.Load().Len()
+}
+
+// Reload loads the file again if its modification time or size has changed since it was last read, and reports
+// whether it did. If the file cannot be loaded, the table keeps its current records until the file changes again,
+// and an error is returned.
+func (t *Table) Reload() (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return false, err
+	}
+
+	if t.index.Load() != nil && info.ModTime().Equal(t.modTime) && info.Size() == t.size {
+		return false, nil
+	}
+
+	t.modTime, t.size = info.ModTime(), info.Size()
+
+	index, err := Load(t.path)
+	if err != nil {
+		return false, err
+	}
+	t.index.Store(index)
+
+	return true, nil
+}
+
+// Watch checks the file for changes every interval, reloading it when it changes, until ctx is cancelled.
+func (t *Table) Watch(ctx context.Context, interval time.Duration, infoLog, errorLog *log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := t.Reload()
+			if err != nil {
+				errorLog.Printf("failed to reload BIN table: %v", err)
+			} else if reloaded {
+				infoLog.Printf("Reloaded %d BINs from %s", t.Len(), t.path)
+			}
+		}
+	}
+}
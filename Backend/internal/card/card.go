@@ -0,0 +1,184 @@
+// Package card detects the scheme (brand) of a payment card from its issuer identification number (IIN), the
+// leading digits of the card number, and checks card numbers and CVVs against the rules of that scheme.
+package card
+
+import (
+	"strconv"
+)
+
+// Brand is a card scheme.
+type Brand string
+
+// Brands the gateway can detect.
+const (
+	Visa       Brand = "visa"
+	Mastercard Brand = "mastercard"
+	Amex       Brand = "amex"
+	Discover   Brand = "discover"
+	JCB        Brand = "jcb"
+	UnionPay   Brand = "unionpay"
+	Maestro    Brand = "maestro"
+	Diners     Brand = "diners"
+)
+
+// iinRange is a range of IINs with the same number of digits, e.g. 2221 to 2720.
+type iinRange struct {
+	low, high int
+	digits    int
+}
+
+// scheme holds the rules for the cards of one brand.
+type scheme struct {
+	brand      Brand
+	ranges     []iinRange
+	panLengths []int // The card number lengths the brand issues
+	cvvLength  int
+}
+
+// schemes lists the IIN ranges and length rules of every detectable brand. Where ranges overlap, the longest
+// matching prefix decides the brand, e.g. 6011 is Discover even though 60 is not.
+var schemes = []scheme{
+	{brand: Visa, ranges: prefixes(1, 4), panLengths: []int{13, 16, 19}, cvvLength: 3},
+	{brand: Mastercard, ranges: []iinRange{{51, 55, 2}, {2221, 2720, 4}}, panLengths: []int{16}, cvvLength: 3},
+	{brand: Amex, ranges: prefixes(2, 34, 37), panLengths: []int{15}, cvvLength: 4},
+	{
+		brand:      Discover,
+		ranges:     []iinRange{{6011, 6011, 4}, {644, 649, 3}, {65, 65, 2}},
+		panLengths: []int{16, 17, 18, 19},
+		cvvLength:  3,
+	},
+	{brand: JCB, ranges: []iinRange{{3528, 3589, 4}}, panLengths: []int{16, 17, 18, 19}, cvvLength: 3},
+	{brand: UnionPay, ranges: []iinRange{{62, 62, 2}, {8100, 8171, 4}}, panLengths: []int{16, 17, 18, 19}, cvvLength: 3},
+	{
+		brand:      Maestro,
+		ranges:     append(prefixes(4, 5018, 5020, 5038, 5893, 6304, 6759, 6761, 6762, 6763), iinRange{56, 58, 2}),
+		panLengths: []int{12, 13, 14, 15, 16, 17, 18, 19},
+		cvvLength:  3,
+	},
+	{
+		brand:      Diners,
+		ranges:     []iinRange{{300, 305, 3}, {3095, 3095, 4}, {36, 36, 2}, {38, 39, 2}},
+		panLengths: []int{14, 15, 16, 17, 18, 19},
+		cvvLength:  3,
+	},
+}
+
+// prefixes returns a single-IIN range for each of the given prefixes, which all have the given number of digits.
+func prefixes(digits int, iins ...int) []iinRange {
+	ranges := make([]iinRange, len(iins))
+	for i, iin := range iins {
+		ranges[i] = iinRange{iin, iin, digits}
+	}
+
+	return ranges
+}
+
+// lookup returns the scheme of a card number, matching the longest IIN prefix.
+func lookup(number string) (scheme, bool) {
+	var found scheme
+	longest := 0
+
+	for _, s := range schemes {
+		for _, r := range s.ranges {
+			if r.digits <= longest || len(number) < r.digits {
+				continue
+			}
+
+			iin, err := strconv.Atoi(number[:r.digits])
+			if err == nil && iin >= r.low && iin <= r.high {
+				found, longest = s, r.digits
+			}
+		}
+	}
+
+	return found, longest > 0
+}
+
+// Detect returns the brand of a card number. It reports false if the number matches no known IIN range.
+func Detect(number string) (Brand, bool) {
+	s, ok := lookup(number)
+	return s.brand, ok
+}
+
+// ValidNumber reports whether number is made of digits, belongs to a known brand, has a length that brand issues
+// and passes the Luhn check.
+func ValidNumber(number string) bool {
+	if !isDigits(number) {
+		return false
+	}
+
+	s, ok := lookup(number)
+	if !ok || !contains(s.panLengths, len(number)) {
+		return false
+	}
+
+	return luhn(number)
+}
+
+// CVVLength returns the number of digits in the CVV of a card, which is 4 for American Express and 3 otherwise.
+func CVVLength(number string) int {
+	if s, ok := lookup(number); ok {
+		return s.cvvLength
+	}
+
+	return 3
+}
+
+// ValidCVV reports whether cvv is made of digits and has the length used by the brand of the card number.
+func ValidCVV(number, cvv string) bool {
+	return isDigits(cvv) && len(cvv) == CVVLength(number)
+}
+
+// Last4 returns the last four digits of a card number.
+func Last4(number string) string {
+	if len(number) < 4 {
+		return number
+	}
+
+	return number[len(number)-4:]
+}
+
+// luhn reports whether a string of digits passes the Luhn checksum.
+func luhn(number string) bool {
+	sum := 0
+	double := false
+
+	for i := len(number) - 1; i >= 0; i-- {
+		digit := int(number[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+
+	return sum%10 == 0
+}
+
+// isDigits reports whether s is non-empty and contains only ASCII digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func contains(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
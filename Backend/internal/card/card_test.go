@@ -0,0 +1,62 @@
+package card
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		number        string
+		expectedBrand Brand
+		expectedValid bool
+	}{
+		{number: "4111111111111111", expectedBrand: Visa, expectedValid: true},
+		{number: "5555555555554444", expectedBrand: Mastercard, expectedValid: true},
+		{number: "2223003122003222", expectedBrand: Mastercard, expectedValid: true},
+		{number: "378282246310005", expectedBrand: Amex, expectedValid: true},
+		{number: "371449635398431", expectedBrand: Amex, expectedValid: true},
+		{number: "6011111111111117", expectedBrand: Discover, expectedValid: true},
+		{number: "6445644564456445", expectedBrand: Discover, expectedValid: true},
+		{number: "6500000000000002", expectedBrand: Discover, expectedValid: true},
+		{number: "3566002020360505", expectedBrand: JCB, expectedValid: true},
+		{number: "6200000000000005", expectedBrand: UnionPay, expectedValid: true},
+		{number: "8100000000000002", expectedBrand: UnionPay, expectedValid: true},
+		{number: "6759649826438453", expectedBrand: Maestro, expectedValid: true},
+		{number: "5038000000000005", expectedBrand: Maestro, expectedValid: true},
+		{number: "5600000000002", expectedBrand: Maestro, expectedValid: true},
+		{number: "3056930009020004", expectedBrand: Diners, expectedValid: true},
+		{number: "36227206271667", expectedBrand: Diners, expectedValid: true},
+		{number: "30950000000000", expectedBrand: Diners, expectedValid: true},
+		{number: "4111111111111112", expectedBrand: Visa},        // Fails the Luhn check
+		{number: "37828224631000", expectedBrand: Amex},          // Amex numbers have 15 digits
+		{number: "55555555555544440", expectedBrand: Mastercard}, // Mastercard numbers have 16 digits
+		{number: "4111-1111-1111-1111", expectedBrand: Visa},     // Not only digits
+		{number: "1234567890123456"},                             // No known brand
+		{number: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.number, func(t *testing.T) {
+			brand, ok := Detect(tt.number)
+			assert.Equal(t, tt.expectedBrand, brand)
+			assert.Equal(t, tt.expectedBrand != "", ok)
+			assert.Equal(t, tt.expectedValid, ValidNumber(tt.number))
+		})
+	}
+}
+
+func TestValidCVV(t *testing.T) {
+	assert.True(t, ValidCVV("4111111111111111", "123"))
+	assert.False(t, ValidCVV("4111111111111111", "1234"))
+	assert.True(t, ValidCVV("378282246310005", "1234"))
+	assert.False(t, ValidCVV("378282246310005", "123"))
+	assert.False(t, ValidCVV("4111111111111111", "12a"))
+	assert.True(t, ValidCVV("1234567890123456", "123"), "unknown brands use 3 digits")
+}
+
+func TestLast4(t *testing.T) {
+	assert.Equal(t, "1111", Last4("4111111111111111"))
+	assert.Equal(t, "123", Last4("123"))
+}
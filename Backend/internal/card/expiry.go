@@ -0,0 +1,67 @@
+package card
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrMalformedExpiry is returned when an expiry date is not a month and year in MM/YY or MM/YYYY format.
+var ErrMalformedExpiry = errors.New("expiry date must be in MM/YY or MM/YYYY format")
+
+// Expiry is the month and year after which a card can no longer be used.
+type Expiry struct {
+	Month int // The month, from 1 to 12
+	Year  int // The year, with four digits
+}
+
+// ParseExpiry parses an expiry date in MM/YY or MM/YYYY format. Two-digit years are in the 2000s.
+func ParseExpiry(s string) (Expiry, error) {
+	month, year, ok := strings.Cut(s, "/")
+	if !ok || len(month) != 2 || (len(year) != 2 && len(year) != 4) || !isDigits(month) || !isDigits(year) {
+		return Expiry{}, ErrMalformedExpiry
+	}
+
+	m, _ := strconv.Atoi(month)
+	y, _ := strconv.Atoi(year)
+
+	return NewExpiry(m, y)
+}
+
+// NewExpiry returns the expiry in the given month and year. The year may have two digits, in the 2000s, or four.
+func NewExpiry(month, year int) (Expiry, error) {
+	if year >= 0 && year < 100 {
+		year += 2000
+	}
+
+	if month < 1 || month > 12 || year < 2000 || year > 9999 {
+		return Expiry{}, ErrMalformedExpiry
+	}
+
+	return Expiry{Month: month, Year: year}, nil
+}
+
+// Expired reports whether a card with this expiry can no longer be used at the given time. Cards can be used until
+// the end of their expiry month, in UTC.
+func (e Expiry) Expired(now time.Time) bool {
+	now = now.UTC()
+	return e.months() < now.Year()*12+int(now.Month())
+}
+
+// BeyondYears reports whether the expiry is more than the given number of years after the given time.
+func (e Expiry) BeyondYears(now time.Time, years int) bool {
+	now = now.UTC()
+	return e.months() > (now.Year()+years)*12+int(now.Month())
+}
+
+// String returns the expiry in MM/YY format.
+func (e Expiry) String() string {
+	return fmt.Sprintf("%02d/%02d", e.Month, e.Year%100)
+}
+
+// months returns the number of months from the start of year 0 to the expiry month.
+func (e Expiry) months() int {
+	return e.Year*12 + e.Month
+}
@@ -0,0 +1,64 @@
+package card
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExpiry(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedExpiry Expiry
+		expectedError  error
+	}{
+		{input: "12/29", expectedExpiry: Expiry{Month: 12, Year: 2029}},
+		{input: "01/2031", expectedExpiry: Expiry{Month: 1, Year: 2031}},
+		{input: "00/29", expectedError: ErrMalformedExpiry},
+		{input: "13/29", expectedError: ErrMalformedExpiry},
+		{input: "1/29", expectedError: ErrMalformedExpiry},
+		{input: "12/029", expectedError: ErrMalformedExpiry},
+		{input: "12-29", expectedError: ErrMalformedExpiry},
+		{input: "ab/cd", expectedError: ErrMalformedExpiry},
+		{input: "12/1999", expectedError: ErrMalformedExpiry},
+		{input: "", expectedError: ErrMalformedExpiry},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			expiry, err := ParseExpiry(tt.input)
+			assert.Equal(t, tt.expectedError, err)
+			assert.Equal(t, tt.expectedExpiry, expiry)
+		})
+	}
+}
+
+func TestNewExpiry(t *testing.T) {
+	expiry, err := NewExpiry(3, 29)
+	assert.NoError(t, err)
+	assert.Equal(t, Expiry{Month: 3, Year: 2029}, expiry)
+	assert.Equal(t, "03/29", expiry.String())
+
+	expiry, err = NewExpiry(11, 2031)
+	assert.NoError(t, err)
+	assert.Equal(t, "11/31", expiry.String())
+
+	_, err = NewExpiry(0, 2029)
+	assert.ErrorIs(t, err, ErrMalformedExpiry)
+	_, err = NewExpiry(1, 123)
+	assert.ErrorIs(t, err, ErrMalformedExpiry)
+}
+
+func TestExpired(t *testing.T) {
+	now := time.Date(2024, 7, 15, 12, 0, 0, 0, time.UTC)
+
+	assert.False(t, Expiry{Month: 7, Year: 2024}.Expired(now), "cards can be used until the end of their expiry month")
+	assert.True(t, Expiry{Month: 6, Year: 2024}.Expired(now))
+	assert.True(t, Expiry{Month: 12, Year: 2019}.Expired(now))
+	assert.False(t, Expiry{Month: 1, Year: 2025}.Expired(now))
+	assert.True(t, Expiry{Month: 7, Year: 2024}.Expired(time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)))
+
+	assert.False(t, Expiry{Month: 7, Year: 2044}.BeyondYears(now, 20))
+	assert.True(t, Expiry{Month: 8, Year: 2044}.BeyondYears(now, 20))
+}
@@ -0,0 +1,155 @@
+// Package certs serves the gateway's TLS certificate, reloading it when its files change, and generates the
+// certificates needed to run the gateway over HTTPS locally.
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errNoCertificates is returned by LoadPool for a file without any certificates.
+var errNoCertificates = errors.New("no PEM-encoded certificates found")
+
+// MerchantURI returns the URI that identifies the merchant with the given ID in the URI subject alternative name of
+// its client certificates, in the SPIFFE format, e.g. spiffe://payment-gateway/merchant/MER-1. The trust domain
+// names the gateway, so that certificates issued for other services by the same authority are not mistaken for
+// merchants' certificates.
+func MerchantURI(trustDomain, merchantID string) *url.URL {
+	return &url.URL{Scheme: "spiffe", Host: trustDomain, Path: "/merchant/" + merchantID}
+}
+
+// Certificate is a certificate and private key loaded from PEM files, which are reloaded when either changes.
+// Handshakes are served with the last key pair loaded successfully, so a half-written or mismatched pair never
+// replaces a working one.
+type Certificate struct {
+	certFile string
+	keyFile  string
+	pair     atomic.Pointer[tls.Certificate]
+
+	mu       sync.Mutex  // Serializes reloads
+	versions [2]fileInfo // The modification times and sizes of the files when they were last read
+}
+
+// fileInfo identifies a version of a file.
+type fileInfo struct {
+	modTime time.Time
+	size    int64
+}
+
+// Open loads the certificate in certFile, followed by any intermediate certificates, and its private key in keyFile.
+func Open(certFile, keyFile string) (*Certificate, error) {
+	c := &Certificate{certFile: certFile, keyFile: keyFile}
+	if _, err := c.Reload(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// GetCertificate returns the current key pair. It is meant for tls.Config.GetCertificate.
+func (c *Certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.pair.Load(), nil
+}
+
+// ServerConfig returns a TLS configuration serving the current key pair. When clientCAs is not nil, clients may
+// present a certificate issued by one of them, which is verified during the handshake; a handshake with an invalid
+// certificate fails, but whether a certificate is required is left to the handlers.
+func (c *Certificate) ServerConfig(clientCAs *x509.CertPool) *tls.Config {
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: c.GetCertificate,
+	}
+	if clientCAs != nil {
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		config.ClientCAs = clientCAs
+	}
+
+	return config
+}
+
+// Leaf returns the current certificate.
+func (c *Certificate) Leaf() *x509.Certificate {
+	return c.pair.Load().Leaf
+}
+
+// Reload loads the files again if the modification time or size of either has changed since they were last read,
+// and reports whether it did. If they cannot be loaded, the current key pair is kept until the files change again,
+// and an error is returned.
+func (c *Certificate) Reload() (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var versions [2]fileInfo
+	for i, path := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return false, err
+		}
+		versions[i] = fileInfo{modTime: info.ModTime(), size: info.Size()}
+	}
+
+	if c.pair.Load() != nil && versions == c.versions {
+		return false, nil
+	}
+
+	c.versions = versions
+
+	pair, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return false, err
+	}
+	if pair.Leaf == nil {
+		if pair.Leaf, err = x509.ParseCertificate(pair.Certificate[0]); err != nil {
+			return false, err
+		}
+	}
+	c.pair.Store(&pair)
+
+	return true, nil
+}
+
+// Watch checks the files for changes every interval, reloading them when either changes, until ctx is cancelled.
+func (c *Certificate) Watch(ctx context.Context, interval time.Duration, infoLog, errorLog *log.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := c.Reload()
+			if err != nil {
+				errorLog.Printf("failed to reload TLS certificate: %v", err)
+			} else if reloaded {
+				leaf := c.Leaf()
+				infoLog.Printf("Reloaded TLS certificate for %s, expiring %s", leaf.Subject.CommonName, leaf.NotAfter.Format(time.RFC3339))
+			}
+		}
+	}
+}
+
+// LoadPool loads the PEM-encoded certificates in the file at path into a pool, such as the certificate authorities
+// trusted to issue client certificates.
+func LoadPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s: %w", path, errNoCertificates)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,186 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testNow = time.Now()
+
+// newTestAuthority generates a certificate authority and writes its certificate to ca.pem in dir.
+func newTestAuthority(t *testing.T, dir string) (KeyPair, string) {
+	t.Helper()
+
+	ca, err := NewAuthority("Test CA", testNow, time.Hour)
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(path, ca.CertificatePEM(), 0o644))
+
+	return ca, path
+}
+
+// touch moves the modification time of the file at path forward, so that a reload notices it has changed even if
+// its size has not.
+func touch(t *testing.T, path string, offset time.Duration) {
+	t.Helper()
+
+	modTime := testNow.Add(offset)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	ca, _ := newTestAuthority(t, dir)
+	certFile, keyFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem")
+
+	first, err := ca.IssueServer([]string{"localhost", "127.0.0.1"}, testNow, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, first.Write(certFile, keyFile))
+	assert.Equal(t, []string{"localhost"}, first.Certificate.DNSNames)
+	assert.Len(t, first.Certificate.IPAddresses, 1)
+
+	certificate, err := Open(certFile, keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, first.Certificate.SerialNumber, certificate.Leaf().SerialNumber)
+
+	reloaded, err := certificate.Reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded, "unchanged files are not reloaded")
+
+	// A certificate written without its key does not match the old key, so the old pair is kept
+	second, err := ca.IssueServer([]string{"localhost"}, testNow, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certFile, second.CertificatePEM(), 0o644))
+	touch(t, certFile, time.Minute)
+
+	_, err = certificate.Reload()
+	assert.Error(t, err)
+	assert.Equal(t, first.Certificate.SerialNumber, certificate.Leaf().SerialNumber)
+
+	// Once the key is written too, the new pair is served
+	key, err := second.PrivateKeyPEM()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(keyFile, key, 0o600))
+	touch(t, keyFile, time.Minute)
+
+	reloaded, err = certificate.Reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+
+	pair, err := certificate.GetCertificate(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, second.Certificate.SerialNumber, pair.Leaf.SerialNumber)
+
+	_, err = Open(filepath.Join(dir, "missing.pem"), keyFile)
+	assert.Error(t, err)
+}
+
+func TestServerConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca, caFile := newTestAuthority(t, dir)
+	certFile, keyFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem")
+
+	server, err := ca.IssueServer([]string{"localhost", "127.0.0.1"}, testNow, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, server.Write(certFile, keyFile))
+
+	certificate, err := Open(certFile, keyFile)
+	require.NoError(t, err)
+	clientCAs, err := LoadPool(caFile)
+	require.NoError(t, err)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", certificate.ServerConfig(clientCAs))
+	require.NoError(t, err)
+
+	// The handler responds with the common name of the client certificate, if one was presented
+	go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.VerifiedChains) == 0 {
+			io.WriteString(w, "none")
+			return
+		}
+		io.WriteString(w, r.TLS.VerifiedChains[0][0].Subject.CommonName)
+	}))
+	t.Cleanup(func() { listener.Close() })
+
+	// clientWith returns a client trusting the CA that presents the given certificates. They are presented even if
+	// the server does not trust their issuer, which the client would otherwise check.
+	clientWith := func(certificates ...KeyPair) *http.Client {
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.Certificate)
+		config := &tls.Config{RootCAs: roots}
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if len(certificates) == 0 {
+				return &tls.Certificate{}, nil
+			}
+			return &tls.Certificate{
+				Certificate: [][]byte{certificates[0].Certificate.Raw},
+				PrivateKey:  certificates[0].PrivateKey,
+			}, nil
+		}
+
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+	}
+
+	merchant, err := ca.IssueClient("MER-1", MerchantURI("payment-gateway", "MER-1"), testNow, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, merchant.Certificate.URIs, 1)
+	assert.Equal(t, "spiffe://payment-gateway/merchant/MER-1", merchant.Certificate.URIs[0].String())
+	otherCA, err := NewAuthority("Other CA", testNow, time.Hour)
+	require.NoError(t, err)
+	untrusted, err := otherCA.IssueClient("MER-1", MerchantURI("payment-gateway", "MER-1"), testNow, time.Hour)
+	require.NoError(t, err)
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	url := "https://localhost:" + port
+
+	tests := []struct {
+		name         string
+		client       *http.Client
+		expectedBody string
+		expectError  bool
+	}{
+		{"Client Certificate", clientWith(merchant), "MER-1", false},
+		{"No Client Certificate", clientWith(), "none", false},
+		{"Untrusted Client Certificate", clientWith(untrusted), "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.client.Get(url)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+			assert.Equal(t, tt.expectedBody, string(body))
+			assert.Equal(t, uint16(tls.VersionTLS13), resp.TLS.Version)
+		})
+	}
+}
+
+func TestLoadPool(t *testing.T) {
+	dir := t.TempDir()
+	_, caFile := newTestAuthority(t, dir)
+
+	_, err := LoadPool(caFile)
+	assert.NoError(t, err)
+
+	empty := filepath.Join(dir, "empty.pem")
+	require.NoError(t, os.WriteFile(empty, []byte("not a certificate"), 0o644))
+	_, err = LoadPool(empty)
+	assert.ErrorIs(t, err, errNoCertificates)
+}
@@ -0,0 +1,131 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"time"
+)
+
+// KeyPair is a generated certificate and its private key. Generated certificates are for running and testing the
+// gateway locally; production certificates should come from a real certificate authority.
+type KeyPair struct {
+	Certificate *x509.Certificate
+	PrivateKey  *ecdsa.PrivateKey
+}
+
+// NewAuthority generates a self-signed certificate authority, valid from now for validFor, which issues server
+// and client certificates.
+func NewAuthority(commonName string, now time.Time, validFor time.Duration) (KeyPair, error) {
+	return generate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: commonName},
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, KeyPair{}, now, validFor)
+}
+
+// IssueServer issues a server certificate for hosts, which may be DNS names or IP addresses.
+func (ca KeyPair) IssueServer(hosts []string, now time.Time, validFor time.Duration) (KeyPair, error) {
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: hosts[0]},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	return generate(template, ca, now, validFor)
+}
+
+// IssueClient issues a client certificate whose subject common name is commonName, such as a merchant ID, and
+// whose URI subject alternative name is uri, such as the merchant's MerchantURI, if it is not nil.
+func (ca KeyPair) IssueClient(commonName string, uri *url.URL, now time.Time, validFor time.Duration) (KeyPair, error) {
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: commonName},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if uri != nil {
+		template.URIs = []*url.URL{uri}
+	}
+
+	return generate(template, ca, now, validFor)
+}
+
+// CertificatePEM returns the PEM encoding of the certificate.
+func (p KeyPair) CertificatePEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: p.Certificate.Raw})
+}
+
+// PrivateKeyPEM returns the PEM encoding of the private key.
+func (p KeyPair) PrivateKeyPEM() ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(p.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// Write writes the PEM-encoded certificate to certFile and private key to keyFile. The key is only readable by the
+// current user.
+func (p KeyPair) Write(certFile, keyFile string) error {
+	key, err := p.PrivateKeyPEM()
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(keyFile, key, 0o600); err != nil {
+		return err
+	}
+
+	return os.WriteFile(certFile, p.CertificatePEM(), 0o644)
+}
+
+// generate creates a key and a certificate for it from template, signed by issuer, or self-signed if issuer is the
+// zero KeyPair.
+func generate(template *x509.Certificate, issuer KeyPair, now time.Time, validFor time.Duration) (KeyPair, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return KeyPair{}, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return KeyPair{}, err
+	}
+
+	template.SerialNumber = serial
+	template.NotBefore = now.Add(-time.Minute)
+	template.NotAfter = now.Add(validFor)
+
+	parent, signer := template, key
+	if issuer.Certificate != nil {
+		parent, signer = issuer.Certificate, issuer.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		return KeyPair{}, err
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return KeyPair{}, err
+	}
+
+	return KeyPair{Certificate: certificate, PrivateKey: key}, nil
+}
@@ -0,0 +1,119 @@
+// Package currency is a registry of the ISO 4217 currencies the payment gateway understands, and of the
+// currencies each merchant accepts.
+package currency
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Currency describes an ISO 4217 currency.
+type Currency struct {
+	Code     string // The alphabetic code, e.g. "GBP"
+	Numeric  string // The three-digit numeric code, e.g. "826"
+	Exponent int    // The number of decimal places of the minor unit, e.g. 2 for GBP and 0 for JPY
+	Symbol   string // The symbol used to display amounts, e.g. "£"
+	Name     string // The currency's name, e.g. "Pound Sterling"
+}
+
+// Lookup returns the currency with the given alphabetic code, in any case.
+func Lookup(code string) (Currency, bool) {
+	currency, ok := registry[strings.ToUpper(code)]
+	return currency, ok
+}
+
+// IsValid reports whether code is the alphabetic code of an ISO 4217 currency, in any case.
+func IsValid(code string) bool {
+	_, ok := Lookup(code)
+	return ok
+}
+
+// All returns every currency in the registry, sorted by code.
+func All() []Currency {
+	currencies := make([]Currency, 0, len(registry))
+	for _, currency := range registry {
+		currencies = append(currencies, currency)
+	}
+
+	sort.Slice(currencies, func(i, j int) bool {
+		return currencies[i].Code < currencies[j].Code
+	})
+
+	return currencies
+}
+
+// AllowList is a list of accepted currency codes. An empty AllowList accepts every currency.
+type AllowList []string
+
+// Allows reports whether the currency with the given code is accepted.
+func (l AllowList) Allows(code string) bool {
+	if len(l) == 0 {
+		return true
+	}
+
+	for _, allowed := range l {
+		if strings.EqualFold(allowed, code) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowLists holds the currencies accepted from each merchant. Merchants without their own list, and requests that
+// do not identify a merchant, use the default list.
+type AllowLists struct {
+	Default   AllowList            `json:"default"`   // Currencies accepted from merchants without their own list
+	Merchants map[string]AllowList `json:"merchants"` // Currencies accepted from each merchant, keyed by merchant ID
+}
+
+// For returns the currencies accepted from the given merchant.
+func (l AllowLists) For(merchantID string) AllowList {
+	if list, ok := l.Merchants[merchantID]; ok && merchantID != "" {
+		return list
+	}
+
+	return l.Default
+}
+
+// LoadAllowLists reads allow-lists from the JSON file at path, e.g.
+//
+//	{"default": ["GBP", "EUR"], "merchants": {"merchant-1": ["USD"]}}
+//
+// It returns an error if any list names a currency that is not in the registry.
+func LoadAllowLists(path string) (AllowLists, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return AllowLists{}, err
+	}
+
+	var lists AllowLists
+	if err := json.Unmarshal(data, &lists); err != nil {
+		return AllowLists{}, fmt.Errorf("parse currency allow-lists %s: %w", path, err)
+	}
+
+	if err := lists.Default.validate(); err != nil {
+		return AllowLists{}, fmt.Errorf("currency allow-lists %s: default: %w", path, err)
+	}
+	for merchantID, list := range lists.Merchants {
+		if err := list.validate(); err != nil {
+			return AllowLists{}, fmt.Errorf("currency allow-lists %s: merchant %s: %w", path, merchantID, err)
+		}
+	}
+
+	return lists, nil
+}
+
+// validate returns an error if the list names a currency that is not in the registry.
+func (l AllowList) validate() error {
+	for _, code := range l {
+		if !IsValid(code) {
+			return fmt.Errorf("unknown currency %q", code)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package currency
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		code             string
+		expectedOK       bool
+		expectedNumeric  string
+		expectedExponent int
+		expectedSymbol   string
+	}{
+		{code: "GBP", expectedOK: true, expectedNumeric: "826", expectedExponent: 2, expectedSymbol: "£"},
+		{code: "gbp", expectedOK: true, expectedNumeric: "826", expectedExponent: 2, expectedSymbol: "£"},
+		{code: "JPY", expectedOK: true, expectedNumeric: "392", expectedExponent: 0, expectedSymbol: "¥"},
+		{code: "KWD", expectedOK: true, expectedNumeric: "414", expectedExponent: 3, expectedSymbol: "KD"},
+		{code: "ALL", expectedOK: true, expectedNumeric: "008", expectedExponent: 2, expectedSymbol: "L"},
+		{code: "ABC"},
+		{code: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			currency, ok := Lookup(tt.code)
+			assert.Equal(t, tt.expectedOK, ok)
+			assert.Equal(t, tt.expectedOK, IsValid(tt.code))
+			assert.Equal(t, tt.expectedNumeric, currency.Numeric)
+			assert.Equal(t, tt.expectedExponent, currency.Exponent)
+			assert.Equal(t, tt.expectedSymbol, currency.Symbol)
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	numerics := make(map[string]string)
+
+	for code, currency := range registry {
+		assert.Equal(t, code, currency.Code)
+		assert.Regexp(t, `^[A-Z]{3}$`, currency.Code)
+		assert.Regexp(t, `^[0-9]{3}$`, currency.Numeric, code)
+		assert.NotEmpty(t, currency.Symbol, code)
+		assert.NotEmpty(t, currency.Name, code)
+
+		if other, exists := numerics[currency.Numeric]; exists {
+			t.Errorf("%s and %s share the numeric code %s", code, other, currency.Numeric)
+		}
+		numerics[currency.Numeric] = code
+	}
+
+	assert.Len(t, All(), len(registry))
+	assert.Equal(t, "AED", All()[0].Code)
+}
+
+func TestAllowLists(t *testing.T) {
+	lists := AllowLists{
+		Default:   AllowList{"GBP", "EUR"},
+		Merchants: map[string]AllowList{"merchant-1": {"USD"}, "merchant-2": {}},
+	}
+
+	assert.True(t, lists.For("").Allows("GBP"))
+	assert.True(t, lists.For("").Allows("eur"))
+	assert.False(t, lists.For("").Allows("USD"))
+	assert.True(t, lists.For("merchant-1").Allows("USD"))
+	assert.False(t, lists.For("merchant-1").Allows("GBP"))
+	assert.True(t, lists.For("merchant-2").Allows("JPY"), "an empty list accepts every currency")
+	assert.False(t, lists.For("merchant-3").Allows("USD"), "merchants without a list use the default")
+	assert.True(t, AllowLists{}.For("merchant-1").Allows("JPY"))
+}
+
+func TestLoadAllowLists(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	lists, err := LoadAllowLists(write("valid.json", `{"default": ["GBP"], "merchants": {"merchant-1": ["usd", "JPY"]}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, AllowList{"GBP"}, lists.Default)
+	assert.True(t, lists.For("merchant-1").Allows("USD"))
+
+	_, err = LoadAllowLists(write("unknown.json", `{"merchants": {"merchant-1": ["ABC"]}}`))
+	assert.ErrorContains(t, err, `unknown currency "ABC"`)
+
+	_, err = LoadAllowLists(write("invalid.json", `{"default": "GBP"}`))
+	assert.Error(t, err)
+
+	_, err = LoadAllowLists(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,164 @@
+package currency
+
+// registry lists the active ISO 4217 currencies, keyed by their alphabetic code. Symbols are the ones most commonly
+// used for display; currencies without a widely used symbol show their code.
+var registry = map[string]Currency{
+	"AED": {Code: "AED", Numeric: "784", Exponent: 2, Symbol: "د.إ", Name: "UAE Dirham"},
+	"AFN": {Code: "AFN", Numeric: "971", Exponent: 2, Symbol: "؋", Name: "Afghani"},
+	"ALL": {Code: "ALL", Numeric: "008", Exponent: 2, Symbol: "L", Name: "Lek"},
+	"AMD": {Code: "AMD", Numeric: "051", Exponent: 2, Symbol: "֏", Name: "Armenian Dram"},
+	"AOA": {Code: "AOA", Numeric: "973", Exponent: 2, Symbol: "Kz", Name: "Kwanza"},
+	"ARS": {Code: "ARS", Numeric: "032", Exponent: 2, Symbol: "$", Name: "Argentine Peso"},
+	"AUD": {Code: "AUD", Numeric: "036", Exponent: 2, Symbol: "A$", Name: "Australian Dollar"},
+	"AWG": {Code: "AWG", Numeric: "533", Exponent: 2, Symbol: "ƒ", Name: "Aruban Florin"},
+	"AZN": {Code: "AZN", Numeric: "944", Exponent: 2, Symbol: "₼", Name: "Azerbaijan Manat"},
+	"BAM": {Code: "BAM", Numeric: "977", Exponent: 2, Symbol: "KM", Name: "Convertible Mark"},
+	"BBD": {Code: "BBD", Numeric: "052", Exponent: 2, Symbol: "Bds$", Name: "Barbados Dollar"},
+	"BDT": {Code: "BDT", Numeric: "050", Exponent: 2, Symbol: "৳", Name: "Taka"},
+	"BGN": {Code: "BGN", Numeric: "975", Exponent: 2, Symbol: "лв", Name: "Bulgarian Lev"},
+	"BHD": {Code: "BHD", Numeric: "048", Exponent: 3, Symbol: "BD", Name: "Bahraini Dinar"},
+	"BIF": {Code: "BIF", Numeric: "108", Exponent: 0, Symbol: "FBu", Name: "Burundi Franc"},
+	"BMD": {Code: "BMD", Numeric: "060", Exponent: 2, Symbol: "$", Name: "Bermudian Dollar"},
+	"BND": {Code: "BND", Numeric: "096", Exponent: 2, Symbol: "B$", Name: "Brunei Dollar"},
+	"BOB": {Code: "BOB", Numeric: "068", Exponent: 2, Symbol: "Bs", Name: "Boliviano"},
+	"BRL": {Code: "BRL", Numeric: "986", Exponent: 2, Symbol: "R$", Name: "Brazilian Real"},
+	"BSD": {Code: "BSD", Numeric: "044", Exponent: 2, Symbol: "B$", Name: "Bahamian Dollar"},
+	"BTN": {Code: "BTN", Numeric: "064", Exponent: 2, Symbol: "Nu.", Name: "Ngultrum"},
+	"BWP": {Code: "BWP", Numeric: "072", Exponent: 2, Symbol: "P", Name: "Pula"},
+	"BYN": {Code: "BYN", Numeric: "933", Exponent: 2, Symbol: "Br", Name: "Belarusian Ruble"},
+	"BZD": {Code: "BZD", Numeric: "084", Exponent: 2, Symbol: "BZ$", Name: "Belize Dollar"},
+	"CAD": {Code: "CAD", Numeric: "124", Exponent: 2, Symbol: "CA$", Name: "Canadian Dollar"},
+	"CDF": {Code: "CDF", Numeric: "976", Exponent: 2, Symbol: "FC", Name: "Congolese Franc"},
+	"CHF": {Code: "CHF", Numeric: "756", Exponent: 2, Symbol: "CHF", Name: "Swiss Franc"},
+	"CLF": {Code: "CLF", Numeric: "990", Exponent: 4, Symbol: "UF", Name: "Unidad de Fomento"},
+	"CLP": {Code: "CLP", Numeric: "152", Exponent: 0, Symbol: "$", Name: "Chilean Peso"},
+	"CNY": {Code: "CNY", Numeric: "156", Exponent: 2, Symbol: "¥", Name: "Yuan Renminbi"},
+	"COP": {Code: "COP", Numeric: "170", Exponent: 2, Symbol: "$", Name: "Colombian Peso"},
+	"CRC": {Code: "CRC", Numeric: "188", Exponent: 2, Symbol: "₡", Name: "Costa Rican Colon"},
+	"CUP": {Code: "CUP", Numeric: "192", Exponent: 2, Symbol: "$", Name: "Cuban Peso"},
+	"CVE": {Code: "CVE", Numeric: "132", Exponent: 2, Symbol: "Esc", Name: "Cabo Verde Escudo"},
+	"CZK": {Code: "CZK", Numeric: "203", Exponent: 2, Symbol: "Kč", Name: "Czech Koruna"},
+	"DJF": {Code: "DJF", Numeric: "262", Exponent: 0, Symbol: "Fdj", Name: "Djibouti Franc"},
+	"DKK": {Code: "DKK", Numeric: "208", Exponent: 2, Symbol: "kr", Name: "Danish Krone"},
+	"DOP": {Code: "DOP", Numeric: "214", Exponent: 2, Symbol: "RD$", Name: "Dominican Peso"},
+	"DZD": {Code: "DZD", Numeric: "012", Exponent: 2, Symbol: "DA", Name: "Algerian Dinar"},
+	"EGP": {Code: "EGP", Numeric: "818", Exponent: 2, Symbol: "E£", Name: "Egyptian Pound"},
+	"ERN": {Code: "ERN", Numeric: "232", Exponent: 2, Symbol: "Nfk", Name: "Nakfa"},
+	"ETB": {Code: "ETB", Numeric: "230", Exponent: 2, Symbol: "Br", Name: "Ethiopian Birr"},
+	"EUR": {Code: "EUR", Numeric: "978", Exponent: 2, Symbol: "€", Name: "Euro"},
+	"FJD": {Code: "FJD", Numeric: "242", Exponent: 2, Symbol: "FJ$", Name: "Fiji Dollar"},
+	"FKP": {Code: "FKP", Numeric: "238", Exponent: 2, Symbol: "£", Name: "Falkland Islands Pound"},
+	"GBP": {Code: "GBP", Numeric: "826", Exponent: 2, Symbol: "£", Name: "Pound Sterling"},
+	"GEL": {Code: "GEL", Numeric: "981", Exponent: 2, Symbol: "₾", Name: "Lari"},
+	"GHS": {Code: "GHS", Numeric: "936", Exponent: 2, Symbol: "GH₵", Name: "Ghana Cedi"},
+	"GIP": {Code: "GIP", Numeric: "292", Exponent: 2, Symbol: "£", Name: "Gibraltar Pound"},
+	"GMD": {Code: "GMD", Numeric: "270", Exponent: 2, Symbol: "D", Name: "Dalasi"},
+	"GNF": {Code: "GNF", Numeric: "324", Exponent: 0, Symbol: "FG", Name: "Guinean Franc"},
+	"GTQ": {Code: "GTQ", Numeric: "320", Exponent: 2, Symbol: "Q", Name: "Quetzal"},
+	"GYD": {Code: "GYD", Numeric: "328", Exponent: 2, Symbol: "G$", Name: "Guyana Dollar"},
+	"HKD": {Code: "HKD", Numeric: "344", Exponent: 2, Symbol: "HK$", Name: "Hong Kong Dollar"},
+	"HNL": {Code: "HNL", Numeric: "340", Exponent: 2, Symbol: "L", Name: "Lempira"},
+	"HTG": {Code: "HTG", Numeric: "332", Exponent: 2, Symbol: "G", Name: "Gourde"},
+	"HUF": {Code: "HUF", Numeric: "348", Exponent: 2, Symbol: "Ft", Name: "Forint"},
+	"IDR": {Code: "IDR", Numeric: "360", Exponent: 2, Symbol: "Rp", Name: "Rupiah"},
+	"ILS": {Code: "ILS", Numeric: "376", Exponent: 2, Symbol: "₪", Name: "New Israeli Sheqel"},
+	"INR": {Code: "INR", Numeric: "356", Exponent: 2, Symbol: "₹", Name: "Indian Rupee"},
+	"IQD": {Code: "IQD", Numeric: "368", Exponent: 3, Symbol: "ID", Name: "Iraqi Dinar"},
+	"IRR": {Code: "IRR", Numeric: "364", Exponent: 2, Symbol: "﷼", Name: "Iranian Rial"},
+	"ISK": {Code: "ISK", Numeric: "352", Exponent: 0, Symbol: "kr", Name: "Iceland Krona"},
+	"JMD": {Code: "JMD", Numeric: "388", Exponent: 2, Symbol: "J$", Name: "Jamaican Dollar"},
+	"JOD": {Code: "JOD", Numeric: "400", Exponent: 3, Symbol: "JD", Name: "Jordanian Dinar"},
+	"JPY": {Code: "JPY", Numeric: "392", Exponent: 0, Symbol: "¥", Name: "Yen"},
+	"KES": {Code: "KES", Numeric: "404", Exponent: 2, Symbol: "KSh", Name: "Kenyan Shilling"},
+	"KGS": {Code: "KGS", Numeric: "417", Exponent: 2, Symbol: "сом", Name: "Som"},
+	"KHR": {Code: "KHR", Numeric: "116", Exponent: 2, Symbol: "៛", Name: "Riel"},
+	"KMF": {Code: "KMF", Numeric: "174", Exponent: 0, Symbol: "CF", Name: "Comorian Franc"},
+	"KPW": {Code: "KPW", Numeric: "408", Exponent: 2, Symbol: "₩", Name: "North Korean Won"},
+	"KRW": {Code: "KRW", Numeric: "410", Exponent: 0, Symbol: "₩", Name: "Won"},
+	"KWD": {Code: "KWD", Numeric: "414", Exponent: 3, Symbol: "KD", Name: "Kuwaiti Dinar"},
+	"KYD": {Code: "KYD", Numeric: "136", Exponent: 2, Symbol: "CI$", Name: "Cayman Islands Dollar"},
+	"KZT": {Code: "KZT", Numeric: "398", Exponent: 2, Symbol: "₸", Name: "Tenge"},
+	"LAK": {Code: "LAK", Numeric: "418", Exponent: 2, Symbol: "₭", Name: "Lao Kip"},
+	"LBP": {Code: "LBP", Numeric: "422", Exponent: 2, Symbol: "L£", Name: "Lebanese Pound"},
+	"LKR": {Code: "LKR", Numeric: "144", Exponent: 2, Symbol: "Rs", Name: "Sri Lanka Rupee"},
+	"LRD": {Code: "LRD", Numeric: "430", Exponent: 2, Symbol: "L$", Name: "Liberian Dollar"},
+	"LSL": {Code: "LSL", Numeric: "426", Exponent: 2, Symbol: "L", Name: "Loti"},
+	"LYD": {Code: "LYD", Numeric: "434", Exponent: 3, Symbol: "LD", Name: "Libyan Dinar"},
+	"MAD": {Code: "MAD", Numeric: "504", Exponent: 2, Symbol: "DH", Name: "Moroccan Dirham"},
+	"MDL": {Code: "MDL", Numeric: "498", Exponent: 2, Symbol: "L", Name: "Moldovan Leu"},
+	"MGA": {Code: "MGA", Numeric: "969", Exponent: 2, Symbol: "Ar", Name: "Malagasy Ariary"},
+	"MKD": {Code: "MKD", Numeric: "807", Exponent: 2, Symbol: "ден", Name: "Denar"},
+	"MMK": {Code: "MMK", Numeric: "104", Exponent: 2, Symbol: "K", Name: "Kyat"},
+	"MNT": {Code: "MNT", Numeric: "496", Exponent: 2, Symbol: "₮", Name: "Tugrik"},
+	"MOP": {Code: "MOP", Numeric: "446", Exponent: 2, Symbol: "MOP$", Name: "Pataca"},
+	"MRU": {Code: "MRU", Numeric: "929", Exponent: 2, Symbol: "UM", Name: "Ouguiya"},
+	"MUR": {Code: "MUR", Numeric: "480", Exponent: 2, Symbol: "Rs", Name: "Mauritius Rupee"},
+	"MVR": {Code: "MVR", Numeric: "462", Exponent: 2, Symbol: "Rf", Name: "Rufiyaa"},
+	"MWK": {Code: "MWK", Numeric: "454", Exponent: 2, Symbol: "MK", Name: "Malawi Kwacha"},
+	"MXN": {Code: "MXN", Numeric: "484", Exponent: 2, Symbol: "MX$", Name: "Mexican Peso"},
+	"MYR": {Code: "MYR", Numeric: "458", Exponent: 2, Symbol: "RM", Name: "Malaysian Ringgit"},
+	"MZN": {Code: "MZN", Numeric: "943", Exponent: 2, Symbol: "MT", Name: "Mozambique Metical"},
+	"NAD": {Code: "NAD", Numeric: "516", Exponent: 2, Symbol: "N$", Name: "Namibia Dollar"},
+	"NGN": {Code: "NGN", Numeric: "566", Exponent: 2, Symbol: "₦", Name: "Naira"},
+	"NIO": {Code: "NIO", Numeric: "558", Exponent: 2, Symbol: "C$", Name: "Cordoba Oro"},
+	"NOK": {Code: "NOK", Numeric: "578", Exponent: 2, Symbol: "kr", Name: "Norwegian Krone"},
+	"NPR": {Code: "NPR", Numeric: "524", Exponent: 2, Symbol: "Rs", Name: "Nepalese Rupee"},
+	"NZD": {Code: "NZD", Numeric: "554", Exponent: 2, Symbol: "NZ$", Name: "New Zealand Dollar"},
+	"OMR": {Code: "OMR", Numeric: "512", Exponent: 3, Symbol: "RO", Name: "Rial Omani"},
+	"PAB": {Code: "PAB", Numeric: "590", Exponent: 2, Symbol: "B/.", Name: "Balboa"},
+	"PEN": {Code: "PEN", Numeric: "604", Exponent: 2, Symbol: "S/", Name: "Sol"},
+	"PGK": {Code: "PGK", Numeric: "598", Exponent: 2, Symbol: "K", Name: "Kina"},
+	"PHP": {Code: "PHP", Numeric: "608", Exponent: 2, Symbol: "₱", Name: "Philippine Peso"},
+	"PKR": {Code: "PKR", Numeric: "586", Exponent: 2, Symbol: "Rs", Name: "Pakistan Rupee"},
+	"PLN": {Code: "PLN", Numeric: "985", Exponent: 2, Symbol: "zł", Name: "Zloty"},
+	"PYG": {Code: "PYG", Numeric: "600", Exponent: 0, Symbol: "₲", Name: "Guarani"},
+	"QAR": {Code: "QAR", Numeric: "634", Exponent: 2, Symbol: "QR", Name: "Qatari Rial"},
+	"RON": {Code: "RON", Numeric: "946", Exponent: 2, Symbol: "lei", Name: "Romanian Leu"},
+	"RSD": {Code: "RSD", Numeric: "941", Exponent: 2, Symbol: "дин", Name: "Serbian Dinar"},
+	"RUB": {Code: "RUB", Numeric: "643", Exponent: 2, Symbol: "₽", Name: "Russian Ruble"},
+	"RWF": {Code: "RWF", Numeric: "646", Exponent: 0, Symbol: "FRw", Name: "Rwanda Franc"},
+	"SAR": {Code: "SAR", Numeric: "682", Exponent: 2, Symbol: "SR", Name: "Saudi Riyal"},
+	"SBD": {Code: "SBD", Numeric: "090", Exponent: 2, Symbol: "SI$", Name: "Solomon Islands Dollar"},
+	"SCR": {Code: "SCR", Numeric: "690", Exponent: 2, Symbol: "SR", Name: "Seychelles Rupee"},
+	"SDG": {Code: "SDG", Numeric: "938", Exponent: 2, Symbol: "LS", Name: "Sudanese Pound"},
+	"SEK": {Code: "SEK", Numeric: "752", Exponent: 2, Symbol: "kr", Name: "Swedish Krona"},
+	"SGD": {Code: "SGD", Numeric: "702", Exponent: 2, Symbol: "S$", Name: "Singapore Dollar"},
+	"SHP": {Code: "SHP", Numeric: "654", Exponent: 2, Symbol: "£", Name: "Saint Helena Pound"},
+	"SLE": {Code: "SLE", Numeric: "925", Exponent: 2, Symbol: "Le", Name: "Leone"},
+	"SOS": {Code: "SOS", Numeric: "706", Exponent: 2, Symbol: "Sh", Name: "Somali Shilling"},
+	"SRD": {Code: "SRD", Numeric: "968", Exponent: 2, Symbol: "$", Name: "Surinam Dollar"},
+	"SSP": {Code: "SSP", Numeric: "728", Exponent: 2, Symbol: "SS£", Name: "South Sudanese Pound"},
+	"STN": {Code: "STN", Numeric: "930", Exponent: 2, Symbol: "Db", Name: "Dobra"},
+	"SVC": {Code: "SVC", Numeric: "222", Exponent: 2, Symbol: "₡", Name: "El Salvador Colon"},
+	"SYP": {Code: "SYP", Numeric: "760", Exponent: 2, Symbol: "S£", Name: "Syrian Pound"},
+	"SZL": {Code: "SZL", Numeric: "748", Exponent: 2, Symbol: "E", Name: "Lilangeni"},
+	"THB": {Code: "THB", Numeric: "764", Exponent: 2, Symbol: "฿", Name: "Baht"},
+	"TJS": {Code: "TJS", Numeric: "972", Exponent: 2, Symbol: "SM", Name: "Somoni"},
+	"TMT": {Code: "TMT", Numeric: "934", Exponent: 2, Symbol: "m", Name: "Turkmenistan New Manat"},
+	"TND": {Code: "TND", Numeric: "788", Exponent: 3, Symbol: "DT", Name: "Tunisian Dinar"},
+	"TOP": {Code: "TOP", Numeric: "776", Exponent: 2, Symbol: "T$", Name: "Pa'anga"},
+	"TRY": {Code: "TRY", Numeric: "949", Exponent: 2, Symbol: "₺", Name: "Turkish Lira"},
+	"TTD": {Code: "TTD", Numeric: "780", Exponent: 2, Symbol: "TT$", Name: "Trinidad and Tobago Dollar"},
+	"TWD": {Code: "TWD", Numeric: "901", Exponent: 2, Symbol: "NT$", Name: "New Taiwan Dollar"},
+	"TZS": {Code: "TZS", Numeric: "834", Exponent: 2, Symbol: "TSh", Name: "Tanzanian Shilling"},
+	"UAH": {Code: "UAH", Numeric: "980", Exponent: 2, Symbol: "₴", Name: "Hryvnia"},
+	"UGX": {Code: "UGX", Numeric: "800", Exponent: 0, Symbol: "USh", Name: "Uganda Shilling"},
+	"USD": {Code: "USD", Numeric: "840", Exponent: 2, Symbol: "$", Name: "US Dollar"},
+	"UYI": {Code: "UYI", Numeric: "940", Exponent: 0, Symbol: "UYI", Name: "Uruguay Peso en Unidades Indexadas"},
+	"UYU": {Code: "UYU", Numeric: "858", Exponent: 2, Symbol: "$U", Name: "Peso Uruguayo"},
+	"UYW": {Code: "UYW", Numeric: "927", Exponent: 4, Symbol: "UYW", Name: "Unidad Previsional"},
+	"UZS": {Code: "UZS", Numeric: "860", Exponent: 2, Symbol: "soʻm", Name: "Uzbekistan Sum"},
+	"VES": {Code: "VES", Numeric: "928", Exponent: 2, Symbol: "Bs.S", Name: "Bolívar Soberano"},
+	"VND": {Code: "VND", Numeric: "704", Exponent: 0, Symbol: "₫", Name: "Dong"},
+	"VUV": {Code: "VUV", Numeric: "548", Exponent: 0, Symbol: "VT", Name: "Vatu"},
+	"WST": {Code: "WST", Numeric: "882", Exponent: 2, Symbol: "WS$", Name: "Tala"},
+	"XAF": {Code: "XAF", Numeric: "950", Exponent: 0, Symbol: "FCFA", Name: "CFA Franc BEAC"},
+	"XCD": {Code: "XCD", Numeric: "951", Exponent: 2, Symbol: "EC$", Name: "East Caribbean Dollar"},
+	"XCG": {Code: "XCG", Numeric: "532", Exponent: 2, Symbol: "Cg", Name: "Caribbean Guilder"},
+	"XOF": {Code: "XOF", Numeric: "952", Exponent: 0, Symbol: "CFA", Name: "CFA Franc BCEAO"},
+	"XPF": {Code: "XPF", Numeric: "953", Exponent: 0, Symbol: "₣", Name: "CFP Franc"},
+	"YER": {Code: "YER", Numeric: "886", Exponent: 2, Symbol: "﷼", Name: "Yemeni Rial"},
+	"ZAR": {Code: "ZAR", Numeric: "710", Exponent: 2, Symbol: "R", Name: "Rand"},
+	"ZMW": {Code: "ZMW", Numeric: "967", Exponent: 2, Symbol: "ZK", Name: "Zambian Kwacha"},
+	"ZWG": {Code: "ZWG", Numeric: "924", Exponent: 2, Symbol: "ZiG", Name: "Zimbabwe Gold"},
+}
@@ -0,0 +1,228 @@
+// Package envelope implements envelope encryption. Every record is encrypted with its own data encryption key (DEK),
+// which is stored alongside it wrapped (encrypted) by a master key from a keyring. Master keys are rotated by
+// rewrapping the DEKs with a new master key, without decrypting the records themselves.
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// KeySize is the size in bytes of master keys and DEKs, which are AES-256 keys.
+const KeySize = 32
+
+var (
+	// ErrUnknownKey is returned when a record was wrapped by a master key that is not in the keyring.
+	ErrUnknownKey = errors.New("envelope: unknown master key")
+	// ErrDecrypt is returned when a record cannot be decrypted because it is corrupt, has been tampered with, or was
+	// encrypted with different associated data.
+	ErrDecrypt = errors.New("envelope: record cannot be decrypted")
+)
+
+// nonceSize is the size of the AES-GCM nonces that precede every ciphertext.
+const nonceSize = 12
+
+// wrappedKeySize is the size of a wrapped DEK: a nonce, the encrypted key and the GCM tag.
+const wrappedKeySize = nonceSize + KeySize + 16
+
+// Keyring holds the master keys used to wrap DEKs, by ID. New records are wrapped by the primary key; records
+// wrapped by any key in the keyring can be decrypted.
+type Keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+	legacy  cipher.AEAD // Opens records stored without a key ID, if set
+}
+
+// NewKeyring returns a keyring holding the given master keys, which wraps new records with the key whose ID is
+// primary.
+func NewKeyring(primary string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("primary key %q is not in the keyring", primary)
+	}
+
+	keyring := &Keyring{primary: primary, keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		if id == "" {
+			return nil, errors.New("key IDs must not be empty")
+		}
+
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		keyring.keys[id] = aead
+	}
+
+	return keyring, nil
+}
+
+// LoadKeyring reads a keyring from the JSON file at path, which names the primary key and holds every master key
+// encoded in base64, e.g.
+//
+//	{"primary": "2024-07", "keys": {"2024-01": "<base64 key>", "2024-07": "<base64 key>"}}
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Primary string            `json:"primary"`
+		Keys    map[string]string `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse keyring %s: %w", path, err)
+	}
+
+	keys := make(map[string][]byte, len(file.Keys))
+	for id, encoded := range file.Keys {
+		if keys[id], err = base64.StdEncoding.DecodeString(encoded); err != nil {
+			return nil, fmt.Errorf("keyring %s: key %q must be base64-encoded: %w", path, id, err)
+		}
+	}
+
+	keyring, err := NewKeyring(file.Primary, keys)
+	if err != nil {
+		return nil, fmt.Errorf("keyring %s: %w", path, err)
+	}
+
+	return keyring, nil
+}
+
+// SetLegacyKey makes the keyring open records encrypted directly with key, without a DEK, as cards were tokenized
+// before envelope encryption. Such records are stored without a key ID and have no DEK to rewrap, so they are brought
+// under a master key by opening them and sealing them again. It must be called before the keyring is used.
+func (k *Keyring) SetLegacyKey(key []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	k.legacy = aead
+	return nil
+}
+
+// PrimaryKeyID returns the ID of the master key that wraps new records.
+func (k *Keyring) PrimaryKeyID() string {
+	return k.primary
+}
+
+// Seal encrypts plaintext with a new DEK, wraps the DEK with the primary master key and returns the ID of that key
+// with the wrapped DEK and ciphertext. The same associated data must be given to open the record, which binds it
+// to its owner, e.g. by passing the record's ID.
+func (k *Keyring) Seal(plaintext, associatedData []byte) (keyID string, sealed []byte, err error) {
+	dek := make([]byte, KeySize)
+	if _, err := rand.Read(dek); err != nil {
+		return "", nil, err
+	}
+
+	wrapped, err := seal(k.keys[k.primary], dek, []byte(k.primary))
+	if err != nil {
+		return "", nil, err
+	}
+
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return "", nil, err
+	}
+
+	ciphertext, err := seal(aead, plaintext, associatedData)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return k.primary, append(wrapped, ciphertext...), nil
+}
+
+// Open decrypts a record sealed with the master key with the given ID and the given associated data. A record without
+// a key ID is decrypted with the legacy key.
+func (k *Keyring) Open(keyID string, sealed, associatedData []byte) ([]byte, error) {
+	if keyID == "" && k.legacy != nil {
+		return open(k.legacy, sealed, associatedData)
+	}
+
+	dek, err := k.unwrap(keyID, sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	return open(aead, sealed[wrappedKeySize:], associatedData)
+}
+
+// Rewrap wraps the DEK of a record sealed with the master key with the given ID with the primary key instead, and
+// returns the primary key's ID with the rewrapped record. The record itself is not decrypted.
+func (k *Keyring) Rewrap(keyID string, sealed []byte) (string, []byte, error) {
+	dek, err := k.unwrap(keyID, sealed)
+	if err != nil {
+		return "", nil, err
+	}
+
+	wrapped, err := seal(k.keys[k.primary], dek, []byte(k.primary))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return k.primary, append(wrapped, sealed[wrappedKeySize:]...), nil
+}
+
+// unwrap returns the DEK of a sealed record.
+func (k *Keyring) unwrap(keyID string, sealed []byte) ([]byte, error) {
+	master, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+
+	if len(sealed) < wrappedKeySize {
+		return nil, ErrDecrypt
+	}
+
+	return open(master, sealed[:wrappedKeySize], []byte(keyID))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("keys must be %d bytes, not %d", KeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with a random nonce, which precedes the returned ciphertext.
+func seal(aead cipher.AEAD, plaintext, associatedData []byte) ([]byte, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, associatedData), nil
+}
+
+// open decrypts a ciphertext returned by seal.
+func open(aead cipher.AEAD, ciphertext, associatedData []byte) ([]byte, error) {
+	if len(ciphertext) < nonceSize {
+		return nil, ErrDecrypt
+	}
+
+	plaintext, err := aead.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], associatedData)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	return plaintext, nil
+}
@@ -0,0 +1,147 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testKeyring returns a keyring holding the keys "old" and "new", with the given primary key.
+func testKeyring(t *testing.T, primary string) *Keyring {
+	t.Helper()
+
+	keyring, err := NewKeyring(primary, map[string][]byte{
+		"old": bytes.Repeat([]byte{1}, KeySize),
+		"new": bytes.Repeat([]byte{2}, KeySize),
+	})
+	require.NoError(t, err)
+
+	return keyring
+}
+
+func TestSealAndOpen(t *testing.T) {
+	keyring := testKeyring(t, "old")
+	plaintext := []byte("John Doe 12/29")
+
+	keyID, sealed, err := keyring.Seal(plaintext, []byte("PAY-1"))
+	require.NoError(t, err)
+	assert.Equal(t, "old", keyID)
+	assert.NotContains(t, string(sealed), "John")
+
+	opened, err := keyring.Open(keyID, sealed, []byte("PAY-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, plaintext, opened)
+
+	_, other, err := keyring.Seal(plaintext, []byte("PAY-1"))
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed[:wrappedKeySize], other[:wrappedKeySize], "every record has its own DEK")
+
+	_, err = keyring.Open(keyID, sealed, []byte("PAY-2"))
+	assert.ErrorIs(t, err, ErrDecrypt, "records cannot be opened with different associated data")
+
+	_, err = keyring.Open("new", sealed, []byte("PAY-1"))
+	assert.ErrorIs(t, err, ErrDecrypt, "records cannot be opened with another master key")
+
+	_, err = keyring.Open("missing", sealed, []byte("PAY-1"))
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	tampered := append([]byte{}, sealed...)
+	tampered[len(tampered)-1] ^= 1
+	_, err = keyring.Open(keyID, tampered, []byte("PAY-1"))
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	_, err = keyring.Open(keyID, sealed[:10], []byte("PAY-1"))
+	assert.ErrorIs(t, err, ErrDecrypt)
+}
+
+func TestRewrap(t *testing.T) {
+	keyID, sealed, err := testKeyring(t, "old").Seal([]byte("secret"), []byte("TOK-1"))
+	require.NoError(t, err)
+
+	rotated := testKeyring(t, "new")
+	newKeyID, rewrapped, err := rotated.Rewrap(keyID, sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "new", newKeyID)
+	assert.Equal(t, sealed[wrappedKeySize:], rewrapped[wrappedKeySize:], "the record itself is not re-encrypted")
+
+	// Once rewrapped, records no longer need the old master key
+	withoutOld, err := NewKeyring("new", map[string][]byte{"new": bytes.Repeat([]byte{2}, KeySize)})
+	require.NoError(t, err)
+	opened, err := withoutOld.Open(newKeyID, rewrapped, []byte("TOK-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("secret"), opened)
+
+	_, _, err = withoutOld.Rewrap(keyID, sealed)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestLegacyKey(t *testing.T) {
+	legacyKey := bytes.Repeat([]byte{3}, KeySize)
+	legacy, err := newAEAD(legacyKey)
+	require.NoError(t, err)
+
+	// Records encrypted before envelope encryption have no DEK and are stored without a key ID
+	sealed, err := seal(legacy, []byte("secret"), []byte("TOK-1"))
+	require.NoError(t, err)
+
+	keyring := testKeyring(t, "new")
+	_, err = keyring.Open("", sealed, []byte("TOK-1"))
+	assert.ErrorIs(t, err, ErrUnknownKey, "legacy records cannot be opened without the legacy key")
+
+	assert.Error(t, keyring.SetLegacyKey(legacyKey[:16]))
+	require.NoError(t, keyring.SetLegacyKey(legacyKey))
+
+	opened, err := keyring.Open("", sealed, []byte("TOK-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("secret"), opened)
+
+	_, err = keyring.Open("", sealed, []byte("TOK-2"))
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	keyID, resealed, err := keyring.Seal(opened, []byte("TOK-1"))
+	require.NoError(t, err)
+	opened, err = testKeyring(t, "new").Open(keyID, resealed, []byte("TOK-1"))
+	assert.NoError(t, err, "sealed again, legacy records no longer need the legacy key")
+	assert.Equal(t, []byte("secret"), opened)
+}
+
+func TestLoadKeyring(t *testing.T) {
+	dir := t.TempDir()
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, KeySize))
+
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	keyring, err := LoadKeyring(write("valid.json", `{"primary": "2024-07", "keys": {"2024-07": "`+key+`"}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-07", keyring.PrimaryKeyID())
+
+	tests := []struct {
+		name          string
+		content       string
+		expectedError string
+	}{
+		{name: "Missing Primary", content: `{"primary": "2024-08", "keys": {"2024-07": "` + key + `"}}`, expectedError: `primary key "2024-08" is not in the keyring`},
+		{name: "Short Key", content: `{"primary": "2024-07", "keys": {"2024-07": "AAAA"}}`, expectedError: "keys must be 32 bytes, not 3"},
+		{name: "Invalid Base64", content: `{"primary": "2024-07", "keys": {"2024-07": "not base64!"}}`, expectedError: "must be base64-encoded"},
+		{name: "Invalid JSON", content: `{"primary": 1}`, expectedError: "parse keyring"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadKeyring(write("keyring.json", tt.content))
+			assert.ErrorContains(t, err, tt.expectedError)
+		})
+	}
+
+	_, err = LoadKeyring(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,246 @@
+// Package money represents amounts of money exactly, as a whole number of the currency's minor units.
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/currency"
+)
+
+var (
+	// ErrInvalidAmount is returned when a decimal amount cannot be parsed.
+	ErrInvalidAmount = errors.New("money: invalid amount")
+	// ErrTooPrecise is returned when a decimal amount has more decimal places than its currency allows.
+	ErrTooPrecise = errors.New("money: amount has too many decimal places for its currency")
+	// ErrCurrencyMismatch is returned when amounts in different currencies are combined.
+	ErrCurrencyMismatch = errors.New("money: currencies do not match")
+	// ErrOverflow is returned when an amount is too large to be represented.
+	ErrOverflow = errors.New("money: amount out of range")
+)
+
+// Exponent returns the number of decimal places used by the given ISO 4217 currency, e.g. 0 for JPY, 2 for GBP
+// and 3 for KWD. Currencies that are not in the registry use 2.
+func Exponent(code string) int {
+	if c, ok := currency.Lookup(code); ok {
+		return c.Exponent
+	}
+
+	return 2
+}
+
+// Money is an amount in a currency, held as a whole number of the currency's minor units so that arithmetic
+// on it is exact. For example, £10.50 is 1050 GBP and ¥1050 is 1050 JPY.
+//
+// Money is encoded in JSON as {"value": 1050, "currency": "GBP"}. For compatibility with clients that send
+// decimal amounts, a plain JSON number or string such as 10.50 is also accepted; it is held unresolved until
+// Resolve is called with its currency.
+type Money struct {
+	Amount   int64  // The amount in minor units
+	Currency string // The ISO 4217 currency code
+
+	decimal string // A decimal amount decoded from JSON that has not been resolved yet
+}
+
+// New returns the given number of minor units of a currency.
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+// Parse converts a decimal amount such as "10.50" in the given currency to Money. It returns ErrTooPrecise
+// rather than rounding if the amount has more decimal places than the currency allows.
+func Parse(decimal, currency string) (Money, error) {
+	exponent := Exponent(currency)
+
+	value := strings.TrimSpace(decimal)
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimPrefix(strings.TrimPrefix(value, "-"), "+")
+
+	whole, fraction, _ := strings.Cut(value, ".")
+	if whole == "" && fraction == "" || !isDigits(whole) || !isDigits(fraction) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, decimal)
+	}
+
+	// Trailing zeros do not add precision, so 10.500 GBP is accepted
+	fraction = strings.TrimRight(fraction, "0")
+	if len(fraction) > exponent {
+		return Money{}, fmt.Errorf("%w: %q has more than %d decimal places", ErrTooPrecise, decimal, exponent)
+	}
+	fraction += strings.Repeat("0", exponent-len(fraction))
+
+	// Only digits remain, so the only possible error is that the amount is out of range
+	amount, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrOverflow, decimal)
+	}
+
+	if negative {
+		amount = -amount
+	}
+
+	return New(amount, currency), nil
+}
+
+// isDigits reports whether s contains only ASCII digits. The empty string is accepted.
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Resolve returns m with its currency set. A decimal amount decoded from JSON is converted using the
+// currency's exponent. An amount that already has a currency must match the given one, if any.
+func (m Money) Resolve(currency string) (Money, error) {
+	if m.decimal != "" {
+		if currency == "" {
+			return Money{}, fmt.Errorf("%w: %q has no currency", ErrInvalidAmount, m.decimal)
+		}
+		return Parse(m.decimal, currency)
+	}
+
+	switch {
+	case m.Currency == "":
+		m.Currency = strings.ToUpper(currency)
+	case currency != "" && !strings.EqualFold(m.Currency, currency):
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, strings.ToUpper(currency))
+	}
+
+	return m, nil
+}
+
+// IsZero reports whether the amount is zero.
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// IsPositive reports whether the amount is greater than zero.
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+// Add returns the sum of m and other, which must be in the same currency.
+func (m Money) Add(other Money) (Money, error) {
+	if err := m.checkCurrency(other); err != nil {
+		return Money{}, err
+	}
+	if (other.Amount > 0 && m.Amount > math.MaxInt64-other.Amount) || (other.Amount < 0 && m.Amount < math.MinInt64-other.Amount) {
+		return Money{}, ErrOverflow
+	}
+
+	return New(m.Amount+other.Amount, m.Currency), nil
+}
+
+// Sub returns other subtracted from m, which must be in the same currency.
+func (m Money) Sub(other Money) (Money, error) {
+	if other.Amount == math.MinInt64 {
+		return Money{}, ErrOverflow
+	}
+
+	return m.Add(Money{Amount: -other.Amount, Currency: other.Currency})
+}
+
+// Cmp compares m with other, which must be in the same currency. It returns -1 if m is less than other,
+// 0 if they are equal and +1 if m is greater.
+func (m Money) Cmp(other Money) (int, error) {
+	if err := m.checkCurrency(other); err != nil {
+		return 0, err
+	}
+
+	switch {
+	case m.Amount < other.Amount:
+		return -1, nil
+	case m.Amount > other.Amount:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+func (m Money) checkCurrency(other Money) error {
+	if !strings.EqualFold(m.Currency, other.Currency) {
+		return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+
+	return nil
+}
+
+// Decimal formats the amount as a decimal in major units, e.g. "10.50" for 1050 GBP.
+func (m Money) Decimal() string {
+	exponent := Exponent(m.Currency)
+
+	sign := ""
+	amount := strconv.FormatInt(m.Amount, 10)
+	if strings.HasPrefix(amount, "-") {
+		sign, amount = "-", amount[1:]
+	}
+	if exponent == 0 {
+		return sign + amount
+	}
+
+	if len(amount) <= exponent {
+		amount = strings.Repeat("0", exponent-len(amount)+1) + amount
+	}
+
+	return sign + amount[:len(amount)-exponent] + "." + amount[len(amount)-exponent:]
+}
+
+// String formats the amount with its currency, e.g. "10.50 GBP".
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// jsonMoney is the JSON representation of Money.
+type jsonMoney struct {
+	Value    int64  `json:"value"`
+	Currency string `json:"currency"`
+}
+
+// MarshalJSON encodes m as {"value": <minor units>, "currency": <code>}.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonMoney{Value: m.Amount, Currency: m.Currency})
+}
+
+// UnmarshalJSON decodes either {"value": <minor units>, "currency": <code>} or, for compatibility,
+// a decimal amount in major units given as a JSON number or string.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		return nil
+	case bytes.HasPrefix(data, []byte("{")):
+		var decoded jsonMoney
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&decoded); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidAmount, err)
+		}
+		*m = New(decoded.Value, decoded.Currency)
+	case bytes.HasPrefix(data, []byte(`"`)):
+		var decimal string
+		if err := json.Unmarshal(data, &decimal); err != nil {
+			return err
+		}
+		*m = Money{decimal: decimal}
+	default:
+		var decimal json.Number
+		if err := json.Unmarshal(data, &decimal); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidAmount, data)
+		}
+		if strings.ContainsAny(decimal.String(), "eE") {
+			return fmt.Errorf("%w: %s uses an exponent", ErrInvalidAmount, data)
+		}
+		*m = Money{decimal: decimal.String()}
+	}
+
+	return nil
+}
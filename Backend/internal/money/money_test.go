@@ -0,0 +1,129 @@
+package money
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		decimal     string
+		currency    string
+		expected    Money
+		expectedErr error
+	}{
+		{name: "Pounds And Pence", decimal: "10.50", currency: "GBP", expected: New(1050, "GBP")},
+		{name: "Single Decimal Place", decimal: "100.5", currency: "USD", expected: New(10050, "USD")},
+		{name: "Whole Amount", decimal: "12", currency: "gbp", expected: New(1200, "GBP")},
+		{name: "Trailing Zeros", decimal: "10.500", currency: "GBP", expected: New(1050, "GBP")},
+		{name: "Leading Point", decimal: ".5", currency: "GBP", expected: New(50, "GBP")},
+		{name: "Negative", decimal: "-0.01", currency: "GBP", expected: New(-1, "GBP")},
+		{name: "Yen Has No Minor Unit", decimal: "1050", currency: "JPY", expected: New(1050, "JPY")},
+		{name: "Dinar Has Three Decimal Places", decimal: "1.234", currency: "KWD", expected: New(1234, "KWD")},
+		{name: "Too Precise For Pounds", decimal: "10.505", currency: "GBP", expectedErr: ErrTooPrecise},
+		{name: "Too Precise For Yen", decimal: "10.5", currency: "JPY", expectedErr: ErrTooPrecise},
+		{name: "Not A Number", decimal: "ten", currency: "GBP", expectedErr: ErrInvalidAmount},
+		{name: "Empty", decimal: "", currency: "GBP", expectedErr: ErrInvalidAmount},
+		{name: "Exponent", decimal: "1e3", currency: "GBP", expectedErr: ErrInvalidAmount},
+		{name: "Too Large", decimal: "99999999999999999999", currency: "GBP", expectedErr: ErrOverflow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, err := Parse(tt.decimal, tt.currency)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, amount)
+		})
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	assert.Equal(t, "10.50", New(1050, "GBP").Decimal())
+	assert.Equal(t, "0.05", New(5, "GBP").Decimal())
+	assert.Equal(t, "-0.05", New(-5, "GBP").Decimal())
+	assert.Equal(t, "1050", New(1050, "JPY").Decimal())
+	assert.Equal(t, "1.234", New(1234, "KWD").Decimal())
+	assert.Equal(t, "10.50 GBP", New(1050, "GBP").String())
+}
+
+func TestArithmetic(t *testing.T) {
+	// 0.1 + 0.2 is exactly 0.3
+	sum, err := New(10, "GBP").Add(New(20, "GBP"))
+	assert.NoError(t, err)
+	assert.Equal(t, New(30, "GBP"), sum)
+
+	difference, err := New(1050, "GBP").Sub(New(1100, "GBP"))
+	assert.NoError(t, err)
+	assert.Equal(t, New(-50, "GBP"), difference)
+
+	cmp, err := New(1050, "GBP").Cmp(New(1100, "GBP"))
+	assert.NoError(t, err)
+	assert.Equal(t, -1, cmp)
+
+	_, err = New(1050, "GBP").Add(New(1050, "USD"))
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+
+	_, err = New(1050, "GBP").Cmp(New(1050, "USD"))
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+
+	_, err = New(math.MaxInt64, "GBP").Add(New(1, "GBP"))
+	assert.ErrorIs(t, err, ErrOverflow)
+
+	assert.True(t, New(0, "GBP").IsZero())
+	assert.True(t, New(1, "GBP").IsPositive())
+	assert.False(t, New(-1, "GBP").IsPositive())
+}
+
+func TestJSON(t *testing.T) {
+	encoded, err := json.Marshal(New(1050, "GBP"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"value": 1050, "currency": "GBP"}`, string(encoded))
+
+	tests := []struct {
+		name        string
+		json        string
+		currency    string
+		expected    Money
+		expectedErr error
+	}{
+		{name: "Minor Units", json: `{"value": 1050, "currency": "gbp"}`, expected: New(1050, "GBP")},
+		{name: "Minor Units With Matching Currency", json: `{"value": 1050, "currency": "GBP"}`, currency: "GBP", expected: New(1050, "GBP")},
+		{name: "Minor Units Without Currency", json: `{"value": 1050}`, currency: "JPY", expected: New(1050, "JPY")},
+		{name: "Minor Units With Other Currency", json: `{"value": 1050, "currency": "GBP"}`, currency: "USD", expectedErr: ErrCurrencyMismatch},
+		{name: "Decimal Number", json: `10.5`, currency: "GBP", expected: New(1050, "GBP")},
+		{name: "Decimal Number Is Not Rounded", json: `0.30000000000000004`, currency: "GBP", expectedErr: ErrTooPrecise},
+		{name: "Decimal String", json: `"10.50"`, currency: "KWD", expected: New(10500, "KWD")},
+		{name: "Decimal Without Currency", json: `10.5`, expectedErr: ErrInvalidAmount},
+		{name: "Fractional Minor Units", json: `{"value": 10.5, "currency": "GBP"}`, expectedErr: ErrInvalidAmount},
+		{name: "Unknown Field", json: `{"amount": 1050, "currency": "GBP"}`, expectedErr: ErrInvalidAmount},
+		{name: "Exponent", json: `1e3`, currency: "GBP", expectedErr: ErrInvalidAmount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var decoded Money
+			err := json.Unmarshal([]byte(tt.json), &decoded)
+			if err == nil {
+				decoded, err = decoded.Resolve(tt.currency)
+			}
+
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, decoded)
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// NewClientID returns a new ID for an OAuth client, which identifies it in token requests.
+func NewClientID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	return "CLI-" + hex.EncodeToString(id), nil
+}
+
+// GenerateSecret returns a new client secret. Secrets are only shown when they are created; the gateway stores their
+// hashes.
+func GenerateSecret() (string, error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return "cs_" + hex.EncodeToString(secret), nil
+}
+
+// HashSecret returns the hash a client secret is stored as. Secrets are long and random, so a fast hash cannot be
+// reversed by guessing.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
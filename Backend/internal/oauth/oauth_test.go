@@ -0,0 +1,104 @@
+package oauth
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testIssuer(t *testing.T, key byte) *Issuer {
+	issuer, err := NewIssuer(bytes.Repeat([]byte{key}, MinKeySize), "payment-gateway", 15*time.Minute)
+	require.NoError(t, err)
+
+	return issuer
+}
+
+func TestNewIssuer(t *testing.T) {
+	_, err := NewIssuer(make([]byte, MinKeySize-1), "payment-gateway", time.Minute)
+	assert.Error(t, err)
+
+	_, err = NewIssuer(make([]byte, MinKeySize), "payment-gateway", 0)
+	assert.Error(t, err)
+}
+
+func TestIssueAndVerify(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	issuer := testIssuer(t, 'a')
+
+	token, claims, err := issuer.Issue("CLI-1", "MER-1", []Scope{PaymentsRead, RefundsWrite}, now)
+	require.NoError(t, err)
+	assert.Equal(t, "payments:read refunds:write", claims.Scope)
+	assert.Equal(t, now.Add(15*time.Minute).Unix(), claims.ExpiresAt)
+
+	verified, err := issuer.Verify(token, now.Add(14*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, claims, verified)
+	assert.Equal(t, "CLI-1", verified.Subject)
+	assert.Equal(t, "MER-1", verified.MerchantID)
+	assert.True(t, verified.HasScope(PaymentsRead))
+	assert.False(t, verified.HasScope(PaymentsWrite))
+
+	_, err = issuer.Verify(token, now.Add(15*time.Minute))
+	assert.ErrorIs(t, err, ErrExpiredToken)
+
+	_, err = issuer.Verify(token, now.Add(-2*time.Minute))
+	assert.ErrorIs(t, err, ErrInvalidToken, "tokens issued in the future are rejected")
+
+	other, _, err := testIssuer(t, 'b').Issue("CLI-1", "MER-1", []Scope{PaymentsWrite}, now)
+	require.NoError(t, err)
+	_, err = issuer.Verify(other, now)
+	assert.ErrorIs(t, err, ErrInvalidToken, "tokens signed with another key are rejected")
+
+	// Changing the claims invalidates the signature
+	parts := strings.Split(token, ".")
+	forged := strings.Replace(string(mustDecode(t, parts[1])), "payments:read", "payments:write", 1)
+	_, err = issuer.Verify(parts[0]+"."+base64.RawURLEncoding.EncodeToString([]byte(forged))+"."+parts[2], now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// Unsigned tokens are rejected
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	_, err = issuer.Verify(none+"."+parts[1]+".", now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = issuer.Verify("sk_test_123", now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func mustDecode(t *testing.T, value string) []byte {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	require.NoError(t, err)
+
+	return decoded
+}
+
+func TestParseScope(t *testing.T) {
+	scopes, err := ParseScope(" payments:write  refunds:write payments:write ")
+	require.NoError(t, err)
+	assert.Equal(t, []Scope{PaymentsWrite, RefundsWrite}, scopes)
+
+	scopes, err = ParseScope("")
+	require.NoError(t, err)
+	assert.Empty(t, scopes)
+
+	_, err = ParseScope("payments:write payments:delete")
+	assert.ErrorIs(t, err, ErrInvalidScope)
+
+	assert.Equal(t, "payments:write refunds:write", FormatScope([]Scope{PaymentsWrite, RefundsWrite}))
+}
+
+func TestClientCredentials(t *testing.T) {
+	id, err := NewClientID()
+	require.NoError(t, err)
+	assert.Regexp(t, `^CLI-[0-9a-f]{32}$`, id)
+
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	assert.Regexp(t, `^cs_[0-9a-f]{48}$`, secret)
+	assert.Len(t, HashSecret(secret), 64)
+	assert.NotEqual(t, HashSecret(secret), HashSecret(secret+"0"))
+}
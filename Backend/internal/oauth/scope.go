@@ -0,0 +1,59 @@
+package oauth
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalidScope is returned when a scope string names an unknown scope.
+var ErrInvalidScope = errors.New("invalid scope")
+
+// Scope is a permission an access token grants.
+type Scope string
+
+const (
+	PaymentsWrite Scope = "payments:write" // Make, capture and void payments
+	PaymentsRead  Scope = "payments:read"  // Retrieve payments and their refunds
+	RefundsWrite  Scope = "refunds:write"  // Refund payments
+)
+
+// Scopes lists every scope, in the order they are documented.
+var Scopes = []Scope{PaymentsWrite, PaymentsRead, RefundsWrite}
+
+// ParseScope parses a space-separated list of scopes, as sent in the scope parameter of a token request. Repeated
+// scopes are only returned once. It returns ErrInvalidScope if any scope is unknown.
+func ParseScope(value string) ([]Scope, error) {
+	var scopes []Scope
+	for _, field := range strings.Fields(value) {
+		scope := Scope(field)
+		if !Contains(Scopes, scope) {
+			return nil, ErrInvalidScope
+		}
+		if !Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return scopes, nil
+}
+
+// FormatScope returns scopes as a space-separated list.
+func FormatScope(scopes []Scope) string {
+	fields := make([]string, len(scopes))
+	for i, scope := range scopes {
+		fields[i] = string(scope)
+	}
+
+	return strings.Join(fields, " ")
+}
+
+// Contains reports whether scopes contains scope.
+func Contains(scopes []Scope, scope Scope) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
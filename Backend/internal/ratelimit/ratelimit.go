@@ -0,0 +1,204 @@
+// Package ratelimit implements token bucket rate limits: a bucket holds up to a limit's number of requests, each
+// request takes one token, and tokens are added back steadily over the limit's period.
+package ratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidLimit is returned when a limit is not written as requests per period, e.g. "20/m".
+var ErrInvalidLimit = errors.New("limit must be a positive number of requests per s, m, h or a duration, e.g. 20/m")
+
+// Limit is a number of requests allowed per period. Its bucket holds Requests tokens, so that many requests can be
+// made at once, and refills completely over Period. The zero Limit allows every request.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseLimit parses a limit written as requests per period, where the period is s, m, h or a duration such as 10s.
+func ParseLimit(s string) (Limit, error) {
+	requests, period, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return Limit{}, ErrInvalidLimit
+	}
+
+	n, err := strconv.Atoi(requests)
+	if err != nil || n <= 0 {
+		return Limit{}, ErrInvalidLimit
+	}
+
+	var d time.Duration
+	switch period {
+	case "s":
+		d = time.Second
+	case "m":
+		d = time.Minute
+	case "h":
+		d = time.Hour
+	default:
+		if d, err = time.ParseDuration(period); err != nil || d <= 0 {
+			return Limit{}, ErrInvalidLimit
+		}
+	}
+
+	return Limit{Requests: n, Period: d}, nil
+}
+
+// String returns the limit in the form parsed by ParseLimit.
+func (l Limit) String() string {
+	switch l.Period {
+	case time.Second:
+		return fmt.Sprintf("%d/s", l.Requests)
+	case time.Minute:
+		return fmt.Sprintf("%d/m", l.Requests)
+	case time.Hour:
+		return fmt.Sprintf("%d/h", l.Requests)
+	default:
+		return fmt.Sprintf("%d/%s", l.Requests, l.Period)
+	}
+}
+
+// IsZero reports whether the limit allows every request.
+func (l Limit) IsZero() bool {
+	return l.Requests <= 0 || l.Period <= 0
+}
+
+// UnmarshalText parses a limit with ParseLimit, so that limits can be written as strings in JSON.
+func (l *Limit) UnmarshalText(text []byte) error {
+	parsed, err := ParseLimit(string(text))
+	if err != nil {
+		return fmt.Errorf("%q: %w", text, err)
+	}
+
+	*l = parsed
+	return nil
+}
+
+// MarshalText returns the limit as written for ParseLimit.
+func (l Limit) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed    bool          // Whether a token was taken, so the request may go ahead
+	Limit      Limit         // The limit of the bucket
+	Remaining  int           // How many whole tokens are left
+	RetryAfter time.Duration // How long until the next token, when none were left
+	Reset      time.Duration // How long until the bucket is full again
+}
+
+// Take takes a token from a bucket of the limit holding tokens, after adding the tokens earned over elapsed, the time
+// since the bucket was last used. It returns the tokens left in the bucket and the result.
+func (l Limit) Take(tokens float64, elapsed time.Duration) (float64, Result) {
+	capacity := float64(l.Requests)
+	rate := capacity / l.Period.Seconds()
+
+	tokens = math.Min(capacity, tokens+math.Max(0, elapsed.Seconds())*rate)
+
+	result := Result{Limit: l}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - tokens) / rate)
+	}
+
+	result.Remaining = int(math.Floor(tokens))
+	result.Reset = seconds((capacity - tokens) / rate)
+
+	return tokens, result
+}
+
+// seconds converts a number of seconds to a duration.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// Rule is the limits of a route. A request takes a token from the bucket of its API key, of its merchant and of its
+// client's IP address, each of which has its own limit; a zero limit is not checked.
+type Rule struct {
+	APIKey   Limit `json:"apiKey"`   // Limit for each API key, OAuth client or dashboard user
+	Merchant Limit `json:"merchant"` // Limit for each merchant, across all of its credentials
+	IP       Limit `json:"ip"`       // Limit for each client IP address
+}
+
+// Rules holds the limits of each route. Routes without their own rule use the default rule.
+type Rules struct {
+	Default Rule            `json:"default"` // Limits of routes without their own rule
+	Routes  map[string]Rule `json:"routes"`  // Limits of each route, keyed by method and path pattern, e.g. "POST /api/v1/payments"
+}
+
+// DefaultRules are the limits used when no others are configured. They are strict where stolen cards are tested and
+// passwords guessed, and generous elsewhere.
+var DefaultRules = Rules{
+	Default: Rule{
+		APIKey: Limit{Requests: 600, Period: time.Minute},
+		IP:     Limit{Requests: 1200, Period: time.Minute},
+	},
+	Routes: map[string]Rule{
+		"POST /api/v1/payments": {
+			APIKey:   Limit{Requests: 60, Period: time.Minute},
+			Merchant: Limit{Requests: 300, Period: time.Minute},
+			IP:       Limit{Requests: 20, Period: time.Minute},
+		},
+		"POST /api/v1/tokens": {
+			APIKey:   Limit{Requests: 60, Period: time.Minute},
+			Merchant: Limit{Requests: 300, Period: time.Minute},
+			IP:       Limit{Requests: 20, Period: time.Minute},
+		},
+		"POST /api/v1/sessions": {
+			IP: Limit{Requests: 10, Period: time.Minute},
+		},
+		"POST /oauth/token": {
+			IP: Limit{Requests: 30, Period: time.Minute},
+		},
+	},
+}
+
+// For returns the rule of the route with the given method and path pattern.
+func (r Rules) For(method, path string) Rule {
+	if rule, ok := r.Routes[method+" "+path]; ok {
+		return rule
+	}
+
+	return r.Default
+}
+
+// LongestPeriod returns the longest period of any limit, after which an unused bucket is always full.
+func (r Rules) LongestPeriod() time.Duration {
+	longest := max(r.Default.APIKey.Period, r.Default.Merchant.Period, r.Default.IP.Period)
+	for _, rule := range r.Routes {
+		longest = max(longest, rule.APIKey.Period, rule.Merchant.Period, rule.IP.Period)
+	}
+
+	return longest
+}
+
+// LoadRules reads rules from the JSON file at path, e.g.
+//
+//	{"default": {"ip": "1200/m"}, "routes": {"POST /api/v1/payments": {"apiKey": "60/m", "ip": "20/m"}}}
+//
+// Routes are named by their method and path pattern as registered with the router. It returns an error if a limit
+// is not written as requests per period.
+func LoadRules(path string) (Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Rules{}, err
+	}
+
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return Rules{}, fmt.Errorf("parse rate limits %s: %w", path, err)
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedLimit Limit
+		expectError   bool
+	}{
+		{input: "20/m", expectedLimit: Limit{Requests: 20, Period: time.Minute}},
+		{input: "5/s", expectedLimit: Limit{Requests: 5, Period: time.Second}},
+		{input: " 1000/h ", expectedLimit: Limit{Requests: 1000, Period: time.Hour}},
+		{input: "3/10s", expectedLimit: Limit{Requests: 3, Period: 10 * time.Second}},
+		{input: "20", expectError: true},
+		{input: "0/m", expectError: true},
+		{input: "-1/m", expectError: true},
+		{input: "twenty/m", expectError: true},
+		{input: "20/fortnight", expectError: true},
+		{input: "20/-1m", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			limit, err := ParseLimit(tt.input)
+			if tt.expectError {
+				assert.ErrorIs(t, err, ErrInvalidLimit)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedLimit, limit)
+
+			reparsed, err := ParseLimit(limit.String())
+			require.NoError(t, err)
+			assert.Equal(t, limit, reparsed)
+		})
+	}
+}
+
+func TestLimitTake(t *testing.T) {
+	limit := Limit{Requests: 10, Period: 10 * time.Second}
+
+	tests := []struct {
+		name           string
+		tokens         float64
+		elapsed        time.Duration
+		expectedTokens float64
+		expectedResult Result
+	}{
+		{"Full Bucket", 10, 0, 9, Result{Allowed: true, Limit: limit, Remaining: 9, Reset: time.Second}},
+		{"Refilled Up To Capacity", 5, time.Hour, 9, Result{Allowed: true, Limit: limit, Remaining: 9, Reset: time.Second}},
+		{"Partly Refilled", 0, 2500 * time.Millisecond, 1.5, Result{Allowed: true, Limit: limit, Remaining: 1, Reset: 8500 * time.Millisecond}},
+		{"Empty Bucket", 0.25, 0, 0.25, Result{Allowed: false, Limit: limit, Remaining: 0, RetryAfter: 750 * time.Millisecond, Reset: 9750 * time.Millisecond}},
+		{"Clock Went Backwards", 0, -time.Minute, 0, Result{Allowed: false, Limit: limit, Remaining: 0, RetryAfter: time.Second, Reset: 10 * time.Second}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, result := limit.Take(tt.tokens, tt.elapsed)
+			assert.InDelta(t, tt.expectedTokens, tokens, 1e-9)
+			assert.Equal(t, tt.expectedResult, result)
+		})
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rate-limits.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"default": {"ip": "100/m"},
+		"routes": {"POST /api/v1/payments": {"apiKey": "10/m", "merchant": "50/m", "ip": "5/h"}}
+	}`), 0o600))
+
+	rules, err := LoadRules(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, Rule{
+		APIKey:   Limit{Requests: 10, Period: time.Minute},
+		Merchant: Limit{Requests: 50, Period: time.Minute},
+		IP:       Limit{Requests: 5, Period: time.Hour},
+	}, rules.For("POST", "/api/v1/payments"))
+	assert.Equal(t, Rule{IP: Limit{Requests: 100, Period: time.Minute}}, rules.For("GET", "/api/v1/payments"))
+	assert.True(t, rules.For("GET", "/api/v1/payments").APIKey.IsZero())
+	assert.Equal(t, time.Hour, rules.LongestPeriod())
+
+	invalid := filepath.Join(dir, "invalid.json")
+	require.NoError(t, os.WriteFile(invalid, []byte(`{"default": {"ip": "lots"}}`), 0o600))
+	_, err = LoadRules(invalid)
+	assert.ErrorIs(t, err, ErrInvalidLimit)
+
+	_, err = LoadRules(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,76 @@
+// Package rbac defines the permissions needed by each endpoint of the gateway and the roles of dashboard users, each
+// of which grants a fixed set of permissions.
+package rbac
+
+// Permission allows an action on the gateway. The permissions for payments and refunds share their names with the
+// OAuth scopes that grant them.
+type Permission string
+
+const (
+	PaymentsRead  Permission = "payments:read"  // Retrieve payments and their refunds
+	PaymentsWrite Permission = "payments:write" // Make, capture and void payments
+	RefundsWrite  Permission = "refunds:write"  // Refund payments
+	TokensWrite   Permission = "tokens:write"   // Tokenize cards
+	TokensManage  Permission = "tokens:manage"  // Retrieve and revoke tokens
+	BINsRead      Permission = "bins:read"      // Look up BINs
+	MerchantRead  Permission = "merchant:read"  // Retrieve the merchant
+	MerchantWrite Permission = "merchant:write" // Create signing secrets
+	APIKeysRead   Permission = "api-keys:read"  // List API keys
+	APIKeysWrite  Permission = "api-keys:write" // Create, rotate and revoke API keys
+	UsersRead     Permission = "users:read"     // List dashboard users
+	UsersWrite    Permission = "users:write"    // Create, change the role of and disable dashboard users
+	// Create and rotate secret API keys, along with APIKeysWrite. Secret keys have every permission, so only roles
+	// granting every permission have it.
+	SecretKeysWrite Permission = "secret-keys:write"
+)
+
+// Permissions lists every permission.
+var Permissions = []Permission{
+	PaymentsRead, PaymentsWrite, RefundsWrite, TokensWrite, TokensManage, BINsRead,
+	MerchantRead, MerchantWrite, APIKeysRead, APIKeysWrite, UsersRead, UsersWrite, SecretKeysWrite,
+}
+
+// Role is the role of a dashboard user, which determines what they can do.
+type Role string
+
+const (
+	Admin     Role = "admin"     // Can do everything, including managing users
+	Developer Role = "developer" // Integrates with the gateway: payments, tokens, publishable API keys and signing secrets
+	Support   Role = "support"   // Looks up payments for customers, without changing anything
+	Finance   Role = "finance"   // Reviews payments and issues refunds
+)
+
+// Roles lists every role.
+var Roles = []Role{Admin, Developer, Support, Finance}
+
+// rolePermissions maps each role to the permissions it grants.
+var rolePermissions = map[Role][]Permission{
+	Admin: Permissions,
+	Developer: {
+		PaymentsRead, PaymentsWrite, TokensWrite, TokensManage, BINsRead,
+		MerchantRead, MerchantWrite, APIKeysRead, APIKeysWrite,
+	},
+	Support: {PaymentsRead, MerchantRead},
+	Finance: {PaymentsRead, RefundsWrite, MerchantRead},
+}
+
+// Valid reports whether r is a known role.
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Can reports whether the role grants permission.
+func (r Role) Can(permission Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PublishableKeyPermissions are the permissions of publishable API keys, which can be embedded in web pages and apps.
+// Secret keys have every permission.
+var PublishableKeyPermissions = []Permission{TokensWrite, BINsRead}
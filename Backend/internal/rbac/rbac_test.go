@@ -0,0 +1,47 @@
+package rbac
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleCan(t *testing.T) {
+	tests := []struct {
+		role       Role
+		permission Permission
+		expected   bool
+	}{
+		{Admin, UsersWrite, true},
+		{Admin, RefundsWrite, true},
+		{Developer, APIKeysWrite, true},
+		{Developer, PaymentsWrite, true},
+		{Developer, RefundsWrite, false},
+		{Developer, UsersWrite, false},
+		{Developer, SecretKeysWrite, false},
+		{Admin, SecretKeysWrite, true},
+		{Support, PaymentsRead, true},
+		{Support, MerchantRead, true},
+		{Support, RefundsWrite, false},
+		{Support, APIKeysWrite, false},
+		{Support, PaymentsWrite, false},
+		{Finance, RefundsWrite, true},
+		{Finance, PaymentsWrite, false},
+		{Finance, APIKeysRead, false},
+		{Role("owner"), PaymentsRead, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.role)+" "+string(tt.permission), func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.role.Can(tt.permission))
+		})
+	}
+}
+
+func TestRoleValid(t *testing.T) {
+	for _, role := range Roles {
+		assert.True(t, role.Valid(), role)
+	}
+	assert.False(t, Role("owner").Valid())
+	assert.False(t, Role("").Valid())
+}
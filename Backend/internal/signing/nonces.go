@@ -0,0 +1,68 @@
+package signing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// NonceCache remembers the nonces of signed requests until their signatures expire, so that a request cannot be
+// replayed within the replay window. Implementations must be safe for concurrent use.
+type NonceCache interface {
+	// Add records a nonce until expiresAt, and reports whether it was new. A nonce that was recorded before and has
+	// not expired by now is not recorded again.
+	Add(ctx context.Context, nonce string, now, expiresAt time.Time) (bool, error)
+}
+
+// NonceCacheFunc adapts a function to the NonceCache interface, such as the method of a store that shares nonces
+// between gateway instances.
+type NonceCacheFunc func(ctx context.Context, nonce string, now, expiresAt time.Time) (bool, error)
+
+// Add calls f.
+func (f NonceCacheFunc) Add(ctx context.Context, nonce string, now, expiresAt time.Time) (bool, error) {
+	return f(ctx, nonce, now, expiresAt)
+}
+
+// MemoryNonceCache is a NonceCache held in memory. It only protects the instance it runs in, so deployments with
+// several instances need a shared cache.
+type MemoryNonceCache struct {
+	mu        sync.Mutex           // Guards the fields below
+	nonces    map[string]time.Time // When each nonce expires
+	lastPurge time.Time            // When expired nonces were last removed
+}
+
+// NewMemoryNonceCache returns an empty MemoryNonceCache.
+func NewMemoryNonceCache() *MemoryNonceCache {
+	return &MemoryNonceCache{nonces: make(map[string]time.Time)}
+}
+
+// Add records a nonce until expiresAt, and reports whether it was new.
+func (c *MemoryNonceCache) Add(ctx context.Context, nonce string, now, expiresAt time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Expired nonces are removed at most once a minute, so that the cache does not grow without bound
+	if now.Sub(c.lastPurge) >= time.Minute {
+		for n, expires := range c.nonces {
+			if !now.Before(expires) {
+				delete(c.nonces, n)
+			}
+		}
+		c.lastPurge = now
+	}
+
+	if expires, exists := c.nonces[nonce]; exists && now.Before(expires) {
+		return false, nil
+	}
+
+	c.nonces[nonce] = expiresAt
+	return true, nil
+}
+
+// Len returns the number of nonces in the cache, including any that have expired but not yet been removed.
+func (c *MemoryNonceCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.nonces)
+}
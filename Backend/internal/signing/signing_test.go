@@ -0,0 +1,96 @@
+package signing
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSign(t *testing.T) {
+	secret := "sig_" + strings.Repeat("ab", 32)
+	request := Request{
+		Timestamp: time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC),
+		Nonce:     "nonce-1",
+		Method:    "POST",
+		Path:      "/api/v1/payments",
+		Body:      []byte(`{"amount":10}`),
+	}
+
+	signature := Sign(secret, request)
+	assert.Regexp(t, `^v1=[0-9a-f]{64}$`, signature)
+	assert.True(t, Verify(secret, request, signature))
+
+	lowercase := request
+	lowercase.Method = "post"
+	assert.True(t, Verify(secret, lowercase, signature), "methods are not case-sensitive")
+
+	tests := []struct {
+		name   string
+		change func(*Request)
+	}{
+		{"Timestamp", func(r *Request) { r.Timestamp = r.Timestamp.Add(time.Second) }},
+		{"Nonce", func(r *Request) { r.Nonce = "nonce-2" }},
+		{"Method", func(r *Request) { r.Method = "PUT" }},
+		{"Path", func(r *Request) { r.Path = "/api/v1/payments?capture=false" }},
+		{"Body", func(r *Request) { r.Body = []byte(`{"amount":100}`) }},
+	}
+
+	for _, tt := range tests {
+		t.Run("Changed "+tt.name, func(t *testing.T) {
+			changed := request
+			tt.change(&changed)
+			assert.False(t, Verify(secret, changed, signature))
+		})
+	}
+
+	assert.False(t, Verify("sig_other", request, signature))
+	assert.False(t, Verify(secret, request, strings.TrimPrefix(signature, "v1=")))
+}
+
+func TestParseTimestamp(t *testing.T) {
+	timestamp, err := ParseTimestamp("1719835200")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC), timestamp)
+
+	_, err = ParseTimestamp("2024-07-01T12:00:00Z")
+	assert.Error(t, err)
+}
+
+func TestNewSecret(t *testing.T) {
+	secret, err := NewSecret()
+	require.NoError(t, err)
+	assert.Regexp(t, `^sig_[0-9a-f]{64}$`, secret)
+
+	other, err := NewSecret()
+	require.NoError(t, err)
+	assert.NotEqual(t, secret, other)
+}
+
+func TestMemoryNonceCache(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	cache := NewMemoryNonceCache()
+
+	added, err := cache.Add(ctx, "nonce-1", now, now.Add(5*time.Minute))
+	require.NoError(t, err)
+	assert.True(t, added)
+
+	added, err = cache.Add(ctx, "nonce-1", now.Add(time.Minute), now.Add(6*time.Minute))
+	require.NoError(t, err)
+	assert.False(t, added, "a nonce cannot be reused before it expires")
+
+	added, err = cache.Add(ctx, "nonce-2", now, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, added)
+
+	// Expired nonces can be reused, and are eventually removed
+	later := now.Add(10 * time.Minute)
+	added, err = cache.Add(ctx, "nonce-1", later, later.Add(5*time.Minute))
+	require.NoError(t, err)
+	assert.True(t, added)
+	assert.Equal(t, 1, cache.Len())
+}
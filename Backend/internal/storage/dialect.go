@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrations embed.FS
+
+// dialect captures the differences between the SQL databases supported by SQLStore.
+type dialect struct {
+	name              string           // Human-readable database name used in errors
+	driver            string           // database/sql driver name
+	migrations        embed.FS         // Embedded migration files
+	migrationsDir     string           // Directory of migrations within the embedded filesystem
+	now               string           // SQL expression for the current timestamp
+	migrationLock     string           // Statement run at the start of each migration transaction, if any
+	forUpdate         string           // Clause locking the rows selected in a transaction until it ends, if needed
+	configure         func(*sql.DB)    // Optional connection pool configuration
+	isUniqueViolation func(error) bool // Reports whether an error was caused by a unique constraint
+}
+
+var postgresDialect = dialect{
+	name:          "postgres",
+	driver:        "postgres",
+	migrations:    postgresMigrations,
+	migrationsDir: "migrations/postgres",
+	now:           "now()",
+	// Arbitrary application-wide key shared by every gateway instance, so that instances
+	// starting at the same time do not apply the same migration twice.
+	migrationLock: "SELECT pg_advisory_xact_lock(7262461)",
+	forUpdate:     " FOR UPDATE",
+	isUniqueViolation: func(err error) bool {
+		var pqErr *pq.Error
+		// 23505 is the PostgreSQL error code raised when a unique constraint is violated.
+		return errors.As(err, &pqErr) && pqErr.Code == "23505"
+	},
+}
+
+var sqliteDialect = dialect{
+	name:          "sqlite",
+	driver:        "sqlite",
+	migrations:    sqliteMigrations,
+	migrationsDir: "migrations/sqlite",
+	now:           "strftime('%Y-%m-%d %H:%M:%f', 'now')",
+	configure: func(db *sql.DB) {
+		// SQLite allows a single writer at a time, so share one connection rather than
+		// have concurrent requests fail with SQLITE_BUSY.
+		db.SetMaxOpenConns(1)
+	},
+	isUniqueViolation: func(err error) bool {
+		var sqliteErr *sqlite.Error
+		return errors.As(err, &sqliteErr) &&
+			(sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE)
+	},
+}
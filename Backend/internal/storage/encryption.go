@@ -0,0 +1,330 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/envelope"
+)
+
+// ErrNoKeyring is returned when a record is encrypted but the store has no keyring to decrypt it with.
+var ErrNoKeyring = errors.New("storage: record is encrypted but no keyring is configured")
+
+// Option configures a SQLStore.
+type Option func(*SQLStore)
+
+// WithKeyring encrypts the cardholder data of new payments and the signing secrets of merchants with envelope
+// encryption, using the keyring's primary master key, and decrypts records encrypted with any of its keys. Records
+// stored before encryption was enabled are read as they are until RotateKeys encrypts them.
+func WithKeyring(keyring *envelope.Keyring) Option {
+	return func(s *SQLStore) {
+		s.keyring = keyring
+	}
+}
+
+// cardholder is the sensitive part of a payment, which is stored encrypted when the store has a keyring.
+type cardholder struct {
+	FirstName  string
+	LastName   string
+	ExpiryDate string
+}
+
+// sealCardholder returns the cardholder data to store in a payment's plaintext columns, with the ID of the master key
+// and the encrypted cardholder data to store alongside them. Without a keyring, the cardholder data is returned as it
+// is and the key ID is empty.
+func (s *SQLStore) sealCardholder(payment models.PaymentDetails) (cardholder, string, []byte, error) {
+	holder := cardholder{FirstName: payment.FirstName, LastName: payment.LastName, ExpiryDate: payment.ExpiryDate}
+	if s.keyring == nil {
+		return holder, "", nil, nil
+	}
+
+	keyID, sealed, err := encryptCardholder(s.keyring, payment.ID, holder)
+	if err != nil {
+		return cardholder{}, "", nil, err
+	}
+
+	return cardholder{}, keyID, sealed, nil
+}
+
+// openCardholder decrypts a payment's cardholder data into payment.
+func (s *SQLStore) openCardholder(payment *models.PaymentDetails, keyID string, sealed []byte) error {
+	if s.keyring == nil {
+		return fmt.Errorf("payment %s: %w", payment.ID, ErrNoKeyring)
+	}
+
+	plaintext, err := s.keyring.Open(keyID, sealed, []byte(payment.ID))
+	if err != nil {
+		return fmt.Errorf("decrypt payment %s: %w", payment.ID, err)
+	}
+
+	var holder cardholder
+	if err := json.Unmarshal(plaintext, &holder); err != nil {
+		return fmt.Errorf("decode payment %s: %w", payment.ID, err)
+	}
+
+	payment.FirstName, payment.LastName, payment.ExpiryDate = holder.FirstName, holder.LastName, holder.ExpiryDate
+	return nil
+}
+
+// encryptCardholder encrypts the cardholder data of the payment with the given ID, which binds it to the payment.
+func encryptCardholder(keyring *envelope.Keyring, paymentID string, holder cardholder) (string, []byte, error) {
+	plaintext, err := json.Marshal(holder)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return keyring.Seal(plaintext, []byte(paymentID))
+}
+
+// sealSigningSecret returns the signing secret to store in a merchant's plaintext column, with the ID of the master
+// key and the encrypted secret to store alongside it. Without a keyring, or without a secret, the secret is returned
+// as it is and the key ID is empty.
+func (s *SQLStore) sealSigningSecret(merchantID, secret string) (string, string, []byte, error) {
+	if s.keyring == nil || secret == "" {
+		return secret, "", nil, nil
+	}
+
+	keyID, sealed, err := s.keyring.Seal([]byte(secret), []byte(merchantID))
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	return "", keyID, sealed, nil
+}
+
+// openSigningSecret decrypts a merchant's signing secret into merchant.
+func (s *SQLStore) openSigningSecret(merchant *models.Merchant, keyID string, sealed []byte) error {
+	if s.keyring == nil {
+		return fmt.Errorf("merchant %s: %w", merchant.ID, ErrNoKeyring)
+	}
+
+	secret, err := s.keyring.Open(keyID, sealed, []byte(merchant.ID))
+	if err != nil {
+		return fmt.Errorf("decrypt signing secret of merchant %s: %w", merchant.ID, err)
+	}
+
+	merchant.SigningSecret = string(secret)
+	return nil
+}
+
+// RotateKeys brings every encrypted record under the keyring's primary master key, and returns the number of records
+// it changed. Records wrapped by another master key have their DEK rewrapped, payments stored in plaintext are
+// encrypted, and tokens encrypted with the legacy key are sealed again. Records are updated in batches of batchSize,
+// each only if it has not been rotated concurrently, so the gateway can keep serving requests while keys are rotated
+// as long as every instance has the new keyring.
+func (s *SQLStore) RotateKeys(ctx context.Context, batchSize int) (int, error) {
+	if s.keyring == nil {
+		return 0, ErrNoKeyring
+	}
+	if batchSize <= 0 {
+		return 0, fmt.Errorf("batch size must be positive, not %d", batchSize)
+	}
+
+	payments, err := s.rotatePaymentKeys(ctx, batchSize)
+	if err != nil {
+		return payments, err
+	}
+
+	tokens, err := s.rotateTokenKeys(ctx, batchSize)
+	if err != nil {
+		return payments + tokens, err
+	}
+
+	merchants, err := s.rotateMerchantKeys(ctx, batchSize)
+	return payments + tokens + merchants, err
+}
+
+// updateRotated runs the statement saving a rotated record and returns the number of records it changed, which is
+// none if the record was rotated or deleted concurrently.
+func (s *SQLStore) updateRotated(ctx context.Context, query string, args ...any) (int, error) {
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	changed, err := result.RowsAffected()
+	return int(changed), err
+}
+
+// rotatePaymentKeys encrypts or rewraps the payments that are not encrypted with the primary master key.
+func (s *SQLStore) rotatePaymentKeys(ctx context.Context, batchSize int) (int, error) {
+	primary := s.keyring.PrimaryKeyID()
+	rotated := 0
+
+	for {
+		rows, err := s.db.QueryContext(ctx, `SELECT id, first_name, last_name, expiry_date, key_id, encrypted_cardholder
+			FROM payments WHERE key_id <> $1 ORDER BY id LIMIT $2`, primary, batchSize)
+		if err != nil {
+			return rotated, err
+		}
+
+		type payment struct {
+			id, keyID string
+			holder    cardholder
+			sealed    []byte
+		}
+		var batch []payment
+		for rows.Next() {
+			var p payment
+			if err := rows.Scan(&p.id, &p.holder.FirstName, &p.holder.LastName, &p.holder.ExpiryDate, &p.keyID, &p.sealed); err != nil {
+				rows.Close()
+				return rotated, err
+			}
+			batch = append(batch, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return rotated, err
+		}
+
+		if len(batch) == 0 {
+			return rotated, nil
+		}
+
+		for _, p := range batch {
+			var keyID string
+			var sealed []byte
+			if p.keyID == "" {
+				keyID, sealed, err = encryptCardholder(s.keyring, p.id, p.holder)
+			} else {
+				keyID, sealed, err = s.keyring.Rewrap(p.keyID, p.sealed)
+			}
+			if err != nil {
+				return rotated, fmt.Errorf("rotate payment %s: %w", p.id, err)
+			}
+
+			changed, err := s.updateRotated(ctx, `UPDATE payments
+				SET first_name = '', last_name = '', expiry_date = '', key_id = $1, encrypted_cardholder = $2
+				WHERE id = $3 AND key_id = $4`, keyID, sealed, p.id, p.keyID)
+			if err != nil {
+				return rotated, err
+			}
+			rotated += changed
+		}
+	}
+}
+
+// rotateTokenKeys rewraps the tokens that are not wrapped by the primary master key. Tokens without a key ID were
+// encrypted with the keyring's legacy key, before envelope encryption, and are decrypted and sealed again.
+func (s *SQLStore) rotateTokenKeys(ctx context.Context, batchSize int) (int, error) {
+	primary := s.keyring.PrimaryKeyID()
+	rotated := 0
+
+	for {
+		rows, err := s.db.QueryContext(ctx, `SELECT id, key_id, encrypted_card FROM tokens
+			WHERE key_id <> $1 ORDER BY id LIMIT $2`, primary, batchSize)
+		if err != nil {
+			return rotated, err
+		}
+
+		var batch []models.Token
+		for rows.Next() {
+			var token models.Token
+			if err := rows.Scan(&token.ID, &token.KeyID, &token.EncryptedCard); err != nil {
+				rows.Close()
+				return rotated, err
+			}
+			batch = append(batch, token)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return rotated, err
+		}
+
+		if len(batch) == 0 {
+			return rotated, nil
+		}
+
+		for _, token := range batch {
+			var keyID string
+			var sealed []byte
+			if token.KeyID == "" {
+				keyID, sealed, err = s.resealLegacyToken(token)
+			} else {
+				keyID, sealed, err = s.keyring.Rewrap(token.KeyID, token.EncryptedCard)
+			}
+			if err != nil {
+				return rotated, fmt.Errorf("rotate token %s: %w", token.ID, err)
+			}
+
+			changed, err := s.updateRotated(ctx, `UPDATE tokens SET key_id = $1, encrypted_card = $2 WHERE id = $3 AND key_id = $4`,
+				keyID, sealed, token.ID, token.KeyID)
+			if err != nil {
+				return rotated, err
+			}
+			rotated += changed
+		}
+	}
+}
+
+// resealLegacyToken decrypts a token encrypted with the legacy key and seals it with the primary master key. Cards are
+// bound to the ID of their token, as the vault does.
+func (s *SQLStore) resealLegacyToken(token models.Token) (string, []byte, error) {
+	card, err := s.keyring.Open("", token.EncryptedCard, []byte(token.ID))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return s.keyring.Seal(card, []byte(token.ID))
+}
+
+// rotateMerchantKeys encrypts or rewraps the signing secrets that are not encrypted with the primary master key.
+func (s *SQLStore) rotateMerchantKeys(ctx context.Context, batchSize int) (int, error) {
+	primary := s.keyring.PrimaryKeyID()
+	rotated := 0
+
+	for {
+		rows, err := s.db.QueryContext(ctx, `SELECT id, signing_secret, signing_key_id, encrypted_signing_secret FROM merchants
+			WHERE signing_key_id <> $1 AND (signing_key_id <> '' OR signing_secret <> '') ORDER BY id LIMIT $2`,
+			primary, batchSize)
+		if err != nil {
+			return rotated, err
+		}
+
+		type merchant struct {
+			id, secret, keyID string
+			sealed            []byte
+		}
+		var batch []merchant
+		for rows.Next() {
+			var m merchant
+			if err := rows.Scan(&m.id, &m.secret, &m.keyID, &m.sealed); err != nil {
+				rows.Close()
+				return rotated, err
+			}
+			batch = append(batch, m)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return rotated, err
+		}
+
+		if len(batch) == 0 {
+			return rotated, nil
+		}
+
+		for _, m := range batch {
+			var keyID string
+			var sealed []byte
+			if m.keyID == "" {
+				keyID, sealed, err = s.keyring.Seal([]byte(m.secret), []byte(m.id))
+			} else {
+				keyID, sealed, err = s.keyring.Rewrap(m.keyID, m.sealed)
+			}
+			if err != nil {
+				return rotated, fmt.Errorf("rotate merchant %s: %w", m.id, err)
+			}
+
+			changed, err := s.updateRotated(ctx, `UPDATE merchants
+				SET signing_secret = '', signing_key_id = $1, encrypted_signing_secret = $2
+				WHERE id = $3 AND signing_key_id = $4`, keyID, sealed, m.id, m.keyID)
+			if err != nil {
+				return rotated, err
+			}
+			rotated += changed
+		}
+	}
+}
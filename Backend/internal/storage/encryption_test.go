@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/envelope"
+	"github.com/Lionel-Wilson/payment-gateway/internal/vault"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testKeyring returns a keyring holding a master key for each of the given IDs, with primary as its primary key.
+// Keys are derived from their IDs, so keyrings created with the same IDs share keys.
+func testKeyring(t *testing.T, primary string, ids ...string) *envelope.Keyring {
+	keys := make(map[string][]byte, len(ids))
+	for _, id := range ids {
+		keys[id] = bytes.Repeat([]byte(id[len(id)-1:]), envelope.KeySize)
+	}
+
+	keyring, err := envelope.NewKeyring(primary, keys)
+	require.NoError(t, err)
+	return keyring
+}
+
+// storedCardholder returns the key ID and the cardholder columns of a payment as they are stored.
+func storedCardholder(t *testing.T, store *SQLStore, id string) (string, cardholder, []byte) {
+	var keyID string
+	var holder cardholder
+	var encrypted []byte
+
+	err := store.db.QueryRow(`SELECT key_id, first_name, last_name, expiry_date, encrypted_cardholder FROM payments WHERE id = $1`, id).
+		Scan(&keyID, &holder.FirstName, &holder.LastName, &holder.ExpiryDate, &encrypted)
+	require.NoError(t, err)
+
+	return keyID, holder, encrypted
+}
+
+func TestSQLStoreEncryptsCardholderData(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewSQLiteStore(ctx, filepath.Join(t.TempDir(), "payments.db"), WithKeyring(testKeyring(t, "key-1", "key-1")))
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, store.CreatePayment(ctx, testPayment("PAY-1")))
+
+	keyID, holder, encrypted := storedCardholder(t, store, "PAY-1")
+	assert.Equal(t, "key-1", keyID)
+	assert.Equal(t, cardholder{}, holder)
+	assert.NotContains(t, string(encrypted), "Jane")
+
+	payment, err := store.GetPayment(ctx, "PAY-1")
+	require.NoError(t, err)
+	assert.Equal(t, testPayment("PAY-1"), payment)
+
+	// Encrypted payments cannot be read without the keyring
+	_, err = store.db.Exec(`UPDATE payments SET id = 'PAY-2' WHERE id = 'PAY-1'`)
+	require.NoError(t, err)
+	_, err = store.GetPayment(ctx, "PAY-2")
+	assert.ErrorIs(t, err, envelope.ErrDecrypt, "payments are bound to their IDs")
+
+	store.keyring = nil
+	_, err = store.GetPayment(ctx, "PAY-2")
+	assert.ErrorIs(t, err, ErrNoKeyring)
+}
+
+func TestSQLStoreRotateKeys(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "payments.db")
+
+	// PAY-1 is stored before encryption is enabled, and PAY-2 and a token with the first master key
+	store, err := NewSQLiteStore(ctx, path)
+	require.NoError(t, err)
+	require.NoError(t, store.CreatePayment(ctx, testPayment("PAY-1")))
+	require.NoError(t, store.Close())
+
+	store, err = NewSQLiteStore(ctx, path, WithKeyring(testKeyring(t, "key-1", "key-1")))
+	require.NoError(t, err)
+	require.NoError(t, store.CreatePayment(ctx, testPayment("PAY-2")))
+
+	oldKeyring := testKeyring(t, "key-1", "key-1")
+	keyID, sealed, err := oldKeyring.Seal([]byte("card"), []byte("TOK-1"))
+	require.NoError(t, err)
+	require.NoError(t, store.CreateToken(ctx, models.Token{ID: "TOK-1", KeyID: keyID, EncryptedCard: sealed}))
+	require.NoError(t, store.CreateMerchant(ctx, models.Merchant{ID: "MER-1", SigningSecret: "sig_1"}))
+	require.NoError(t, store.Close())
+
+	// The second master key becomes primary, while the first can still be read
+	keyring := testKeyring(t, "key-2", "key-1", "key-2")
+	store, err = NewSQLiteStore(ctx, path, WithKeyring(keyring))
+	require.NoError(t, err)
+	defer store.Close()
+
+	_, err = store.RotateKeys(ctx, 0)
+	assert.Error(t, err, "a batch size of zero would never finish")
+
+	rotated, err := store.RotateKeys(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 4, rotated)
+
+	for _, id := range []string{"PAY-1", "PAY-2"} {
+		keyID, holder, _ := storedCardholder(t, store, id)
+		assert.Equal(t, "key-2", keyID)
+		assert.Equal(t, cardholder{}, holder)
+
+		payment, err := store.GetPayment(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, testPayment(id), payment)
+	}
+
+	token, err := store.GetToken(ctx, "TOK-1")
+	require.NoError(t, err)
+	assert.Equal(t, "key-2", token.KeyID)
+
+	card, err := testKeyring(t, "key-2", "key-2").Open(token.KeyID, token.EncryptedCard, []byte("TOK-1"))
+	require.NoError(t, err, "the first master key is no longer needed")
+	assert.Equal(t, "card", string(card))
+
+	var signingKeyID, plaintext string
+	require.NoError(t, store.db.QueryRowContext(ctx, `SELECT signing_key_id, signing_secret FROM merchants WHERE id = $1`, "MER-1").
+		Scan(&signingKeyID, &plaintext))
+	assert.Equal(t, "key-2", signingKeyID)
+	assert.Empty(t, plaintext)
+
+	merchant, err := store.GetMerchant(ctx, "MER-1")
+	require.NoError(t, err)
+	assert.Equal(t, "sig_1", merchant.SigningSecret)
+
+	// A record rotated concurrently is not counted again
+	changed, err := store.updateRotated(ctx, `UPDATE tokens SET key_id = $1 WHERE id = $2 AND key_id = $3`, "key-2", "TOK-1", "key-1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, changed)
+
+	// Rotating again has nothing to do
+	rotated, err = store.RotateKeys(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 0, rotated)
+}
+
+// sealLegacyCard encrypts a card for a token as the vault did with VAULT_KEY before envelope encryption: directly
+// with AES-256-GCM, behind a random nonce, bound to the token's ID.
+func sealLegacyCard(t *testing.T, key []byte, tokenID string, card vault.Card) []byte {
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+	aead, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+
+	plaintext, err := json.Marshal(card)
+	require.NoError(t, err)
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	require.NoError(t, err)
+
+	return aead.Seal(nonce, nonce, plaintext, []byte(tokenID))
+}
+
+func TestSQLStoreRotateLegacyTokens(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "payments.db")
+	vaultKey := bytes.Repeat([]byte{9}, envelope.KeySize)
+	card := vault.Card{Number: "4111111111111111", ExpiryDate: "12/29", FirstName: "John", LastName: "Doe"}
+
+	// TOK-1 was tokenized with VAULT_KEY, before the keyring existed
+	store, err := NewSQLiteStore(ctx, path)
+	require.NoError(t, err)
+	require.NoError(t, store.CreateToken(ctx, models.Token{ID: "TOK-1", EncryptedCard: sealLegacyCard(t, vaultKey, "TOK-1", card)}))
+	require.NoError(t, store.Close())
+
+	withoutLegacyKey := testKeyring(t, "key-1", "key-1")
+	store, err = NewSQLiteStore(ctx, path, WithKeyring(withoutLegacyKey))
+	require.NoError(t, err)
+	defer store.Close()
+
+	_, err = store.RotateKeys(ctx, 1)
+	assert.ErrorIs(t, err, envelope.ErrUnknownKey, "legacy tokens cannot be rotated without VAULT_KEY")
+
+	// With VAULT_KEY as the legacy key, the token can be charged before and after it is rotated
+	keyring := testKeyring(t, "key-1", "key-1")
+	require.NoError(t, keyring.SetLegacyKey(vaultKey))
+	store.keyring = keyring
+
+	token, err := store.GetToken(ctx, "TOK-1")
+	require.NoError(t, err)
+	assert.Empty(t, token.KeyID)
+	opened, err := vault.New(keyring).Open(token.ID, token.KeyID, token.EncryptedCard)
+	require.NoError(t, err)
+	assert.Equal(t, card, opened)
+
+	rotated, err := store.RotateKeys(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, rotated)
+
+	token, err = store.GetToken(ctx, "TOK-1")
+	require.NoError(t, err)
+	assert.Equal(t, "key-1", token.KeyID)
+	opened, err = vault.New(withoutLegacyKey).Open(token.ID, token.KeyID, token.EncryptedCard)
+	require.NoError(t, err, "VAULT_KEY is no longer needed")
+	assert.Equal(t, card, opened)
+
+	rotated, err = store.RotateKeys(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 0, rotated)
+}
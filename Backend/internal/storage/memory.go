@@ -0,0 +1,749 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/ratelimit"
+	"github.com/Lionel-Wilson/payment-gateway/internal/rbac"
+)
+
+// MemoryStore is an in-memory Store. Its contents are lost when the process exits,
+// which makes it suitable for local development and tests.
+type MemoryStore struct {
+	mu             sync.RWMutex                     // Guards the fields below
+	payments       map[string]models.PaymentDetails // Payments keyed by their ID
+	order          []string                         // Payment IDs in creation order
+	refunds        map[string]models.Refund         // Refunds keyed by their ID
+	paymentRefunds map[string][]string              // Refund IDs in creation order, keyed by payment ID
+	idempotency    map[string]IdempotencyRecord     // Idempotency records keyed by their key
+	tokens         map[string]models.Token          // Vault tokens keyed by their ID
+	merchants      map[string]models.Merchant       // Merchants keyed by their ID
+	apiKeys        map[string]models.APIKey         // API keys keyed by their ID
+	apiKeyOrder    []string                         // API key IDs in creation order
+	apiKeyHashes   map[string]string                // API key IDs keyed by the key's hash
+	oauthClients   map[string]models.OAuthClient    // OAuth clients keyed by their ID
+	users          map[string]models.User           // Dashboard users keyed by their ID
+	userOrder      []string                         // User IDs in creation order
+	userEmails     map[string]string                // User IDs keyed by their email address
+	sessions       map[string]models.Session        // Dashboard sessions keyed by their ID
+	rateLimits     map[string]rateLimitBucket       // Rate limit token buckets keyed by their key
+	nonces         map[string]time.Time             // When each nonce of a signed request expires
+}
+
+// rateLimitBucket is the state of a rate limit token bucket when it was last used.
+type rateLimitBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		payments:       make(map[string]models.PaymentDetails),
+		refunds:        make(map[string]models.Refund),
+		paymentRefunds: make(map[string][]string),
+		idempotency:    make(map[string]IdempotencyRecord),
+		tokens:         make(map[string]models.Token),
+		merchants:      make(map[string]models.Merchant),
+		apiKeys:        make(map[string]models.APIKey),
+		apiKeyHashes:   make(map[string]string),
+		oauthClients:   make(map[string]models.OAuthClient),
+		users:          make(map[string]models.User),
+		userEmails:     make(map[string]string),
+		sessions:       make(map[string]models.Session),
+		rateLimits:     make(map[string]rateLimitBucket),
+		nonces:         make(map[string]time.Time),
+	}
+}
+
+// CreatePayment stores a new payment.
+func (s *MemoryStore) CreatePayment(ctx context.Context, payment models.PaymentDetails) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.payments[payment.ID]; exists {
+		return ErrDuplicate
+	}
+
+	s.payments[payment.ID] = payment
+	s.order = append(s.order, payment.ID)
+
+	return nil
+}
+
+// GetPayment returns the payment with the given ID.
+func (s *MemoryStore) GetPayment(ctx context.Context, id string) (models.PaymentDetails, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	payment, exists := s.payments[id]
+	if !exists {
+		return models.PaymentDetails{}, ErrNotFound
+	}
+
+	return payment, nil
+}
+
+// ListPayments returns the payments of the given merchant in creation order.
+func (s *MemoryStore) ListPayments(ctx context.Context, merchantID string) ([]models.PaymentDetails, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	paymentsList := []models.PaymentDetails{}
+	for _, id := range s.order {
+		if payment := s.payments[id]; payment.MerchantID == merchantID {
+			paymentsList = append(paymentsList, payment)
+		}
+	}
+
+	return paymentsList, nil
+}
+
+// ListAuthorizationsExpiringBefore returns the payments with the given status whose authorization expires before the given time.
+func (s *MemoryStore) ListAuthorizationsExpiringBefore(ctx context.Context, status models.PaymentStatus, before time.Time) ([]models.PaymentDetails, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	paymentsList := []models.PaymentDetails{}
+	for _, id := range s.order {
+		payment := s.payments[id]
+		if payment.Status == status && payment.AuthorizationExpiresAt != nil && payment.AuthorizationExpiresAt.Before(before) {
+			paymentsList = append(paymentsList, payment)
+		}
+	}
+
+	return paymentsList, nil
+}
+
+// ListCapturesStartedBefore returns the payments with the given status whose capture started before the given time.
+func (s *MemoryStore) ListCapturesStartedBefore(ctx context.Context, status models.PaymentStatus, before time.Time) ([]models.PaymentDetails, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	paymentsList := []models.PaymentDetails{}
+	for _, id := range s.order {
+		payment := s.payments[id]
+		if payment.Status == status && payment.CaptureStartedAt != nil && payment.CaptureStartedAt.Before(before) {
+			paymentsList = append(paymentsList, payment)
+		}
+	}
+
+	return paymentsList, nil
+}
+
+// UpdatePayment saves the mutable fields of an existing payment if its version has not changed.
+func (s *MemoryStore) UpdatePayment(ctx context.Context, payment models.PaymentDetails) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, exists := s.payments[payment.ID]
+	if !exists {
+		return ErrNotFound
+	}
+	if stored.Version != payment.Version {
+		return ErrConflict
+	}
+
+	stored.Status = payment.Status
+	stored.StatusCode = payment.StatusCode
+	stored.BankReference = payment.BankReference
+	stored.CapturedAmount = payment.CapturedAmount
+	stored.RefundedAmount = payment.RefundedAmount
+	stored.AuthorizationExpiresAt = payment.AuthorizationExpiresAt
+	stored.CaptureStartedAt = payment.CaptureStartedAt
+	stored.ResponseSummary = payment.ResponseSummary
+	stored.Version++
+	s.payments[payment.ID] = stored
+
+	return nil
+}
+
+// CreateRefund stores a new refund.
+func (s *MemoryStore) CreateRefund(ctx context.Context, refund models.Refund) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.refunds[refund.ID]; exists {
+		return ErrDuplicate
+	}
+	if _, exists := s.payments[refund.PaymentID]; !exists {
+		return ErrNotFound
+	}
+
+	s.refunds[refund.ID] = refund
+	s.paymentRefunds[refund.PaymentID] = append(s.paymentRefunds[refund.PaymentID], refund.ID)
+
+	return nil
+}
+
+// GetRefund returns the refund with the given ID.
+func (s *MemoryStore) GetRefund(ctx context.Context, id string) (models.Refund, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	refund, exists := s.refunds[id]
+	if !exists {
+		return models.Refund{}, ErrNotFound
+	}
+
+	return refund, nil
+}
+
+// ListRefunds returns the refunds of the given payment in creation order.
+func (s *MemoryStore) ListRefunds(ctx context.Context, paymentID string) ([]models.Refund, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	refundsList := []models.Refund{}
+	for _, id := range s.paymentRefunds[paymentID] {
+		refundsList = append(refundsList, s.refunds[id])
+	}
+
+	return refundsList, nil
+}
+
+// ListRefundsCreatedBefore returns the refunds with the given status that were created before the given time.
+func (s *MemoryStore) ListRefundsCreatedBefore(ctx context.Context, status models.RefundStatus, before time.Time) ([]models.Refund, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	refundsList := []models.Refund{}
+	for _, paymentID := range s.order {
+		for _, id := range s.paymentRefunds[paymentID] {
+			refund := s.refunds[id]
+			if refund.Status == status && refund.CreatedAt.Before(before) {
+				refundsList = append(refundsList, refund)
+			}
+		}
+	}
+
+	return refundsList, nil
+}
+
+// UpdateRefund saves the mutable fields of an existing refund.
+func (s *MemoryStore) UpdateRefund(ctx context.Context, refund models.Refund) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, exists := s.refunds[refund.ID]
+	if !exists {
+		return ErrNotFound
+	}
+
+	stored.Status = refund.Status
+	stored.StatusCode = refund.StatusCode
+	stored.ResponseSummary = refund.ResponseSummary
+	stored.BankReference = refund.BankReference
+	s.refunds[refund.ID] = stored
+
+	return nil
+}
+
+// ReserveIdempotencyKey stores an incomplete record unless an unexpired one already exists for the key.
+func (s *MemoryStore) ReserveIdempotencyKey(ctx context.Context, record IdempotencyRecord, now time.Time) (IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, exists := s.idempotency[record.Key]; exists && existing.ExpiresAt.After(now) {
+		return existing, false, nil
+	}
+
+	record.Completed = false
+	s.idempotency[record.Key] = record
+
+	return record, true, nil
+}
+
+// CompleteIdempotencyKey records the response sent to the request made with the given key.
+func (s *MemoryStore) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, exists := s.idempotency[key]
+	if !exists {
+		return ErrNotFound
+	}
+
+	record.Completed = true
+	record.StatusCode = statusCode
+	record.ContentType = contentType
+	record.Body = append([]byte(nil), body...)
+	s.idempotency[key] = record
+
+	return nil
+}
+
+// ReleaseIdempotencyKey deletes the record for the given key.
+func (s *MemoryStore) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.idempotency, key)
+
+	return nil
+}
+
+// DeleteIdempotencyKeysExpiredBefore deletes every record that expired before the given time.
+func (s *MemoryStore) DeleteIdempotencyKeysExpiredBefore(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for key, record := range s.idempotency {
+		if record.ExpiresAt.Before(before) {
+			delete(s.idempotency, key)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// CreateToken stores a new token.
+func (s *MemoryStore) CreateToken(ctx context.Context, token models.Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.tokens[token.ID]; exists {
+		return ErrDuplicate
+	}
+
+	s.tokens[token.ID] = token
+
+	return nil
+}
+
+// GetToken returns the token with the given ID.
+func (s *MemoryStore) GetToken(ctx context.Context, id string) (models.Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	token, exists := s.tokens[id]
+	if !exists {
+		return models.Token{}, ErrNotFound
+	}
+
+	return token, nil
+}
+
+// RevokeToken marks the token with the given ID as revoked, unless it already is.
+func (s *MemoryStore) RevokeToken(ctx context.Context, id string, revokedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, exists := s.tokens[id]
+	if !exists {
+		return ErrNotFound
+	}
+
+	if token.RevokedAt == nil {
+		revokedAt = revokedAt.UTC()
+		token.RevokedAt = &revokedAt
+		s.tokens[id] = token
+	}
+
+	return nil
+}
+
+// CreateMerchant stores a new merchant.
+func (s *MemoryStore) CreateMerchant(ctx context.Context, merchant models.Merchant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.merchants[merchant.ID]; exists {
+		return ErrDuplicate
+	}
+
+	s.merchants[merchant.ID] = merchant
+
+	return nil
+}
+
+// GetMerchant returns the merchant with the given ID.
+func (s *MemoryStore) GetMerchant(ctx context.Context, id string) (models.Merchant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	merchant, exists := s.merchants[id]
+	if !exists {
+		return models.Merchant{}, ErrNotFound
+	}
+
+	return merchant, nil
+}
+
+// SetSigningSecret replaces the signing secret of the merchant with the given ID.
+func (s *MemoryStore) SetSigningSecret(ctx context.Context, id string, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	merchant, exists := s.merchants[id]
+	if !exists {
+		return ErrNotFound
+	}
+
+	merchant.SigningSecret = secret
+	s.merchants[id] = merchant
+
+	return nil
+}
+
+// CreateAPIKey stores a new API key.
+func (s *MemoryStore) CreateAPIKey(ctx context.Context, key models.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, idExists := s.apiKeys[key.ID]
+	_, hashExists := s.apiKeyHashes[key.Hash]
+	if idExists || hashExists {
+		return ErrDuplicate
+	}
+
+	key.Key = ""
+	s.apiKeys[key.ID] = key
+	s.apiKeyOrder = append(s.apiKeyOrder, key.ID)
+	s.apiKeyHashes[key.Hash] = key.ID
+
+	return nil
+}
+
+// GetAPIKey returns the API key with the given ID.
+func (s *MemoryStore) GetAPIKey(ctx context.Context, id string) (models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, exists := s.apiKeys[id]
+	if !exists {
+		return models.APIKey{}, ErrNotFound
+	}
+
+	return key, nil
+}
+
+// GetAPIKeyByHash returns the API key with the given hash.
+func (s *MemoryStore) GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, exists := s.apiKeyHashes[hash]
+	if !exists {
+		return models.APIKey{}, ErrNotFound
+	}
+
+	return s.apiKeys[id], nil
+}
+
+// ListAPIKeys returns the API keys of the given merchant in creation order.
+func (s *MemoryStore) ListAPIKeys(ctx context.Context, merchantID string) ([]models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := []models.APIKey{}
+	for _, id := range s.apiKeyOrder {
+		if key := s.apiKeys[id]; key.MerchantID == merchantID {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+// ExpireAPIKey makes the API key with the given ID stop working at the given time, unless it already expires sooner.
+func (s *MemoryStore) ExpireAPIKey(ctx context.Context, id string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, exists := s.apiKeys[id]
+	if !exists {
+		return ErrNotFound
+	}
+
+	if key.ExpiresAt == nil || expiresAt.Before(*key.ExpiresAt) {
+		expiresAt = expiresAt.UTC()
+		key.ExpiresAt = &expiresAt
+		s.apiKeys[id] = key
+	}
+
+	return nil
+}
+
+// RevokeAPIKey marks the API key with the given ID as revoked, unless it already is.
+func (s *MemoryStore) RevokeAPIKey(ctx context.Context, id string, revokedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, exists := s.apiKeys[id]
+	if !exists {
+		return ErrNotFound
+	}
+
+	if key.RevokedAt == nil {
+		revokedAt = revokedAt.UTC()
+		key.RevokedAt = &revokedAt
+		s.apiKeys[id] = key
+	}
+
+	return nil
+}
+
+// CreateOAuthClient stores a new OAuth client.
+func (s *MemoryStore) CreateOAuthClient(ctx context.Context, client models.OAuthClient) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.oauthClients[client.ID]; exists {
+		return ErrDuplicate
+	}
+
+	s.oauthClients[client.ID] = client
+
+	return nil
+}
+
+// GetOAuthClient returns the OAuth client with the given ID.
+func (s *MemoryStore) GetOAuthClient(ctx context.Context, id string) (models.OAuthClient, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	client, exists := s.oauthClients[id]
+	if !exists {
+		return models.OAuthClient{}, ErrNotFound
+	}
+
+	return client, nil
+}
+
+// RevokeOAuthClient marks the OAuth client with the given ID as revoked, unless it already is.
+func (s *MemoryStore) RevokeOAuthClient(ctx context.Context, id string, revokedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, exists := s.oauthClients[id]
+	if !exists {
+		return ErrNotFound
+	}
+
+	if client.RevokedAt == nil {
+		revokedAt = revokedAt.UTC()
+		client.RevokedAt = &revokedAt
+		s.oauthClients[id] = client
+	}
+
+	return nil
+}
+
+// CreateUser stores a new user.
+func (s *MemoryStore) CreateUser(ctx context.Context, user models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, idExists := s.users[user.ID]
+	_, emailExists := s.userEmails[user.Email]
+	if idExists || emailExists {
+		return ErrDuplicate
+	}
+
+	s.users[user.ID] = user
+	s.userOrder = append(s.userOrder, user.ID)
+	s.userEmails[user.Email] = user.ID
+
+	return nil
+}
+
+// GetUser returns the user with the given ID.
+func (s *MemoryStore) GetUser(ctx context.Context, id string) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, exists := s.users[id]
+	if !exists {
+		return models.User{}, ErrNotFound
+	}
+
+	return user, nil
+}
+
+// GetUserByEmail returns the user with the given email address.
+func (s *MemoryStore) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, exists := s.userEmails[email]
+	if !exists {
+		return models.User{}, ErrNotFound
+	}
+
+	return s.users[id], nil
+}
+
+// ListUsers returns the users of the given merchant in the order they were created.
+func (s *MemoryStore) ListUsers(ctx context.Context, merchantID string) ([]models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := []models.User{}
+	for _, id := range s.userOrder {
+		if user := s.users[id]; user.MerchantID == merchantID {
+			users = append(users, user)
+		}
+	}
+
+	return users, nil
+}
+
+// UpdateUserRole changes the role of the user with the given ID.
+func (s *MemoryStore) UpdateUserRole(ctx context.Context, id string, role rbac.Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.users[id]
+	if !exists {
+		return ErrNotFound
+	}
+
+	user.Role = role
+	s.users[id] = user
+
+	return nil
+}
+
+// DisableUser marks the user with the given ID as disabled, unless they already are.
+func (s *MemoryStore) DisableUser(ctx context.Context, id string, disabledAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.users[id]
+	if !exists {
+		return ErrNotFound
+	}
+
+	if user.DisabledAt == nil {
+		disabledAt = disabledAt.UTC()
+		user.DisabledAt = &disabledAt
+		s.users[id] = user
+	}
+
+	return nil
+}
+
+// CreateSession stores a new session.
+func (s *MemoryStore) CreateSession(ctx context.Context, session models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.sessions[session.ID]; exists {
+		return ErrDuplicate
+	}
+
+	session.Token, session.User = "", nil
+	s.sessions[session.ID] = session
+
+	return nil
+}
+
+// GetSession returns the session with the given ID.
+func (s *MemoryStore) GetSession(ctx context.Context, id string) (models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, exists := s.sessions[id]
+	if !exists {
+		return models.Session{}, ErrNotFound
+	}
+
+	return session, nil
+}
+
+// DeleteSession deletes the session with the given ID.
+func (s *MemoryStore) DeleteSession(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.sessions[id]; !exists {
+		return ErrNotFound
+	}
+
+	delete(s.sessions, id)
+
+	return nil
+}
+
+// DeleteSessionsExpiredBefore deletes every session that expired before the given time.
+func (s *MemoryStore) DeleteSessionsExpiredBefore(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for id, session := range s.sessions {
+		if session.ExpiresAt.Before(before) {
+			delete(s.sessions, id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// TakeRateLimitToken takes a token from the bucket with the given key.
+func (s *MemoryStore) TakeRateLimitToken(ctx context.Context, key string, limit ratelimit.Limit, now time.Time) (ratelimit.Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, exists := s.rateLimits[key]
+	if !exists {
+		bucket = rateLimitBucket{tokens: float64(limit.Requests), updatedAt: now}
+	}
+
+	tokens, result := limit.Take(bucket.tokens, now.Sub(bucket.updatedAt))
+	s.rateLimits[key] = rateLimitBucket{tokens: tokens, updatedAt: now}
+
+	return result, nil
+}
+
+// DeleteRateLimitBucketsUsedBefore deletes every bucket last used before the given time.
+func (s *MemoryStore) DeleteRateLimitBucketsUsedBefore(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for key, bucket := range s.rateLimits {
+		if bucket.updatedAt.Before(before) {
+			delete(s.rateLimits, key)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// AddNonce records a nonce until expiresAt, and reports whether it was new.
+func (s *MemoryStore) AddNonce(ctx context.Context, nonce string, now, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if expires, exists := s.nonces[nonce]; exists && now.Before(expires) {
+		return false, nil
+	}
+
+	s.nonces[nonce] = expiresAt
+	return true, nil
+}
+
+// DeleteNoncesExpiredBefore deletes every nonce that expired before the given time.
+func (s *MemoryStore) DeleteNoncesExpiredBefore(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for nonce, expiresAt := range s.nonces {
+		if expiresAt.Before(before) {
+			delete(s.nonces, nonce)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
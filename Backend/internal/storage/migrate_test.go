@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/money"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	tests := []struct {
+		name             string
+		files            fstest.MapFS
+		expectedVersions []int
+		expectError      bool
+	}{
+		{
+			name: "Sorted By Version",
+			files: fstest.MapFS{
+				"m/0002_add_index.sql":       {Data: []byte("CREATE INDEX")},
+				"m/0001_create_payments.sql": {Data: []byte("CREATE TABLE")},
+				"m/README.md":                {Data: []byte("ignored")},
+			},
+			expectedVersions: []int{1, 2},
+		},
+		{
+			name: "Invalid Version Prefix",
+			files: fstest.MapFS{
+				"m/first_create_payments.sql": {Data: []byte("CREATE TABLE")},
+			},
+			expectError: true,
+		},
+		{
+			name: "Duplicate Version",
+			files: fstest.MapFS{
+				"m/0001_create_payments.sql": {Data: []byte("CREATE TABLE")},
+				"m/0001_create_refunds.sql":  {Data: []byte("CREATE TABLE")},
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := loadMigrations(tt.files, "m")
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			var versions []int
+			for _, m := range migrations {
+				versions = append(versions, m.version)
+			}
+			assert.Equal(t, tt.expectedVersions, versions)
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	for _, d := range []dialect{postgresDialect, sqliteDialect} {
+		migrations, err := loadMigrations(d.migrations, d.migrationsDir)
+		assert.NoError(t, err, d.name)
+		assert.NotEmpty(t, migrations, d.name)
+	}
+}
+
+func TestMigrateLegacyPayments(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "payments.db")
+
+	// Create a database holding decimal amounts, as stored before amounts were kept in minor units
+	migrations, err := loadMigrations(sqliteDialect.migrations, sqliteDialect.migrationsDir)
+	require.NoError(t, err)
+	var legacy []migration
+	for _, m := range migrations {
+		if m.version < 7 {
+			legacy = append(legacy, m)
+		}
+	}
+
+	db, err := sql.Open(sqliteDialect.driver, path)
+	require.NoError(t, err)
+	require.NoError(t, migrate(ctx, db, sqliteDialect, legacy))
+
+	for _, payment := range []struct {
+		id       string
+		amount   float64
+		currency string
+	}{
+		{"PAY-GBP", 200.5, "GBP"},
+		{"PAY-JPY", 1050, "JPY"},
+		{"PAY-KWD", 1.234, "kwd"},
+		{"PAY-USD", 0.29, "USD"},
+	} {
+		_, err := db.ExecContext(ctx, `INSERT INTO payments (id, first_name, last_name, card_number, expiry_date, amount,
+			currency_code, status, status_code, captured_amount, refunded_amount)
+			VALUES ($1, 'Jane', 'Doe', '************1111', '12/29', $2, $3, 'payment_paid', 10000, $2, 0)`,
+			payment.id, payment.amount, payment.currency)
+		require.NoError(t, err)
+	}
+	_, err = db.ExecContext(ctx, `INSERT INTO refunds (id, payment_id, amount, currency_code, status, status_code, created_at)
+		VALUES ('REF-1', 'PAY-GBP', 50.25, 'GBP', 'refund_succeeded', 10000, '2024-07-01 12:00:00')`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	store, err := NewSQLiteStore(ctx, path)
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	for id, expected := range map[string]money.Money{
+		"PAY-GBP": money.New(20050, "GBP"),
+		"PAY-JPY": money.New(1050, "JPY"),
+		"PAY-KWD": money.New(1234, "KWD"),
+		"PAY-USD": money.New(29, "USD"),
+	} {
+		payment, err := store.GetPayment(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, expected, payment.Amount, id)
+		assert.Equal(t, expected, payment.CapturedAmount, id)
+		assert.True(t, payment.RefundedAmount.IsZero(), id)
+		assert.Equal(t, "1111", payment.CardLast4, id)
+	}
+
+	refund, err := store.GetRefund(ctx, "REF-1")
+	require.NoError(t, err)
+	assert.Equal(t, money.New(5025, "GBP"), refund.Amount)
+}
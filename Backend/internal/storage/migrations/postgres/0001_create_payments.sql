@@ -0,0 +1,15 @@
+CREATE TABLE payments (
+    id            TEXT PRIMARY KEY,
+    first_name    TEXT             NOT NULL,
+    last_name     TEXT             NOT NULL,
+    card_number   TEXT             NOT NULL,
+    expiry_date   TEXT             NOT NULL,
+    amount        DOUBLE PRECISION NOT NULL,
+    currency_code CHAR(3)          NOT NULL,
+    status        TEXT             NOT NULL,
+    status_code   INTEGER          NOT NULL,
+    created_at    TIMESTAMPTZ      NOT NULL DEFAULT now(),
+    updated_at    TIMESTAMPTZ      NOT NULL DEFAULT now()
+);
+
+CREATE INDEX payments_created_at_idx ON payments (created_at, id);
@@ -0,0 +1,7 @@
+ALTER TABLE payments ADD COLUMN captured_amount DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE payments ADD COLUMN authorization_expires_at TIMESTAMPTZ;
+
+CREATE INDEX payments_authorization_expires_at_idx ON payments (status, authorization_expires_at);
+
+-- Payments made before authorizations existed were captured in full.
+UPDATE payments SET captured_amount = amount WHERE status = 'payment_paid';
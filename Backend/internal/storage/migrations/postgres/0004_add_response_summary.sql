@@ -0,0 +1 @@
+ALTER TABLE payments ADD COLUMN response_summary TEXT NOT NULL DEFAULT '';
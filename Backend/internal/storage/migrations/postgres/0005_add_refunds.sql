@@ -0,0 +1,18 @@
+ALTER TABLE payments ADD COLUMN refunded_amount DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE payments ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE refunds (
+    id               TEXT PRIMARY KEY,
+    payment_id       TEXT             NOT NULL REFERENCES payments (id),
+    amount           DOUBLE PRECISION NOT NULL,
+    currency_code    CHAR(3)          NOT NULL,
+    status           TEXT             NOT NULL,
+    status_code      INTEGER          NOT NULL,
+    response_summary TEXT             NOT NULL DEFAULT '',
+    reason           TEXT             NOT NULL DEFAULT '',
+    bank_reference   TEXT             NOT NULL DEFAULT '',
+    created_at       TIMESTAMPTZ      NOT NULL DEFAULT now(),
+    updated_at       TIMESTAMPTZ      NOT NULL DEFAULT now()
+);
+
+CREATE INDEX refunds_payment_id_idx ON refunds (payment_id, created_at, id);
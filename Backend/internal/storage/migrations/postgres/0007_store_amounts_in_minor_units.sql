@@ -0,0 +1,38 @@
+-- Amounts are stored as whole numbers of the currency's minor units, e.g. pence for GBP and yen for JPY, so that
+-- they are exact. Existing decimal amounts are converted using the exponent of their ISO 4217 currency, which is 2
+-- unless listed below.
+CREATE TEMPORARY TABLE minor_unit_factors (
+    currency_code TEXT PRIMARY KEY,
+    factor        BIGINT NOT NULL
+);
+
+INSERT INTO minor_unit_factors (currency_code, factor) VALUES
+    ('BIF', 1), ('CLP', 1), ('DJF', 1), ('GNF', 1), ('ISK', 1), ('JPY', 1), ('KMF', 1), ('KRW', 1), ('PYG', 1),
+    ('RWF', 1), ('UGX', 1), ('UYI', 1), ('VND', 1), ('VUV', 1), ('XAF', 1), ('XOF', 1), ('XPF', 1),
+    ('BHD', 1000), ('IQD', 1000), ('JOD', 1000), ('KWD', 1000), ('LYD', 1000), ('OMR', 1000), ('TND', 1000),
+    ('CLF', 10000), ('UYW', 10000);
+
+ALTER TABLE payments ADD COLUMN amount_minor BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE payments ADD COLUMN captured_amount_minor BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE payments ADD COLUMN refunded_amount_minor BIGINT NOT NULL DEFAULT 0;
+
+UPDATE payments SET
+    amount_minor          = CAST(ROUND(amount * COALESCE((SELECT factor FROM minor_unit_factors WHERE currency_code = UPPER(payments.currency_code)), 100)) AS BIGINT),
+    captured_amount_minor = CAST(ROUND(captured_amount * COALESCE((SELECT factor FROM minor_unit_factors WHERE currency_code = UPPER(payments.currency_code)), 100)) AS BIGINT),
+    refunded_amount_minor = CAST(ROUND(refunded_amount * COALESCE((SELECT factor FROM minor_unit_factors WHERE currency_code = UPPER(payments.currency_code)), 100)) AS BIGINT);
+
+ALTER TABLE payments DROP COLUMN amount;
+ALTER TABLE payments DROP COLUMN captured_amount;
+ALTER TABLE payments DROP COLUMN refunded_amount;
+ALTER TABLE payments RENAME COLUMN amount_minor TO amount;
+ALTER TABLE payments RENAME COLUMN captured_amount_minor TO captured_amount;
+ALTER TABLE payments RENAME COLUMN refunded_amount_minor TO refunded_amount;
+
+ALTER TABLE refunds ADD COLUMN amount_minor BIGINT NOT NULL DEFAULT 0;
+
+UPDATE refunds SET amount_minor = CAST(ROUND(amount * COALESCE((SELECT factor FROM minor_unit_factors WHERE currency_code = UPPER(refunds.currency_code)), 100)) AS BIGINT);
+
+ALTER TABLE refunds DROP COLUMN amount;
+ALTER TABLE refunds RENAME COLUMN amount_minor TO amount;
+
+DROP TABLE minor_unit_factors;
@@ -0,0 +1,9 @@
+CREATE TABLE tokens (
+    id             TEXT PRIMARY KEY,
+    merchant_id    TEXT        NOT NULL DEFAULT '',
+    card_brand     TEXT        NOT NULL DEFAULT '',
+    card_last4     TEXT        NOT NULL DEFAULT '',
+    encrypted_card BYTEA       NOT NULL,
+    created_at     TIMESTAMPTZ NOT NULL,
+    revoked_at     TIMESTAMPTZ
+);
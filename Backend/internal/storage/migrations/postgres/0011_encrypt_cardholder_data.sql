@@ -0,0 +1,8 @@
+-- Cardholder data is encrypted with envelope encryption. key_id is the ID of the master key that wraps a record's
+-- data encryption key, and is empty for records stored before encryption was enabled.
+ALTER TABLE payments ADD COLUMN key_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN encrypted_cardholder BYTEA;
+ALTER TABLE tokens ADD COLUMN key_id TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX payments_key_id_idx ON payments (key_id);
+CREATE INDEX tokens_key_id_idx ON tokens (key_id);
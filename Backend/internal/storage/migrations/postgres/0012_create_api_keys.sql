@@ -0,0 +1,14 @@
+-- API keys are stored by the SHA-256 hash of the key, which is only shown to the merchant when it is created.
+CREATE TABLE api_keys (
+    id          TEXT PRIMARY KEY,
+    merchant_id TEXT        NOT NULL,
+    kind        TEXT        NOT NULL,
+    mode        TEXT        NOT NULL,
+    last4       TEXT        NOT NULL,
+    hash        TEXT        NOT NULL UNIQUE,
+    created_at  TIMESTAMPTZ NOT NULL,
+    expires_at  TIMESTAMPTZ,
+    revoked_at  TIMESTAMPTZ
+);
+
+CREATE INDEX api_keys_merchant_id_idx ON api_keys (merchant_id, created_at, id);
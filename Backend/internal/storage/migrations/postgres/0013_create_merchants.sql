@@ -0,0 +1,12 @@
+-- Payments, refunds, tokens and API keys belong to merchants. Payments and refunds made before merchants existed
+-- have no merchant, so no merchant can see them.
+CREATE TABLE merchants (
+    id         TEXT PRIMARY KEY,
+    name       TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+ALTER TABLE payments ADD COLUMN merchant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE refunds ADD COLUMN merchant_id TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX payments_merchant_id_idx ON payments (merchant_id, created_at, id);
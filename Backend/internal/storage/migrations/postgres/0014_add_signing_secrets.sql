@@ -0,0 +1,5 @@
+-- Merchants can sign their requests with a signing secret, which is encrypted like cardholder data when the store
+-- has a keyring.
+ALTER TABLE merchants ADD COLUMN signing_secret TEXT NOT NULL DEFAULT '';
+ALTER TABLE merchants ADD COLUMN signing_key_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE merchants ADD COLUMN encrypted_signing_secret BYTEA;
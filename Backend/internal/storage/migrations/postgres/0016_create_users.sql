@@ -0,0 +1,24 @@
+-- Dashboard users log in with their email address, which is unique across merchants, and a bcrypt-hashed password.
+-- Sessions are stored by the SHA-256 hash of their token, which is only shown to the user when they log in.
+CREATE TABLE users (
+    id            TEXT PRIMARY KEY,
+    merchant_id   TEXT        NOT NULL,
+    email         TEXT        NOT NULL UNIQUE,
+    name          TEXT        NOT NULL,
+    role          TEXT        NOT NULL,
+    password_hash TEXT        NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL,
+    disabled_at   TIMESTAMPTZ
+);
+
+CREATE INDEX users_merchant_id_idx ON users (merchant_id, created_at, id);
+
+CREATE TABLE sessions (
+    id          TEXT PRIMARY KEY,
+    user_id     TEXT        NOT NULL,
+    merchant_id TEXT        NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL,
+    expires_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX sessions_expires_at_idx ON sessions (expires_at);
@@ -0,0 +1,4 @@
+-- Captures whose outcome is unknown leave their payment capturing until they are reconciled with the bank
+ALTER TABLE payments ADD COLUMN capture_started_at TIMESTAMPTZ;
+
+CREATE INDEX payments_capture_started_at_idx ON payments (status, capture_started_at);
@@ -0,0 +1,8 @@
+-- Nonces of signed requests shared by every gateway instance when they are kept in the database, so that a signed
+-- request cannot be replayed against another instance. A nonce is remembered until its signature expires.
+CREATE TABLE request_nonces (
+    nonce      TEXT PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX request_nonces_expires_at_idx ON request_nonces (expires_at);
@@ -0,0 +1 @@
+ALTER TABLE payments ADD COLUMN bank_reference TEXT NOT NULL DEFAULT '';
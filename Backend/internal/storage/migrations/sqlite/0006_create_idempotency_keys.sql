@@ -0,0 +1,12 @@
+CREATE TABLE idempotency_keys (
+    idempotency_key TEXT PRIMARY KEY,
+    fingerprint     TEXT      NOT NULL,
+    completed       INTEGER   NOT NULL DEFAULT 0,
+    status_code     INTEGER   NOT NULL DEFAULT 0,
+    content_type    TEXT      NOT NULL DEFAULT '',
+    body            BLOB,
+    expires_at      TIMESTAMP NOT NULL,
+    created_at      TEXT      NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
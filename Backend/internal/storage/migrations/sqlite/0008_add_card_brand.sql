@@ -0,0 +1,6 @@
+ALTER TABLE payments ADD COLUMN card_brand TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN card_last4 TEXT NOT NULL DEFAULT '';
+
+-- Only the masked card number is stored, so the brand of existing payments is unknown, but their last four digits
+-- are still visible.
+UPDATE payments SET card_last4 = SUBSTR(card_number, -4);
@@ -0,0 +1,5 @@
+-- The issuer of a card is looked up from its BIN when a payment is made. It is unknown for existing payments.
+ALTER TABLE payments ADD COLUMN card_issuer TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN card_country TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN card_funding TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN card_product TEXT NOT NULL DEFAULT '';
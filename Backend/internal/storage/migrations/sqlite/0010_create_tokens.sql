@@ -0,0 +1,9 @@
+CREATE TABLE tokens (
+    id             TEXT PRIMARY KEY,
+    merchant_id    TEXT      NOT NULL DEFAULT '',
+    card_brand     TEXT      NOT NULL DEFAULT '',
+    card_last4     TEXT      NOT NULL DEFAULT '',
+    encrypted_card BLOB      NOT NULL,
+    created_at     TIMESTAMP NOT NULL,
+    revoked_at     TIMESTAMP
+);
@@ -0,0 +1,11 @@
+-- OAuth clients are stored by the SHA-256 hash of their secret, which is only shown when the client is created.
+-- Scopes and merchant IDs are space-separated lists.
+CREATE TABLE oauth_clients (
+    id           TEXT PRIMARY KEY,
+    name         TEXT        NOT NULL,
+    secret_hash  TEXT        NOT NULL,
+    scopes       TEXT        NOT NULL,
+    merchant_ids TEXT        NOT NULL,
+    created_at   TIMESTAMP   NOT NULL,
+    revoked_at   TIMESTAMP
+);
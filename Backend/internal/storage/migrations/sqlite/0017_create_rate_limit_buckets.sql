@@ -0,0 +1,9 @@
+-- Token buckets shared by every gateway instance when rate limits are kept in the database. A bucket holds the
+-- tokens left when it was last used; the tokens earned since are added when it is next used.
+CREATE TABLE rate_limit_buckets (
+    bucket_key TEXT PRIMARY KEY,
+    tokens     REAL             NOT NULL,
+    updated_at TIMESTAMP        NOT NULL
+);
+
+CREATE INDEX rate_limit_buckets_updated_at_idx ON rate_limit_buckets (updated_at);
@@ -0,0 +1,2 @@
+-- Refunds whose outcome is unknown stay pending until they are reconciled with the bank
+CREATE INDEX refunds_status_idx ON refunds (status, created_at);
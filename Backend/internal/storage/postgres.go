@@ -0,0 +1,8 @@
+package storage
+
+import "context"
+
+// NewPostgresStore connects to the PostgreSQL database described by dsn and applies any pending schema migrations.
+func NewPostgresStore(ctx context.Context, dsn string, options ...Option) (*SQLStore, error) {
+	return openSQLStore(ctx, postgresDialect, dsn, options)
+}
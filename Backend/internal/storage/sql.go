@@ -0,0 +1,968 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/envelope"
+	"github.com/Lionel-Wilson/payment-gateway/internal/money"
+	"github.com/Lionel-Wilson/payment-gateway/internal/oauth"
+	"github.com/Lionel-Wilson/payment-gateway/internal/ratelimit"
+	"github.com/Lionel-Wilson/payment-gateway/internal/rbac"
+)
+
+// SQLStore is a PaymentStore and RefundStore backed by a SQL database. Use NewPostgresStore or NewSQLiteStore to create one.
+// Queries use $N placeholders, which both supported databases understand.
+type SQLStore struct {
+	db      *sql.DB
+	dialect dialect
+	keyring *envelope.Keyring // Encrypts cardholder data when set
+}
+
+// paymentColumns lists the payments table columns in the order scanned by scanPayment.
+const paymentColumns = `id, first_name, last_name, card_number, expiry_date, amount, currency_code, status, status_code,
+	bank_reference, captured_amount, authorization_expires_at, response_summary, refunded_amount, version, card_brand,
+	card_last4, card_issuer, card_country, card_funding, card_product, key_id, encrypted_cardholder, merchant_id,
+	capture_started_at`
+
+// refundColumns lists the refunds table columns in the order scanned by scanRefund.
+const refundColumns = `id, payment_id, amount, currency_code, status, status_code, response_summary, reason, bank_reference,
+	created_at, merchant_id`
+
+// tokenColumns lists the tokens table columns in the order scanned by scanToken.
+const tokenColumns = `id, merchant_id, card_brand, card_last4, encrypted_card, key_id, created_at, revoked_at`
+
+// apiKeyColumns lists the api_keys table columns in the order scanned by scanAPIKey.
+const apiKeyColumns = `id, merchant_id, kind, mode, last4, hash, created_at, expires_at, revoked_at`
+
+// oauthClientColumns lists the oauth_clients table columns in the order scanned by scanOAuthClient.
+const oauthClientColumns = `id, name, secret_hash, scopes, merchant_ids, created_at, revoked_at`
+
+// userColumns lists the users table columns in the order scanned by scanUser.
+const userColumns = `id, merchant_id, email, name, role, password_hash, created_at, disabled_at`
+
+// sessionColumns lists the sessions table columns in the order scanned by scanSession.
+const sessionColumns = `id, user_id, merchant_id, created_at, expires_at`
+
+// openSQLStore opens a connection pool for the given dialect and applies any pending schema migrations.
+func openSQLStore(ctx context.Context, d dialect, dsn string, options []Option) (*SQLStore, error) {
+	db, err := sql.Open(d.driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.configure != nil {
+		d.configure(db)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connect to %s: %w", d.name, err)
+	}
+
+	migrations, err := loadMigrations(d.migrations, d.migrationsDir)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if err := migrate(ctx, db, d, migrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &SQLStore{db: db, dialect: d}
+	for _, option := range options {
+		option(s)
+	}
+
+	return s, nil
+}
+
+// Close closes the underlying database connection pool.
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+// CreatePayment stores a new payment. With a keyring, the cardholder's name and the card's expiry date are stored
+// encrypted.
+func (s *SQLStore) CreatePayment(ctx context.Context, payment models.PaymentDetails) error {
+	holder, keyID, encrypted, err := s.sealCardholder(payment)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `INSERT INTO payments (`+paymentColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25)`,
+		payment.ID, holder.FirstName, holder.LastName, payment.CardNumber, holder.ExpiryDate,
+		payment.Amount.Amount, payment.CurrencyCode, payment.Status, payment.StatusCode,
+		payment.BankReference, payment.CapturedAmount.Amount, nullTime(payment.AuthorizationExpiresAt), payment.ResponseSummary,
+		payment.RefundedAmount.Amount, payment.Version, payment.CardBrand, payment.CardLast4,
+		payment.CardIssuer, payment.CardCountry, payment.CardFunding, payment.CardProduct, keyID, encrypted,
+		payment.MerchantID, nullTime(payment.CaptureStartedAt))
+
+	if err != nil && s.dialect.isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+
+	return err
+}
+
+// GetPayment returns the payment with the given ID.
+func (s *SQLStore) GetPayment(ctx context.Context, id string) (models.PaymentDetails, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+paymentColumns+` FROM payments WHERE id = $1`, id)
+
+	payment, err := s.scanPayment(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.PaymentDetails{}, ErrNotFound
+	}
+
+	return payment, err
+}
+
+// ListPayments returns the payments of the given merchant in creation order.
+func (s *SQLStore) ListPayments(ctx context.Context, merchantID string) ([]models.PaymentDetails, error) {
+	return s.queryPayments(ctx, `SELECT `+paymentColumns+` FROM payments WHERE merchant_id = $1 ORDER BY created_at, id`, merchantID)
+}
+
+// ListAuthorizationsExpiringBefore returns the payments with the given status whose authorization expires before the given time.
+func (s *SQLStore) ListAuthorizationsExpiringBefore(ctx context.Context, status models.PaymentStatus, before time.Time) ([]models.PaymentDetails, error) {
+	return s.queryPayments(ctx, `SELECT `+paymentColumns+` FROM payments
+		WHERE status = $1 AND authorization_expires_at < $2
+		ORDER BY created_at, id`, status, before.UTC())
+}
+
+// ListCapturesStartedBefore returns the payments with the given status whose capture started before the given time.
+func (s *SQLStore) ListCapturesStartedBefore(ctx context.Context, status models.PaymentStatus, before time.Time) ([]models.PaymentDetails, error) {
+	return s.queryPayments(ctx, `SELECT `+paymentColumns+` FROM payments
+		WHERE status = $1 AND capture_started_at < $2
+		ORDER BY created_at, id`, status, before.UTC())
+}
+
+func (s *SQLStore) queryPayments(ctx context.Context, query string, args ...any) ([]models.PaymentDetails, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paymentsList := []models.PaymentDetails{}
+	for rows.Next() {
+		payment, err := s.scanPayment(rows)
+		if err != nil {
+			return nil, err
+		}
+		paymentsList = append(paymentsList, payment)
+	}
+
+	return paymentsList, rows.Err()
+}
+
+// UpdatePayment saves the mutable fields of an existing payment if its version has not changed.
+func (s *SQLStore) UpdatePayment(ctx context.Context, payment models.PaymentDetails) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE payments
+		SET status = $1, status_code = $2, bank_reference = $3, captured_amount = $4, authorization_expires_at = $5,
+			response_summary = $6, refunded_amount = $7, capture_started_at = $8, version = version + 1,
+			updated_at = `+s.dialect.now+`
+		WHERE id = $9 AND version = $10`,
+		payment.Status, payment.StatusCode, payment.BankReference, payment.CapturedAmount.Amount,
+		nullTime(payment.AuthorizationExpiresAt), payment.ResponseSummary, payment.RefundedAmount.Amount,
+		nullTime(payment.CaptureStartedAt), payment.ID, payment.Version)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		// Distinguish a missing payment from one that has been modified since it was retrieved
+		if _, err := s.GetPayment(ctx, payment.ID); err != nil {
+			return err
+		}
+		return ErrConflict
+	}
+
+	return nil
+}
+
+// CreateRefund stores a new refund. It returns ErrNotFound if the refunded payment does not exist.
+func (s *SQLStore) CreateRefund(ctx context.Context, refund models.Refund) error {
+	if _, err := s.GetPayment(ctx, refund.PaymentID); err != nil {
+		return err
+	}
+
+	_, err := s.db.ExecContext(ctx, `INSERT INTO refunds (`+refundColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		refund.ID, refund.PaymentID, refund.Amount.Amount, refund.CurrencyCode, refund.Status, refund.StatusCode,
+		refund.ResponseSummary, refund.Reason, refund.BankReference, refund.CreatedAt.UTC(), refund.MerchantID)
+
+	if err != nil && s.dialect.isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+
+	return err
+}
+
+// GetRefund returns the refund with the given ID.
+func (s *SQLStore) GetRefund(ctx context.Context, id string) (models.Refund, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+refundColumns+` FROM refunds WHERE id = $1`, id)
+
+	refund, err := scanRefund(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Refund{}, ErrNotFound
+	}
+
+	return refund, err
+}
+
+// ListRefunds returns the refunds of the given payment in creation order.
+func (s *SQLStore) ListRefunds(ctx context.Context, paymentID string) ([]models.Refund, error) {
+	return s.queryRefunds(ctx, `SELECT `+refundColumns+` FROM refunds
+		WHERE payment_id = $1
+		ORDER BY created_at, id`, paymentID)
+}
+
+// ListRefundsCreatedBefore returns the refunds with the given status that were created before the given time.
+func (s *SQLStore) ListRefundsCreatedBefore(ctx context.Context, status models.RefundStatus, before time.Time) ([]models.Refund, error) {
+	return s.queryRefunds(ctx, `SELECT `+refundColumns+` FROM refunds
+		WHERE status = $1 AND created_at < $2
+		ORDER BY created_at, id`, status, before.UTC())
+}
+
+func (s *SQLStore) queryRefunds(ctx context.Context, query string, args ...any) ([]models.Refund, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	refundsList := []models.Refund{}
+	for rows.Next() {
+		refund, err := scanRefund(rows)
+		if err != nil {
+			return nil, err
+		}
+		refundsList = append(refundsList, refund)
+	}
+
+	return refundsList, rows.Err()
+}
+
+// UpdateRefund saves the mutable fields of an existing refund.
+func (s *SQLStore) UpdateRefund(ctx context.Context, refund models.Refund) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE refunds
+		SET status = $1, status_code = $2, response_summary = $3, bank_reference = $4, updated_at = `+s.dialect.now+`
+		WHERE id = $5`,
+		refund.Status, refund.StatusCode, refund.ResponseSummary, refund.BankReference, refund.ID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ReserveIdempotencyKey stores an incomplete record unless an unexpired one already exists for the key.
+func (s *SQLStore) ReserveIdempotencyKey(ctx context.Context, record IdempotencyRecord, now time.Time) (IdempotencyRecord, bool, error) {
+	// The existing record may be released between the insert and the select, so try again if it disappears
+	for attempt := 0; attempt < 2; attempt++ {
+		result, err := s.db.ExecContext(ctx, `INSERT INTO idempotency_keys (idempotency_key, fingerprint, expires_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (idempotency_key) DO UPDATE
+			SET fingerprint = excluded.fingerprint, completed = FALSE, status_code = 0, content_type = '', body = NULL,
+				expires_at = excluded.expires_at
+			WHERE idempotency_keys.expires_at <= $4`,
+			record.Key, record.Fingerprint, record.ExpiresAt.UTC(), now.UTC())
+		if err != nil {
+			return IdempotencyRecord{}, false, err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return IdempotencyRecord{}, false, err
+		}
+		if affected > 0 {
+			record.Completed = false
+			return record, true, nil
+		}
+
+		existing, err := s.getIdempotencyKey(ctx, record.Key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+
+		return existing, false, err
+	}
+
+	return IdempotencyRecord{}, false, ErrConflict
+}
+
+func (s *SQLStore) getIdempotencyKey(ctx context.Context, key string) (IdempotencyRecord, error) {
+	var record IdempotencyRecord
+
+	err := s.db.QueryRowContext(ctx, `SELECT idempotency_key, fingerprint, completed, status_code, content_type, body,
+		expires_at FROM idempotency_keys WHERE idempotency_key = $1`, key).
+		Scan(&record.Key, &record.Fingerprint, &record.Completed, &record.StatusCode, &record.ContentType, &record.Body,
+			&record.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return IdempotencyRecord{}, ErrNotFound
+	}
+	record.ExpiresAt = record.ExpiresAt.UTC()
+
+	return record, err
+}
+
+// CompleteIdempotencyKey records the response sent to the request made with the given key.
+func (s *SQLStore) CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE idempotency_keys
+		SET completed = TRUE, status_code = $1, content_type = $2, body = $3
+		WHERE idempotency_key = $4`,
+		statusCode, contentType, body, key)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ReleaseIdempotencyKey deletes the record for the given key.
+func (s *SQLStore) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE idempotency_key = $1`, key)
+	return err
+}
+
+// DeleteIdempotencyKeysExpiredBefore deletes every record that expired before the given time.
+func (s *SQLStore) DeleteIdempotencyKeysExpiredBefore(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at < $1`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
+
+// CreateToken stores a new token.
+func (s *SQLStore) CreateToken(ctx context.Context, token models.Token) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO tokens (`+tokenColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		token.ID, token.MerchantID, token.CardBrand, token.CardLast4, token.EncryptedCard, token.KeyID,
+		token.CreatedAt.UTC(), nullTime(token.RevokedAt))
+
+	if err != nil && s.dialect.isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+
+	return err
+}
+
+// GetToken returns the token with the given ID.
+func (s *SQLStore) GetToken(ctx context.Context, id string) (models.Token, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+tokenColumns+` FROM tokens WHERE id = $1`, id)
+
+	token, err := scanToken(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Token{}, ErrNotFound
+	}
+
+	return token, err
+}
+
+// RevokeToken marks the token with the given ID as revoked, unless it already is.
+func (s *SQLStore) RevokeToken(ctx context.Context, id string, revokedAt time.Time) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE tokens SET revoked_at = COALESCE(revoked_at, $1) WHERE id = $2`,
+		revokedAt.UTC(), id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// CreateMerchant stores a new merchant.
+func (s *SQLStore) CreateMerchant(ctx context.Context, merchant models.Merchant) error {
+	secret, keyID, sealed, err := s.sealSigningSecret(merchant.ID, merchant.SigningSecret)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `INSERT INTO merchants (id, name, created_at, signing_secret, signing_key_id, encrypted_signing_secret)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		merchant.ID, merchant.Name, merchant.CreatedAt.UTC(), secret, keyID, sealed)
+
+	if err != nil && s.dialect.isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+
+	return err
+}
+
+// GetMerchant returns the merchant with the given ID.
+func (s *SQLStore) GetMerchant(ctx context.Context, id string) (models.Merchant, error) {
+	var merchant models.Merchant
+	var keyID string
+	var sealed []byte
+	err := s.db.QueryRowContext(ctx, `SELECT id, name, created_at, signing_secret, signing_key_id, encrypted_signing_secret
+		FROM merchants WHERE id = $1`, id).
+		Scan(&merchant.ID, &merchant.Name, &merchant.CreatedAt, &merchant.SigningSecret, &keyID, &sealed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Merchant{}, ErrNotFound
+	} else if err != nil {
+		return models.Merchant{}, err
+	}
+	merchant.CreatedAt = merchant.CreatedAt.UTC()
+
+	if keyID != "" {
+		if err := s.openSigningSecret(&merchant, keyID, sealed); err != nil {
+			return models.Merchant{}, err
+		}
+	}
+
+	return merchant, nil
+}
+
+// SetSigningSecret replaces the signing secret of the merchant with the given ID.
+func (s *SQLStore) SetSigningSecret(ctx context.Context, id string, secret string) error {
+	secret, keyID, sealed, err := s.sealSigningSecret(id, secret)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.db.ExecContext(ctx, `UPDATE merchants
+		SET signing_secret = $1, signing_key_id = $2, encrypted_signing_secret = $3 WHERE id = $4`,
+		secret, keyID, sealed, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// CreateAPIKey stores a new API key.
+func (s *SQLStore) CreateAPIKey(ctx context.Context, key models.APIKey) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO api_keys (`+apiKeyColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		key.ID, key.MerchantID, key.Kind, key.Mode, key.Last4, key.Hash, key.CreatedAt.UTC(),
+		nullTime(key.ExpiresAt), nullTime(key.RevokedAt))
+
+	if err != nil && s.dialect.isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+
+	return err
+}
+
+// GetAPIKey returns the API key with the given ID.
+func (s *SQLStore) GetAPIKey(ctx context.Context, id string) (models.APIKey, error) {
+	return s.getAPIKey(ctx, `id`, id)
+}
+
+// GetAPIKeyByHash returns the API key with the given hash.
+func (s *SQLStore) GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	return s.getAPIKey(ctx, `hash`, hash)
+}
+
+// getAPIKey returns the API key whose column has the given value. column must be a unique column.
+func (s *SQLStore) getAPIKey(ctx context.Context, column, value string) (models.APIKey, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE `+column+` = $1`, value)
+
+	key, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.APIKey{}, ErrNotFound
+	}
+
+	return key, err
+}
+
+// ListAPIKeys returns the API keys of the given merchant in creation order.
+func (s *SQLStore) ListAPIKeys(ctx context.Context, merchantID string) ([]models.APIKey, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys
+		WHERE merchant_id = $1
+		ORDER BY created_at, id`, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// ExpireAPIKey makes the API key with the given ID stop working at the given time, unless it already expires sooner.
+func (s *SQLStore) ExpireAPIKey(ctx context.Context, id string, expiresAt time.Time) error {
+	return s.updateAPIKey(ctx, `UPDATE api_keys
+		SET expires_at = CASE WHEN expires_at IS NULL OR expires_at > $1 THEN $1 ELSE expires_at END
+		WHERE id = $2`, expiresAt.UTC(), id)
+}
+
+// RevokeAPIKey marks the API key with the given ID as revoked, unless it already is.
+func (s *SQLStore) RevokeAPIKey(ctx context.Context, id string, revokedAt time.Time) error {
+	return s.updateAPIKey(ctx, `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $1) WHERE id = $2`,
+		revokedAt.UTC(), id)
+}
+
+// updateAPIKey runs an update of a single API key, returning ErrNotFound if it matches no key.
+func (s *SQLStore) updateAPIKey(ctx context.Context, query string, args ...any) error {
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// CreateOAuthClient stores a new OAuth client.
+func (s *SQLStore) CreateOAuthClient(ctx context.Context, client models.OAuthClient) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO oauth_clients (`+oauthClientColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		client.ID, client.Name, client.SecretHash, oauth.FormatScope(client.Scopes),
+		strings.Join(client.MerchantIDs, " "), client.CreatedAt.UTC(), nullTime(client.RevokedAt))
+
+	if err != nil && s.dialect.isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+
+	return err
+}
+
+// GetOAuthClient returns the OAuth client with the given ID.
+func (s *SQLStore) GetOAuthClient(ctx context.Context, id string) (models.OAuthClient, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+oauthClientColumns+` FROM oauth_clients WHERE id = $1`, id)
+
+	client, err := scanOAuthClient(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.OAuthClient{}, ErrNotFound
+	}
+
+	return client, err
+}
+
+// RevokeOAuthClient marks the OAuth client with the given ID as revoked, unless it already is.
+func (s *SQLStore) RevokeOAuthClient(ctx context.Context, id string, revokedAt time.Time) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE oauth_clients SET revoked_at = COALESCE(revoked_at, $1) WHERE id = $2`,
+		revokedAt.UTC(), id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// CreateUser stores a new user.
+func (s *SQLStore) CreateUser(ctx context.Context, user models.User) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO users (`+userColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		user.ID, user.MerchantID, user.Email, user.Name, user.Role, user.PasswordHash, user.CreatedAt.UTC(),
+		nullTime(user.DisabledAt))
+
+	if err != nil && s.dialect.isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+
+	return err
+}
+
+// GetUser returns the user with the given ID.
+func (s *SQLStore) GetUser(ctx context.Context, id string) (models.User, error) {
+	return s.getUser(ctx, `id`, id)
+}
+
+// GetUserByEmail returns the user with the given email address.
+func (s *SQLStore) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	return s.getUser(ctx, `email`, email)
+}
+
+// getUser returns the user whose column has the given value. column must be a unique column.
+func (s *SQLStore) getUser(ctx context.Context, column, value string) (models.User, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE `+column+` = $1`, value)
+
+	user, err := scanUser(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, ErrNotFound
+	}
+
+	return user, err
+}
+
+// ListUsers returns the users of the given merchant in the order they were created.
+func (s *SQLStore) ListUsers(ctx context.Context, merchantID string) ([]models.User, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+userColumns+` FROM users
+		WHERE merchant_id = $1
+		ORDER BY created_at, id`, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// UpdateUserRole changes the role of the user with the given ID.
+func (s *SQLStore) UpdateUserRole(ctx context.Context, id string, role rbac.Role) error {
+	return s.updateUser(ctx, `UPDATE users SET role = $1 WHERE id = $2`, role, id)
+}
+
+// DisableUser marks the user with the given ID as disabled, unless they already are.
+func (s *SQLStore) DisableUser(ctx context.Context, id string, disabledAt time.Time) error {
+	return s.updateUser(ctx, `UPDATE users SET disabled_at = COALESCE(disabled_at, $1) WHERE id = $2`,
+		disabledAt.UTC(), id)
+}
+
+// updateUser runs an update of a single user, returning ErrNotFound if it matches no user.
+func (s *SQLStore) updateUser(ctx context.Context, query string, args ...any) error {
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// CreateSession stores a new session.
+func (s *SQLStore) CreateSession(ctx context.Context, session models.Session) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO sessions (`+sessionColumns+`) VALUES ($1, $2, $3, $4, $5)`,
+		session.ID, session.UserID, session.MerchantID, session.CreatedAt.UTC(), session.ExpiresAt.UTC())
+
+	if err != nil && s.dialect.isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+
+	return err
+}
+
+// GetSession returns the session with the given ID.
+func (s *SQLStore) GetSession(ctx context.Context, id string) (models.Session, error) {
+	var session models.Session
+	err := s.db.QueryRowContext(ctx, `SELECT `+sessionColumns+` FROM sessions WHERE id = $1`, id).
+		Scan(&session.ID, &session.UserID, &session.MerchantID, &session.CreatedAt, &session.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Session{}, ErrNotFound
+	}
+	session.CreatedAt, session.ExpiresAt = session.CreatedAt.UTC(), session.ExpiresAt.UTC()
+
+	return session, err
+}
+
+// DeleteSession deletes the session with the given ID.
+func (s *SQLStore) DeleteSession(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteSessionsExpiredBefore deletes every session that expired before the given time.
+func (s *SQLStore) DeleteSessionsExpiredBefore(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE expires_at < $1`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
+
+// TakeRateLimitToken takes a token from the bucket with the given key. The bucket is locked until its new state is
+// written, so that gateway instances sharing the database never take the same token twice.
+func (s *SQLStore) TakeRateLimitToken(ctx context.Context, key string, limit ratelimit.Limit, now time.Time) (ratelimit.Result, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO rate_limit_buckets (bucket_key, tokens, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (bucket_key) DO NOTHING`, key, float64(limit.Requests), now.UTC())
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	var tokens float64
+	var updatedAt time.Time
+	err = tx.QueryRowContext(ctx, `SELECT tokens, updated_at FROM rate_limit_buckets WHERE bucket_key = $1`+s.dialect.forUpdate, key).
+		Scan(&tokens, &updatedAt)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	tokens, result := limit.Take(tokens, now.Sub(updatedAt))
+
+	_, err = tx.ExecContext(ctx, `UPDATE rate_limit_buckets SET tokens = $1, updated_at = $2 WHERE bucket_key = $3`,
+		tokens, now.UTC(), key)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	return result, tx.Commit()
+}
+
+// DeleteRateLimitBucketsUsedBefore deletes every bucket last used before the given time.
+func (s *SQLStore) DeleteRateLimitBucketsUsedBefore(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM rate_limit_buckets WHERE updated_at < $1`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
+
+// AddNonce records a nonce until expiresAt, and reports whether it was new. A nonce that has expired is recorded
+// again in place of the old one, in a single statement, so that concurrent requests with the same nonce cannot both
+// record it.
+func (s *SQLStore) AddNonce(ctx context.Context, nonce string, now, expiresAt time.Time) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `INSERT INTO request_nonces (nonce, expires_at) VALUES ($1, $2)
+		ON CONFLICT (nonce) DO UPDATE SET expires_at = excluded.expires_at WHERE request_nonces.expires_at <= $3`,
+		nonce, expiresAt.UTC(), now.UTC())
+	if err != nil {
+		return false, err
+	}
+
+	added, err := result.RowsAffected()
+	return added > 0, err
+}
+
+// DeleteNoncesExpiredBefore deletes every nonce that expired before the given time.
+func (s *SQLStore) DeleteNoncesExpiredBefore(ctx context.Context, before time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM request_nonces WHERE expires_at < $1`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanPayment scans a payment, decrypting its cardholder data if it is encrypted.
+func (s *SQLStore) scanPayment(row rowScanner) (models.PaymentDetails, error) {
+	var payment models.PaymentDetails
+	var amount, capturedAmount, refundedAmount int64
+	var authorizationExpiresAt, captureStartedAt sql.NullTime
+	var keyID string
+	var encrypted []byte
+
+	err := row.Scan(&payment.ID, &payment.FirstName, &payment.LastName, &payment.CardNumber, &payment.ExpiryDate,
+		&amount, &payment.CurrencyCode, &payment.Status, &payment.StatusCode,
+		&payment.BankReference, &capturedAmount, &authorizationExpiresAt, &payment.ResponseSummary,
+		&refundedAmount, &payment.Version, &payment.CardBrand, &payment.CardLast4,
+		&payment.CardIssuer, &payment.CardCountry, &payment.CardFunding, &payment.CardProduct, &keyID, &encrypted,
+		&payment.MerchantID, &captureStartedAt)
+	if err != nil {
+		return models.PaymentDetails{}, err
+	}
+
+	if keyID != "" {
+		if err := s.openCardholder(&payment, keyID, encrypted); err != nil {
+			return models.PaymentDetails{}, err
+		}
+	}
+
+	// Amounts are stored in minor units of the payment's currency
+	payment.Amount = money.New(amount, payment.CurrencyCode)
+	payment.CapturedAmount = money.New(capturedAmount, payment.CurrencyCode)
+	payment.RefundedAmount = money.New(refundedAmount, payment.CurrencyCode)
+
+	if authorizationExpiresAt.Valid {
+		expiresAt := authorizationExpiresAt.Time.UTC()
+		payment.AuthorizationExpiresAt = &expiresAt
+	}
+	if captureStartedAt.Valid {
+		startedAt := captureStartedAt.Time.UTC()
+		payment.CaptureStartedAt = &startedAt
+	}
+
+	return payment, nil
+}
+
+func scanRefund(row rowScanner) (models.Refund, error) {
+	var refund models.Refund
+	var amount int64
+
+	err := row.Scan(&refund.ID, &refund.PaymentID, &amount, &refund.CurrencyCode, &refund.Status,
+		&refund.StatusCode, &refund.ResponseSummary, &refund.Reason, &refund.BankReference, &refund.CreatedAt,
+		&refund.MerchantID)
+	refund.Amount = money.New(amount, refund.CurrencyCode)
+	refund.CreatedAt = refund.CreatedAt.UTC()
+
+	return refund, err
+}
+
+func scanToken(row rowScanner) (models.Token, error) {
+	var token models.Token
+	var revokedAt sql.NullTime
+
+	err := row.Scan(&token.ID, &token.MerchantID, &token.CardBrand, &token.CardLast4, &token.EncryptedCard,
+		&token.KeyID, &token.CreatedAt, &revokedAt)
+	token.CreatedAt = token.CreatedAt.UTC()
+
+	if revokedAt.Valid {
+		revoked := revokedAt.Time.UTC()
+		token.RevokedAt = &revoked
+	}
+
+	return token, err
+}
+
+func scanAPIKey(row rowScanner) (models.APIKey, error) {
+	var key models.APIKey
+	var expiresAt, revokedAt sql.NullTime
+
+	err := row.Scan(&key.ID, &key.MerchantID, &key.Kind, &key.Mode, &key.Last4, &key.Hash, &key.CreatedAt,
+		&expiresAt, &revokedAt)
+	key.CreatedAt = key.CreatedAt.UTC()
+
+	if expiresAt.Valid {
+		expires := expiresAt.Time.UTC()
+		key.ExpiresAt = &expires
+	}
+	if revokedAt.Valid {
+		revoked := revokedAt.Time.UTC()
+		key.RevokedAt = &revoked
+	}
+
+	return key, err
+}
+
+func scanOAuthClient(row rowScanner) (models.OAuthClient, error) {
+	var client models.OAuthClient
+	var scopes, merchantIDs string
+	var revokedAt sql.NullTime
+
+	err := row.Scan(&client.ID, &client.Name, &client.SecretHash, &scopes, &merchantIDs, &client.CreatedAt, &revokedAt)
+	if err != nil {
+		return models.OAuthClient{}, err
+	}
+	client.CreatedAt = client.CreatedAt.UTC()
+
+	for _, scope := range strings.Fields(scopes) {
+		client.Scopes = append(client.Scopes, oauth.Scope(scope))
+	}
+	client.MerchantIDs = strings.Fields(merchantIDs)
+
+	if revokedAt.Valid {
+		revoked := revokedAt.Time.UTC()
+		client.RevokedAt = &revoked
+	}
+
+	return client, nil
+}
+
+func scanUser(row rowScanner) (models.User, error) {
+	var user models.User
+	var disabledAt sql.NullTime
+
+	err := row.Scan(&user.ID, &user.MerchantID, &user.Email, &user.Name, &user.Role, &user.PasswordHash,
+		&user.CreatedAt, &disabledAt)
+	user.CreatedAt = user.CreatedAt.UTC()
+
+	if disabledAt.Valid {
+		disabled := disabledAt.Time.UTC()
+		user.DisabledAt = &disabled
+	}
+
+	return user, err
+}
+
+// nullTime converts an optional time to a value that can be stored in a nullable timestamp column.
+// Times are stored in UTC so that they compare correctly in databases that store them as text.
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
@@ -0,0 +1,18 @@
+package storage
+
+import (
+	"context"
+	"net/url"
+)
+
+// NewSQLiteStore opens, creating it if necessary, the SQLite database file at path and applies any
+// pending schema migrations. The whole store lives in that single file, so no database server is required.
+func NewSQLiteStore(ctx context.Context, path string, options ...Option) (*SQLStore, error) {
+	params := url.Values{}
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "foreign_keys(ON)")
+	params.Add("_time_format", "sqlite")
+
+	return openSQLStore(ctx, sqliteDialect, "file:"+path+"?"+params.Encode(), options)
+}
@@ -0,0 +1,211 @@
+// Package storage provides the persistence backends used by the payment gateway.
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/ratelimit"
+	"github.com/Lionel-Wilson/payment-gateway/internal/rbac"
+)
+
+var (
+	// ErrNotFound is returned when the requested record does not exist in the store.
+	ErrNotFound = errors.New("storage: record not found")
+	// ErrDuplicate is returned when a record with the same identifier has already been stored.
+	ErrDuplicate = errors.New("storage: record already exists")
+	// ErrConflict is returned when a record was changed by another request before it could be updated.
+	ErrConflict = errors.New("storage: record was modified concurrently")
+)
+
+// PaymentStore is implemented by every backend capable of persisting payment details.
+// Implementations must be safe for concurrent use.
+type PaymentStore interface {
+	// CreatePayment stores a new payment. It returns ErrDuplicate if the payment ID is already in use.
+	CreatePayment(ctx context.Context, payment models.PaymentDetails) error
+	// GetPayment returns the payment with the given ID, or ErrNotFound if it does not exist.
+	GetPayment(ctx context.Context, id string) (models.PaymentDetails, error)
+	// ListPayments returns the payments of the given merchant in the order they were created.
+	ListPayments(ctx context.Context, merchantID string) ([]models.PaymentDetails, error)
+	// ListAuthorizationsExpiringBefore returns the payments with the given status whose authorization
+	// expires before the given time.
+	ListAuthorizationsExpiringBefore(ctx context.Context, status models.PaymentStatus, before time.Time) ([]models.PaymentDetails, error)
+	// ListCapturesStartedBefore returns the payments with the given status whose capture started before the
+	// given time.
+	ListCapturesStartedBefore(ctx context.Context, status models.PaymentStatus, before time.Time) ([]models.PaymentDetails, error)
+	// UpdatePayment saves the status, status code, response summary, bank reference, captured and refunded
+	// amounts, authorization expiry and capture start of an existing payment, and increments its version. The
+	// update only happens if the stored payment still has the same version as the one given; otherwise
+	// ErrConflict is returned, so that concurrent changes cannot overwrite each other.
+	UpdatePayment(ctx context.Context, payment models.PaymentDetails) error
+}
+
+// Store is implemented by backends that persist payments, refunds and idempotency keys, which lets a refund
+// and the payment it belongs to live in the same database.
+type Store interface {
+	PaymentStore
+	RefundStore
+	IdempotencyStore
+	TokenStore
+	APIKeyStore
+	MerchantStore
+	OAuthClientStore
+	UserStore
+	SessionStore
+	RateLimitStore
+	NonceStore
+}
+
+// RefundStore is implemented by every backend capable of persisting refunds.
+// Implementations must be safe for concurrent use.
+type RefundStore interface {
+	// CreateRefund stores a new refund. It returns ErrDuplicate if the refund ID is already in use.
+	CreateRefund(ctx context.Context, refund models.Refund) error
+	// GetRefund returns the refund with the given ID, or ErrNotFound if it does not exist.
+	GetRefund(ctx context.Context, id string) (models.Refund, error)
+	// ListRefunds returns the refunds of the given payment in the order they were created.
+	ListRefunds(ctx context.Context, paymentID string) ([]models.Refund, error)
+	// ListRefundsCreatedBefore returns the refunds with the given status that were created before the given time.
+	ListRefundsCreatedBefore(ctx context.Context, status models.RefundStatus, before time.Time) ([]models.Refund, error)
+	// UpdateRefund saves the status, status code, response summary and bank reference of an existing refund.
+	UpdateRefund(ctx context.Context, refund models.Refund) error
+}
+
+// IdempotencyRecord is a request made with an Idempotency-Key header, and the response sent to it once it has completed.
+type IdempotencyRecord struct {
+	Key         string    // The Idempotency-Key sent by the client
+	Fingerprint string    // A hash identifying the request made with the key
+	Completed   bool      // Whether the response below has been recorded
+	StatusCode  int       // The HTTP status code of the response
+	ContentType string    // The content type of the response
+	Body        []byte    // The body of the response
+	ExpiresAt   time.Time // When the key may be reused
+}
+
+// IdempotencyStore is implemented by every backend capable of persisting idempotency keys.
+// Implementations must be safe for concurrent use.
+type IdempotencyStore interface {
+	// ReserveIdempotencyKey stores an incomplete record for a request about to be processed, replacing any record
+	// for the same key that expired before now. If an unexpired record already exists it is returned instead and
+	// the reported bool is false.
+	ReserveIdempotencyKey(ctx context.Context, record IdempotencyRecord, now time.Time) (IdempotencyRecord, bool, error)
+	// CompleteIdempotencyKey records the response sent to the request made with the given key.
+	CompleteIdempotencyKey(ctx context.Context, key string, statusCode int, contentType string, body []byte) error
+	// ReleaseIdempotencyKey deletes the record for the given key, so that the request can be retried.
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+	// DeleteIdempotencyKeysExpiredBefore deletes every record that expired before the given time and returns how
+	// many were deleted.
+	DeleteIdempotencyKeysExpiredBefore(ctx context.Context, before time.Time) (int, error)
+}
+
+// TokenStore is implemented by every backend capable of persisting vault tokens.
+// Implementations must be safe for concurrent use.
+type TokenStore interface {
+	// CreateToken stores a new token. It returns ErrDuplicate if the token ID is already in use.
+	CreateToken(ctx context.Context, token models.Token) error
+	// GetToken returns the token with the given ID, or ErrNotFound if it does not exist.
+	GetToken(ctx context.Context, id string) (models.Token, error)
+	// RevokeToken marks the token with the given ID as revoked at the given time, or returns ErrNotFound if it does
+	// not exist. Revoking a token that has already been revoked keeps the time it was first revoked.
+	RevokeToken(ctx context.Context, id string, revokedAt time.Time) error
+}
+
+// MerchantStore is implemented by every backend capable of persisting merchants.
+// Implementations must be safe for concurrent use.
+type MerchantStore interface {
+	// CreateMerchant stores a new merchant. It returns ErrDuplicate if the merchant ID is already in use.
+	CreateMerchant(ctx context.Context, merchant models.Merchant) error
+	// GetMerchant returns the merchant with the given ID, or ErrNotFound if it does not exist.
+	GetMerchant(ctx context.Context, id string) (models.Merchant, error)
+	// SetSigningSecret replaces the signing secret of the merchant with the given ID, or returns ErrNotFound if it
+	// does not exist.
+	SetSigningSecret(ctx context.Context, id string, secret string) error
+}
+
+// APIKeyStore is implemented by every backend capable of persisting merchant API keys. Keys are stored by their hash;
+// the key itself is never stored. Implementations must be safe for concurrent use.
+type APIKeyStore interface {
+	// CreateAPIKey stores a new API key. It returns ErrDuplicate if the key's ID or hash is already in use.
+	CreateAPIKey(ctx context.Context, key models.APIKey) error
+	// GetAPIKey returns the API key with the given ID, or ErrNotFound if it does not exist.
+	GetAPIKey(ctx context.Context, id string) (models.APIKey, error)
+	// GetAPIKeyByHash returns the API key with the given hash, or ErrNotFound if it does not exist.
+	GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error)
+	// ListAPIKeys returns the API keys of the given merchant in the order they were created.
+	ListAPIKeys(ctx context.Context, merchantID string) ([]models.APIKey, error)
+	// ExpireAPIKey makes the API key with the given ID stop working at the given time, unless it already expires
+	// sooner, or returns ErrNotFound if it does not exist.
+	ExpireAPIKey(ctx context.Context, id string, expiresAt time.Time) error
+	// RevokeAPIKey marks the API key with the given ID as revoked at the given time, or returns ErrNotFound if it
+	// does not exist. Revoking a key that has already been revoked keeps the time it was first revoked.
+	RevokeAPIKey(ctx context.Context, id string, revokedAt time.Time) error
+}
+
+// OAuthClientStore is implemented by every backend capable of persisting OAuth clients. Clients are stored with the
+// hash of their secret; the secret itself is never stored. Implementations must be safe for concurrent use.
+type OAuthClientStore interface {
+	// CreateOAuthClient stores a new OAuth client. It returns ErrDuplicate if the client ID is already in use.
+	CreateOAuthClient(ctx context.Context, client models.OAuthClient) error
+	// GetOAuthClient returns the OAuth client with the given ID, or ErrNotFound if it does not exist.
+	GetOAuthClient(ctx context.Context, id string) (models.OAuthClient, error)
+	// RevokeOAuthClient marks the OAuth client with the given ID as revoked at the given time, or returns ErrNotFound
+	// if it does not exist. Revoking a client that has already been revoked keeps the time it was first revoked.
+	RevokeOAuthClient(ctx context.Context, id string, revokedAt time.Time) error
+}
+
+// UserStore is implemented by every backend capable of persisting dashboard users.
+// Implementations must be safe for concurrent use.
+type UserStore interface {
+	// CreateUser stores a new user. It returns ErrDuplicate if the user's ID or email address is already in use.
+	CreateUser(ctx context.Context, user models.User) error
+	// GetUser returns the user with the given ID, or ErrNotFound if it does not exist.
+	GetUser(ctx context.Context, id string) (models.User, error)
+	// GetUserByEmail returns the user with the given email address, or ErrNotFound if it does not exist.
+	GetUserByEmail(ctx context.Context, email string) (models.User, error)
+	// ListUsers returns the users of the given merchant in the order they were created.
+	ListUsers(ctx context.Context, merchantID string) ([]models.User, error)
+	// UpdateUserRole changes the role of the user with the given ID, or returns ErrNotFound if it does not exist.
+	UpdateUserRole(ctx context.Context, id string, role rbac.Role) error
+	// DisableUser marks the user with the given ID as disabled at the given time, or returns ErrNotFound if it does
+	// not exist. Disabling a user who has already been disabled keeps the time they were first disabled.
+	DisableUser(ctx context.Context, id string, disabledAt time.Time) error
+}
+
+// SessionStore is implemented by every backend capable of persisting dashboard sessions. Sessions are stored by the
+// hash of their token; the token itself is never stored. Implementations must be safe for concurrent use.
+type SessionStore interface {
+	// CreateSession stores a new session. It returns ErrDuplicate if the session ID is already in use.
+	CreateSession(ctx context.Context, session models.Session) error
+	// GetSession returns the session with the given ID, or ErrNotFound if it does not exist.
+	GetSession(ctx context.Context, id string) (models.Session, error)
+	// DeleteSession deletes the session with the given ID, or returns ErrNotFound if it does not exist.
+	DeleteSession(ctx context.Context, id string) error
+	// DeleteSessionsExpiredBefore deletes every session that expired before the given time and returns how many
+	// were deleted.
+	DeleteSessionsExpiredBefore(ctx context.Context, before time.Time) (int, error)
+}
+
+// RateLimitStore is implemented by every backend capable of persisting rate limit token buckets. A database backend
+// lets every gateway instance share the same buckets. Implementations must be safe for concurrent use.
+type RateLimitStore interface {
+	// TakeRateLimitToken takes a token from the bucket with the given key, which refills at the rate of limit and
+	// starts full. The result reports whether a token was taken and what is left.
+	TakeRateLimitToken(ctx context.Context, key string, limit ratelimit.Limit, now time.Time) (ratelimit.Result, error)
+	// DeleteRateLimitBucketsUsedBefore deletes every bucket last used before the given time and returns how many
+	// were deleted.
+	DeleteRateLimitBucketsUsedBefore(ctx context.Context, before time.Time) (int, error)
+}
+
+// NonceStore is implemented by every backend capable of remembering the nonces of signed requests. A database backend
+// lets every gateway instance share the same nonces, so that a request cannot be replayed against another instance.
+// Implementations must be safe for concurrent use.
+type NonceStore interface {
+	// AddNonce records a nonce until expiresAt, and reports whether it was new. A nonce that was recorded before and
+	// has not expired by now is not recorded again.
+	AddNonce(ctx context.Context, nonce string, now, expiresAt time.Time) (bool, error)
+	// DeleteNoncesExpiredBefore deletes every nonce that expired before the given time and returns how many were
+	// deleted.
+	DeleteNoncesExpiredBefore(ctx context.Context, before time.Time) (int, error)
+}
@@ -0,0 +1,687 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/api/models"
+	"github.com/Lionel-Wilson/payment-gateway/internal/apikey"
+	"github.com/Lionel-Wilson/payment-gateway/internal/bin"
+	"github.com/Lionel-Wilson/payment-gateway/internal/money"
+	"github.com/Lionel-Wilson/payment-gateway/internal/oauth"
+	"github.com/Lionel-Wilson/payment-gateway/internal/ratelimit"
+	"github.com/Lionel-Wilson/payment-gateway/internal/rbac"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// storeFactories returns a constructor for every Store implementation. The PostgreSQL store is
+// only included when POSTGRES_TEST_DSN names a database, e.g. the "postgres" service from docker-compose.yml.
+func storeFactories() map[string]func(t *testing.T) Store {
+	factories := map[string]func(t *testing.T) Store{
+		"Memory": func(t *testing.T) Store {
+			return NewMemoryStore()
+		},
+		"SQLite": func(t *testing.T) Store {
+			store, err := NewSQLiteStore(context.Background(), filepath.Join(t.TempDir(), "payments.db"))
+			require.NoError(t, err)
+			t.Cleanup(func() { store.Close() })
+			return store
+		},
+		"EncryptedSQLite": func(t *testing.T) Store {
+			store, err := NewSQLiteStore(context.Background(), filepath.Join(t.TempDir(), "payments.db"),
+				WithKeyring(testKeyring(t, "key-1", "key-1")))
+			require.NoError(t, err)
+			t.Cleanup(func() { store.Close() })
+			return store
+		},
+	}
+
+	if dsn := os.Getenv("POSTGRES_TEST_DSN"); dsn != "" {
+		factories["Postgres"] = func(t *testing.T) Store {
+			store, err := NewPostgresStore(context.Background(), dsn)
+			require.NoError(t, err)
+			t.Cleanup(func() { store.Close() })
+
+			_, err = store.db.Exec(`TRUNCATE refunds, payments, idempotency_keys, tokens, api_keys, merchants, oauth_clients, users, sessions, rate_limit_buckets`)
+			require.NoError(t, err)
+			return store
+		}
+	}
+
+	return factories
+}
+
+// TestPostgresStoreIsTested fails in CI when POSTGRES_TEST_DSN is not set, so that the PostgreSQL store cannot stop
+// being tested without anyone noticing. Elsewhere it is reported as skipped.
+func TestPostgresStoreIsTested(t *testing.T) {
+	if os.Getenv("POSTGRES_TEST_DSN") != "" {
+		return
+	}
+	if os.Getenv("CI") != "" {
+		t.Fatal("POSTGRES_TEST_DSN must name a database in CI, so that the PostgreSQL store is tested")
+	}
+
+	t.Skip("POSTGRES_TEST_DSN is not set, so the PostgreSQL store is not tested")
+}
+
+func testPayment(id string) models.PaymentDetails {
+	return models.PaymentDetails{
+		ID:              id,
+		MerchantID:      "merchant-1",
+		FirstName:       "Jane",
+		LastName:        "Doe",
+		CardNumber:      "************1111",
+		CardBrand:       "visa",
+		CardLast4:       "1111",
+		CardIssuer:      "Test Bank",
+		CardCountry:     "GB",
+		CardFunding:     bin.Credit,
+		CardProduct:     "Visa Classic",
+		ExpiryDate:      "12/29",
+		Amount:          money.New(20050, "USD"),
+		CurrencyCode:    "USD",
+		Status:          "payment_paid",
+		StatusCode:      10000,
+		BankReference:   "BNK-1",
+		ResponseSummary: "Approved",
+		CapturedAmount:  money.New(20050, "USD"),
+		RefundedAmount:  money.New(0, "USD"),
+	}
+}
+
+func TestPaymentStore(t *testing.T) {
+	for name, newStore := range storeFactories() {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			ctx := context.Background()
+
+			paymentsList, err := store.ListPayments(ctx, "merchant-1")
+			assert.NoError(t, err)
+			assert.Empty(t, paymentsList)
+
+			first, second, other := testPayment("PAY-1"), testPayment("PAY-2"), testPayment("PAY-3")
+			other.MerchantID = "merchant-2"
+			require.NoError(t, store.CreatePayment(ctx, first))
+			require.NoError(t, store.CreatePayment(ctx, second))
+			require.NoError(t, store.CreatePayment(ctx, other))
+			assert.ErrorIs(t, store.CreatePayment(ctx, first), ErrDuplicate)
+
+			payment, err := store.GetPayment(ctx, "PAY-1")
+			assert.NoError(t, err)
+			assert.Equal(t, first, payment)
+
+			_, err = store.GetPayment(ctx, "PAY-404")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			declined := second
+			declined.Status = "payment_declined"
+			declined.StatusCode = 50280
+			declined.ResponseSummary = "Insufficient funds"
+			assert.NoError(t, store.UpdatePayment(ctx, declined))
+			assert.ErrorIs(t, store.UpdatePayment(ctx, declined), ErrConflict, "stale versions must be rejected")
+			assert.ErrorIs(t, store.UpdatePayment(ctx, testPayment("PAY-404")), ErrNotFound)
+
+			paymentsList, err = store.ListPayments(ctx, "merchant-1")
+			assert.NoError(t, err)
+			require.Len(t, paymentsList, 2, "only the merchant's own payments are listed")
+			assert.Equal(t, "PAY-1", paymentsList[0].ID)
+			assert.Equal(t, models.StatusDeclined, paymentsList[1].Status)
+			assert.Equal(t, 50280, paymentsList[1].StatusCode)
+			assert.Equal(t, "Insufficient funds", paymentsList[1].ResponseSummary)
+			assert.Equal(t, 1, paymentsList[1].Version)
+		})
+	}
+}
+
+func TestRefundStore(t *testing.T) {
+	createdAt := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	refund := func(id, paymentID string) models.Refund {
+		return models.Refund{
+			ID:           id,
+			PaymentID:    paymentID,
+			MerchantID:   "merchant-1",
+			Amount:       money.New(5025, "USD"),
+			CurrencyCode: "USD",
+			Status:       "refund_pending",
+			Reason:       "Item returned",
+			CreatedAt:    createdAt,
+		}
+	}
+
+	for name, newStore := range storeFactories() {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			ctx := context.Background()
+
+			require.NoError(t, store.CreatePayment(ctx, testPayment("PAY-1")))
+			require.NoError(t, store.CreatePayment(ctx, testPayment("PAY-2")))
+
+			first, second := refund("REF-1", "PAY-1"), refund("REF-2", "PAY-1")
+			second.CreatedAt = createdAt.Add(time.Second)
+			require.NoError(t, store.CreateRefund(ctx, first))
+			require.NoError(t, store.CreateRefund(ctx, second))
+			assert.ErrorIs(t, store.CreateRefund(ctx, first), ErrDuplicate)
+			assert.ErrorIs(t, store.CreateRefund(ctx, refund("REF-3", "PAY-404")), ErrNotFound)
+
+			stored, err := store.GetRefund(ctx, "REF-1")
+			assert.NoError(t, err)
+			assert.Equal(t, first, stored)
+
+			_, err = store.GetRefund(ctx, "REF-404")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			succeeded := second
+			succeeded.Status = "refund_succeeded"
+			succeeded.StatusCode = 10000
+			succeeded.ResponseSummary = "Approved"
+			succeeded.BankReference = "BNK-2"
+			assert.NoError(t, store.UpdateRefund(ctx, succeeded))
+			assert.ErrorIs(t, store.UpdateRefund(ctx, refund("REF-404", "PAY-1")), ErrNotFound)
+
+			refundsList, err := store.ListRefunds(ctx, "PAY-1")
+			assert.NoError(t, err)
+			assert.Equal(t, []models.Refund{first, succeeded}, refundsList)
+
+			refundsList, err = store.ListRefunds(ctx, "PAY-2")
+			assert.NoError(t, err)
+			assert.Empty(t, refundsList)
+
+			pending := refund("REF-4", "PAY-2")
+			pending.CreatedAt = createdAt.Add(time.Minute)
+			require.NoError(t, store.CreateRefund(ctx, pending))
+
+			refundsList, err = store.ListRefundsCreatedBefore(ctx, "refund_pending", createdAt.Add(time.Minute))
+			assert.NoError(t, err)
+			assert.Equal(t, []models.Refund{first}, refundsList)
+		})
+	}
+}
+
+func TestTokenStore(t *testing.T) {
+	createdAt := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	token := models.Token{
+		ID:            "TOK-1",
+		MerchantID:    "merchant-1",
+		CardBrand:     "visa",
+		CardLast4:     "1111",
+		EncryptedCard: []byte{0x01, 0x02, 0x03},
+		CreatedAt:     createdAt,
+	}
+
+	for name, newStore := range storeFactories() {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			ctx := context.Background()
+
+			require.NoError(t, store.CreateToken(ctx, token))
+			assert.ErrorIs(t, store.CreateToken(ctx, token), ErrDuplicate)
+
+			stored, err := store.GetToken(ctx, "TOK-1")
+			assert.NoError(t, err)
+			assert.Equal(t, token, stored)
+
+			_, err = store.GetToken(ctx, "TOK-404")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			revokedAt := createdAt.Add(time.Hour)
+			assert.NoError(t, store.RevokeToken(ctx, "TOK-1", revokedAt))
+			assert.NoError(t, store.RevokeToken(ctx, "TOK-1", revokedAt.Add(time.Hour)))
+			assert.ErrorIs(t, store.RevokeToken(ctx, "TOK-404", revokedAt), ErrNotFound)
+
+			stored, err = store.GetToken(ctx, "TOK-1")
+			assert.NoError(t, err)
+			if assert.NotNil(t, stored.RevokedAt) {
+				assert.Equal(t, revokedAt, *stored.RevokedAt, "a token keeps the time it was first revoked")
+			}
+		})
+	}
+}
+
+func TestAPIKeyStore(t *testing.T) {
+	createdAt := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	newKey := func(id, merchantID string, offset time.Duration) models.APIKey {
+		return models.APIKey{
+			ID:         id,
+			MerchantID: merchantID,
+			Kind:       apikey.Secret,
+			Mode:       apikey.Test,
+			Last4:      "abcd",
+			Hash:       "hash-" + id,
+			CreatedAt:  createdAt.Add(offset),
+		}
+	}
+
+	for name, newStore := range storeFactories() {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			ctx := context.Background()
+
+			key := newKey("KEY-1", "merchant-1", 0)
+			require.NoError(t, store.CreateAPIKey(ctx, key))
+			require.NoError(t, store.CreateAPIKey(ctx, newKey("KEY-2", "merchant-2", time.Minute)))
+			require.NoError(t, store.CreateAPIKey(ctx, newKey("KEY-3", "merchant-1", 2*time.Minute)))
+			assert.ErrorIs(t, store.CreateAPIKey(ctx, key), ErrDuplicate)
+
+			sameHash := newKey("KEY-4", "merchant-1", 0)
+			sameHash.Hash = key.Hash
+			assert.ErrorIs(t, store.CreateAPIKey(ctx, sameHash), ErrDuplicate)
+
+			stored, err := store.GetAPIKey(ctx, "KEY-1")
+			assert.NoError(t, err)
+			assert.Equal(t, key, stored)
+
+			stored, err = store.GetAPIKeyByHash(ctx, "hash-KEY-1")
+			assert.NoError(t, err)
+			assert.Equal(t, key, stored)
+
+			_, err = store.GetAPIKey(ctx, "KEY-404")
+			assert.ErrorIs(t, err, ErrNotFound)
+			_, err = store.GetAPIKeyByHash(ctx, "hash-KEY-404")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			keys, err := store.ListAPIKeys(ctx, "merchant-1")
+			assert.NoError(t, err)
+			assert.Equal(t, []models.APIKey{key, newKey("KEY-3", "merchant-1", 2*time.Minute)}, keys)
+
+			keys, err = store.ListAPIKeys(ctx, "merchant-404")
+			assert.NoError(t, err)
+			assert.Empty(t, keys)
+
+			expiresAt := createdAt.Add(24 * time.Hour)
+			assert.NoError(t, store.ExpireAPIKey(ctx, "KEY-1", expiresAt))
+			assert.NoError(t, store.ExpireAPIKey(ctx, "KEY-1", expiresAt.Add(time.Hour)))
+			assert.ErrorIs(t, store.ExpireAPIKey(ctx, "KEY-404", expiresAt), ErrNotFound)
+
+			revokedAt := createdAt.Add(time.Hour)
+			assert.NoError(t, store.RevokeAPIKey(ctx, "KEY-1", revokedAt))
+			assert.NoError(t, store.RevokeAPIKey(ctx, "KEY-1", revokedAt.Add(time.Hour)))
+			assert.ErrorIs(t, store.RevokeAPIKey(ctx, "KEY-404", revokedAt), ErrNotFound)
+
+			stored, err = store.GetAPIKey(ctx, "KEY-1")
+			assert.NoError(t, err)
+			if assert.NotNil(t, stored.ExpiresAt) {
+				assert.Equal(t, expiresAt, *stored.ExpiresAt, "a key keeps its earliest expiry")
+			}
+			if assert.NotNil(t, stored.RevokedAt) {
+				assert.Equal(t, revokedAt, *stored.RevokedAt, "a key keeps the time it was first revoked")
+			}
+		})
+	}
+}
+
+func TestMerchantStore(t *testing.T) {
+	merchant := models.Merchant{
+		ID:        "MER-1",
+		Name:      "Acme Ltd",
+		CreatedAt: time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	for name, newStore := range storeFactories() {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			ctx := context.Background()
+
+			require.NoError(t, store.CreateMerchant(ctx, merchant))
+			assert.ErrorIs(t, store.CreateMerchant(ctx, merchant), ErrDuplicate)
+
+			stored, err := store.GetMerchant(ctx, "MER-1")
+			assert.NoError(t, err)
+			assert.Equal(t, merchant, stored)
+
+			_, err = store.GetMerchant(ctx, "MER-404")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			require.NoError(t, store.SetSigningSecret(ctx, "MER-1", "sig_1"))
+			stored, err = store.GetMerchant(ctx, "MER-1")
+			assert.NoError(t, err)
+			assert.Equal(t, "sig_1", stored.SigningSecret)
+
+			assert.ErrorIs(t, store.SetSigningSecret(ctx, "MER-404", "sig_1"), ErrNotFound)
+		})
+	}
+}
+
+func TestOAuthClientStore(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	client := models.OAuthClient{
+		ID:          "CLI-1",
+		Name:        "Acme Platform",
+		SecretHash:  "hash-1",
+		Scopes:      []oauth.Scope{oauth.PaymentsWrite, oauth.PaymentsRead},
+		MerchantIDs: []string{"MER-1", "MER-2"},
+		CreatedAt:   now,
+	}
+
+	for name, newStore := range storeFactories() {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			ctx := context.Background()
+
+			require.NoError(t, store.CreateOAuthClient(ctx, client))
+			assert.ErrorIs(t, store.CreateOAuthClient(ctx, client), ErrDuplicate)
+
+			stored, err := store.GetOAuthClient(ctx, "CLI-1")
+			assert.NoError(t, err)
+			assert.Equal(t, client, stored)
+
+			_, err = store.GetOAuthClient(ctx, "CLI-404")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			// Revoking a client twice keeps the time it was first revoked
+			require.NoError(t, store.RevokeOAuthClient(ctx, "CLI-1", now.Add(time.Hour)))
+			require.NoError(t, store.RevokeOAuthClient(ctx, "CLI-1", now.Add(2*time.Hour)))
+			stored, err = store.GetOAuthClient(ctx, "CLI-1")
+			assert.NoError(t, err)
+			if assert.NotNil(t, stored.RevokedAt) {
+				assert.Equal(t, now.Add(time.Hour), *stored.RevokedAt)
+			}
+
+			assert.ErrorIs(t, store.RevokeOAuthClient(ctx, "CLI-404", now), ErrNotFound)
+		})
+	}
+}
+
+func TestUserStore(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	user := func(id, merchantID, email string) models.User {
+		return models.User{
+			ID:           id,
+			MerchantID:   merchantID,
+			Email:        email,
+			Name:         "Jane Doe",
+			Role:         rbac.Support,
+			PasswordHash: "hash",
+			CreatedAt:    now,
+		}
+	}
+
+	for name, newStore := range storeFactories() {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			ctx := context.Background()
+
+			require.NoError(t, store.CreateUser(ctx, user("USR-1", "MER-1", "jane@example.com")))
+			require.NoError(t, store.CreateUser(ctx, user("USR-2", "MER-2", "john@example.com")))
+			require.NoError(t, store.CreateUser(ctx, user("USR-3", "MER-1", "joan@example.com")))
+			assert.ErrorIs(t, store.CreateUser(ctx, user("USR-1", "MER-1", "other@example.com")), ErrDuplicate)
+			assert.ErrorIs(t, store.CreateUser(ctx, user("USR-4", "MER-2", "jane@example.com")), ErrDuplicate,
+				"email addresses are unique across merchants")
+
+			stored, err := store.GetUser(ctx, "USR-1")
+			assert.NoError(t, err)
+			assert.Equal(t, user("USR-1", "MER-1", "jane@example.com"), stored)
+
+			stored, err = store.GetUserByEmail(ctx, "john@example.com")
+			assert.NoError(t, err)
+			assert.Equal(t, "USR-2", stored.ID)
+
+			_, err = store.GetUser(ctx, "USR-404")
+			assert.ErrorIs(t, err, ErrNotFound)
+			_, err = store.GetUserByEmail(ctx, "nobody@example.com")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			users, err := store.ListUsers(ctx, "MER-1")
+			assert.NoError(t, err)
+			if assert.Len(t, users, 2) {
+				assert.Equal(t, "USR-1", users[0].ID)
+				assert.Equal(t, "USR-3", users[1].ID)
+			}
+
+			require.NoError(t, store.UpdateUserRole(ctx, "USR-1", rbac.Finance))
+			assert.ErrorIs(t, store.UpdateUserRole(ctx, "USR-404", rbac.Finance), ErrNotFound)
+
+			// Disabling a user twice keeps the time they were first disabled
+			require.NoError(t, store.DisableUser(ctx, "USR-1", now.Add(time.Hour)))
+			require.NoError(t, store.DisableUser(ctx, "USR-1", now.Add(2*time.Hour)))
+			assert.ErrorIs(t, store.DisableUser(ctx, "USR-404", now), ErrNotFound)
+
+			stored, err = store.GetUser(ctx, "USR-1")
+			assert.NoError(t, err)
+			assert.Equal(t, rbac.Finance, stored.Role)
+			if assert.NotNil(t, stored.DisabledAt) {
+				assert.Equal(t, now.Add(time.Hour), *stored.DisabledAt)
+			}
+		})
+	}
+}
+
+func TestSessionStore(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	session := func(id string, expiresAt time.Time) models.Session {
+		return models.Session{ID: id, UserID: "USR-1", MerchantID: "MER-1", CreatedAt: now, ExpiresAt: expiresAt}
+	}
+
+	for name, newStore := range storeFactories() {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			ctx := context.Background()
+
+			require.NoError(t, store.CreateSession(ctx, session("hash-1", now.Add(time.Hour))))
+			require.NoError(t, store.CreateSession(ctx, session("hash-2", now.Add(3*time.Hour))))
+			assert.ErrorIs(t, store.CreateSession(ctx, session("hash-1", now)), ErrDuplicate)
+
+			stored, err := store.GetSession(ctx, "hash-1")
+			assert.NoError(t, err)
+			assert.Equal(t, session("hash-1", now.Add(time.Hour)), stored)
+
+			deleted, err := store.DeleteSessionsExpiredBefore(ctx, now.Add(2*time.Hour))
+			assert.NoError(t, err)
+			assert.Equal(t, 1, deleted)
+
+			_, err = store.GetSession(ctx, "hash-1")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			require.NoError(t, store.DeleteSession(ctx, "hash-2"))
+			assert.ErrorIs(t, store.DeleteSession(ctx, "hash-2"), ErrNotFound)
+		})
+	}
+}
+
+func TestRateLimitStore(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	limit := ratelimit.Limit{Requests: 2, Period: time.Minute}
+
+	for name, newStore := range storeFactories() {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			ctx := context.Background()
+
+			take := func(key string, at time.Time) ratelimit.Result {
+				result, err := store.TakeRateLimitToken(ctx, key, limit, at)
+				require.NoError(t, err)
+				return result
+			}
+
+			// A new bucket starts full
+			assert.Equal(t, ratelimit.Result{Allowed: true, Limit: limit, Remaining: 1, Reset: 30 * time.Second}, take("key-1", now))
+			assert.Equal(t, ratelimit.Result{Allowed: true, Limit: limit, Remaining: 0, Reset: time.Minute}, take("key-1", now))
+			assert.Equal(t, ratelimit.Result{Allowed: false, Limit: limit, Remaining: 0, RetryAfter: 30 * time.Second, Reset: time.Minute}, take("key-1", now))
+
+			// Buckets are independent, and refill over the period
+			assert.True(t, take("key-2", now).Allowed)
+			assert.True(t, take("key-1", now.Add(30*time.Second)).Allowed)
+			assert.False(t, take("key-1", now.Add(30*time.Second)).Allowed)
+
+			deleted, err := store.DeleteRateLimitBucketsUsedBefore(ctx, now.Add(time.Second))
+			assert.NoError(t, err)
+			assert.Equal(t, 1, deleted)
+		})
+	}
+}
+
+func TestNonceStore(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	for name, newStore := range storeFactories() {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			ctx := context.Background()
+
+			add := func(nonce string, at time.Time) bool {
+				added, err := store.AddNonce(ctx, nonce, at, at.Add(time.Minute))
+				require.NoError(t, err)
+				return added
+			}
+
+			// A nonce is only accepted again once it has expired
+			assert.True(t, add("merchant-1/nonce-1", now))
+			assert.False(t, add("merchant-1/nonce-1", now.Add(30*time.Second)))
+			assert.True(t, add("merchant-2/nonce-1", now))
+			assert.True(t, add("merchant-1/nonce-1", now.Add(time.Minute)))
+			assert.False(t, add("merchant-1/nonce-1", now.Add(time.Minute)))
+
+			deleted, err := store.DeleteNoncesExpiredBefore(ctx, now.Add(90*time.Second))
+			assert.NoError(t, err)
+			assert.Equal(t, 1, deleted)
+		})
+	}
+}
+
+func TestIdempotencyStore(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	for name, newStore := range storeFactories() {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			ctx := context.Background()
+
+			record := IdempotencyRecord{Key: "key-1", Fingerprint: "fingerprint-1", ExpiresAt: now.Add(time.Hour)}
+			reserved, ok, err := store.ReserveIdempotencyKey(ctx, record, now)
+			require.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, record, reserved)
+
+			// A second request with the same key sees the first one in progress
+			other := IdempotencyRecord{Key: "key-1", Fingerprint: "fingerprint-2", ExpiresAt: now.Add(time.Hour)}
+			existing, ok, err := store.ReserveIdempotencyKey(ctx, other, now)
+			require.NoError(t, err)
+			assert.False(t, ok)
+			assert.Equal(t, record, existing)
+
+			require.NoError(t, store.CompleteIdempotencyKey(ctx, "key-1", 201, "application/json", []byte(`{"id":"PAY-1"}`)))
+			assert.ErrorIs(t, store.CompleteIdempotencyKey(ctx, "key-404", 201, "application/json", nil), ErrNotFound)
+
+			existing, ok, err = store.ReserveIdempotencyKey(ctx, other, now)
+			require.NoError(t, err)
+			assert.False(t, ok)
+			assert.True(t, existing.Completed)
+			assert.Equal(t, "fingerprint-1", existing.Fingerprint)
+			assert.Equal(t, 201, existing.StatusCode)
+			assert.Equal(t, "application/json", existing.ContentType)
+			assert.Equal(t, []byte(`{"id":"PAY-1"}`), existing.Body)
+
+			// Once the key expires it can be reused
+			later := now.Add(2 * time.Hour)
+			other.ExpiresAt = later.Add(time.Hour)
+			reserved, ok, err = store.ReserveIdempotencyKey(ctx, other, later)
+			require.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, other, reserved)
+
+			// A released key can be reserved again straight away
+			require.NoError(t, store.ReleaseIdempotencyKey(ctx, "key-1"))
+			_, ok, err = store.ReserveIdempotencyKey(ctx, record, now)
+			require.NoError(t, err)
+			assert.True(t, ok)
+
+			_, _, err = store.ReserveIdempotencyKey(ctx, IdempotencyRecord{Key: "key-2", Fingerprint: "f", ExpiresAt: now.Add(3 * time.Hour)}, now)
+			require.NoError(t, err)
+
+			deleted, err := store.DeleteIdempotencyKeysExpiredBefore(ctx, now.Add(2*time.Hour))
+			require.NoError(t, err)
+			assert.Equal(t, 1, deleted)
+
+			_, ok, err = store.ReserveIdempotencyKey(ctx, IdempotencyRecord{Key: "key-2", Fingerprint: "f", ExpiresAt: now.Add(time.Hour)}, now)
+			require.NoError(t, err)
+			assert.False(t, ok, "unexpired keys must not be deleted")
+		})
+	}
+}
+
+func TestListAuthorizationsExpiringBefore(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	authorization := func(id string, expiresAt time.Time) models.PaymentDetails {
+		payment := testPayment(id)
+		payment.Status = "payment_authorized"
+		payment.AuthorizationExpiresAt = &expiresAt
+		return payment
+	}
+
+	for name, newStore := range storeFactories() {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			ctx := context.Background()
+
+			expired := authorization("PAY-1", now.Add(-time.Minute))
+			require.NoError(t, store.CreatePayment(ctx, expired))
+			require.NoError(t, store.CreatePayment(ctx, authorization("PAY-2", now.Add(time.Minute))))
+			require.NoError(t, store.CreatePayment(ctx, testPayment("PAY-3")))
+
+			paymentsList, err := store.ListAuthorizationsExpiringBefore(ctx, "payment_authorized", now)
+			assert.NoError(t, err)
+			assert.Equal(t, []models.PaymentDetails{expired}, paymentsList)
+		})
+	}
+}
+
+func TestListCapturesStartedBefore(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	capture := func(id string, startedAt time.Time) models.PaymentDetails {
+		payment := testPayment(id)
+		payment.Status = "payment_capturing"
+		payment.CaptureStartedAt = &startedAt
+		return payment
+	}
+
+	for name, newStore := range storeFactories() {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			ctx := context.Background()
+
+			stuck := capture("PAY-1", now.Add(-time.Minute))
+			require.NoError(t, store.CreatePayment(ctx, stuck))
+			require.NoError(t, store.CreatePayment(ctx, capture("PAY-2", now.Add(time.Minute))))
+			require.NoError(t, store.CreatePayment(ctx, testPayment("PAY-3")))
+
+			paymentsList, err := store.ListCapturesStartedBefore(ctx, "payment_capturing", now)
+			assert.NoError(t, err)
+			assert.Equal(t, []models.PaymentDetails{stuck}, paymentsList)
+
+			// The capture start is saved with the payment's other mutable fields
+			captured := stuck
+			captured.Status = "payment_paid"
+			captured.CaptureStartedAt = nil
+			require.NoError(t, store.UpdatePayment(ctx, captured))
+
+			paymentsList, err = store.ListCapturesStartedBefore(ctx, "payment_capturing", now)
+			assert.NoError(t, err)
+			assert.Empty(t, paymentsList)
+		})
+	}
+}
+
+func TestSQLiteStorePersistsAcrossRestarts(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "payments.db")
+
+	store, err := NewSQLiteStore(ctx, path)
+	require.NoError(t, err)
+	require.NoError(t, store.CreatePayment(ctx, testPayment("PAY-1")))
+	require.NoError(t, store.Close())
+
+	// Reopening must not re-apply migrations or lose data.
+	store, err = NewSQLiteStore(ctx, path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	payment, err := store.GetPayment(ctx, "PAY-1")
+	assert.NoError(t, err)
+	assert.Equal(t, testPayment("PAY-1"), payment)
+}
@@ -0,0 +1,72 @@
+// Package vault encrypts the card details behind payment tokens, so that merchants can charge returning customers
+// without handling their card numbers again.
+package vault
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/envelope"
+)
+
+// ErrDecrypt is returned when an encrypted card cannot be decrypted, because it was encrypted for another token,
+// with a master key that is not in the keyring, or has been tampered with.
+var ErrDecrypt = errors.New("card cannot be decrypted")
+
+// Card is the cardholder data held in the vault. The CVV is never stored.
+type Card struct {
+	Number     string `json:"number"`
+	ExpiryDate string `json:"expiryDate"`
+	FirstName  string `json:"firstName"`
+	LastName   string `json:"lastName"`
+}
+
+// Vault encrypts and decrypts cards with envelope encryption, so that every card has its own data encryption key.
+type Vault struct {
+	keyring *envelope.Keyring
+}
+
+// New returns a vault that wraps the key of every card with a master key from keyring.
+func New(keyring *envelope.Keyring) *Vault {
+	return &Vault{keyring: keyring}
+}
+
+// Seal encrypts a card for the token with the given ID, and returns the ID of the master key it was wrapped with.
+// The ciphertext can only be decrypted for the same token, so encrypted cards cannot be swapped between tokens.
+func (v *Vault) Seal(tokenID string, card Card) (keyID string, ciphertext []byte, err error) {
+	plaintext, err := json.Marshal(card)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return v.keyring.Seal(plaintext, []byte(tokenID))
+}
+
+// Open decrypts a card sealed for the token with the given ID and wrapped with the master key with the given ID.
+// It returns ErrDecrypt if the card cannot be decrypted.
+func (v *Vault) Open(tokenID, keyID string, ciphertext []byte) (Card, error) {
+	plaintext, err := v.keyring.Open(keyID, ciphertext, []byte(tokenID))
+	if err != nil {
+		return Card{}, fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+
+	var card Card
+	if err := json.Unmarshal(plaintext, &card); err != nil {
+		return Card{}, fmt.Errorf("decode card: %w", err)
+	}
+
+	return card, nil
+}
+
+// NewTokenID returns a new, unguessable token ID.
+func NewTokenID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	return "TOK-" + hex.EncodeToString(id), nil
+}
@@ -0,0 +1,48 @@
+package vault
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Lionel-Wilson/payment-gateway/internal/envelope"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testCard = Card{Number: "4111111111111111", ExpiryDate: "12/29", FirstName: "John", LastName: "Doe"}
+
+func TestSealAndOpen(t *testing.T) {
+	keyring, err := envelope.NewKeyring("key-1", map[string][]byte{"key-1": bytes.Repeat([]byte{1}, envelope.KeySize)})
+	require.NoError(t, err)
+	v := New(keyring)
+
+	keyID, ciphertext, err := v.Seal("TOK-1", testCard)
+	require.NoError(t, err)
+	assert.Equal(t, "key-1", keyID)
+	assert.NotContains(t, string(ciphertext), testCard.Number)
+
+	card, err := v.Open("TOK-1", keyID, ciphertext)
+	assert.NoError(t, err)
+	assert.Equal(t, testCard, card)
+
+	_, err = v.Open("TOK-2", keyID, ciphertext)
+	assert.ErrorIs(t, err, ErrDecrypt, "a card sealed for one token cannot be opened for another")
+
+	tampered := append([]byte{}, ciphertext...)
+	tampered[len(tampered)-1] ^= 1
+	_, err = v.Open("TOK-1", keyID, tampered)
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	_, err = v.Open("TOK-1", "key-2", ciphertext)
+	assert.ErrorIs(t, err, ErrDecrypt)
+}
+
+func TestNewTokenID(t *testing.T) {
+	id, err := NewTokenID()
+	assert.NoError(t, err)
+	assert.Regexp(t, `^TOK-[0-9a-f]{32}$`, id)
+
+	other, err := NewTokenID()
+	assert.NoError(t, err)
+	assert.NotEqual(t, id, other)
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// EnvString returns the value of the environment variable named by key, or fallback if it is unset or empty.
+func EnvString(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+// EnvInt returns the integer value of the environment variable named by key, or fallback if it is unset or empty.
+func EnvInt(key string, fallback int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer: %w", key, err)
+	}
+
+	return parsed, nil
+}
+
+// EnvFloat returns the floating point value of the environment variable named by key, or fallback if it is unset or empty.
+func EnvFloat(key string, fallback float64) (float64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number: %w", key, err)
+	}
+
+	return parsed, nil
+}
+
+// EnvDuration returns the duration value, e.g. "1.5s", of the environment variable named by key,
+// or fallback if it is unset or empty.
+func EnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a duration such as 1.5s: %w", key, err)
+	}
+
+	return parsed, nil
+}
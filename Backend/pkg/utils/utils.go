@@ -1,35 +1,12 @@
 package utils
 
 import (
-	"fmt"
-	"math/rand"
 	"reflect"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// SimulateBank simulates a bank's response to a payment request.
-// It returns a unique payment ID, status, status code, and a response summary.
-// The status is randomly chosen between "payment_paid" and "payment_declined".
-func SimulateBank() (string, string, int, string) {
-	statuses := []string{"payment_paid", "payment_declined"}
-	status := statuses[rand.Intn(len(statuses))]
-
-	id := fmt.Sprintf("PAY-%d", time.Now().UnixNano())
-
-	if status == "payment_paid" {
-		statusCode := 10000
-		summary := "Approved"
-		return id, status, statusCode, summary
-	} else {
-		statusCode := 50280
-		summary := "Insufficient funds"
-		return id, status, statusCode, summary
-	}
-}
-
 // MaskCardNumber masks all but the last four digits of a credit card number.
 // It replaces the initial digits with asterisks (*).
 func MaskCardNumber(cardNumber string) string {
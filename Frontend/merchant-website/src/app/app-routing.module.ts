@@ -3,6 +3,7 @@ import { RouterModule, Routes } from '@angular/router';
 import { HomeComponent } from './home/home.component';
 import { RetrievePaymentDetailsComponent } from './retrieve-payment-details/retrieve-payment-details.component';
 import { ViewAllPaymentsComponent } from './view-all-payments/view-all-payments.component';
+import { LoginComponent } from './login/login.component';
 
 const routes: Routes = [
   { path: '', component: HomeComponent },
@@ -15,6 +16,7 @@ const routes: Routes = [
     path: 'view-all-payments',
     component: ViewAllPaymentsComponent,
   },
+  { path: 'login', component: LoginComponent },
 ];
 
 @NgModule({
@@ -20,6 +20,7 @@ import { HttpClientModule } from '@angular/common/http';
 import { CommonModule } from '@angular/common';
 import { FormsModule } from '@angular/forms';
 import { ViewAllPaymentsComponent } from './view-all-payments/view-all-payments.component';
+import { LoginComponent } from './login/login.component';
 
 @NgModule({
   declarations: [
@@ -28,6 +29,7 @@ import { ViewAllPaymentsComponent } from './view-all-payments/view-all-payments.
     RetrievePaymentDetailsComponent,
     HomeComponent,
     ViewAllPaymentsComponent,
+    LoginComponent,
   ],
   imports: [
     BrowserModule,
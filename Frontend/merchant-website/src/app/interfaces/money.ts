@@ -0,0 +1,12 @@
+import { getNumberOfCurrencyDigits } from '@angular/common';
+
+// An amount in a currency's minor units, e.g. { value: 10050, currency: 'GBP' } is £100.50.
+export interface Money {
+  value: number;
+  currency: string;
+}
+
+// Converts an amount in minor units to a decimal amount in major units.
+export function toMajorUnits(amount: Money): number {
+  return amount.value / Math.pow(10, getNumberOfCurrencyDigits(amount.currency));
+}
@@ -1,10 +1,18 @@
+import { Money } from './money';
+
 export interface PaymentDetailsDTO {
   id: string;
   firstName: string;
   lastName: string;
   cardNumber: string;
+  cardBrand: string;
+  cardLast4: string;
+  cardIssuer: string;
+  cardCountry: string;
+  cardFunding: string;
+  cardProduct: string;
   expiryDate: string;
-  amount: number;
+  amount: Money;
   currencyCode: string;
   status: string;
   statusCode: number;
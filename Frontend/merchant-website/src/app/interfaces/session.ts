@@ -0,0 +1,15 @@
+export interface User {
+  id: string;
+  email: string;
+  name: string;
+  role: 'admin' | 'developer' | 'support' | 'finance';
+  createdAt: string;
+  disabledAt?: string;
+}
+
+export interface Session {
+  token?: string;
+  user: User;
+  createdAt: string;
+  expiresAt: string;
+}
@@ -0,0 +1,37 @@
+import { Component } from '@angular/core';
+import { PaymentGatewayService } from '../services/payment-gateway.service';
+import { User } from '../interfaces/session';
+
+@Component({
+  selector: 'app-login',
+  templateUrl: './login.component.html',
+  styleUrl: './login.component.css',
+})
+export class LoginComponent {
+  constructor(private _paymentGatewayService: PaymentGatewayService) {}
+
+  email: string = ''; // Variable to hold the email address of the user
+  password: string = ''; // Variable to hold the password of the user
+  user: User | undefined; // Variable to hold the logged in user
+  errorString: string = '';
+
+  onSubmit(): void {
+    this._paymentGatewayService.login(this.email, this.password).subscribe(
+      (session) => {
+        this.user = session.user;
+        this.password = '';
+        this.errorString = '';
+      },
+      (errorResponse) => {
+        this.errorString = errorResponse.error.message;
+        this.user = undefined;
+      }
+    );
+  }
+
+  onLogout(): void {
+    this._paymentGatewayService.logout().subscribe(() => {
+      this.user = undefined;
+    });
+  }
+}
@@ -1,6 +1,7 @@
 import { Component } from '@angular/core';
 import { PaymentGatewayService } from '../services/payment-gateway.service';
 import { PaymentDetailsDTO } from '../interfaces/payment-details';
+import { toMajorUnits } from '../interfaces/money';
 
 @Component({
   selector: 'app-retrieve-payment-details',
@@ -13,6 +14,7 @@ export class RetrievePaymentDetailsComponent {
   paymentDetailsResponse: PaymentDetailsDTO | undefined; // Variable to hold the payment response
   id: string | null = null; // Variable to hold the payment response
   errorString: string = '';
+  toMajorUnits = toMajorUnits;
 
   onSubmit(): void {
     this._paymentGatewayService.retrievePaymentDetails(this.id).subscribe(
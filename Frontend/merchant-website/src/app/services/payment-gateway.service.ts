@@ -1,23 +1,46 @@
-import { HttpClient } from '@angular/common/http';
+import { HttpClient, HttpHeaders } from '@angular/common/http';
 import { Injectable } from '@angular/core';
+import { tap } from 'rxjs';
 import { PaymentDetails } from '../classes/payment-details';
 import { PaymentDetailsDTO } from '../interfaces/payment-details';
+import { Session } from '../interfaces/session';
 
 @Injectable({
   providedIn: 'root',
 })
 export class PaymentGatewayService {
   _url = 'http://localhost:8080/api/v1/payments';
+  _sessionsUrl = 'http://localhost:8080/api/v1/sessions';
+  // The token of the logged in dashboard user, whose role decides what they can do
+  _sessionToken = '';
 
   constructor(private _http: HttpClient) {}
 
+  private get _headers() {
+    return new HttpHeaders({ Authorization: 'Bearer ' + this._sessionToken });
+  }
+
+  login(email: string, password: string) {
+    return this._http
+      .post<Session>(this._sessionsUrl, { email, password })
+      .pipe(tap((session) => (this._sessionToken = session.token ?? '')));
+  }
+  logout() {
+    return this._http
+      .delete<void>(this._sessionsUrl + '/current', { headers: this._headers })
+      .pipe(tap(() => (this._sessionToken = '')));
+  }
+  currentSession() {
+    return this._http.get<Session>(this._sessionsUrl + '/current', { headers: this._headers });
+  }
+
   processPayment(paymentDetails: PaymentDetails) {
-    return this._http.post<any>(this._url, paymentDetails);
+    return this._http.post<any>(this._url, paymentDetails, { headers: this._headers });
   }
   retrievePaymentDetails(id: string | null) {
-    return this._http.get<any>(this._url + '/' + id);
+    return this._http.get<any>(this._url + '/' + id, { headers: this._headers });
   }
   retrievePayments() {
-    return this._http.get<PaymentDetailsDTO[]>(this._url);
+    return this._http.get<PaymentDetailsDTO[]>(this._url, { headers: this._headers });
   }
 }
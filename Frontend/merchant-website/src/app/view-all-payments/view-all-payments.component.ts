@@ -1,6 +1,7 @@
 import { Component, OnInit } from '@angular/core';
 import { PaymentGatewayService } from '../services/payment-gateway.service';
 import { PaymentDetailsDTO } from '../interfaces/payment-details';
+import { toMajorUnits } from '../interfaces/money';
 
 @Component({
   selector: 'app-view-all-payments',
@@ -10,6 +11,7 @@ import { PaymentDetailsDTO } from '../interfaces/payment-details';
 export class ViewAllPaymentsComponent implements OnInit {
   payments: PaymentDetailsDTO[] = [];
   errorMessage: string = '';
+  toMajorUnits = toMajorUnits;
   constructor(private _paymentGatewayService: PaymentGatewayService) {}
 
   ngOnInit(): void {